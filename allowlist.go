@@ -0,0 +1,105 @@
+package rebelcache
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ipAllowlist: rejects rpcs from remote addresses outside the allowed networks
+type ipAllowlist struct {
+	prefixes []netip.Prefix
+}
+
+// newIPAllowlist: parse CIDRs (or bare IPs), an empty list allows everyone
+func newIPAllowlist(cidrs []string) (*ipAllowlist, error) {
+	l := &ipAllowlist{}
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return nil, fmt.Errorf("rebelcache: invalid allowlist entry %q: %w", cidr, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		l.prefixes = append(l.prefixes, prefix.Masked())
+	}
+	return l, nil
+}
+
+// allowed: whether addr is inside one of the allowed networks
+func (l *ipAllowlist) allowed(addr net.Addr) bool {
+	if len(l.prefixes) == 0 {
+		return true
+	}
+	if addr == nil {
+		return false
+	}
+	return l.allowedRemote(addr.String())
+}
+
+// allowedRemote: whether the "ip:port" remote is inside one of the allowed networks
+func (l *ipAllowlist) allowedRemote(remote string) bool {
+	if len(l.prefixes) == 0 {
+		return true
+	}
+	ap, err := netip.ParseAddrPort(remote)
+	if err != nil {
+		return false
+	}
+	ip := ap.Addr().Unmap()
+	for _, prefix := range l.prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// check: return PermissionDenied if the caller of ctx is not allowed
+func (l *ipAllowlist) check(ctx context.Context) error {
+	p, ok := peer.FromContext(ctx)
+	if !ok || !l.allowed(p.Addr) {
+		var addr net.Addr
+		if ok {
+			addr = p.Addr
+		}
+		return status.Errorf(codes.PermissionDenied, "rebelcache: address %v not allowed", addr)
+	}
+	return nil
+}
+
+// unaryInterceptor: enforce the allowlist on unary rpcs
+func (l *ipAllowlist) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := l.check(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streamInterceptor: enforce the allowlist on streaming rpcs
+func (l *ipAllowlist) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := l.check(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// httpMiddleware: enforce the allowlist on http requests
+func (l *ipAllowlist) httpMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.allowedRemote(r.RemoteAddr) {
+			http.Error(w, fmt.Sprintf("rebelcache: address %s not allowed", r.RemoteAddr), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
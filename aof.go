@@ -0,0 +1,710 @@
+package rebelcache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	"golang.org/x/time/rate"
+)
+
+// FsyncPolicy: when the append-only log is synced to disk
+type FsyncPolicy string
+
+const (
+	FsyncAlways   FsyncPolicy = "always"   // before each write returns, nothing acknowledged is lost
+	FsyncEverySec FsyncPolicy = "everysec" // once a second, a crash loses up to a second of writes
+	FsyncNo       FsyncPolicy = "no"       // when the os flushes, fastest
+)
+
+const (
+	defaultSegmentBytes    = 64 << 20 // size an incremental log is rotated at
+	defaultCompactSegments = 8        // incremental logs accumulated before compacting
+	compactBurst           = 64 << 10 // bytes a rate limited compaction writes at once
+)
+
+// ErrAOFCorrupt: a log has a damaged record before its end, replaying past it would lose writes
+var ErrAOFCorrupt = errors.New("rebelcache: corrupt append-only log")
+
+// AOFOptions: append-only log of the writes to a server's groups, replayed when it starts
+type AOFOptions struct {
+	Dir   string      // directory of the log files
+	Fsync FsyncPolicy // empty means FsyncEverySec
+	// SegmentBytes: size the incremental log is rotated at, 0 means 64MB
+	SegmentBytes int64
+	// CompactSegments: incremental logs accumulated before they are compacted
+	// into a base log of the live entries, 0 means 8
+	CompactSegments int
+	Groups          []string // groups to log, empty means all groups served
+	// CompactInterval: also compact this often if the log grew since its
+	// base, so a slowly written log sheds its expired and overwritten entries
+	// too, 0 compacts only after CompactSegments
+	CompactInterval time.Duration
+	// CompactRate: bytes per second a compaction writes at most, so it leaves
+	// disk bandwidth to the appends, 0 means no limit
+	CompactRate int64
+	// Format: name of the record codec new logs are written with, see
+	// RegisterRecordCodec, empty means "binary". Logs of every registered
+	// codec are replayed whatever the format
+	Format string
+}
+
+// AOFStats: size of the append-only log and what its compactions did
+type AOFStats struct {
+	DiskBytes        int64         // bytes of the log files
+	Compactions      int64         // compactions completed
+	CompactionErrors int64         // compactions that failed
+	ReclaimedBytes   int64         // bytes of the logs compactions dropped, less the bases replacing them
+	LastCompaction   time.Duration // how long the last completed compaction took
+}
+
+// log file layout: aofMagic and the header of its format, see recordFormat,
+// then records of a uvarint length, the big-endian crc32c of the payload and
+// the payload, a Record encoded by the log's codec. Logs of format 1 have no
+// header and their payloads are laid out like those of BinaryRecords. The
+// magic starts with a zero byte, which no record of format 1 does
+const aofMagic = "\x00RCAOF"
+
+// log file names, seq orders them: a base holds the live entries when it
+// was written, the incremental logs from its seq on the writes since
+const (
+	aofBasePattern = "base-%08d.aof"
+	aofIncrPattern = "incr-%08d.aof"
+)
+
+// appendLog: the append-only log of a server, see AOFOptions. The journal of
+// every logged group's cache appends to it, so writes reach the log in the
+// order they were applied
+type appendLog struct {
+	opts       AOFOptions
+	codec      RecordCodec // codec of the records written
+	groups     map[string]*Group
+	mtx        sync.Mutex
+	f          *os.File // active incremental log
+	seq        int      // seq of the active incremental log
+	size       int64    // bytes of the active incremental log
+	base       int      // seq of the newest base, 0 if none
+	dirty      bool     // appended since the last sync
+	failed     bool     // the last append failed, logged once
+	compacting atomic.Bool
+	loops      *supervisor   // the sync and compaction loops
+	compactCh  chan struct{} // signaled when enough logs piled up since the base
+	// compactLimit: pace of the compactions, nil without CompactRate
+	compactLimit *rate.Limiter
+	// closing: canceled by close, ends a compaction waiting on compactLimit
+	closing        context.Context
+	stopCompaction context.CancelFunc
+	compactions    atomic.Int64
+	compactErrors  atomic.Int64
+	reclaimed      atomic.Int64
+	lastCompaction atomic.Int64 // duration of the last completed compaction
+}
+
+// openAppendLog: replay the log in opts.Dir into groups, then start logging
+// their writes to a fresh incremental log
+func openAppendLog(opts AOFOptions, groups map[string]*Group) (*appendLog, error) {
+	if opts.Fsync == "" {
+		opts.Fsync = FsyncEverySec
+	}
+	switch opts.Fsync {
+	case FsyncAlways, FsyncEverySec, FsyncNo:
+	default:
+		return nil, fmt.Errorf("rebelcache: unknown fsync policy %q", opts.Fsync)
+	}
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = defaultSegmentBytes
+	}
+	if opts.CompactSegments <= 0 {
+		opts.CompactSegments = defaultCompactSegments
+	}
+	codec, err := recordCodecNamed(opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	a := &appendLog{opts: opts, codec: codec, groups: groups, compactCh: make(chan struct{}, 1)}
+	a.closing, a.stopCompaction = context.WithCancel(context.Background())
+	if opts.CompactRate > 0 {
+		a.compactLimit = rate.NewLimiter(rate.Limit(opts.CompactRate), int(min(opts.CompactRate, compactBurst)))
+	}
+	n, err := a.replay()
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		log.Printf("rebelcache: replayed %d writes from %s", n, opts.Dir)
+	}
+	if err := a.rotate(); err != nil {
+		return nil, err
+	}
+	for name, g := range groups {
+		g.cache.feed.setJournal(func(ev keyEvent) {
+			ev.group = name
+			a.append(ev)
+		})
+	}
+	a.loops = newSupervisor(a.closing)
+	if opts.Fsync == FsyncEverySec {
+		a.loops.Go("aof sync", RestartOnFailure, a.syncLoop)
+	}
+	a.loops.Go("aof compaction", RestartOnFailure, a.compactLoop)
+	return a, nil
+}
+
+// logFiles: seqs of the base and incremental logs in the directory, ascending
+func (a *appendLog) logFiles() (bases, incrs []int, err error) {
+	entries, err := os.ReadDir(a.opts.Dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range entries {
+		var seq int
+		if _, err := fmt.Sscanf(e.Name(), aofBasePattern, &seq); err == nil && e.Name() == fmt.Sprintf(aofBasePattern, seq) {
+			bases = append(bases, seq)
+		} else if _, err := fmt.Sscanf(e.Name(), aofIncrPattern, &seq); err == nil && e.Name() == fmt.Sprintf(aofIncrPattern, seq) {
+			incrs = append(incrs, seq)
+		}
+	}
+	slices.Sort(bases)
+	slices.Sort(incrs)
+	return bases, incrs, nil
+}
+
+// path: path of the log named by pattern and seq
+func (a *appendLog) path(pattern string, seq int) string {
+	return filepath.Join(a.opts.Dir, fmt.Sprintf(pattern, seq))
+}
+
+// replay: apply the newest base and the incremental logs after it. A damaged
+// tail of the last log, as left by a crash mid-append, is cut off
+func (a *appendLog) replay() (int, error) {
+	bases, incrs, err := a.logFiles()
+	if err != nil {
+		return 0, err
+	}
+	var files []string
+	if len(bases) > 0 {
+		a.base = bases[len(bases)-1]
+		a.seq = a.base
+		files = append(files, a.path(aofBasePattern, a.base))
+	}
+	for _, seq := range incrs {
+		if seq >= a.base {
+			files = append(files, a.path(aofIncrPattern, seq))
+			a.seq = seq
+		}
+	}
+
+	total := 0
+	for i, path := range files {
+		n, good, err := a.replayFile(path)
+		total += n
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, ErrAOFCorrupt) || i < len(files)-1 {
+			return total, err
+		}
+		log.Printf("%v, truncating %s to %d bytes", err, path, good)
+		if err := os.Truncate(path, good); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// replayFile: apply the records of the log at path, good is the offset after
+// the last intact record
+func (a *appendLog) replayFile(path string) (n int, good int64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	codec, good, err := readAOFHeader(r)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %s: %w", ErrAOFCorrupt, filepath.Base(path), err)
+	}
+	for {
+		payload, size, err := readAOFRecord(r)
+		if errors.Is(err, io.EOF) {
+			return n, good, nil
+		}
+		if err != nil {
+			return n, good, fmt.Errorf("%w: %s at offset %d: %w", ErrAOFCorrupt, filepath.Base(path), good, err)
+		}
+		if err := a.apply(codec, payload); err != nil {
+			return n, good, fmt.Errorf("%w: %s at offset %d: %w", ErrAOFCorrupt, filepath.Base(path), good, err)
+		}
+		good += size
+		n++
+	}
+}
+
+// readAOFHeader: read the header of a log, if it has one, returning the codec
+// of its records and the size of the header. Logs of format 1 have none
+func readAOFHeader(r *bufio.Reader) (RecordCodec, int64, error) {
+	if b, err := r.Peek(1); err != nil || b[0] != aofMagic[0] {
+		return BinaryRecords, 0, nil
+	}
+	magic := make([]byte, len(aofMagic)+1)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic[:len(aofMagic)]) != aofMagic {
+		return nil, 0, errors.New("unknown format")
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > maxRecordHeader {
+		return nil, 0, errors.New("malformed header")
+	}
+	header := make([]byte, n)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, 0, errors.New("malformed header")
+	}
+	codec, err := parseHeader(header)
+	if err != nil {
+		return nil, 0, err
+	}
+	return codec, int64(len(magic)) + int64(len(binary.AppendUvarint(nil, n))) + int64(n), nil
+}
+
+// readAOFRecord: read one record, io.EOF at a clean end of the log
+func readAOFRecord(r *bufio.Reader) (payload []byte, size int64, err error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, err
+	}
+	if length > maxSnapshotField {
+		return nil, 0, fmt.Errorf("record length %d", length)
+	}
+	buf := make([]byte, 4+length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	if crc32.Checksum(buf[4:], snapshotTable) != binary.BigEndian.Uint32(buf) {
+		return nil, 0, errors.New("checksum mismatch")
+	}
+	return buf[4:], int64(len(binary.AppendUvarint(nil, length))) + int64(len(buf)), nil
+}
+
+// apply: replay a record of codec on its group, records of groups not logged
+// are skipped, so are those of ops this release doesn't know
+func (a *appendLog) apply(codec RecordCodec, payload []byte) error {
+	var rec Record
+	if err := codec.DecodeRecord(payload, &rec); err != nil {
+		return err
+	}
+	g, ok := a.groups[rec.Group]
+	if !ok {
+		return nil
+	}
+	switch rec.Op {
+	case RecordSet, RecordCounter:
+		// entries without expiration stay so rather than getting the default ttl
+		ttl := NoExpiration
+		if rec.Expiry != 0 {
+			if ttl = time.Until(time.Unix(0, rec.Expiry)); ttl <= 0 {
+				// expired meanwhile, it must not leave an older value behind
+				g.cache.Delete(rec.Key)
+				return nil
+			}
+		}
+		return g.cache.setWithOrigin(rec.Key, rec.value(), ttl, "aof")
+	case RecordDelete:
+		g.cache.Delete(rec.Key)
+	case RecordClear:
+		g.cache.Clear()
+	}
+	return nil
+}
+
+// encodeAOFRecord: the framed record of rec, nil if codec fails to encode it
+func encodeAOFRecord(codec RecordCodec, rec Record) []byte {
+	payload, err := codec.AppendRecord(nil, &rec)
+	if err != nil {
+		log.Printf("rebelcache: append-only log: encode %s record: %v", codec.Name(), err)
+		return nil
+	}
+	framed := binary.AppendUvarint(nil, uint64(len(payload)))
+	framed = binary.BigEndian.AppendUint32(framed, crc32.Checksum(payload, snapshotTable))
+	return append(framed, payload...)
+}
+
+// setRecord: the framed record of setting key of group to value, that of
+// deleting it for a value without a byte form, which must not survive a
+// restart either
+func (a *appendLog) setRecord(group, key string, value store.Value, expireAt time.Time) []byte {
+	var expiry int64
+	if !expireAt.IsZero() {
+		expiry = expireAt.UnixNano()
+	}
+	rec, ok := newRecord(group, key, value, expiry)
+	if !ok {
+		rec = Record{Op: RecordDelete, Group: group, Key: key}
+	}
+	return encodeAOFRecord(a.codec, rec)
+}
+
+// append: log ev, rotating the incremental log once it is full
+func (a *appendLog) append(ev keyEvent) {
+	var rec []byte
+	switch ev.kind {
+	case eventSet:
+		var expireAt time.Time
+		if ev.ttl > 0 {
+			expireAt = time.Now().Add(ev.ttl)
+		}
+		rec = a.setRecord(ev.group, ev.key, ev.value, expireAt)
+	case eventDelete:
+		rec = encodeAOFRecord(a.codec, Record{Op: RecordDelete, Group: ev.group, Key: ev.key})
+	case eventClear:
+		rec = encodeAOFRecord(a.codec, Record{Op: RecordClear, Group: ev.group})
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if a.f == nil {
+		return
+	}
+	_, err := a.f.Write(rec)
+	if err == nil && a.opts.Fsync == FsyncAlways {
+		err = a.f.Sync()
+	}
+	a.report(err)
+	a.size += int64(len(rec))
+	a.dirty = true
+	if a.size >= a.opts.SegmentBytes {
+		a.report(a.rotateLocked())
+	}
+}
+
+// report: log the first of a run of failed appends
+// Note: lock must be held before calling this function
+func (a *appendLog) report(err error) {
+	if err != nil && !a.failed {
+		log.Printf("rebelcache: append-only log: %v", err)
+	}
+	a.failed = err != nil
+}
+
+// rotate: start a new incremental log
+func (a *appendLog) rotate() error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.rotateLocked()
+}
+
+// rotateLocked: start a new incremental log, compacting once enough piled up since the base.
+// Note: lock must be held before calling this function
+func (a *appendLog) rotateLocked() error {
+	f, err := os.OpenFile(a.path(aofIncrPattern, a.seq+1), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	// the header isn't counted in the size of the log
+	info, err := f.Stat()
+	if err == nil && info.Size() == 0 {
+		_, err = f.Write(appendHeader(nil, aofMagic, a.codec))
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if a.f != nil {
+		a.f.Sync()
+		a.f.Close()
+	}
+	a.f, a.seq, a.size, a.dirty = f, a.seq+1, 0, false
+	if a.seq-a.base >= a.opts.CompactSegments && !a.compacting.Load() {
+		select {
+		case a.compactCh <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// compact: write a base of the live entries and drop the logs it replaces.
+// Writes racing with it are in the base and again in the incremental logs
+// after it, replaying them twice ends in the same state
+func (a *appendLog) compact() (err error) {
+	a.mtx.Lock()
+	if a.f == nil {
+		a.mtx.Unlock()
+		return nil
+	}
+	start := time.Now()
+	defer func() {
+		if err != nil {
+			// a compaction cut short by close is no failure
+			if a.closing.Err() == nil {
+				a.compactErrors.Add(1)
+			}
+			return
+		}
+		a.compactions.Add(1)
+		a.lastCompaction.Store(int64(time.Since(start)))
+	}()
+	// writes from here on go to the logs kept after the base
+	if err := a.rotateLocked(); err != nil {
+		a.mtx.Unlock()
+		return err
+	}
+	seq := a.seq
+	a.mtx.Unlock()
+
+	tmp, err := os.CreateTemp(a.opts.Dir, "base-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	var dst io.Writer = tmp
+	if a.compactLimit != nil {
+		dst = &limitedWriter{ctx: a.closing, w: tmp, limit: a.compactLimit}
+	}
+	w := bufio.NewWriter(dst)
+	w.Write(appendHeader(nil, aofMagic, a.codec))
+	for name, g := range a.groups {
+		w.Write(encodeAOFRecord(a.codec, Record{Op: RecordClear, Group: name}))
+		var entries []snapshotEntry
+		g.cache.Range(func(key string, value store.Value, expireAt time.Time) bool {
+			entries = append(entries, snapshotEntry{key: key, value: value, expireAt: expireAt})
+			return true
+		})
+		for _, e := range entries {
+			w.Write(a.setRecord(name, e.key, e.value, e.expireAt))
+		}
+	}
+	err = w.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	var baseBytes int64
+	if info, serr := tmp.Stat(); serr == nil {
+		baseBytes = info.Size()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), a.path(aofBasePattern, seq)); err != nil {
+		return err
+	}
+
+	a.mtx.Lock()
+	a.base = seq
+	a.mtx.Unlock()
+	bases, incrs, err := a.logFiles()
+	if err != nil {
+		return err
+	}
+	dropped := a.remove(aofBasePattern, bases, seq) + a.remove(aofIncrPattern, incrs, seq)
+	a.reclaimed.Add(max(dropped-baseBytes, 0))
+	return nil
+}
+
+// remove: delete the logs of pattern with a seq below seq, returning the bytes freed
+func (a *appendLog) remove(pattern string, seqs []int, below int) int64 {
+	var freed int64
+	for _, seq := range seqs {
+		if seq >= below {
+			continue
+		}
+		path := a.path(pattern, seq)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if os.Remove(path) == nil {
+			freed += info.Size()
+		}
+	}
+	return freed
+}
+
+// limitedWriter: writes to w no faster than limit allows
+type limitedWriter struct {
+	ctx   context.Context
+	w     io.Writer
+	limit *rate.Limiter
+}
+
+// Write: write p in chunks of the limit's burst, waiting for each
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		chunk := min(len(p), l.limit.Burst())
+		if err := l.limit.WaitN(l.ctx, chunk); err != nil {
+			return n, err
+		}
+		m, err := l.w.Write(p[:chunk])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[chunk:]
+	}
+	return n, nil
+}
+
+// compactNow: compact the log unless a compaction is running
+func (a *appendLog) compactNow() error {
+	if !a.compacting.CompareAndSwap(false, true) {
+		return errors.New("rebelcache: append-only log is being compacted")
+	}
+	defer a.compacting.Store(false)
+	return a.compact()
+}
+
+// syncLoop: sync the log once a second if it was appended to
+func (a *appendLog) syncLoop(ctx context.Context) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.mtx.Lock()
+			if a.dirty && a.f != nil {
+				a.report(a.f.Sync())
+				a.dirty = false
+			}
+			a.mtx.Unlock()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// compactLoop: compact once CompactSegments logs piled up since the base,
+// and every CompactInterval if set and the log grew since its base
+func (a *appendLog) compactLoop(ctx context.Context) error {
+	var tick <-chan time.Time
+	if a.opts.CompactInterval > 0 {
+		ticker := time.NewTicker(a.opts.CompactInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+			a.mtx.Lock()
+			grew := a.seq > a.base || a.size > 0
+			a.mtx.Unlock()
+			if !grew {
+				continue
+			}
+		case <-a.compactCh:
+		case <-ctx.Done():
+			return nil
+		}
+		if a.compacting.Load() {
+			// CompactAOF is at it
+			continue
+		}
+		if err := a.compactNow(); err != nil && ctx.Err() == nil {
+			log.Printf("rebelcache: compact append-only log: %v", err)
+		}
+	}
+}
+
+// stats: size of the log files and counters of the compactions
+func (a *appendLog) stats() AOFStats {
+	st := AOFStats{
+		Compactions:      a.compactions.Load(),
+		CompactionErrors: a.compactErrors.Load(),
+		ReclaimedBytes:   a.reclaimed.Load(),
+		LastCompaction:   time.Duration(a.lastCompaction.Load()),
+	}
+	bases, incrs, err := a.logFiles()
+	if err != nil {
+		return st
+	}
+	for _, b := range bases {
+		if info, err := os.Stat(a.path(aofBasePattern, b)); err == nil {
+			st.DiskBytes += info.Size()
+		}
+	}
+	for _, i := range incrs {
+		if info, err := os.Stat(a.path(aofIncrPattern, i)); err == nil {
+			st.DiskBytes += info.Size()
+		}
+	}
+	return st
+}
+
+// close: stop logging, sync and close the log
+func (a *appendLog) close() error {
+	for _, g := range a.groups {
+		g.cache.feed.setJournal(nil)
+	}
+	a.stopCompaction()
+	a.loops.Stop()
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if a.f == nil {
+		return nil
+	}
+	err := a.f.Sync()
+	if cerr := a.f.Close(); err == nil {
+		err = cerr
+	}
+	a.f = nil
+	return err
+}
+
+// logGroups: the groups named in names, or all served groups if names is empty
+func (s *Server) logGroups(names []string) map[string]*Group {
+	groups := make(map[string]*Group)
+	if len(names) == 0 {
+		s.groups.Range(func(k, v any) bool {
+			groups[k.(string)] = v.(*Group)
+			return true
+		})
+		return groups
+	}
+	for _, name := range names {
+		if g, err := s.getGroup(name); err == nil {
+			groups[name] = g
+		} else {
+			log.Printf("rebelcache: append-only log: %v", err)
+		}
+	}
+	return groups
+}
+
+// CompactAOF: compact the append-only log now instead of waiting for CompactSegments
+func (s *Server) CompactAOF() error {
+	aof := s.aof.Load()
+	if aof == nil {
+		return errors.New("rebelcache: append-only log is not enabled")
+	}
+	return aof.compactNow()
+}
+
+// AOFStats: size and compactions of the append-only log, false if it is not enabled
+func (s *Server) AOFStats() (AOFStats, bool) {
+	aof := s.aof.Load()
+	if aof == nil {
+		return AOFStats{}, false
+	}
+	return aof.stats(), true
+}
@@ -0,0 +1,145 @@
+package rebelcache
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// authKey: rpc metadata carrying the caller's token as "Bearer <token>"
+const authKey = "authorization"
+
+// AuthOptions: tokens a node accepts from its callers, clients' apart from
+// the cluster's nodes', so a leaked client token can't pass for a node.
+// Forwarded rpcs, which carry the gets, replication, handoffs, merges and
+// invalidations nodes send one another, need a peer token. Clients send
+// ClientOptions.Token, nodes PickerOptions.PeerToken. Tokens travel as they
+// are, use TLS credentials in GrpcOptions and DialOptions on untrusted networks
+type AuthOptions struct {
+	ClientTokens []string // tokens of clients, of the http api and redis AUTH too
+	PeerTokens   []string // tokens of the cluster's nodes, good for client rpcs too
+}
+
+// authRole: what a token lets its caller do
+type authRole int
+
+const (
+	roleNone   authRole = iota // unknown token, rejected
+	roleClient                 // client rpcs only
+	rolePeer                   // client and forwarded rpcs
+)
+
+// authenticator: checks the tokens of rpcs, nil accepts every rpc
+type authenticator struct {
+	clients, peers [][]byte
+}
+
+// newAuthenticator: create an authenticator, nil if opts is nil
+func newAuthenticator(opts *AuthOptions) *authenticator {
+	if opts == nil {
+		return nil
+	}
+	a := &authenticator{}
+	for _, t := range opts.ClientTokens {
+		a.clients = append(a.clients, []byte(t))
+	}
+	for _, t := range opts.PeerTokens {
+		a.peers = append(a.peers, []byte(t))
+	}
+	return a
+}
+
+// role: the role of token, compared in constant time
+func (a *authenticator) role(token string) authRole {
+	if token == "" {
+		return roleNone
+	}
+	match := func(tokens [][]byte) bool {
+		found := 0
+		for _, t := range tokens {
+			found |= subtle.ConstantTimeCompare(t, []byte(token))
+		}
+		return found == 1
+	}
+	switch {
+	case match(a.peers):
+		return rolePeer
+	case match(a.clients):
+		return roleClient
+	}
+	return roleNone
+}
+
+// check: Unauthenticated for an rpc without a known token, PermissionDenied
+// for a forwarded one without a peer token
+func (a *authenticator) check(ctx context.Context) error {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(authKey); len(v) > 0 {
+			token, _ = strings.CutPrefix(v[0], "Bearer ")
+		}
+	}
+	switch a.role(token) {
+	case roleNone:
+		return status.Error(codes.Unauthenticated, "rebelcache: missing or unknown token")
+	case roleClient:
+		if isForwarded(ctx) {
+			return status.Error(codes.PermissionDenied, "rebelcache: forwarded rpcs need a peer token")
+		}
+	}
+	return nil
+}
+
+// unaryInterceptor: enforce the tokens on unary rpcs
+func (a *authenticator) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := a.check(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streamInterceptor: enforce the tokens on streaming rpcs
+func (a *authenticator) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := a.check(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// httpMiddleware: enforce the tokens, in the Authorization header, on the
+// requests of the http api, probes like /livez need none
+func (a *authenticator) httpMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if a.role(token) == roleNone {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "rebelcache: missing or unknown token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tokenCredentials: grpc.PerRPCCredentials sending a token with every rpc
+type tokenCredentials string
+
+// GetRequestMetadata: implements credentials.PerRPCCredentials
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{authKey: "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity: implements credentials.PerRPCCredentials, false
+// as clients dial without TLS unless their DialOptions add it
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
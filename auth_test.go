@@ -0,0 +1,43 @@
+package rebelcache
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthRoles(t *testing.T) {
+	auth := &AuthOptions{ClientTokens: []string{"client"}, PeerTokens: []string{"peer"}}
+	tests := []struct {
+		name      string
+		peerToken string // the nodes send one another
+		token     string // the client sends
+		forwarded bool   // the client marks its rpcs as a node's
+		code      codes.Code
+	}{
+		{"client token", "peer", "client", false, codes.OK},
+		{"peer token from a client", "peer", "peer", false, codes.OK},
+		{"no token", "peer", "", false, codes.Unauthenticated},
+		{"unknown token", "peer", "other", false, codes.Unauthenticated},
+		{"client token posing as a node", "peer", "client", true, codes.PermissionDenied},
+		{"peer token posing as a node", "peer", "peer", true, codes.OK},
+		{"nodes sending a client token", "client", "client", false, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCluster(t, 2, clusterOptions{auth: auth, peerToken: tt.peerToken})
+			ctx := context.Background()
+			if tt.forwarded {
+				ctx = withForwarded(ctx)
+			}
+			// a conditional set is checked on the owner, whose answer comes back as is
+			key := c.keyOwnedBy(1, "auth")
+			_, err := c.client(0, &ClientOptions{Token: tt.token}).SetNX(ctx, testGroup, key, []byte("v"), 0)
+			if status.Code(err) != tt.code {
+				t.Fatalf("SetNX: %v, want code %v", err, tt.code)
+			}
+		})
+	}
+}
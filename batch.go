@@ -0,0 +1,526 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// batchWorkers: keys of a batch got one by one at once, e.g. loaded on a miss
+const batchWorkers = 16
+
+// BatchError: the keys of a batch call that failed and why, the other keys
+// were served
+type BatchError struct {
+	Keys map[string]error
+}
+
+// Error: the number of keys failed and one of them
+func (e *BatchError) Error() string {
+	key := slices.Min(slices.Collect(maps.Keys(e.Keys)))
+	return fmt.Sprintf("rebelcache: %d keys of the batch failed, %s: %v", len(e.Keys), FormatKey(key), e.Keys[key])
+}
+
+// Unwrap: the errors of the keys
+func (e *BatchError) Unwrap() []error {
+	return slices.Collect(maps.Values(e.Keys))
+}
+
+// batchPeer: implemented by PeerGetters getting many keys in one call, the
+// peers of ClientPicker do
+type batchPeer interface {
+	// mget: the values of keys found on the peer, a *BatchError for the
+	// keys that failed there
+	mget(ctx context.Context, group string, keys []string) (map[string][]byte, error)
+}
+
+// mget: implements batchPeer, under the caller's deadline less reserve
+func (p peerClient) mget(ctx context.Context, group string, keys []string) (map[string][]byte, error) {
+	ctx, cancel, err := hopContext(ctx, p.reserve)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	p.stats.forwards.Add(1)
+	values, err := p.Client.MGet(withForwarded(ctx), group, keys)
+	var batchErr *BatchError
+	if err != nil && !errors.As(err, &batchErr) {
+		p.stats.failures.Add(1)
+	}
+	return values, err
+}
+
+// MGet: get the values of keys, keys missing from the result have no value.
+// Cached keys are served from the local cache, the keys owned by a peer are
+// fetched from it in one call per peer, the others are got as Get does. A
+// *BatchError lists the keys that failed, the others are still returned
+func (g *Group) MGet(ctx context.Context, keys []string) (map[string]store.Value, error) {
+	values := g.cache.MGet(keys)
+	failed := make(map[string]error)
+	var mtx sync.Mutex
+	// keys batched by their owner, the others are got one by one
+	byPeer := make(map[batchPeer][]string)
+	var single []string
+	level, _ := consistencyFrom(ctx)
+	routed := level == ConsistencyOne && !isForwarded(ctx) && !isReplicaRead(ctx)
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if _, ok := values[key]; ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		norm, err := g.cache.opts.KeyPolicy.Apply(key)
+		if err == nil && key == "" {
+			err = fmt.Errorf("%w: empty key", ErrInvalidKey)
+		}
+		if err != nil {
+			failed[key] = err
+			continue
+		}
+		if routed && !g.isHot(key) {
+			if peer, ok := g.pickPeer(norm); ok {
+				if bp, ok := peer.(batchPeer); ok {
+					byPeer[bp] = append(byPeer[bp], key)
+					continue
+				}
+			}
+		}
+		single = append(single, key)
+	}
+
+	var wg sync.WaitGroup
+	for peer, batch := range byPeer {
+		wg.Go(func() {
+			found, err := peer.mget(ctx, g.name, batch)
+			var batchErr *BatchError
+			mtx.Lock()
+			defer mtx.Unlock()
+			if err != nil && !errors.As(err, &batchErr) {
+				// the peer failed as a whole, Get falls back to replicas or a local load
+				single = append(single, batch...)
+				return
+			}
+			for key, b := range found {
+				values[key] = byteViewOf(b)
+			}
+			if batchErr != nil {
+				maps.Copy(failed, batchErr.Keys)
+			}
+		})
+	}
+	wg.Wait()
+
+	work := make(chan string)
+	for range min(batchWorkers, len(single)) {
+		wg.Go(func() {
+			for key := range work {
+				value, err := g.Get(ctx, key)
+				mtx.Lock()
+				switch {
+				case err != nil:
+					failed[key] = err
+				case value != nil:
+					values[key] = value
+				}
+				mtx.Unlock()
+			}
+		})
+	}
+	for _, key := range single {
+		work <- key
+	}
+	close(work)
+	wg.Wait()
+	if len(failed) > 0 {
+		return values, &BatchError{Keys: failed}
+	}
+	return values, nil
+}
+
+// MSet: set entries with the same ttl, ttl <= 0 means the group's default
+// ttl and NoExpiration none. Nothing is written if a key or a value is
+// invalid. Keys derived from them are deleted and the writes copied to the
+// replicas as Set does
+func (g *Group) MSet(ctx context.Context, entries map[string]store.Value, ttl time.Duration) error {
+	if err := g.checkWritable(); err != nil {
+		return err
+	}
+	if _, ok := entries[""]; ok {
+		return fmt.Errorf("%w: empty key", ErrInvalidKey)
+	}
+	for _, value := range entries {
+		if err := checkWrite(ctx, value); err != nil {
+			return err
+		}
+	}
+	if err := g.cache.MSet(entries, ttl); err != nil {
+		return err
+	}
+	var errs []error
+	for key, value := range entries {
+		g.invalidateDependents(ctx, key)
+		errs = append(errs, g.replicateSet(ctx, key, value, ttl))
+	}
+	return errors.Join(errs...)
+}
+
+// MDelete: delete keys, return how many existed. Keys derived from them are
+// deleted and the deletes copied to the replicas as Delete does
+func (g *Group) MDelete(ctx context.Context, keys []string) (int, error) {
+	if err := g.checkWritable(); err != nil {
+		return 0, err
+	}
+	deleted := g.cache.MDelete(keys)
+	var errs []error
+	for _, key := range keys {
+		g.invalidateDependents(ctx, key)
+		errs = append(errs, g.replicateDelete(ctx, key))
+	}
+	return deleted, errors.Join(errs...)
+}
+
+// BatchOptions: limits of the batch rpcs MGet, MSet and MDelete, so one huge
+// batch can't monopolize a node. A batch is served in chunks, each waiting
+// for one of the node's batch workers, so concurrent batches take turns
+// chunk by chunk and point rpcs keep the rest of the node
+type BatchOptions struct {
+	MaxKeys   int // keys of a request, more are rejected with InvalidArgument, 0 means 10000
+	ChunkKeys int // keys of a chunk, 0 means 256
+	Workers   int // chunks served at once by the node, 0 means GOMAXPROCS
+}
+
+// batchLimiter: the limits and workers of BatchOptions
+type batchLimiter struct {
+	opts    BatchOptions
+	workers chan struct{} // a token per chunk being served
+}
+
+// newBatchLimiter: create the limiter of opts, zero fields get their defaults
+func newBatchLimiter(opts BatchOptions) *batchLimiter {
+	if opts.MaxKeys <= 0 {
+		opts.MaxKeys = 10000
+	}
+	if opts.ChunkKeys <= 0 {
+		opts.ChunkKeys = 256
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	return &batchLimiter{opts: opts, workers: make(chan struct{}, opts.Workers)}
+}
+
+// chunks: run fn on the chunks [lo, hi) of a batch of n keys one after the
+// other, each holding a worker. Stops at the first error, InvalidArgument if
+// n is over MaxKeys. Forwarded batches hold no worker, the chunk forwarding
+// them holds one on its node, and nodes waiting on each other's workers
+// would deadlock
+func (b *batchLimiter) chunks(ctx context.Context, n int, fn func(lo, hi int) error) error {
+	if n > b.opts.MaxKeys {
+		return status.Errorf(codes.InvalidArgument, "rebelcache: batch of %d keys exceeds %d", n, b.opts.MaxKeys)
+	}
+	forwarded := isForwarded(ctx)
+	for lo := 0; lo < n; lo += b.opts.ChunkKeys {
+		if !forwarded {
+			select {
+			case b.workers <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		err := fn(lo, min(lo+b.opts.ChunkKeys, n))
+		if !forwarded {
+			<-b.workers
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MGet: get the values of many keys from a group
+func (s *Server) MGet(ctx context.Context, req *pb.MGetRequest) (*pb.MGetResponse, error) {
+	g, err := s.getGroup(req.GetGroup())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	keys := make([]string, len(req.GetKeys()))
+	for i, key := range req.GetKeys() {
+		keys[i] = string(key)
+	}
+	values := make(map[string]store.Value, len(keys))
+	batchErr := &BatchError{Keys: make(map[string]error)}
+	err = s.batches.chunks(ctx, len(keys), func(lo, hi int) error {
+		if req.GetCached() {
+			maps.Copy(values, g.cache.MGet(keys[lo:hi]))
+			return nil
+		}
+		found, err := g.MGet(ctx, keys[lo:hi])
+		var chunkErr *BatchError
+		if err != nil && !errors.As(err, &chunkErr) {
+			return err
+		}
+		maps.Copy(values, found)
+		if chunkErr != nil {
+			maps.Copy(batchErr.Keys, chunkErr.Keys)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &pb.MGetResponse{Values: make([]*pb.KeyValue, 0, len(values))}
+	keyError := func(key string, err error) {
+		st := status.Convert(toStatus(err))
+		resp.Errors = append(resp.Errors, &pb.KeyError{Key: []byte(key), Code: int32(st.Code()), Message: st.Message()})
+	}
+	for key, value := range values {
+		b, err := valueBytes(value)
+		if err == nil {
+			b, err = s.transforms.apply(ctx, g.name, key, b)
+		}
+		if err != nil {
+			keyError(key, err)
+		} else {
+			resp.Values = append(resp.Values, &pb.KeyValue{Key: []byte(key), Value: b})
+		}
+	}
+	for key, err := range batchErr.Keys {
+		keyError(key, err)
+	}
+	return resp, nil
+}
+
+// MSet: set many keys of a group with one ttl. Nothing is written if a key
+// is invalid, the chunks after one that failed aren't written
+func (s *Server) MSet(ctx context.Context, req *pb.MSetRequest) (*pb.MSetResponse, error) {
+	g, err := s.writableGroup(req.GetGroup())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	for _, e := range req.GetEntries() {
+		_, err := g.cache.opts.KeyPolicy.Apply(string(e.GetKey()))
+		if err == nil && len(e.GetKey()) == 0 {
+			err = fmt.Errorf("%w: empty key", ErrInvalidKey)
+		}
+		if err != nil {
+			return nil, toStatus(err)
+		}
+	}
+	err = s.batches.chunks(ctx, len(req.GetEntries()), func(lo, hi int) error {
+		entries := make(map[string]store.Value, hi-lo)
+		for _, e := range req.GetEntries()[lo:hi] {
+			entries[string(e.GetKey())] = byteViewOf(e.GetValue())
+		}
+		return g.MSet(ctx, entries, req.GetTtl().AsDuration())
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.MSetResponse{}, nil
+}
+
+// MDelete: delete many keys of a group
+func (s *Server) MDelete(ctx context.Context, req *pb.MDeleteRequest) (*pb.MDeleteResponse, error) {
+	g, err := s.writableGroup(req.GetGroup())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	keys := make([]string, len(req.GetKeys()))
+	for i, key := range req.GetKeys() {
+		keys[i] = string(key)
+	}
+	var deleted int
+	err = s.batches.chunks(ctx, len(keys), func(lo, hi int) error {
+		n, err := g.MDelete(ctx, keys[lo:hi])
+		deleted += n
+		return err
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.MDeleteResponse{Deleted: int64(deleted)}, nil
+}
+
+// MGet: get the values of keys from a group in one call, keys missing from
+// the result have no value. A *BatchError lists the keys that failed, keys
+// rejected by the KeyPolicy among them, the values of the others are still
+// returned. With a Picker the keys are split by owner and each owner is
+// sent its own in parallel, the keys of an owner that failed are listed
+// with its error
+func (c *Client) MGet(ctx context.Context, group string, keys []string) (map[string][]byte, error) {
+	failed := make(map[string]error)
+	// callers' keys by the normalized key sent for them
+	asked := make(map[string][]string, len(keys))
+	byNode := make(map[*Client][]string)
+	for _, key := range keys {
+		norm, err := c.key(key)
+		if err != nil {
+			failed[key] = err
+			continue
+		}
+		if _, ok := asked[norm]; !ok {
+			node := c
+			if picker := c.opts.Picker; picker != nil {
+				if addr, _, ok := picker.ownerClient(norm); ok {
+					node = c.owner(addr)
+				}
+			}
+			byNode[node] = append(byNode[node], norm)
+		}
+		asked[norm] = append(asked[norm], key)
+	}
+	values := make(map[string][]byte, len(asked))
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	var callErr error
+	for node, batch := range byNode {
+		wg.Go(func() {
+			found, errs, err := node.mget(ctx, group, batch)
+			mtx.Lock()
+			defer mtx.Unlock()
+			if err != nil {
+				if c.opts.Picker == nil {
+					callErr = err
+					return
+				}
+				errs = make(map[string]error, len(batch))
+				for _, norm := range batch {
+					errs[norm] = err
+				}
+			}
+			for norm, value := range found {
+				for _, key := range asked[norm] {
+					values[key] = value
+				}
+			}
+			for norm, err := range errs {
+				for _, key := range asked[norm] {
+					failed[key] = err
+				}
+			}
+		})
+	}
+	wg.Wait()
+	if callErr != nil {
+		return nil, callErr
+	}
+	if len(failed) > 0 {
+		return values, &BatchError{Keys: failed}
+	}
+	return values, nil
+}
+
+// owner: the client of the node at addr owning keys of an MGet, made with
+// the client's options and kept until addr leaves the Picker's ring. The
+// client itself if it can't be made, its node forwards the keys
+func (c *Client) owner(addr string) *Client {
+	c.ownersMtx.Lock()
+	defer c.ownersMtx.Unlock()
+	if changes := c.opts.Picker.changes.Load(); changes != c.ownersAt {
+		c.ownersAt = changes
+		peers := c.opts.Picker.Peers()
+		for addr, owner := range c.owners {
+			if !slices.Contains(peers, addr) {
+				owner.Close()
+				delete(c.owners, addr)
+			}
+		}
+	}
+	if owner, ok := c.owners[addr]; ok {
+		return owner
+	}
+	opts := c.opts
+	opts.Picker = nil
+	owner, err := NewClient(addr, c.svcName, &opts)
+	if err != nil {
+		log.Printf("rebelcache: dial owner %s: %v", addr, err)
+		return c
+	}
+	if c.owners == nil {
+		c.owners = make(map[string]*Client)
+	}
+	c.owners[addr] = owner
+	return owner
+}
+
+// mget: the MGet rpc of normalized keys, the values found and the errors of
+// the keys that failed by key
+func (c *Client) mget(ctx context.Context, group string, keys []string) (map[string][]byte, map[string]error, error) {
+	req := &pb.MGetRequest{Group: group, Keys: make([][]byte, len(keys))}
+	for i, key := range keys {
+		req.Keys[i] = []byte(key)
+	}
+	var resp *pb.MGetResponse
+	err := c.invoke(ctx, "MGet", group, func(ctx context.Context) (err error) {
+		resp, err = c.grpcCli.MGet(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	values := make(map[string][]byte, len(resp.GetValues()))
+	for _, kv := range resp.GetValues() {
+		values[string(kv.GetKey())] = kv.GetValue()
+	}
+	failed := make(map[string]error, len(resp.GetErrors()))
+	for _, e := range resp.GetErrors() {
+		failed[string(e.GetKey())] = status.Error(codes.Code(e.GetCode()), e.GetMessage())
+	}
+	return values, failed, nil
+}
+
+// MSet: set entries in a group with one ttl in one call, ttl <= 0 means the
+// group's default ttl and NoExpiration none. Nothing is sent if the
+// KeyPolicy rejects a key
+func (c *Client) MSet(ctx context.Context, group string, entries map[string][]byte, ttl time.Duration) error {
+	req := &pb.MSetRequest{Group: group, Entries: make([]*pb.KeyValue, 0, len(entries))}
+	for key, value := range entries {
+		norm, err := c.key(key)
+		if err != nil {
+			return err
+		}
+		req.Entries = append(req.Entries, &pb.KeyValue{Key: []byte(norm), Value: value})
+	}
+	if ttl > 0 || ttl == NoExpiration {
+		req.Ttl = durationpb.New(ttl)
+	}
+	return c.invoke(ctx, "MSet", group, func(ctx context.Context) error {
+		_, err := c.grpcCli.MSet(ctx, req)
+		return err
+	})
+}
+
+// MDelete: delete keys from a group in one call, return how many existed.
+// Nothing is sent if the KeyPolicy rejects a key
+func (c *Client) MDelete(ctx context.Context, group string, keys []string) (int, error) {
+	req := &pb.MDeleteRequest{Group: group, Keys: make([][]byte, len(keys))}
+	for i, key := range keys {
+		norm, err := c.key(key)
+		if err != nil {
+			return 0, err
+		}
+		req.Keys[i] = []byte(norm)
+	}
+	var resp *pb.MDeleteResponse
+	err := c.invoke(ctx, "MDelete", group, func(ctx context.Context) (err error) {
+		resp, err = c.grpcCli.MDelete(ctx, req)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.GetDeleted()), nil
+}
@@ -0,0 +1,102 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBatchChunks(t *testing.T) {
+	c := newTestCluster(t, 3, clusterOptions{serverOpts: func(i int, opts *ServerOptions) {
+		opts.Batch = BatchOptions{MaxKeys: 40, ChunkKeys: 3, Workers: 2}
+	}})
+	ctx := context.Background()
+	cli := c.client(0, nil)
+
+	tests := []struct {
+		name string
+		keys int
+		code codes.Code
+	}{
+		{"one chunk", 2, codes.OK},
+		{"last chunk partial", 10, codes.OK},
+		{"at the limit", 40, codes.OK},
+		{"over the limit", 41, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := make(map[string][]byte, tt.keys)
+			for i := range tt.keys {
+				entries[fmt.Sprintf("%s-%d", tt.name, i)] = fmt.Appendf(nil, "value-%d", i)
+			}
+			err := cli.MSet(ctx, testGroup, entries, 0)
+			if status.Code(err) != tt.code {
+				t.Fatalf("MSet: %v, want code %v", err, tt.code)
+			}
+			got, err := cli.MGet(ctx, testGroup, slices.Collect(maps.Keys(entries)))
+			if status.Code(err) != tt.code {
+				t.Fatalf("MGet: %v, want code %v", err, tt.code)
+			}
+			if tt.code == codes.OK && !maps.EqualFunc(got, entries, func(a, b []byte) bool { return string(a) == string(b) }) {
+				t.Fatalf("MGet: %d values, want the %d set", len(got), len(entries))
+			}
+		})
+	}
+}
+
+func TestMGetPickerUsesClientToken(t *testing.T) {
+	c := newTestCluster(t, 3, clusterOptions{
+		auth:      &AuthOptions{ClientTokens: []string{"client"}, PeerTokens: []string{"peer"}},
+		peerToken: "peer",
+	})
+	ctx := context.Background()
+	keys := []string{c.keyOwnedBy(0, "a"), c.keyOwnedBy(1, "b"), c.keyOwnedBy(2, "c")}
+	setter := c.client(0, &ClientOptions{Token: "client"})
+	for _, key := range keys {
+		if err := setter.Set(ctx, testGroup, key, []byte(key), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		token     string // of the client
+		peerToken string // of its picker
+		code      codes.Code
+	}{
+		{"client token, picker without one", "client", "", codes.OK},
+		{"no token, picker with the peer token", "", "peer", codes.Unauthenticated},
+		{"wrong token, picker with the peer token", "wrong", "peer", codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			picker := NewClientPicker("", ServiceName{}, PickerOptions{DialOptions: []grpc.DialOption{c.dial}, PeerToken: tt.peerToken})
+			defer picker.Close()
+			picker.Set(c.nodes[0].addr, c.nodes[1].addr, c.nodes[2].addr)
+			cli := c.client(0, &ClientOptions{Token: tt.token, Picker: picker})
+			got, err := cli.MGet(ctx, testGroup, keys)
+			if tt.code == codes.OK {
+				if err != nil || len(got) != len(keys) {
+					t.Fatalf("MGet: %d values, %v, want %d", len(got), err, len(keys))
+				}
+				return
+			}
+			var batchErr *BatchError
+			if !errors.As(err, &batchErr) || len(batchErr.Keys) != len(keys) {
+				t.Fatalf("MGet: %v, want every key failed", err)
+			}
+			for key, err := range batchErr.Keys {
+				if status.Code(err) != tt.code {
+					t.Fatalf("key %s: %v, want code %v", key, err, tt.code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package rebelcache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ErrBudgetExhausted: the caller's deadline cannot cover the next peer hop or load,
+// it wraps context.DeadlineExceeded so rpcs answer DeadlineExceeded
+var ErrBudgetExhausted = fmt.Errorf("%w: latency budget exhausted", context.DeadlineExceeded)
+
+// defaultHopReserve: part of the caller's budget a forwarded get leaves for its reply
+const defaultHopReserve = 2 * time.Millisecond
+
+// remaining: time left before the deadline of ctx, ok is false when ctx has none
+func remaining(ctx context.Context) (left time.Duration, ok bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
+// checkBudget: ErrBudgetExhausted if the deadline of ctx leaves less than need for what,
+// a ctx without deadline has unlimited budget
+func checkBudget(ctx context.Context, need time.Duration, what string) error {
+	left, ok := remaining(ctx)
+	if !ok || (left > 0 && left >= need) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s needs %v, %v left", ErrBudgetExhausted, what, need, max(left, 0))
+}
+
+// hopContext: ctx for a peer hop, its deadline moved reserve earlier so the
+// peer answers while the caller still waits. grpc sends the peer what is left
+// of the deadline, so each hop spends the time elapsed before it
+func hopContext(ctx context.Context, reserve time.Duration) (context.Context, context.CancelFunc, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return ctx, func() {}, nil
+	}
+	if err := checkBudget(ctx, reserve, "peer hop"); err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithDeadline(ctx, deadline.Add(-reserve))
+	return ctx, cancel, nil
+}
+
+// detachBudget: ctx without its cancellation but with its deadline, for work
+// shared by several callers that must not outlive the one who started it
+func detachBudget(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
+	}
+	return detached, func() {}
+}
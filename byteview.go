@@ -0,0 +1,50 @@
+package rebelcache
+
+import "bytes"
+
+// ByteView: an immutable view of bytes, the value of entries written over
+// rpc, http, the redis protocol, snapshots and the append-only log. Its bytes
+// never change once the view exists, so the cache, the rpc server and peers
+// share them without defensive copies: the bytes are copied once on the way
+// in by NewByteView, and on the way out only to callers asking for a slice
+// they may modify
+type ByteView struct {
+	b []byte
+}
+
+// NewByteView: a view of a copy of b, so later writes to b don't reach the cache
+func NewByteView(b []byte) ByteView {
+	return ByteView{b: bytes.Clone(b)}
+}
+
+// byteViewOf: a view of b itself, for slices nothing else holds, like the
+// decoded fields of a request
+func byteViewOf(b []byte) ByteView {
+	return ByteView{b: b}
+}
+
+// Len: size of the value
+func (v ByteView) Len() int {
+	return len(v.b)
+}
+
+// ByteSlice: a copy of the bytes, the caller may modify it
+func (v ByteView) ByteSlice() []byte {
+	return bytes.Clone(v.b)
+}
+
+// String: the bytes as a string
+func (v ByteView) String() string {
+	return string(v.b)
+}
+
+// Equal: whether v holds the same bytes as other
+func (v ByteView) Equal(other ByteView) bool {
+	return bytes.Equal(v.b, other.b)
+}
+
+// view: the shared bytes, for encoding them without a copy. They must not be
+// modified
+func (v ByteView) view() []byte {
+	return v.b
+}
@@ -1,23 +1,42 @@
 package rebelcache
 
 import (
-	// "context"
+	"context"
+	"errors"
+	"maps"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	"golang.org/x/sync/singleflight"
 )
 
+// ErrCacheClosed: returned when operating on a closed cache
+var ErrCacheClosed = errors.New("rebelcache: cache is closed")
+
 // Cache: encapsulates underlying cache store
 type Cache struct {
 	mtx         sync.RWMutex
-	store       store.Store  // underlying store
-	opts        CacheOptions // cache options
-	hits        int64        // number of cache hits
-	misses      int64        // number of cache misses
-	initialized int32        // whether the cache has been initialized
-	closed      int32        // whether the cache has been closed
+	store       store.Store        // underlying store
+	opts        CacheOptions       // cache options
+	hits        int64              // number of cache hits
+	misses      int64              // number of cache misses
+	initialized int32              // whether the cache has been initialized
+	closed      int32              // whether the cache has been closed
+	loads       singleflight.Group // in-flight loads by key
+	shadow      *shadowArea        // soft-deleted entries, nil if soft delete is off
+	feed        *eventFeed         // writes as seen by watchers, see Server.Watch
+	dedup       *setDedup          // recent sets, nil without SetDedupWindow
+	// compressionSaved: bytes compression saved on the values written
+	compressionSaved atomic.Int64
+	// base: options the cache was created with, see Reconfigure
+	base CacheOptions
+	// top: hottest keys read, nil without CacheOptions.TopKeys
+	top *topKeys
+	// lifetimes: how the entries that left were read, nil without CacheOptions.Lifetimes
+	lifetimes *lifetimes
 }
 
 // CacheOptions: options for cache
@@ -27,8 +46,60 @@ type CacheOptions struct {
 	BucketCnt    uint16                              // number of buckets
 	CapPerBucket uint16                              // capacity of lru2's cache buckets
 	Level2Cap    uint16                              // capacity of lru2's lv2 cache buckets
+	ShardCnt     uint16                              // number of shards of sharded lru
 	CleanupTime  time.Duration                       // cleanup duration
 	OnEvicted    func(key string, value store.Value) // eviction callback
+	DefaultTTL   time.Duration                       // ttl applied when Set carries none, 0 means no expiration, see NoExpiration
+	MinTTL       time.Duration                       // lower bound of ttl, 0 means no bound
+	MaxTTL       time.Duration                       // upper bound of ttl, also caps entries without ttl, 0 means no bound
+	KeyPolicy    *KeyPolicy                          // key validation and normalization, nil accepts keys as is
+	Admission    store.AdmissionPolicy               // admission filter for new keys, nil admits all
+	Provenance   bool                                // record who produced each entry, see GetEntryInfo
+	NodeName     string                              // node recorded in provenance
+	// SoftDeleteWindow: how long deleted entries can be restored with Undelete, 0 deletes for good
+	SoftDeleteWindow time.Duration
+	// SoftDeleteBytes: budget of the soft-deleted entries, separate from MaxBytes,
+	// the oldest ones are dropped first, 0 means a quarter of MaxBytes
+	SoftDeleteBytes int64
+	// MinLoadBudget: time left before the caller's deadline a load needs to start,
+	// callers with less fail fast with ErrBudgetExhausted, 0 only requires some time left
+	MinLoadBudget time.Duration
+	// OnEvictedReason: eviction callback told why the entry left, to write
+	// back only entries evicted for capacity say, called after OnEvicted
+	OnEvictedReason func(key string, value store.Value, reason store.EvictionReason)
+	// SetDedupWindow: a set repeating the value and ttl of the key's last write
+	// within the window is acknowledged without writing it, publishing it to
+	// watchers or journaling it, 0 writes every set. Values without a byte form
+	// are always written
+	SetDedupWindow time.Duration
+	// EvictionQueue: run eviction callbacks on EvictionWorkers workers with
+	// this many queued per worker instead of under the store's lock, in order
+	// for each key, see store.Options.EvictionQueue. 0 calls them under the lock
+	EvictionQueue   int
+	EvictionWorkers int // workers of EvictionQueue, 0 means 1
+	// MemoryPressure: evict entries proactively while the process heap is near
+	// its limit, given or GOMEMLIMIT, nil relies on MaxBytes alone. Only lru
+	// and sharded lru caches honor it
+	MemoryPressure *store.MemoryPressure
+	// HotWrites: send watchers only the latest write of keys written at
+	// extreme rates, once per interval, nil sends every write
+	HotWrites *HotWriteOptions
+	// Codec: encoding of the values of SetObject and GetObject, nil means JSON
+	Codec ValueCodec
+	// Compression: store values above a size threshold compressed, nil
+	// stores every value as it is
+	Compression *CompressionOptions
+	// TopKeys: track the read rates of this many of the hottest keys, up to
+	// 1024, for TopKeys to diagnose skew. 0 disables tracking
+	TopKeys int
+	// Lifetimes: count, for the entries leaving the cache, the gets they
+	// served and the time from their set to their last get, reported by
+	// Stats under "lifetimes", see LifetimeStats. Every entry is wrapped
+	// as with Provenance, some 80 bytes each
+	Lifetimes bool
+	// Merger: combines operands into values, see Merge, nil rejects merges
+	// with ErrNoMerger
+	Merger Merger
 }
 
 // DefaultCacheOptions: return default cache config
@@ -39,6 +110,7 @@ func DefaultCacheOptions() CacheOptions {
 		BucketCnt:    16,
 		CapPerBucket: 512,
 		Level2Cap:    256,
+		ShardCnt:     16,
 		CleanupTime:  time.Minute,
 		OnEvicted:    nil,
 	}
@@ -46,12 +118,27 @@ func DefaultCacheOptions() CacheOptions {
 
 // NewCache: create a new cache example
 func NewCache(opts CacheOptions) *Cache {
-	return &Cache{
-		opts: opts,
+	shadowBytes := opts.SoftDeleteBytes
+	if shadowBytes <= 0 {
+		shadowBytes = opts.MaxBytes / 4
+	}
+	c := &Cache{
+		opts:      opts,
+		base:      opts,
+		top:       newTopKeys(opts.TopKeys),
+		shadow:    newShadowArea(opts.SoftDeleteWindow, shadowBytes),
+		feed:      newEventFeed(),
+		dedup:     newSetDedup(opts.SetDedupWindow),
+		lifetimes: newLifetimes(opts.Lifetimes),
 	}
+	if c.dedup != nil {
+		c.feed.observe = c.dedup.observe
+	}
+	c.feed.hot = newHotWrites(opts.HotWrites, c.feed)
+	return c
 }
 
-// ensureInit
+// ensureInit: lazily create the underlying store on first use
 func (c *Cache) ensureInit() {
 	// rapid check
 	if atomic.LoadInt32(&c.initialized) == 1 {
@@ -61,7 +148,798 @@ func (c *Cache) ensureInit() {
 	// double check
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
-	// if c.initialized == store.Options {
+	if c.initialized == 0 && atomic.LoadInt32(&c.closed) == 0 {
+		c.store = c.newStore()
+		atomic.StoreInt32(&c.initialized, 1)
+	}
+}
+
+// newStore: create a store from the cache's options
+func (c *Cache) newStore() store.Store {
+	return store.NewStore(c.opts.CacheType, store.Options{
+		MaxBytes:        c.opts.MaxBytes,
+		BucketCnt:       c.opts.BucketCnt,
+		CapPerBucket:    c.opts.CapPerBucket,
+		Level2Cap:       c.opts.Level2Cap,
+		ShardCnt:        c.opts.ShardCnt,
+		CleanupInterval: c.opts.CleanupTime,
+		OnEvictedReason: c.onEvicted(),
+		AdmissionPolicy: c.opts.Admission,
+		EvictionQueue:   c.opts.EvictionQueue,
+		EvictionWorkers: c.opts.EvictionWorkers,
+		MemoryPressure:  c.opts.MemoryPressure,
+		OnPanic:         countPanic,
+	})
+}
+
+// Reconfigure: apply cfg over the options the cache was created with, a
+// zero cfg restores them. Ttl bounds apply to later writes. A new eviction
+// policy, or a new size of a store that cannot be resized, moves the
+// entries into a new store, as many as fit, with their versions reset. The
+// move runs unlocked, writes made meanwhile win over the moved entries and
+// keys not moved yet miss
+func (c *Cache) Reconfigure(cfg GroupConfig) {
+	old, moved := c.reconfigure(cfg)
+	if old == nil {
+		return
+	}
+	if r, ok := old.(store.Ranger); ok {
+		now := time.Now()
+		r.Range(func(key string, value store.Value, expireAt time.Time) bool {
+			var ttl time.Duration
+			if !expireAt.IsZero() {
+				if ttl = expireAt.Sub(now); ttl <= 0 {
+					return true
+				}
+			}
+			moved.SetNX(key, value, ttl)
+			return true
+		})
+	}
+	// closed unlocked, see Close
+	old.Close()
+}
+
+// reconfigure: apply cfg under the lock, the store replaced by moved if the
+// entries must move, nil if not
+func (c *Cache) reconfigure(cfg GroupConfig) (old, moved store.Store) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	opts := cfg.apply(c.base)
+	c.opts.DefaultTTL, c.opts.MinTTL, c.opts.MaxTTL = opts.DefaultTTL, opts.MinTTL, opts.MaxTTL
+	resized, retyped := opts.MaxBytes != c.opts.MaxBytes, opts.CacheType != c.opts.CacheType
+	c.opts.MaxBytes, c.opts.CacheType = opts.MaxBytes, opts.CacheType
+	if c.store == nil || !resized && !retyped {
+		return nil, nil
+	}
+	if r, ok := c.store.(interface{ SetMaxBytes(max int64) }); ok && !retyped {
+		r.SetMaxBytes(opts.MaxBytes)
+		return nil, nil
+	}
+	old, c.store = c.store, c.newStore()
+	return old, c.store
+}
+
+// onEvicted: the store's eviction callback, handing out values without provenance
+func (c *Cache) onEvicted() func(key string, value store.Value, reason store.EvictionReason) {
+	onEvicted, onReason := c.opts.OnEvicted, c.opts.OnEvictedReason
+	if onEvicted == nil && onReason == nil && c.lifetimes == nil {
+		return nil
+	}
+	return func(key string, value store.Value, reason store.EvictionReason) {
+		c.lifetimes.end(value)
+		value = unwrapValue(value)
+		if onEvicted != nil {
+			onEvicted(key, value)
+		}
+		if onReason != nil {
+			onReason(key, value, reason)
+		}
+	}
+}
+
+// Get: get value by key, a closed cache or an invalid key always misses
+func (c *Cache) Get(key string) (store.Value, bool) {
+	var value store.Value
+	ok := c.read(key, func(s store.Store, key string) (ok bool) {
+		if c.top != nil {
+			c.top.record(key)
+		}
+		value, ok = s.Get(key)
+		c.lifetimes.read(value)
+		value = unwrapValue(value)
+		return ok
+	})
+	return value, ok
+}
+
+// TopKeys: the n hottest keys read with Get and MGet and their rates, hottest
+// first, measured over the last complete window of 10s. Nil unless
+// CacheOptions.TopKeys is set
+func (c *Cache) TopKeys(n int) []KeyRate {
+	if c.top == nil {
+		return nil
+	}
+	return c.top.hottest(n)
+}
+
+// Loader: load the value of a missing key and its ttl (<= 0 means DefaultTTL)
+type Loader func(ctx context.Context) (store.Value, time.Duration, error)
+
+// GetOrLoad: get value by key, on a miss call loader and store its result;
+// concurrent misses of the same key share one loader call. The shared call
+// is not canceled by any single caller, each caller stops waiting on its own ctx.
+// The loader runs under the deadline of the caller that started it and is not
+// started at all when that deadline leaves less than MinLoadBudget. A set or
+// delete of the key while the loader runs wins over the loaded value
+func (c *Cache) GetOrLoad(ctx context.Context, key string, loader Loader) (store.Value, error) {
+	if value, ok := c.Get(key); ok {
+		return value, nil
+	}
+	key, err := c.opts.KeyPolicy.Apply(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkBudget(ctx, c.opts.MinLoadBudget, "load"); err != nil {
+		return nil, err
+	}
+
+	ch := c.loads.DoChan(key, func() (_ interface{}, err error) {
+		// singleflight rethrows panics where nobody can recover them
+		defer recoverPanic("load", &err)
+		// tracked before the check, so no write can slip in between
+		superseded, done := c.feed.trackLoad(key)
+		defer done()
+		// another load may have finished between our miss and this call, the
+		// miss is counted once
+		if value, ok := c.peek(key); ok {
+			return value, nil
+		}
+		// callers joining the load share it, so leaving the first one does not
+		// cancel it, but it stops at the first one's deadline
+		loadCtx, cancel := detachBudget(ctx)
+		defer cancel()
+		value, ttl, err := loader(loadCtx)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		return c.populate(key, value, ttl, originFromContext(ctx, "loader"), superseded)
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		value, _ := res.Val.(store.Value)
+		return value, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Set: set value by key with no expiration
+func (c *Cache) Set(key string, value store.Value) error {
+	return c.SetWithExpiration(key, value, 0)
+}
+
+// SetWithExpiration: set value by key, expiration <= 0 means DefaultTTL and
+// NoExpiration none, the result is bounded by MinTTL and MaxTTL
+func (c *Cache) SetWithExpiration(key string, value store.Value, expiration time.Duration) error {
+	return c.setWithOrigin(key, value, expiration, "")
+}
+
+// setWithOrigin: SetWithExpiration recording origin in the entry's provenance
+func (c *Cache) setWithOrigin(key string, value store.Value, expiration time.Duration, origin string) error {
+	_, err := c.setUnlessDuplicate(key, value, expiration, origin)
+	return err
+}
+
+// setUnlessDuplicate: like setWithOrigin, written is false when the set
+// repeated the key's last one within SetDedupWindow and was only acknowledged
+func (c *Cache) setUnlessDuplicate(key string, value store.Value, expiration time.Duration, origin string) (written bool, err error) {
+	err = c.write(key, func(s store.Store, key string) (err error) {
+		written, err = c.set(s, key, value, expiration, origin)
+		return err
+	})
+	return written, err
+}
+
+// set: the write of setUnlessDuplicate.
+// Note: must run under write
+func (c *Cache) set(s store.Store, key string, value store.Value, expiration time.Duration, origin string) (written bool, err error) {
+	ttl := c.boundTTL(expiration)
+	if c.dedup != nil && value != nil {
+		// an entry evicted or expired since is written again
+		if _, ok := s.TTL(key); ok && c.dedup.duplicate(key, value, ttl) {
+			return false, nil
+		}
+	}
+	if err := s.SetWithExpiration(key, c.wrapValue(value, origin), ttl); err != nil {
+		return false, err
+	}
+	c.feed.publish(setEvent(key, value, ttl))
+	if c.dedup != nil && value != nil {
+		c.dedup.remember(key, value, ttl)
+	}
+	return true, nil
+}
+
+// populate: store the loaded value of key unless a write of the key was
+// published while it loaded, see eventFeed.trackLoad. That write is newer:
+// its value is returned instead, the loaded one is returned uncached when it
+// was a delete
+func (c *Cache) populate(key string, value store.Value, ttl time.Duration, origin string, superseded *atomic.Bool) (store.Value, error) {
+	err := c.write(key, func(s store.Store, key string) error {
+		if superseded.Load() {
+			if current, ok := s.Get(key); ok {
+				value = unwrapValue(current)
+			}
+			return nil
+		}
+		_, err := c.set(s, key, value, ttl, origin)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// setEvent: the event of setting key to value, setting nil deletes the key
+func setEvent(key string, value store.Value, ttl time.Duration) keyEvent {
+	if value == nil {
+		return keyEvent{kind: eventDelete, key: key}
+	}
+	return keyEvent{kind: eventSet, key: key, value: value, ttl: ttl}
+}
+
+// GetWithVersion: get value and its version by key, the version feeds CompareAndSwap
+func (c *Cache) GetWithVersion(key string) (store.Value, uint64, bool) {
+	var value store.Value
+	var version uint64
+	ok := c.read(key, func(s store.Store, key string) (ok bool) {
+		value, version, ok = s.GetWithVersion(key)
+		c.lifetimes.read(value)
+		value = unwrapValue(value)
+		return ok
+	})
+	return value, version, ok
+}
+
+// SetNX: set value only if key is absent, return whether it was set
+func (c *Cache) SetNX(key string, value store.Value, expiration time.Duration) (bool, error) {
+	var set bool
+	err := c.write(key, func(s store.Store, key string) (err error) {
+		ttl := c.boundTTL(expiration)
+		if set, err = s.SetNX(key, c.wrapValue(value, ""), ttl); set {
+			c.feed.publish(setEvent(key, value, ttl))
+		}
+		return err
+	})
+	return set, err
+}
+
+// SetXX: set value only if key is present, return whether it was set
+func (c *Cache) SetXX(key string, value store.Value, expiration time.Duration) (bool, error) {
+	var set bool
+	err := c.write(key, func(s store.Store, key string) (err error) {
+		ttl := c.boundTTL(expiration)
+		if set, err = s.SetXX(key, c.wrapValue(value, ""), ttl); set {
+			c.feed.publish(setEvent(key, value, ttl))
+		}
+		return err
+	})
+	return set, err
+}
+
+// CompareAndSwap: set value only if the entry's version equals version (0 for absent),
+// return whether it was set
+func (c *Cache) CompareAndSwap(key string, version uint64, value store.Value, expiration time.Duration) (bool, error) {
+	var set bool
+	err := c.write(key, func(s store.Store, key string) (err error) {
+		ttl := c.boundTTL(expiration)
+		if set, err = s.CompareAndSwap(key, version, c.wrapValue(value, ""), ttl); set {
+			c.feed.publish(setEvent(key, value, ttl))
+		}
+		return err
+	})
+	return set, err
+}
+
+// write: run fn on the store with the normalized key, initializing the store if needed.
+// fn runs under the key's stripe lock of the feed and publishes what it wrote
+func (c *Cache) write(key string, fn func(s store.Store, key string) error) error {
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return ErrCacheClosed
+	}
+	key, err := c.opts.KeyPolicy.Apply(key)
+	if err != nil {
+		return err
+	}
+	c.ensureInit()
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.store == nil {
+		return ErrCacheClosed
+	}
+	defer c.feed.lock(key)()
+	before := c.lifetimes.peek(c.store, key)
+	err = fn(c.store, key)
+	c.lifetimes.endOverwritten(c.store, key, before)
+	return err
+}
+
+// read: run fn on the store with the normalized key and count a hit or miss by its result,
+// an invalid key, a closed cache or one nothing has been set in always misses
+func (c *Cache) read(key string, fn func(s store.Store, key string) bool) bool {
+	key, err := c.opts.KeyPolicy.Apply(key)
+	if err != nil || atomic.LoadInt32(&c.closed) == 1 || atomic.LoadInt32(&c.initialized) == 0 {
+		atomic.AddInt64(&c.misses, 1)
+		return false
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.store == nil || !fn(c.store, key) {
+		atomic.AddInt64(&c.misses, 1)
+		return false
+	}
+	atomic.AddInt64(&c.hits, 1)
+	return true
+}
+
+// peek: the value of the normalized key, counted neither as a hit nor a miss
+func (c *Cache) peek(key string) (store.Value, bool) {
+	if atomic.LoadInt32(&c.closed) == 1 || atomic.LoadInt32(&c.initialized) == 0 {
+		return nil, false
+	}
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.store == nil {
+		return nil, false
+	}
+	value, ok := c.store.Get(key)
+	return unwrapValue(value), ok
+}
+
+// boundTTL: apply default ttl and clamp it into [MinTTL, MaxTTL], 0 means
+// no expiration
+func (c *Cache) boundTTL(expiration time.Duration) time.Duration {
+	switch {
+	case expiration == NoExpiration:
+		expiration = 0
+	case expiration <= 0:
+		expiration = c.opts.DefaultTTL
+	}
+	if expiration <= 0 {
+		// no expiration is only allowed without an upper bound
+		if c.opts.MaxTTL > 0 {
+			return c.opts.MaxTTL
+		}
+		return 0
+	}
+	if c.opts.MinTTL > 0 && expiration < c.opts.MinTTL {
+		expiration = c.opts.MinTTL
+	}
+	if c.opts.MaxTTL > 0 && expiration > c.opts.MaxTTL {
+		expiration = c.opts.MaxTTL
+	}
+	return expiration
+}
+
+// Incr: atomically add delta to the counter at key, see store.Counter
+func (c *Cache) Incr(key string, delta int64) (int64, error) {
+	var n int64
+	err := c.write(key, func(s store.Store, key string) (err error) {
+		if n, err = s.Incr(key, delta); err != nil {
+			return err
+		}
+		ttl, _ := s.TTL(key)
+		c.feed.publish(keyEvent{kind: eventSet, key: key, value: store.Counter(n), ttl: ttl})
+		return nil
+	})
+	return n, err
+}
+
+// Decr: atomically subtract delta from the counter at key
+func (c *Cache) Decr(key string, delta int64) (int64, error) {
+	return c.Incr(key, -delta)
+}
+
+// MGet: get the values of keys in one batch, keys that miss or are invalid are absent from the result
+func (c *Cache) MGet(keys []string) map[string]store.Value {
+	values := make(map[string]store.Value, len(keys))
+	// normalized key -> keys as given by the caller
+	given := make(map[string][]string, len(keys))
+	for _, key := range keys {
+		if norm, err := c.opts.KeyPolicy.Apply(key); err == nil {
+			given[norm] = append(given[norm], key)
+		}
+	}
+	if atomic.LoadInt32(&c.closed) == 1 || atomic.LoadInt32(&c.initialized) == 0 {
+		atomic.AddInt64(&c.misses, int64(len(keys)))
+		return values
+	}
+
+	normalized := make([]string, 0, len(given))
+	for norm := range given {
+		normalized = append(normalized, norm)
+		if c.top != nil {
+			c.top.record(norm)
+		}
+	}
+	c.mtx.RLock()
+	var found map[string]store.Value
+	if c.store != nil {
+		found = store.MGet(c.store, normalized)
+	}
+	c.mtx.RUnlock()
+
+	for norm, value := range found {
+		for _, key := range given[norm] {
+			c.lifetimes.read(value)
+			values[key] = unwrapValue(value)
+		}
+	}
+	atomic.AddInt64(&c.hits, int64(len(values)))
+	atomic.AddInt64(&c.misses, int64(len(keys)-len(values)))
+	return values
+}
+
+// MSet: set all entries in one batch with the same expiration,
+// nothing is written if any key is invalid
+func (c *Cache) MSet(entries map[string]store.Value, expiration time.Duration) error {
+	normalized := make(map[string]store.Value, len(entries))
+	for key, value := range entries {
+		norm, err := c.opts.KeyPolicy.Apply(key)
+		if err != nil {
+			return err
+		}
+		normalized[norm] = c.wrapValue(value, "")
+	}
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return ErrCacheClosed
+	}
+	c.ensureInit()
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.store == nil {
+		return ErrCacheClosed
+	}
+	defer c.feed.lockKeys(slices.Collect(maps.Keys(normalized)))()
+	ttl := c.boundTTL(expiration)
+	var before map[string]store.Value
+	if c.lifetimes != nil {
+		before = make(map[string]store.Value, len(normalized))
+		for key := range normalized {
+			before[key] = c.lifetimes.peek(c.store, key)
+		}
+	}
+	err := store.MSet(c.store, normalized, ttl)
+	for key, value := range before {
+		c.lifetimes.endOverwritten(c.store, key, value)
+	}
+	if err != nil {
+		return err
+	}
+	for key, value := range normalized {
+		c.feed.publish(setEvent(key, unwrapValue(value), ttl))
+	}
+	return nil
+}
+
+// MDelete: delete keys in one batch, return the number of keys that existed,
+// soft-deleted like Delete
+func (c *Cache) MDelete(keys []string) int {
+	if atomic.LoadInt32(&c.closed) == 1 || atomic.LoadInt32(&c.initialized) == 0 {
+		return 0
+	}
+	normalized := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if norm, err := c.opts.KeyPolicy.Apply(key); err == nil {
+			normalized = append(normalized, norm)
+		}
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.store == nil {
+		return 0
+	}
+	defer c.feed.lockKeys(normalized)()
+	// watchers are told about every key, deleting an absent key is harmless
+	defer func() {
+		for _, key := range normalized {
+			c.feed.publish(keyEvent{kind: eventDelete, key: key})
+		}
+	}()
+	if c.shadow == nil {
+		return store.MDelete(c.store, normalized)
+	}
+	found := store.MGet(c.store, normalized)
+	n := store.MDelete(c.store, normalized)
+	for _, key := range normalized {
+		if value, ok := found[key]; ok {
+			c.shadow.put(key, value)
+		}
+	}
+	return n
+}
+
+// TTL: remaining time to live of key, 0 if it never expires, ok is false if
+// the key is absent; it does not count as a hit or miss
+func (c *Cache) TTL(key string) (time.Duration, bool) {
+	if atomic.LoadInt32(&c.closed) == 1 || atomic.LoadInt32(&c.initialized) == 0 {
+		return 0, false
+	}
+	key, err := c.opts.KeyPolicy.Apply(key)
+	if err != nil {
+		return 0, false
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.store == nil {
+		return 0, false
+	}
+	return c.store.TTL(key)
+}
+
+// Delete: delete value by key, return whether the key existed;
+// with a SoftDeleteWindow the entry stays restorable with Undelete
+func (c *Cache) Delete(key string) bool {
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return false
+	}
+	key, err := c.opts.KeyPolicy.Apply(key)
+	if err != nil {
+		return false
+	}
+	// deleting an absent key still invalidates what a load in flight read
+	if atomic.LoadInt32(&c.initialized) == 0 {
+		c.feed.supersedeLoads(keyEvent{kind: eventDelete, key: key})
+		return false
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.store == nil {
+		return false
+	}
+	defer c.feed.lock(key)()
+	var value store.Value
+	var ok bool
+	if c.shadow != nil {
+		value, ok = c.store.Get(key)
+	}
+	if !c.store.Delete(key) {
+		c.feed.supersedeLoads(keyEvent{kind: eventDelete, key: key})
+		return false
+	}
+	if ok {
+		c.shadow.put(key, value)
+	}
+	c.feed.publish(keyEvent{kind: eventDelete, key: key})
+	return true
+}
+
+// current: the entry of key as Range hands it out, its version and when it
+// expires, zero if never, without counting as a hit or an access of the key's provenance
+func (c *Cache) current(key string) (value store.Value, version uint64, expireAt time.Time, ok bool) {
+	if atomic.LoadInt32(&c.closed) == 1 || atomic.LoadInt32(&c.initialized) == 0 {
+		return nil, 0, time.Time{}, false
+	}
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.store == nil {
+		return nil, 0, time.Time{}, false
+	}
+	defer c.feed.lock(key)()
+	ttl, ok := c.store.TTL(key)
+	if !ok {
+		return nil, 0, time.Time{}, false
+	}
+	if value, version, ok = c.store.GetWithVersion(key); !ok {
+		return nil, 0, time.Time{}, false
+	}
+	if ttl > 0 {
+		expireAt = time.Now().Add(ttl)
+	}
+	return unwrapValue(value), version, expireAt, true
+}
+
+// evictIfVersion: remove the entry of key if its version is still version,
+// e.g. once handed off to its new owner. Unlike Delete it publishes no
+// event and keeps no soft deleted copy: the key moved, it wasn't deleted
+func (c *Cache) evictIfVersion(key string, version uint64) bool {
+	if atomic.LoadInt32(&c.closed) == 1 || atomic.LoadInt32(&c.initialized) == 0 {
+		return false
+	}
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.store == nil {
+		return false
+	}
+	defer c.feed.lock(key)()
+	if _, v, ok := c.store.GetWithVersion(key); !ok || v != version {
+		return false
+	}
+	return c.store.Delete(key)
+}
+
+// Clear: remove all entries and reset stats, cleared entries cannot be restored
+func (c *Cache) Clear() {
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return
+	}
+	if atomic.LoadInt32(&c.initialized) == 0 {
+		c.feed.supersedeLoads(keyEvent{kind: eventClear})
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.store != nil {
+		c.store.Clear()
+		c.feed.publish(keyEvent{kind: eventClear})
+	}
+	atomic.StoreInt64(&c.hits, 0)
+	atomic.StoreInt64(&c.misses, 0)
+}
+
+// Len: number of entries in the cache
+func (c *Cache) Len() int {
+	if atomic.LoadInt32(&c.closed) == 1 || atomic.LoadInt32(&c.initialized) == 0 {
+		return 0
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.store == nil {
+		return 0
+	}
+	return c.store.Len()
+}
+
+// Range: call fn for each unexpired entry with its expiration time, zero if it
+// never expires, until fn returns false. ok is false if the store cannot be
+// ranged over, see store.Ranger.
+// Note: fn runs under the store's locks and must not call the cache
+func (c *Cache) Range(fn func(key string, value store.Value, expireAt time.Time) bool) (ok bool) {
+	if atomic.LoadInt32(&c.closed) == 1 || atomic.LoadInt32(&c.initialized) == 0 {
+		return true
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.store == nil {
+		return true
+	}
+	r, ok := c.store.(store.Ranger)
+	if !ok {
+		return false
+	}
+	r.Range(func(key string, value store.Value, expireAt time.Time) bool {
+		return fn(key, unwrapValue(value), expireAt)
+	})
+	return true
+}
+
+// Close: close the cache and release the underlying store, later writes return ErrCacheClosed
+func (c *Cache) Close() {
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		return
+	}
+
+	c.mtx.Lock()
+	old := c.store
+	c.store = nil
+	if c.shadow != nil {
+		c.shadow.clear()
+	}
+	if c.feed.hot != nil {
+		c.feed.hot.close()
+	}
+	atomic.StoreInt32(&c.initialized, 0)
+	c.mtx.Unlock()
+	// closed unlocked, it waits for its cleanup, whose eviction callbacks may read the cache
+	if old != nil {
+		old.Close()
+	}
+}
+
+// Stats: return cache statistics
+func (c *Cache) Stats() map[string]interface{} {
+	hits := atomic.LoadInt64(&c.hits)
+	misses := atomic.LoadInt64(&c.misses)
+	stats := map[string]interface{}{
+		"initialized": atomic.LoadInt32(&c.initialized) == 1,
+		"closed":      atomic.LoadInt32(&c.closed) == 1,
+		"hits":        hits,
+		"misses":      misses,
+	}
+	if total := hits + misses; total > 0 {
+		stats["hit_rate"] = float64(hits) / float64(total)
+	} else {
+		stats["hit_rate"] = 0.0
+	}
+	if atomic.LoadInt32(&c.initialized) == 1 {
+		m := c.metrics()
+		stats["size"] = m.entries
+		stats["evicted"] = m.evicted
+		stats["expired"] = m.expired
+		if m.usedBytes >= 0 {
+			stats["used_bytes"] = m.usedBytes
+		}
+		if m.immortalEntries >= 0 {
+			stats["immortal_entries"] = m.immortalEntries
+			stats["immortal_bytes"] = m.immortalBytes
+		}
+	}
+	if c.shadow != nil {
+		stats["soft_deleted"] = c.shadow.len()
+	}
+	if c.dedup != nil {
+		stats["dedup_sets"] = c.dedup.collapsed.Load()
+	}
+	if c.feed.hot != nil {
+		stats["hot_write_keys"] = c.feed.hot.hotKeys()
+		stats["coalesced_events"] = c.feed.hot.coalesced.Load()
+	}
+	if c.opts.Compression != nil {
+		stats["compression_saved_bytes"] = c.compressionSaved.Load()
+	}
+	if c.lifetimes != nil {
+		stats["lifetimes"] = c.lifetimes.stats()
+	}
+	return stats
+}
+
+// cacheMetrics: point-in-time counters of a cache
+type cacheMetrics struct {
+	hits      int64
+	misses    int64
+	evicted   int64 // entries evicted by the store to make room
+	expired   int64 // entries the store dropped once their ttl passed
+	usedBytes int64 // -1 if the store does not account bytes
+	entries   int
+	// immortal entries and their bytes, -1 if the store does not count them
+	immortalEntries int64
+	immortalBytes   int64
+}
+
+// metrics: snapshot the cache's counters, store counters are 0 before first use
+func (c *Cache) metrics() cacheMetrics {
+	m := cacheMetrics{
+		hits:            atomic.LoadInt64(&c.hits),
+		misses:          atomic.LoadInt64(&c.misses),
+		usedBytes:       -1,
+		immortalEntries: -1,
+		immortalBytes:   -1,
+	}
+	if atomic.LoadInt32(&c.closed) == 1 || atomic.LoadInt32(&c.initialized) == 0 {
+		return m
+	}
 
-	// }
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.store == nil {
+		return m
+	}
+	m.entries = c.store.Len()
+	if r, ok := c.store.(store.RemovalCounter); ok {
+		removals := r.Removals()
+		m.evicted, m.expired = removals.Evicted, removals.Expired
+	}
+	if b, ok := c.store.(interface{ UsedBytes() int64 }); ok {
+		m.usedBytes = b.UsedBytes()
+	}
+	if im, ok := c.store.(store.ImmortalCounter); ok {
+		m.immortalEntries, m.immortalBytes = im.Immortal()
+	}
+	return m
 }
@@ -0,0 +1,109 @@
+package rebelcache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+func TestGetOrLoad(t *testing.T) {
+	tests := []struct {
+		name       string
+		preset     bool // key cached before the calls
+		callers    int
+		loads      int64
+		hits, miss int64
+		want       string
+	}{
+		{"hit", true, 1, 0, 1, 0, "cached"},
+		{"miss", false, 1, 1, 0, 1, "loaded"},
+		{"concurrent misses share a load", false, 8, 1, 0, 8, "loaded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCache(DefaultCacheOptions())
+			defer c.Close()
+			if tt.preset {
+				if err := c.Set("k", byteViewOf([]byte("cached"))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var loads atomic.Int64
+			release := make(chan struct{})
+			loader := func(ctx context.Context) (store.Value, time.Duration, error) {
+				loads.Add(1)
+				<-release
+				return byteViewOf([]byte("loaded")), time.Minute, nil
+			}
+			var wg sync.WaitGroup
+			for range tt.callers {
+				wg.Go(func() {
+					value, err := c.GetOrLoad(context.Background(), "k", loader)
+					if err != nil || value.(ByteView).String() != tt.want {
+						t.Errorf("GetOrLoad: %v, %v, want %q", value, err, tt.want)
+					}
+				})
+			}
+			// the callers wait on the first load before it returns
+			eventually(t, "callers waiting", func() bool {
+				return tt.preset || c.Stats()["misses"].(int64) == tt.miss
+			})
+			close(release)
+			wg.Wait()
+			stats := c.Stats()
+			if loads.Load() != tt.loads || stats["hits"] != tt.hits || stats["misses"] != tt.miss {
+				t.Fatalf("loads %d, hits %v, misses %v, want %d, %d, %d",
+					loads.Load(), stats["hits"], stats["misses"], tt.loads, tt.hits, tt.miss)
+			}
+		})
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   GroupConfig
+		keep  int // entries of the 10 set before that are still there
+		check func(t *testing.T, c *Cache)
+	}{
+		{"eviction policy", GroupConfig{CacheType: store.LFU}, 10, nil},
+		{"bounds of ttl", GroupConfig{MaxTTL: time.Minute}, 10, func(t *testing.T, c *Cache) {
+			if err := c.SetWithExpiration("bounded", byteViewOf([]byte("v")), time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			if ttl, ok := c.TTL("bounded"); !ok || ttl > time.Minute {
+				t.Fatalf("ttl %v, want at most a minute", ttl)
+			}
+		}},
+		{"zero config", GroupConfig{}, 10, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCache(DefaultCacheOptions())
+			defer c.Close()
+			for i := range 10 {
+				if err := c.Set(fmt.Sprint(i), byteViewOf([]byte("v"))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c.Reconfigure(tt.cfg)
+			kept := 0
+			for i := range 10 {
+				if _, ok := c.Get(fmt.Sprint(i)); ok {
+					kept++
+				}
+			}
+			if kept != tt.keep {
+				t.Fatalf("%d entries kept, want %d", kept, tt.keep)
+			}
+			if tt.check != nil {
+				tt.check(t, c)
+			}
+		})
+	}
+}
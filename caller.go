@@ -0,0 +1,62 @@
+package rebelcache
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// featureKey: rpc metadata naming the feature of the calling application a
+// request serves, see WithFeature
+const featureKey = "rebelcache-feature"
+
+// featureHeader: http header naming the feature of the calling application
+const featureHeader = "X-Rebelcache-Feature"
+
+// anonymousCaller: caller label of rpcs that announce no caller
+const anonymousCaller = "anonymous"
+
+// callerCtxKey, featureCtxKey: context keys of WithCaller and WithFeature
+type (
+	callerCtxKey  struct{}
+	featureCtxKey struct{}
+)
+
+// WithCaller: attribute the calls made with ctx to caller, e.g. the calling
+// service, instead of the client's CallerID. Servers shape requests and count
+// them per caller, and pass the caller on to the peers they forward to
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerCtxKey{}, caller)
+}
+
+// WithFeature: tag the calls made with ctx with the feature of the caller
+// they serve, e.g. "checkout", servers count them per caller and feature
+func WithFeature(ctx context.Context, feature string) context.Context {
+	return context.WithValue(ctx, featureCtxKey{}, feature)
+}
+
+// CallerFromContext: caller and feature set by WithCaller and WithFeature,
+// else those announced by the client of the rpc served with ctx, empty if none
+func CallerFromContext(ctx context.Context) (caller, feature string) {
+	caller, _ = ctx.Value(callerCtxKey{}).(string)
+	feature, _ = ctx.Value(featureCtxKey{}).(string)
+	if caller != "" && feature != "" {
+		return caller, feature
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if caller == "" {
+		caller = firstOf(md.Get(callerKey))
+	}
+	if feature == "" {
+		feature = firstOf(md.Get(featureKey))
+	}
+	return caller, feature
+}
+
+// firstOf: the first of values, empty if none
+func firstOf(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
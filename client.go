@@ -1,17 +1,540 @@
 package rebelcache
 
 import (
-	// pb "cache/pb"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
 	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
 	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// ErrNotFound: returned by Client.Get when the key has no value
+var ErrNotFound = errors.New("rebelcache: not found")
+
+// CacheClient: the calls on the values of groups, implemented by Client,
+// FailoverClient and the fake of package rebelcachetest, so applications can
+// depend on it and wrap or swap the client
+type CacheClient interface {
+	Get(ctx context.Context, group, key string) ([]byte, error)
+	Set(ctx context.Context, group, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, group, key string) (bool, error)
+	Close() error
+}
+
+var (
+	_ CacheClient = (*Client)(nil)
+	_ CacheClient = (*FailoverClient)(nil)
 )
 
 type Client struct {
 	addr    string
-	svcName string
+	svcName ServiceName
 	etcdCli *clientv3.Client
 	conn    *grpc.ClientConn
-	// grpcCli pb.CacheClient
+	grpcCli pb.CacheClient
 	store   store.Store
-}
\ No newline at end of file
+	opts    ClientOptions
+	server  atomic.Pointer[ProtocolInfo] // protocol of the servers, learned from responses
+	// latencies: recent latencies by peer, nil without adaptive timeouts
+	latencies *peerLatencies
+	// owners: clients of the nodes MGet sends their keys to by addr, dialed
+	// with the client's options, see ClientOptions.Picker
+	ownersMtx sync.Mutex
+	owners    map[string]*Client
+	ownersAt  uint64 // ring updates of the Picker when owners was last pruned
+}
+
+// ClientOptions: options for client
+type ClientOptions struct {
+	Etcd        EtcdOptions       // etcd used to resolve the service's nodes
+	Timeout     time.Duration     // deadline of each attempt, 0 means no deadline beyond ctx
+	MaxAttempts int               // attempts per call including the first, 0 means 3
+	BaseBackoff time.Duration     // wait before the first retry, doubled each retry
+	MaxBackoff  time.Duration     // upper bound of the wait between retries
+	DialOptions []grpc.DialOption // extra options when dialing
+	CallerID    string            // name of the calling application, servers shape requests per caller, see WithCaller
+	// Adaptive: derive deadlines and hedging of gets from the peers' recent
+	// latencies, nil keeps the static Timeout
+	Adaptive *AdaptiveTimeouts
+	// TracerProvider: spans of the client's calls, nil only traces calls made
+	// under a span of the caller, with that span's provider
+	TracerProvider trace.TracerProvider
+	// Codec: encoding of the values of SetObject and GetObject, nil means JSON
+	Codec ValueCodec
+	// Compression: send the values of Set above a size threshold compressed
+	// once the server announced CapCompression, nil sends them as they are.
+	// Nodes of a service must all support compression before it is enabled
+	Compression *CompressionOptions
+	// Consistency: level of Get, Set and Delete on replicated groups, see
+	// Consistency and WithConsistency, which overrides it per call
+	Consistency Consistency
+	// Registry: where the service's nodes are resolved instead of Etcd, e.g.
+	// NewConsulRegistry for nodes with DiscoveryConsul. The client leaves it open
+	Registry Registry
+	// KeyPolicy: keys are normalized and validated with it before any call,
+	// a rejected key fails with ErrInvalidKey without reaching a node. Use
+	// the policy of the servers' groups, nil sends keys as they are
+	KeyPolicy *KeyPolicy
+	// Picker: the ring of the service's nodes, fed by Discover, Watch or Set
+	// like a node's, with an empty self and no PeerToken. Only its ring is
+	// used: MGet sends the keys of each owner straight to it over a
+	// connection made with these options, Token included, nil sends them all
+	// to the client's node, which forwards them. The client leaves it open
+	Picker *ClientPicker
+	// Token: sent with every call for nodes with ServerOptions.Auth, one of
+	// their ClientTokens, empty sends none
+	Token string
+}
+
+// DefaultClientOptions: return default client config
+func DefaultClientOptions() *ClientOptions {
+	return &ClientOptions{
+		Etcd:        DefaultEtcdOptions(),
+		Timeout:     time.Second,
+		MaxAttempts: 3,
+		BaseBackoff: 50 * time.Millisecond,
+		MaxBackoff:  time.Second,
+	}
+}
+
+// NewClient: create a client of the node at addr, or with an empty addr of all
+// nodes of svcName as registered in etcd or the Registry of opts, calls are
+// spread round robin over them.
+// nil opts uses the defaults
+func NewClient(addr string, svcName ServiceName, opts *ClientOptions) (*Client, error) {
+	if opts == nil {
+		opts = DefaultClientOptions()
+	}
+	c := &Client{addr: addr, svcName: svcName, opts: *opts}
+	if c.opts.MaxAttempts <= 0 {
+		c.opts.MaxAttempts = DefaultClientOptions().MaxAttempts
+	}
+
+	target := addr
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(c.announceUnary),
+	}
+	if opts.Token != "" {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(tokenCredentials(opts.Token)))
+	}
+	if opts.Adaptive != nil {
+		c.latencies = newPeerLatencies(*opts.Adaptive, opts.Timeout)
+		dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(c.measureUnary))
+	}
+	if addr == "" {
+		if err := svcName.Validate(); err != nil {
+			return nil, err
+		}
+		registry := func(ServiceName) Registry { return opts.Registry }
+		if opts.Registry == nil {
+			cli, err := newEtcdClient(opts.Etcd)
+			if err != nil {
+				return nil, fmt.Errorf("rebelcache: connect etcd: %w", err)
+			}
+			c.etcdCli = cli
+			registry = func(svc ServiceName) Registry { return NewEtcdRegistry(cli, svc, 0) }
+		}
+		target = svcName.Target()
+		dialOpts = append(dialOpts,
+			grpc.WithResolvers(&discoveryBuilder{registry: registry}),
+			grpc.WithDefaultServiceConfig(`{"loadBalancingConfig":[{"round_robin":{}}]}`))
+	}
+
+	conn, err := grpc.NewClient(target, append(dialOpts, opts.DialOptions...)...)
+	if err != nil {
+		if c.etcdCli != nil {
+			c.etcdCli.Close()
+		}
+		return nil, err
+	}
+	c.conn = conn
+	c.grpcCli = pb.NewCacheClient(conn)
+	return c, nil
+}
+
+// Addr: addr of the node the client talks to, empty if it resolves its service
+func (c *Client) Addr() string {
+	return c.addr
+}
+
+// Get: get value by key from a group, ErrNotFound if the key has no value
+func (c *Client) Get(ctx context.Context, group, key string) ([]byte, error) {
+	key, err := c.key(key)
+	if err != nil {
+		return nil, err
+	}
+	level, err := c.consistency(ctx)
+	if err != nil {
+		return nil, err
+	}
+	value, _, err := c.get(ctx, &pb.GetRequest{Group: group, Key: []byte(key), Consistency: level})
+	return value, err
+}
+
+// key: key normalized and validated by the KeyPolicy of the options
+func (c *Client) key(key string) (string, error) {
+	return c.opts.KeyPolicy.Apply(key)
+}
+
+// consistency: level of a call made with ctx, see ClientOptions.Consistency.
+// Calls between nodes stay at ConsistencyOne, calls above it fail with
+// ErrConsistency against a server known not to support levels
+func (c *Client) consistency(ctx context.Context) (pb.Consistency, error) {
+	level, ok := consistencyFrom(ctx)
+	if !ok {
+		level = c.opts.Consistency
+	}
+	if level == ConsistencyOne || isForwarded(ctx) {
+		return pb.Consistency_CONSISTENCY_ONE, nil
+	}
+	if server, ok := c.ServerProtocol(); ok && !server.Supports(CapConsistency) {
+		return 0, fmt.Errorf("%w: %s doesn't support consistency levels", ErrConsistency, c.addr)
+	}
+	switch level {
+	case ConsistencyQuorum:
+		return pb.Consistency_CONSISTENCY_QUORUM, nil
+	case ConsistencyAll:
+		return pb.Consistency_CONSISTENCY_ALL, nil
+	}
+	return 0, fmt.Errorf("rebelcache: unknown %s", level)
+}
+
+// get: Get as req asks, hot is true if the node flagged the key hot, see HotKeyOptions
+func (c *Client) get(ctx context.Context, req *pb.GetRequest) (value []byte, hot bool, err error) {
+	resp, value, err := c.getResponse(ctx, req)
+	return value, resp.GetHot(), err
+}
+
+// getResponse: the response to the Get req and its value decompressed
+func (c *Client) getResponse(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, []byte, error) {
+	// hedged attempts run at once, the first response is kept
+	var resp atomic.Pointer[pb.GetResponse]
+	err := c.invoke(ctx, "Get", req.GetGroup(), func(ctx context.Context) error {
+		r, err := c.grpcCli.Get(ctx, req)
+		if err == nil {
+			resp.CompareAndSwap(nil, r)
+		}
+		return err
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil, nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	r := resp.Load()
+	value, err := decompress(Compression(r.GetCompression()), r.GetValue(), 0)
+	return r, value, err
+}
+
+// Set: set value by key in a group, ttl <= 0 means the group's default ttl
+// and NoExpiration none
+func (c *Client) Set(ctx context.Context, group, key string, value []byte, ttl time.Duration) error {
+	key, err := c.key(key)
+	if err != nil {
+		return err
+	}
+	level, err := c.consistency(ctx)
+	if err != nil {
+		return err
+	}
+	req := c.setRequest(group, key, value, ttl)
+	req.Consistency = level
+	return c.invoke(ctx, "Set", group, func(ctx context.Context) error {
+		_, err := c.grpcCli.Set(ctx, req)
+		return err
+	})
+}
+
+// SetNX: set value by key in a group only if the key is absent, return
+// whether it was set, see Set
+func (c *Client) SetNX(ctx context.Context, group, key string, value []byte, ttl time.Duration) (bool, error) {
+	key, err := c.key(key)
+	if err != nil {
+		return false, err
+	}
+	req := c.setRequest(group, key, value, ttl)
+	req.IfAbsent = true
+	return c.setIf(ctx, req)
+}
+
+// SetXX: set value by key in a group only if the key is present, see SetNX
+func (c *Client) SetXX(ctx context.Context, group, key string, value []byte, ttl time.Duration) (bool, error) {
+	key, err := c.key(key)
+	if err != nil {
+		return false, err
+	}
+	req := c.setRequest(group, key, value, ttl)
+	req.IfPresent = true
+	return c.setIf(ctx, req)
+}
+
+// CompareAndSwap: set value by key in a group only if the key's entry has
+// version, 0 meaning absent, as returned by GetWithVersion. The version is
+// that of the entry on the key's owner, whichever node serves the call
+func (c *Client) CompareAndSwap(ctx context.Context, group, key string, version uint64, value []byte, ttl time.Duration) (bool, error) {
+	key, err := c.key(key)
+	if err != nil {
+		return false, err
+	}
+	req := c.setRequest(group, key, value, ttl)
+	req.IfVersion = &version
+	return c.setIf(ctx, req)
+}
+
+// setIf: send the conditional set req, return whether it applied. A retry
+// after a failed attempt may find the condition broken by that attempt
+func (c *Client) setIf(ctx context.Context, req *pb.SetRequest) (bool, error) {
+	if server, ok := c.ServerProtocol(); ok && !server.Supports(CapConditionalSet) {
+		return false, fmt.Errorf("rebelcache: %s doesn't support conditional sets", c.addr)
+	}
+	level, err := c.consistency(ctx)
+	if err != nil {
+		return false, err
+	}
+	req.Consistency = level
+	var resp *pb.SetResponse
+	err = c.invoke(ctx, "Set", req.GetGroup(), func(ctx context.Context) (err error) {
+		resp, err = c.grpcCli.Set(ctx, req)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return resp.GetApplied(), nil
+}
+
+// GetWithVersion: get the cached value of key in a group and the version of
+// its entry on the key's owner, for CompareAndSwap. A miss isn't loaded, it
+// is ErrNotFound
+func (c *Client) GetWithVersion(ctx context.Context, group, key string) ([]byte, uint64, error) {
+	if server, ok := c.ServerProtocol(); ok && !server.Supports(CapConditionalSet) {
+		return nil, 0, fmt.Errorf("rebelcache: %s doesn't support entry versions", c.addr)
+	}
+	key, err := c.key(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, value, err := c.getResponse(ctx, &pb.GetRequest{Group: group, Key: []byte(key), Cached: true})
+	return value, resp.GetVersion(), err
+}
+
+// setRequest: the request setting key to value with ttl, compressed if the
+// options and the server allow
+func (c *Client) setRequest(group, key string, value []byte, ttl time.Duration) *pb.SetRequest {
+	req := &pb.SetRequest{Group: group, Key: []byte(key), Value: value}
+	if opts := c.opts.Compression; opts.compressible(value) {
+		if server, ok := c.ServerProtocol(); ok && server.Supports(CapCompression) {
+			if z := compress(opts.Algorithm, value); len(z) < len(value) {
+				req.Value, req.Compression = z, pb.Compression(opts.Algorithm)
+			}
+		}
+	}
+	if ttl > 0 || ttl == NoExpiration {
+		req.Ttl = durationpb.New(ttl)
+	}
+	return req
+}
+
+// Delete: delete value by key from a group, return whether the key existed;
+// after a retry the key may have been deleted by the attempt that failed
+func (c *Client) Delete(ctx context.Context, group, key string) (bool, error) {
+	key, err := c.key(key)
+	if err != nil {
+		return false, err
+	}
+	level, err := c.consistency(ctx)
+	if err != nil {
+		return false, err
+	}
+	var resp *pb.DeleteResponse
+	err = c.invoke(ctx, "Delete", group, func(ctx context.Context) (err error) {
+		resp, err = c.grpcCli.Delete(ctx, &pb.DeleteRequest{Group: group, Key: []byte(key), Consistency: level})
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return resp.GetDeleted(), nil
+}
+
+// Ownership: what the node holds and serves of a group in segments slices of
+// the ring, a power of two up to 256, 0 means 16. Render the reports of every
+// node with RenderOwnership. A client resolving its service asks any one node
+func (c *Client) Ownership(ctx context.Context, group string, segments int) (*OwnershipReport, error) {
+	var resp *pb.OwnershipResponse
+	err := c.invoke(ctx, "Ownership", group, func(ctx context.Context) (err error) {
+		resp, err = c.grpcCli.Ownership(ctx, &pb.OwnershipRequest{Group: group, Segments: int32(segments)})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	report := &OwnershipReport{Group: resp.GetGroup(), Node: resp.GetNode()}
+	for _, seg := range resp.GetSegments() {
+		report.Segments = append(report.Segments, SegmentLoad{
+			Start:     seg.GetStart(),
+			RingShare: seg.GetRingShare(),
+			Keys:      seg.GetKeys(),
+			Bytes:     seg.GetBytes(),
+			QPS:       seg.GetQps(),
+		})
+	}
+	return report, nil
+}
+
+// TopKeys: the n hottest keys read of a group on the node with their rates,
+// hottest first, 0 means 10. A client resolving its service asks any one node
+func (c *Client) TopKeys(ctx context.Context, group string, n int) ([]KeyRate, error) {
+	var resp *pb.TopKeysResponse
+	err := c.invoke(ctx, "TopKeys", group, func(ctx context.Context) (err error) {
+		resp, err = c.grpcCli.TopKeys(ctx, &pb.TopKeysRequest{Group: group, N: int32(n)})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]KeyRate, 0, len(resp.GetKeys()))
+	for _, kr := range resp.GetKeys() {
+		keys = append(keys, KeyRate{Key: string(kr.GetKey()), QPS: kr.GetQps()})
+	}
+	return keys, nil
+}
+
+// ImmortalKeys: up to limit keys of a group's entries without expiration on
+// the node, 0 means 100, with the number of such entries and their bytes
+func (c *Client) ImmortalKeys(ctx context.Context, group string, limit int) (keys []string, entries, bytes int64, err error) {
+	return c.immortalKeys(ctx, &pb.ImmortalKeysRequest{Group: group, Limit: int32(limit)})
+}
+
+// ExpireImmortal: give up to limit of a group's entries without expiration
+// on the node ttl, 0 means 100. Returns the keys given the ttl, with the
+// number of entries without expiration left and their bytes
+func (c *Client) ExpireImmortal(ctx context.Context, group string, ttl time.Duration, limit int) (keys []string, entries, bytes int64, err error) {
+	return c.immortalKeys(ctx, &pb.ImmortalKeysRequest{Group: group, Limit: int32(limit), Ttl: durationpb.New(ttl)})
+}
+
+// immortalKeys: call ImmortalKeys with req
+func (c *Client) immortalKeys(ctx context.Context, req *pb.ImmortalKeysRequest) ([]string, int64, int64, error) {
+	var resp *pb.ImmortalKeysResponse
+	err := c.invoke(ctx, "ImmortalKeys", req.GetGroup(), func(ctx context.Context) (err error) {
+		resp, err = c.grpcCli.ImmortalKeys(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	keys := make([]string, 0, len(resp.GetKeys()))
+	for _, key := range resp.GetKeys() {
+		keys = append(keys, string(key))
+	}
+	return keys, resp.GetEntries(), resp.GetBytes(), nil
+}
+
+// invoke: call fn with a per-attempt deadline, retrying transient failures
+// with exponential backoff until MaxAttempts or ctx is done. The call is traced
+// as one span named after op
+func (c *Client) invoke(ctx context.Context, op, group string, fn func(ctx context.Context) error) (err error) {
+	ctx, span := tracerFor(ctx, c.opts.TracerProvider).Start(ctx, "rebelcache.Client/"+op,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("rebelcache.group", group)))
+	attempt := 1
+	defer func() {
+		span.SetAttributes(attribute.Int("rebelcache.attempts", attempt))
+		endSpan(span, err)
+	}()
+
+	backoff := c.opts.BaseBackoff
+	for ; ; attempt++ {
+		err = c.attempt(ctx, op, fn)
+		if err == nil || attempt >= c.opts.MaxAttempts || !retryable(ctx, err) {
+			return err
+		}
+		// wake a connection that went idle or failed so the retry can reconnect
+		if state := c.conn.GetState(); state == connectivity.Idle || state == connectivity.TransientFailure {
+			c.conn.Connect()
+		}
+
+		wait := backoff
+		if wait > 0 {
+			wait = wait/2 + rand.N(wait/2+1)
+		}
+		// a retry that would start past the deadline only burns the caller's budget
+		if left, ok := remaining(ctx); ok && left <= wait {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-time.After(wait):
+		}
+		if backoff *= 2; c.opts.MaxBackoff > 0 && backoff > c.opts.MaxBackoff {
+			backoff = c.opts.MaxBackoff
+		}
+	}
+}
+
+// attempt: call fn once under the per-attempt deadline, with adaptive timeouts
+// derived from the peers' latencies and gets hedged once they run late
+func (c *Client) attempt(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	timeout := c.opts.Timeout
+	if c.latencies != nil {
+		if op != "Get" && op != "Set" && op != "Delete" {
+			timeout = c.latencies.opts.Ceiling
+		} else if timeout = c.latencies.timeout(); op == "Get" {
+			if delay, ok := c.latencies.hedgeDelay(); ok && delay < timeout {
+				return c.hedge(ctx, timeout, delay, fn)
+			}
+		}
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return fn(ctx)
+}
+
+// retryable: whether err is transient and the caller still waits
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Aborted, codes.ResourceExhausted:
+		return true
+	case codes.DeadlineExceeded:
+		// only the attempt's own deadline passed
+		return true
+	}
+	return false
+}
+
+// Close: close the connection and the etcd client
+func (c *Client) Close() error {
+	err := c.conn.Close()
+	c.ownersMtx.Lock()
+	for _, owner := range c.owners {
+		owner.Close()
+	}
+	c.owners = nil
+	c.ownersMtx.Unlock()
+	if c.etcdCli != nil {
+		c.etcdCli.Close()
+	}
+	return err
+}
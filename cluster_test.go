@@ -0,0 +1,181 @@
+package rebelcache
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testGroup: name of the group every node of a testCluster serves
+const testGroup = "shared"
+
+// clusterOptions: how newTestCluster sets up its nodes, zero values are defaults
+type clusterOptions struct {
+	getter     Getter        // loads the misses of the group, nil loads "v-" + key
+	groupOpts  []GroupOption // options of the group on every node
+	replicas   int           // ServerOptions.ReplicaCount
+	auth       *AuthOptions  // ServerOptions.Auth
+	peerToken  string        // PickerOptions.PeerToken
+	serverOpts func(i int, opts *ServerOptions)
+}
+
+// testNode: a node of a testCluster
+type testNode struct {
+	addr   string
+	server *Server
+	group  *Group
+	picker *ClientPicker
+}
+
+// testCluster: nodes serving testGroup to each other over in-memory
+// connections, stopped when the test ends
+type testCluster struct {
+	t     *testing.T
+	nodes []*testNode
+	dial  grpc.DialOption // connects to the nodes by addr
+}
+
+// newTestCluster: start n nodes with static discovery, node i at 127.0.0.1:i+1
+func newTestCluster(t *testing.T, n int, opts clusterOptions) *testCluster {
+	t.Helper()
+	if opts.getter == nil {
+		opts.getter = GetterFunc(func(ctx context.Context, key string) (store.Value, error) {
+			return byteViewOf([]byte("v-" + key)), nil
+		})
+	}
+	listeners := make(map[string]*bufconn.Listener, n)
+	addrs := make([]string, n)
+	for i := range addrs {
+		addrs[i] = fmt.Sprintf("127.0.0.1:%d", i+1)
+		listeners[addrs[i]] = bufconn.Listen(1 << 20)
+	}
+	c := &testCluster{t: t, dial: grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		lis, ok := listeners[addr]
+		if !ok {
+			return nil, fmt.Errorf("no test node at %s", addr)
+		}
+		return lis.DialContext(ctx)
+	})}
+	for i, addr := range addrs {
+		name := fmt.Sprintf("%s/%d", t.Name(), i)
+		g := NewGroup(name, 1<<20, opts.getter, opts.groupOpts...)
+		groupRegistry.Delete(name)
+		g.name = testGroup
+		picker := NewClientPicker(addr, ServiceName{}, PickerOptions{DialOptions: []grpc.DialOption{c.dial}, PeerToken: opts.peerToken})
+		// Serve sets the same peers, set here so the owners are known once it returns
+		picker.Set(addrs...)
+		serverOpts := &ServerOptions{
+			ServerAddr:    addr,
+			AdvertiseAddr: addr,
+			Discovery:     DiscoveryStatic,
+			Static:        StaticOptions{Peers: addrs},
+			Picker:        picker,
+			ReplicaCount:  opts.replicas,
+			Auth:          opts.auth,
+		}
+		if opts.serverOpts != nil {
+			opts.serverOpts(i, serverOpts)
+		}
+		s, err := NewServer(serverOpts)
+		if err != nil {
+			t.Fatalf("node %s: %v", addr, err)
+		}
+		s.groups = &sync.Map{}
+		s.groups.Store(testGroup, g)
+		g.RegisterPeers(picker)
+		var served sync.WaitGroup
+		served.Add(1)
+		go func() {
+			defer served.Done()
+			if err := s.Serve(listeners[addr]); err != nil {
+				t.Errorf("node %s: %v", addr, err)
+			}
+		}()
+		t.Cleanup(func() {
+			s.Stop()
+			served.Wait()
+			g.Close()
+			picker.Close()
+		})
+		c.nodes = append(c.nodes, &testNode{addr: addr, server: s, group: g, picker: picker})
+	}
+	return c
+}
+
+// client: a client of node i, calls made once, with opts if not nil
+func (c *testCluster) client(i int, opts *ClientOptions) *Client {
+	c.t.Helper()
+	if opts == nil {
+		opts = &ClientOptions{}
+	}
+	opts.MaxAttempts = 1
+	opts.DialOptions = append(opts.DialOptions, c.dial)
+	cli, err := NewClient(c.nodes[i].addr, ServiceName{}, opts)
+	if err != nil {
+		c.t.Fatalf("client of %s: %v", c.nodes[i].addr, err)
+	}
+	c.t.Cleanup(func() { cli.Close() })
+	return cli
+}
+
+// owner: index of the node owning key
+func (c *testCluster) owner(key string) int {
+	addr := c.nodes[0].picker.ring.Get(key)
+	for i, n := range c.nodes {
+		if n.addr == addr {
+			return i
+		}
+	}
+	c.t.Fatalf("no node owns %q", key)
+	return -1
+}
+
+// keyOwnedBy: a key with prefix owned by node i
+func (c *testCluster) keyOwnedBy(i int, prefix string) string {
+	for n := 0; ; n++ {
+		if key := fmt.Sprintf("%s-%d", prefix, n); c.owner(key) == i {
+			return key
+		}
+	}
+}
+
+// replicaSet: indexes of the nodes holding key, its owner first, see
+// clusterOptions.replicas
+func (c *testCluster) replicaSet(key string) []int {
+	var set []int
+	for _, addr := range c.nodes[0].picker.ring.GetN(key, 1+int(c.nodes[0].picker.replicaCount.Load())) {
+		for i, n := range c.nodes {
+			if n.addr == addr {
+				set = append(set, i)
+			}
+		}
+	}
+	return set
+}
+
+// cached: the value node i caches for key, without loading or counting it
+func (c *testCluster) cached(i int, key string) (string, bool) {
+	value, ok := c.nodes[i].group.cache.peek(key)
+	if !ok {
+		return "", false
+	}
+	b, err := valueBytes(unwrapValue(value))
+	return string(b), err == nil
+}
+
+// eventually: fail t unless cond holds within a second
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: timed out", what)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package rebelcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+// ValueCodec: converts arbitrary values to the bytes cached and sent between
+// nodes, and back, see Cache.SetObject and Client.SetObject
+type ValueCodec interface {
+	Marshal(v any) ([]byte, error)
+	// Unmarshal: decode data into v, a pointer
+	Unmarshal(data []byte, v any) error
+}
+
+// JSON: encodes values as json, the default codec
+var JSON ValueCodec = jsonValueCodec{}
+
+// Gob: encodes values with encoding/gob, interface values must be registered with gob
+var Gob ValueCodec = gobValueCodec{}
+
+type jsonValueCodec struct{}
+
+func (jsonValueCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonValueCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type gobValueCodec struct{}
+
+func (gobValueCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobValueCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+var (
+	codecsMtx sync.RWMutex
+	codecs    = map[string]ValueCodec{"json": JSON, "gob": Gob}
+)
+
+// RegisterCodec: make codec available under name, e.g. a protobuf or msgpack
+// codec, so configurations can pick it by name. It panics if codec is nil or
+// name is already registered
+func RegisterCodec(name string, codec ValueCodec) {
+	codecsMtx.Lock()
+	defer codecsMtx.Unlock()
+	if codec == nil {
+		panic("rebelcache: RegisterCodec codec is nil")
+	}
+	if _, dup := codecs[name]; dup {
+		panic(fmt.Sprintf("rebelcache: RegisterCodec called twice for %q", name))
+	}
+	codecs[name] = codec
+}
+
+// CodecByName: the codec registered under name, "json" and "gob" are built in
+func CodecByName(name string) (ValueCodec, bool) {
+	codecsMtx.RLock()
+	defer codecsMtx.RUnlock()
+	codec, ok := codecs[name]
+	return codec, ok
+}
+
+// CodecFor: a Codec of values of type V backed by codec, for TypedGroup
+func CodecFor[V any](codec ValueCodec) Codec[V] {
+	return valueCodecOf[V]{codec: codec}
+}
+
+// valueCodecOf: adapts a ValueCodec to Codec[V]
+type valueCodecOf[V any] struct {
+	codec ValueCodec
+}
+
+func (c valueCodecOf[V]) Encode(value V) ([]byte, error) {
+	return c.codec.Marshal(value)
+}
+
+func (c valueCodecOf[V]) Decode(data []byte) (V, error) {
+	var value V
+	err := c.codec.Unmarshal(data, &value)
+	return value, err
+}
+
+// codecOr: codec, or JSON if nil
+func codecOr(codec ValueCodec) ValueCodec {
+	if codec == nil {
+		return JSON
+	}
+	return codec
+}
+
+// SetObject: encode v with the cache's Codec and set key to it, expiring
+// after ttl, 0 applies the cache's ttl policy like Set
+func (c *Cache) SetObject(key string, v any, ttl time.Duration) error {
+	data, err := codecOr(c.opts.Codec).Marshal(v)
+	if err != nil {
+		return fmt.Errorf("rebelcache: encode %s: %w", FormatKey(key), err)
+	}
+	return c.SetWithExpiration(key, byteViewOf(data), ttl)
+}
+
+// GetObject: decode the value of key into v, a pointer, with the cache's
+// Codec. ok is false if key is absent
+func (c *Cache) GetObject(key string, v any) (ok bool, err error) {
+	value, ok := c.Get(key)
+	if !ok {
+		return false, nil
+	}
+	if err := decodeValue(codecOr(c.opts.Codec), key, value, v); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// decodeValue: decode the bytes of a cached value into v
+func decodeValue(codec ValueCodec, key string, value store.Value, v any) error {
+	data, err := valueBytes(value)
+	if err != nil {
+		return err
+	}
+	if err := codec.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("rebelcache: decode %s: %w", FormatKey(key), err)
+	}
+	return nil
+}
+
+// SetObject: encode v with the client's Codec and set key of group to it, see Set
+func (c *Client) SetObject(ctx context.Context, group, key string, v any, ttl time.Duration) error {
+	data, err := codecOr(c.opts.Codec).Marshal(v)
+	if err != nil {
+		return fmt.Errorf("rebelcache: encode %s: %w", FormatKey(key), err)
+	}
+	return c.Set(ctx, group, key, data, ttl)
+}
+
+// GetObject: decode the value of key of group into v, a pointer, with the
+// client's Codec, see Get
+func (c *Client) GetObject(ctx context.Context, group, key string, v any) error {
+	data, err := c.Get(ctx, group, key)
+	if err != nil {
+		return err
+	}
+	return decodeValue(codecOr(c.opts.Codec), key, byteViewOf(data), v)
+}
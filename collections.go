@@ -0,0 +1,296 @@
+package rebelcache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+// ErrWrongType: the value of a key isn't a set or list as the call expects
+var ErrWrongType = errors.New("rebelcache: value holds the wrong kind of collection")
+
+// ErrReservedValue: a value written or loaded starts as collection values
+// do, only SAdd and LPush write those
+var ErrReservedValue = errors.New("rebelcache: value starts with the reserved prefix of collections")
+
+// collectionMagic: the start of every collection value, then its kind
+const collectionMagic = "\x00rbc"
+
+// kinds of collection values, the byte after collectionMagic
+const (
+	setKind  byte = 0xc5
+	listKind byte = 0xc1
+)
+
+// isCollection: whether b is the value of a collection of any kind
+func isCollection(b []byte) bool {
+	return len(b) > len(collectionMagic) && string(b[:len(collectionMagic)]) == collectionMagic
+}
+
+// checkPlain: ErrReservedValue if value could be taken for a collection,
+// values without a byte representation can't
+func checkPlain(value store.Value) error {
+	b, err := valueBytes(unwrapValue(value))
+	if err == nil && isCollection(b) {
+		return ErrReservedValue
+	}
+	return nil
+}
+
+// checkWrite: checkPlain for a value a client writes, the copies the peers
+// forward of a write were checked where it was made
+func checkWrite(ctx context.Context, value store.Value) error {
+	if isForwarded(ctx) {
+		return nil
+	}
+	return checkPlain(value)
+}
+
+// plainMerger: m for values that aren't collections, it doesn't merge into
+// a collection nor returns one
+func plainMerger(m Merger) Merger {
+	return MergerFunc(func(key string, existing, operand store.Value) (store.Value, error) {
+		if existing != nil {
+			if b, err := valueBytes(existing); err == nil && isCollection(b) {
+				return nil, fmt.Errorf("%w: %s is a collection", ErrWrongType, FormatKey(key))
+			}
+		}
+		merged, err := m.Merge(key, existing, operand)
+		if err == nil {
+			err = checkPlain(merged)
+		}
+		return merged, err
+	})
+}
+
+// encodeElements: the value of a collection of kind, then each element as a
+// uvarint length and its bytes
+func encodeElements(kind byte, elems []string) []byte {
+	size := len(collectionMagic) + 1
+	for _, e := range elems {
+		size += binary.MaxVarintLen64 + len(e)
+	}
+	b := append(append(make([]byte, 0, size), collectionMagic...), kind)
+	for _, e := range elems {
+		b = binary.AppendUvarint(b, uint64(len(e)))
+		b = append(b, e...)
+	}
+	return b
+}
+
+// decodeElements: the elements of a collection value of kind, none for nil
+func decodeElements(kind byte, value store.Value) ([]string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	b, err := valueBytes(value)
+	if err != nil {
+		return nil, err
+	}
+	if !isCollection(b) || b[len(collectionMagic)] != kind {
+		return nil, ErrWrongType
+	}
+	var elems []string
+	for b = b[len(collectionMagic)+1:]; len(b) > 0; {
+		n, size := binary.Uvarint(b)
+		if size <= 0 || uint64(len(b)-size) < n {
+			return nil, fmt.Errorf("%w: truncated element", ErrWrongType)
+		}
+		elems = append(elems, string(b[size:size+int(n)]))
+		b = b[size+int(n):]
+	}
+	return elems, nil
+}
+
+// saddMerger: the Merger adding the members of the operand to a set, kept
+// sorted
+var saddMerger = MergerFunc(func(key string, existing, operand store.Value) (store.Value, error) {
+	members, err := decodeElements(setKind, existing)
+	if err != nil {
+		return nil, err
+	}
+	added, err := decodeElements(setKind, operand)
+	if err != nil {
+		return nil, err
+	}
+	members = slices.Compact(slices.Sorted(slices.Values(append(members, added...))))
+	return ByteView{b: encodeElements(setKind, members)}, nil
+})
+
+// lpushMerger: the Merger pushing the elements of the operand to the head of
+// a list one after the other, keeping maxLen of them, 0 keeps all
+func lpushMerger(maxLen int) Merger {
+	return MergerFunc(func(key string, existing, operand store.Value) (store.Value, error) {
+		elems, err := decodeElements(listKind, existing)
+		if err != nil {
+			return nil, err
+		}
+		pushed, err := decodeElements(listKind, operand)
+		if err != nil {
+			return nil, err
+		}
+		slices.Reverse(pushed)
+		elems = append(pushed, elems...)
+		if maxLen > 0 && len(elems) > maxLen {
+			elems = elems[:maxLen]
+		}
+		return ByteView{b: encodeElements(listKind, elems)}, nil
+	})
+}
+
+// collection: the built-in merge op of operand, elements encoded as their
+// collection's value, into key on the key's owner, see Merge
+func (g *Group) collection(ctx context.Context, key string, op pb.CollectionOp, maxLen int64, operand []byte) (store.Value, error) {
+	req := &pb.MergeRequest{Collection: op, MaxLen: maxLen}
+	switch op {
+	case pb.CollectionOp_COLLECTION_SADD:
+		return g.merge(ctx, key, saddMerger, byteViewOf(operand), 0, req)
+	case pb.CollectionOp_COLLECTION_LPUSH:
+		return g.merge(ctx, key, lpushMerger(int(maxLen)), byteViewOf(operand), 0, req)
+	}
+	return nil, fmt.Errorf("rebelcache: unknown collection op %v", op)
+}
+
+// SAdd: add members to the set at key on the key's owner, return the size of
+// the set. A new set gets the group's default ttl, see Merge
+func (g *Group) SAdd(ctx context.Context, key string, members ...string) (int, error) {
+	value, err := g.collection(ctx, key, pb.CollectionOp_COLLECTION_SADD, 0, encodeElements(setKind, members))
+	if err != nil {
+		return 0, err
+	}
+	members, err = decodeElements(setKind, value)
+	return len(members), err
+}
+
+// SMembers: the members of the set at key in order, none if the key has no
+// value. The set is read from the key's owner, a miss isn't loaded
+func (g *Group) SMembers(ctx context.Context, key string) ([]string, error) {
+	value, _, err := g.GetWithVersion(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return decodeElements(setKind, value)
+}
+
+// LPush: push values to the head of the list at key one after the other on
+// the key's owner, keeping its maxLen newest, 0 keeps all. Return the length
+// of the list. A new list gets the group's default ttl, see Merge
+func (g *Group) LPush(ctx context.Context, key string, maxLen int, values ...string) (int, error) {
+	value, err := g.collection(ctx, key, pb.CollectionOp_COLLECTION_LPUSH, int64(maxLen), encodeElements(listKind, values))
+	if err != nil {
+		return 0, err
+	}
+	values, err = decodeElements(listKind, value)
+	return len(values), err
+}
+
+// LRange: the elements start to stop, both included, of the list at key,
+// negative indexes count from its tail as -1 for the last. None if the key
+// has no value. Read as SMembers is
+func (g *Group) LRange(ctx context.Context, key string, start, stop int) ([]string, error) {
+	value, _, err := g.GetWithVersion(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	elems, err := decodeElements(listKind, value)
+	if err != nil {
+		return nil, err
+	}
+	return listRange(elems, start, stop), nil
+}
+
+// listRange: the elements start to stop of elems, see LRange
+func listRange(elems []string, start, stop int) []string {
+	n := len(elems)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	start, stop = max(start, 0), min(stop, n-1)
+	if start > stop {
+		return nil
+	}
+	return elems[start : stop+1]
+}
+
+// SAdd: add members to the set at key in a group on the node owning the key,
+// return the size of the set. A retry after a failed attempt adds them again,
+// which changes nothing
+func (c *Client) SAdd(ctx context.Context, group, key string, members ...string) (int, error) {
+	value, err := c.collection(ctx, group, key, pb.CollectionOp_COLLECTION_SADD, 0, encodeElements(setKind, members))
+	if err != nil {
+		return 0, err
+	}
+	members, err = decodeElements(setKind, byteViewOf(value))
+	return len(members), err
+}
+
+// SMembers: the members of the set at key in a group in order, none if the
+// key has no value, see Group.SMembers
+func (c *Client) SMembers(ctx context.Context, group, key string) ([]string, error) {
+	value, err := c.getCollection(ctx, group, key)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeElements(setKind, byteViewOf(value))
+}
+
+// LPush: push values to the head of the list at key in a group on the node
+// owning the key, keeping its maxLen newest, 0 keeps all. Return the length
+// of the list. A retry after a failed attempt may push them twice
+func (c *Client) LPush(ctx context.Context, group, key string, maxLen int, values ...string) (int, error) {
+	value, err := c.collection(ctx, group, key, pb.CollectionOp_COLLECTION_LPUSH, int64(maxLen), encodeElements(listKind, values))
+	if err != nil {
+		return 0, err
+	}
+	values, err = decodeElements(listKind, byteViewOf(value))
+	return len(values), err
+}
+
+// LRange: the elements start to stop of the list at key in a group, see Group.LRange
+func (c *Client) LRange(ctx context.Context, group, key string, start, stop int) ([]string, error) {
+	value, err := c.getCollection(ctx, group, key)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	elems, err := decodeElements(listKind, byteViewOf(value))
+	if err != nil {
+		return nil, err
+	}
+	return listRange(elems, start, stop), nil
+}
+
+// collection: send the collection op of operand into key, return the
+// collection's value
+func (c *Client) collection(ctx context.Context, group, key string, op pb.CollectionOp, maxLen int64, operand []byte) ([]byte, error) {
+	key, err := c.key(key)
+	if err != nil {
+		return nil, err
+	}
+	req := c.mergeRequest(group, key, operand, 0)
+	req.Collection, req.MaxLen = op, maxLen
+	return c.mergeOp(ctx, req)
+}
+
+// getCollection: the cached value of a collection at key, a miss isn't loaded
+func (c *Client) getCollection(ctx context.Context, group, key string) ([]byte, error) {
+	key, err := c.key(key)
+	if err != nil {
+		return nil, err
+	}
+	_, value, err := c.getResponse(ctx, &pb.GetRequest{Group: group, Key: []byte(key), Cached: true})
+	return value, err
+}
@@ -0,0 +1,144 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCollectionsAcrossNodes(t *testing.T) {
+	var loads atomic.Int64
+	c := newTestCluster(t, 3, clusterOptions{getter: GetterFunc(func(ctx context.Context, key string) (store.Value, error) {
+		loads.Add(1)
+		return byteViewOf([]byte("loaded")), nil
+	})})
+	ctx := context.Background()
+	key := c.keyOwnedBy(0, "coll")
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, cli *Client) ([]string, error)
+		want []string
+	}{
+		{"members of an absent set", func(t *testing.T, cli *Client) ([]string, error) {
+			return cli.SMembers(ctx, testGroup, key+"-set")
+		}, nil},
+		{"range of an absent list", func(t *testing.T, cli *Client) ([]string, error) {
+			return cli.LRange(ctx, testGroup, key+"-list", 0, -1)
+		}, nil},
+		{"members added through two nodes", func(t *testing.T, cli *Client) ([]string, error) {
+			if _, err := c.client(1, nil).SAdd(ctx, testGroup, key+"-set", "b", "a"); err != nil {
+				return nil, err
+			}
+			if n, err := c.client(2, nil).SAdd(ctx, testGroup, key+"-set", "c", "a"); err != nil || n != 3 {
+				t.Fatalf("SAdd: %d, %v, want 3", n, err)
+			}
+			return cli.SMembers(ctx, testGroup, key+"-set")
+		}, []string{"a", "b", "c"}},
+		{"list pushed through two nodes", func(t *testing.T, cli *Client) ([]string, error) {
+			if _, err := c.client(1, nil).LPush(ctx, testGroup, key+"-list", 3, "a", "b"); err != nil {
+				return nil, err
+			}
+			if n, err := c.client(2, nil).LPush(ctx, testGroup, key+"-list", 3, "c", "d"); err != nil || n != 3 {
+				t.Fatalf("LPush: %d, %v, want 3", n, err)
+			}
+			return cli.LRange(ctx, testGroup, key+"-list", 0, -1)
+		}, []string{"d", "c", "b"}},
+		{"tail of the list", func(t *testing.T, cli *Client) ([]string, error) {
+			return cli.LRange(ctx, testGroup, key+"-list", -2, -1)
+		}, []string{"c", "b"}},
+		{"members through the group of a non-owner", func(t *testing.T, cli *Client) ([]string, error) {
+			return c.nodes[2].group.SMembers(ctx, key+"-set")
+		}, []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.run(t, c.client(1, nil))
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Fatalf("got %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+	if n := loads.Load(); n != 0 {
+		t.Fatalf("collection reads loaded %d keys, want none", n)
+	}
+}
+
+func TestCollectionsRejectPlainValues(t *testing.T) {
+	c := newTestCluster(t, 2, clusterOptions{getter: GetterFunc(func(ctx context.Context, key string) (store.Value, error) {
+		return byteViewOf(encodeElements(setKind, []string{"forged"})), nil
+	})})
+	ctx := context.Background()
+	cli := c.client(1, nil)
+	forged := encodeElements(setKind, []string{"forged"})
+	if err := cli.Set(ctx, testGroup, "plain", []byte("plain"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.SAdd(ctx, testGroup, "set", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		run  func() error
+		code codes.Code // of the error, OK for ErrWrongType decoding the value read
+	}{
+		{"set of a forged collection", func() error {
+			return cli.Set(ctx, testGroup, "forged", forged, 0)
+		}, codes.InvalidArgument},
+		{"SetNX of a forged collection", func() error {
+			_, err := cli.SetNX(ctx, testGroup, "forged", forged, 0)
+			return err
+		}, codes.InvalidArgument},
+		{"MSet of a forged collection", func() error {
+			return cli.MSet(ctx, testGroup, map[string][]byte{"ok": []byte("ok"), "forged": forged}, 0)
+		}, codes.InvalidArgument},
+		{"load of a forged collection", func() error {
+			_, err := cli.Get(ctx, testGroup, "loaded")
+			return err
+		}, codes.InvalidArgument},
+		{"members of a plain value", func() error {
+			_, err := cli.SMembers(ctx, testGroup, "plain")
+			return err
+		}, codes.OK},
+		{"range of a set", func() error {
+			_, err := cli.LRange(ctx, testGroup, "set", 0, -1)
+			return err
+		}, codes.OK},
+		{"patch of a set", func() error {
+			_, err := cli.Patch(ctx, testGroup, "set", -1, []byte("x"), 0)
+			return err
+		}, codes.FailedPrecondition},
+		{"patch into a forged collection", func() error {
+			_, err := cli.Patch(ctx, testGroup, "plain", 0, forged, 0)
+			return err
+		}, codes.InvalidArgument},
+		{"SAdd to a plain value", func() error {
+			_, err := cli.SAdd(ctx, testGroup, "plain", "a")
+			return err
+		}, codes.FailedPrecondition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run()
+			if tt.code == codes.OK {
+				if !errors.Is(err, ErrWrongType) {
+					t.Fatalf("got %v, want ErrWrongType", err)
+				}
+				return
+			}
+			if status.Code(err) != tt.code {
+				t.Fatalf("got %v, want code %v", err, tt.code)
+			}
+		})
+	}
+	if got, _ := cli.SMembers(ctx, testGroup, "set"); !slices.Equal(got, []string{"a"}) {
+		t.Fatalf("set holds %q after the rejected writes, want [a]", got)
+	}
+}
@@ -0,0 +1,189 @@
+package rebelcache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	"github.com/klauspost/compress/s2"
+)
+
+// Compression: algorithm large values are compressed with, see CompressionOptions
+type Compression uint8
+
+const (
+	NoCompression Compression = iota
+	Snappy                    // fast, the ratio of text and html values is around 2
+	Gzip                      // several times slower than Snappy, for a better ratio
+)
+
+// String: name of the algorithm
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case Snappy:
+		return "snappy"
+	case Gzip:
+		return "gzip"
+	}
+	return fmt.Sprintf("Compression(%d)", uint8(c))
+}
+
+// DefaultCompressionThreshold: size from which values are compressed when
+// CompressionOptions.Threshold is 0, smaller ones rarely shrink enough to pay
+// for the work
+const DefaultCompressionThreshold = 1024
+
+// maxInflatedValue: size a compressed value received over rpc may inflate to,
+// so a small request cannot fill the node's memory
+const maxInflatedValue = 64 << 20
+
+// CompressionOptions: transparent compression of large values. Values of at
+// least Threshold bytes are stored compressed and, between nodes and clients
+// announcing CapCompression, sent compressed, every entry is flagged with the
+// algorithm it is stored with so smaller values and values that don't shrink
+// are kept as they are. Readers always get the original bytes
+type CompressionOptions struct {
+	Algorithm Compression // Snappy or Gzip, NoCompression disables compression
+	Threshold int         // values of at least this many bytes are compressed, 0 means DefaultCompressionThreshold
+}
+
+// threshold: the effective Threshold
+func (o CompressionOptions) threshold() int {
+	if o.Threshold <= 0 {
+		return DefaultCompressionThreshold
+	}
+	return o.Threshold
+}
+
+// compressible: whether b is worth compressing under o, o may be nil
+func (o *CompressionOptions) compressible(b []byte) bool {
+	return o != nil && o.Algorithm != NoCompression && len(b) >= o.threshold()
+}
+
+// compressedValue: a value stored compressed, its Len is the compressed size
+// so the cache accounts the memory it really takes
+type compressedValue struct {
+	b    []byte      // compressed bytes, never modified
+	algo Compression // algorithm of b
+	size int         // size of the original value
+}
+
+// Len: implements store.Value
+func (v *compressedValue) Len() int {
+	return len(v.b)
+}
+
+// view: the original value, or the compressed bytes as they are should they
+// not decompress, which only a bug lets happen
+func (v *compressedValue) view() ByteView {
+	b, err := decompress(v.algo, v.b, 0)
+	if err != nil {
+		return byteViewOf(v.b)
+	}
+	return byteViewOf(b)
+}
+
+// compressValue: value compressed under o if it is a large ByteView that shrinks,
+// else value itself. saved counts the bytes compression saved
+func compressValue(o *CompressionOptions, value store.Value, saved *atomic.Int64) store.Value {
+	switch v := value.(type) {
+	case ByteView:
+		if !o.compressible(v.view()) {
+			return value
+		}
+		b := compress(o.Algorithm, v.view())
+		if len(b) >= v.Len() {
+			return value
+		}
+		saved.Add(int64(v.Len() - len(b)))
+		return &compressedValue{b: b, algo: o.Algorithm, size: v.Len()}
+	case *compressedValue:
+		// compressed by a client, kept if it is what we would have stored
+		if o != nil && v.algo == o.Algorithm && v.size >= o.threshold() {
+			saved.Add(int64(v.size - len(v.b)))
+			return value
+		}
+		return compressValue(o, v.view(), saved)
+	}
+	return value
+}
+
+// gzipWriters: reused gzip writers, their state is large
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+
+// compress: b compressed with algo
+func compress(algo Compression, b []byte) []byte {
+	switch algo {
+	case Snappy:
+		return s2.EncodeSnappy(nil, b)
+	case Gzip:
+		var buf bytes.Buffer
+		w := gzipWriters.Get().(*gzip.Writer)
+		defer gzipWriters.Put(w)
+		w.Reset(&buf)
+		// writes to a bytes.Buffer don't fail
+		w.Write(b)
+		w.Close()
+		return buf.Bytes()
+	}
+	return b
+}
+
+// decompress: b decompressed with algo, failing beyond limit bytes when limit > 0
+func decompress(algo Compression, b []byte, limit int) ([]byte, error) {
+	switch algo {
+	case NoCompression:
+		return b, nil
+	case Snappy:
+		n, err := s2.DecodedLen(b)
+		if err != nil {
+			return nil, fmt.Errorf("rebelcache: snappy value: %w", err)
+		}
+		if limit > 0 && n > limit {
+			return nil, fmt.Errorf("rebelcache: snappy value inflates to %d bytes, over %d", n, limit)
+		}
+		out, err := s2.Decode(nil, b)
+		if err != nil {
+			return nil, fmt.Errorf("rebelcache: snappy value: %w", err)
+		}
+		return out, nil
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("rebelcache: gzip value: %w", err)
+		}
+		var src io.Reader = r
+		if limit > 0 {
+			src = io.LimitReader(r, int64(limit)+1)
+		}
+		out, err := io.ReadAll(src)
+		if err != nil {
+			return nil, fmt.Errorf("rebelcache: gzip value: %w", err)
+		}
+		if limit > 0 && len(out) > limit {
+			return nil, fmt.Errorf("rebelcache: gzip value inflates to over %d bytes", limit)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("rebelcache: unknown compression %v", algo)
+}
+
+// receivedValue: the value of an rpc compressed with algo as a cache value,
+// checked to decompress within maxInflatedValue
+func receivedValue(b []byte, algo pb.Compression) (store.Value, error) {
+	if algo == pb.Compression_COMPRESSION_NONE {
+		return byteViewOf(b), nil
+	}
+	raw, err := decompress(Compression(algo), b, maxInflatedValue)
+	if err != nil {
+		return nil, err
+	}
+	return &compressedValue{b: b, algo: Compression(algo), size: len(raw)}, nil
+}
@@ -0,0 +1,225 @@
+package rebelcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+// ErrConsistency: fewer nodes of a key's replica set answered than the
+// consistency level of the operation needs. A write failing so was applied
+// on the nodes that answered
+var ErrConsistency = errors.New("rebelcache: consistency level not reached")
+
+// Consistency: how many nodes of a key's replica set a get, set or delete
+// waits for, trading latency for consistency, see ServerOptions.ReplicaCount.
+// Without replication every level is ConsistencyOne
+type Consistency int
+
+const (
+	// ConsistencyOne: writes return once applied on the node serving them and
+	// are copied to the replica set in the background, gets are served by the
+	// owner, or a replica while it is unreachable
+	ConsistencyOne Consistency = iota
+	// ConsistencyQuorum: writes return once a majority of the replica set
+	// holds them, gets compare the copies of a majority
+	ConsistencyQuorum
+	// ConsistencyAll: like ConsistencyQuorum, with every node of the replica set
+	ConsistencyAll
+)
+
+// String: name of the level
+func (c Consistency) String() string {
+	switch c {
+	case ConsistencyOne:
+		return "ONE"
+	case ConsistencyQuorum:
+		return "QUORUM"
+	case ConsistencyAll:
+		return "ALL"
+	}
+	return fmt.Sprintf("Consistency(%d)", int(c))
+}
+
+// needed: nodes of a replica set of n an operation at level c waits for
+func (c Consistency) needed(n int) int {
+	switch c {
+	case ConsistencyQuorum:
+		return n/2 + 1
+	case ConsistencyAll:
+		return n
+	}
+	return min(n, 1)
+}
+
+// consistencyCtxKey: context key of WithConsistency
+type consistencyCtxKey struct{}
+
+// WithConsistency: run the gets, sets and deletes made with ctx at level,
+// overriding ClientOptions.Consistency. Servers run the rpcs they serve at
+// the level the client asked for
+func WithConsistency(ctx context.Context, level Consistency) context.Context {
+	return context.WithValue(ctx, consistencyCtxKey{}, level)
+}
+
+// consistencyFrom: level set by WithConsistency, ok is false if none was
+func consistencyFrom(ctx context.Context) (level Consistency, ok bool) {
+	level, ok = ctx.Value(consistencyCtxKey{}).(Consistency)
+	return level, ok
+}
+
+// consistencyOf: the level of an rpc
+func consistencyOf(c pb.Consistency) Consistency {
+	switch c {
+	case pb.Consistency_CONSISTENCY_QUORUM:
+		return ConsistencyQuorum
+	case pb.Consistency_CONSISTENCY_ALL:
+		return ConsistencyAll
+	}
+	return ConsistencyOne
+}
+
+// withRequestConsistency: ctx of an rpc asking for level c, forwarded rpcs
+// but owner writes and those at ConsistencyOne keep ctx as is
+func withRequestConsistency(ctx context.Context, c pb.Consistency) context.Context {
+	if c == pb.Consistency_CONSISTENCY_ONE || isForwarded(ctx) && !isOwnerWrite(ctx) {
+		return ctx
+	}
+	return WithConsistency(ctx, consistencyOf(c))
+}
+
+// consistencyAnswer: what a node of a replica set holds of a key
+type consistencyAnswer struct {
+	node  int // index in the replica set
+	value []byte
+	local store.Value // the value of the local node, nil for the others
+	found bool
+	err   error
+}
+
+// getConsistent: get key from the nodes of its replica set as level needs,
+// ok is false if the group isn't replicated or none of the nodes answering
+// holds the key, the owner loads it then. Nodes holding another value than
+// the one returned, see pickAnswer, have their copy deleted in the background
+func (g *Group) getConsistent(ctx context.Context, key, norm string, level Consistency) (_ store.Value, ok bool, err error) {
+	set := g.replicaSet(norm)
+	if len(set) == 0 {
+		return nil, false, nil
+	}
+	need := level.needed(len(set))
+	answers := make(chan consistencyAnswer, len(set))
+	req := &pb.GetRequest{Group: g.name, Key: []byte(key), Cached: true}
+	for i, c := range set {
+		if c == nil {
+			value, found := g.cache.Get(key)
+			a := consistencyAnswer{node: i, local: value, found: found}
+			if found {
+				a.value, a.err = valueBytes(value)
+			}
+			answers <- a
+			continue
+		}
+		go func() {
+			b, _, err := c.get(withForwarded(ctx), req)
+			a := consistencyAnswer{node: i, value: b, found: err == nil, err: err}
+			if errors.Is(err, ErrNotFound) {
+				a.err = nil
+			}
+			answers <- a
+		}()
+	}
+
+	// past the answers needed, more are awaited while the copies tie
+	var got []consistencyAnswer
+	best, sure := -1, false
+	for range set {
+		var a consistencyAnswer
+		select {
+		case a = <-answers:
+		case <-ctx.Done():
+			return nil, true, ctx.Err()
+		}
+		if a.err != nil {
+			continue
+		}
+		got = append(got, a)
+		if best, sure = pickAnswer(got); len(got) >= need && sure {
+			break
+		}
+	}
+	if len(got) < need {
+		return nil, true, fmt.Errorf("%w: %d of %d nodes holding %s answered, %s needs %d",
+			ErrConsistency, len(got), len(set), FormatKey(key), level, need)
+	}
+	if best < 0 {
+		return nil, false, nil
+	}
+	chosen := got[best]
+	var stale []*Client
+	for _, a := range got {
+		if sure && a.found && !bytes.Equal(a.value, chosen.value) {
+			if c := set[a.node]; c != nil {
+				stale = append(stale, c)
+			} else {
+				g.cache.Delete(key)
+			}
+		}
+	}
+	if len(stale) > 0 {
+		g.dropStale(key, stale)
+	}
+	if chosen.local != nil {
+		return chosen.local, true, nil
+	}
+	return byteViewOf(chosen.value), true, nil
+}
+
+// dropStale: delete the differing copies of key on nodes in the background,
+// counted as read repairs
+func (g *Group) dropStale(key string, nodes []*Client) {
+	g.tasks.Go("read repair", func() {
+		ctx, cancel := context.WithTimeout(withForwarded(context.Background()), replicaWriteTimeout)
+		defer cancel()
+		for _, c := range nodes {
+			if _, err := c.Delete(ctx, g.name, key); err != nil {
+				log.Printf("rebelcache: drop stale %s on replica %s: %v", FormatKey(key), c.Addr(), err)
+				continue
+			}
+			g.readRepairs.Add(1)
+		}
+	})
+}
+
+// pickAnswer: the answer among got holding the owner's copy, else the copy
+// most of got hold, -1 if none holds the key. sure is false while the copies
+// of the other nodes tie, the first of them is returned then
+func pickAnswer(got []consistencyAnswer) (best int, sure bool) {
+	best, sure = -1, true
+	votes := 0
+	for i, a := range got {
+		if !a.found {
+			continue
+		}
+		if a.node == 0 {
+			return i, true
+		}
+		n := 0
+		for _, b := range got {
+			if b.found && bytes.Equal(a.value, b.value) {
+				n++
+			}
+		}
+		switch {
+		case n > votes:
+			best, votes, sure = i, n, true
+		case n == votes && !bytes.Equal(a.value, got[best].value):
+			sure = false
+		}
+	}
+	return best, sure
+}
@@ -0,0 +1,270 @@
+// Package consistenthash implements a consistent hashing ring with virtual nodes.
+package consistenthash
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Hash maps bytes to a position on the ring.
+type Hash func(data []byte) uint32
+
+// DefaultReplicas is the number of virtual nodes per node used when none is given.
+const DefaultReplicas = 50
+
+// Map is a consistent hashing ring. Each node is placed on the ring as
+// several virtual nodes so keys spread evenly and only about 1/n of them
+// move when a node joins or leaves. It is safe for concurrent use.
+type Map struct {
+	mtx      sync.RWMutex
+	hash     Hash              // hash function of keys and virtual nodes
+	replicas int               // virtual nodes per node
+	ring     []uint32          // sorted virtual node hashes
+	owners   map[uint32]string // virtual node hash -> node
+	nodes    map[string]struct{}
+	weights  map[string]int // virtual nodes of the nodes placed with less than replicas
+}
+
+// New creates an empty ring.
+//
+// Parameters:
+//   - replicas: the number of virtual nodes per node; non-positive values default to DefaultReplicas
+//   - fn: the hash function; nil defaults to crc32.ChecksumIEEE
+//
+// Returns:
+//   - *Map: A pointer to the newly created ring
+func New(replicas int, fn Hash) *Map {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &Map{
+		hash:     fn,
+		replicas: replicas,
+		owners:   make(map[uint32]string),
+		nodes:    make(map[string]struct{}),
+		weights:  make(map[string]int),
+	}
+}
+
+// Add places nodes on the ring, nodes already on it are ignored.
+func (m *Map) Add(nodes ...string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for _, node := range nodes {
+		if _, ok := m.nodes[node]; !ok {
+			m.addLocked(node)
+		}
+	}
+	slices.Sort(m.ring)
+}
+
+// Remove takes nodes off the ring.
+func (m *Map) Remove(nodes ...string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	removed := false
+	for _, node := range nodes {
+		if _, ok := m.nodes[node]; ok {
+			delete(m.nodes, node)
+			delete(m.weights, node)
+			removed = true
+		}
+	}
+	if removed {
+		m.rebuild()
+	}
+}
+
+// Set replaces the nodes of the ring with nodes.
+func (m *Map) Set(nodes ...string) {
+	m.SetWeighted(nodes, nil)
+}
+
+// SetWeighted replaces the nodes of the ring with nodes, placing those given
+// a weight below 1 with that share of their virtual nodes, at least one. A
+// node's virtual nodes are the first of the ones it has at full weight, so
+// raising its weight only moves keys to it.
+//
+// Parameters:
+//   - nodes: The nodes of the ring
+//   - weights: weight of nodes from 0 to 1, nodes missing from it have full weight
+func (m *Map) SetWeighted(nodes []string, weights map[string]float64) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.nodes = make(map[string]struct{}, len(nodes))
+	m.weights = make(map[string]int)
+	for _, node := range nodes {
+		m.nodes[node] = struct{}{}
+		if w, ok := weights[node]; ok && w < 1 {
+			m.weights[node] = max(1, int(math.Round(w*float64(m.replicas))))
+		}
+	}
+	m.rebuild()
+}
+
+// Get returns the node owning key.
+//
+// Parameters:
+//   - key: The key to locate
+//
+// Returns:
+//   - string: the owning node, empty if the ring is empty
+func (m *Map) Get(key string) string {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	if len(m.ring) == 0 {
+		return ""
+	}
+	h := m.hash([]byte(key))
+	// first virtual node clockwise from h, wrapping around
+	idx, _ := slices.BinarySearch(m.ring, h)
+	if idx == len(m.ring) {
+		idx = 0
+	}
+	return m.owners[m.ring[idx]]
+}
+
+// GetN returns the owner of key followed by the next distinct nodes clockwise,
+// the nodes that take the key over should the ones before them leave.
+//
+// Parameters:
+//   - key: The key to locate
+//   - n: the number of nodes wanted
+//
+// Returns:
+//   - []string: up to n distinct nodes, the owner first, empty if the ring is empty
+func (m *Map) GetN(key string, n int) []string {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	n = min(n, len(m.nodes))
+	if n <= 0 || len(m.ring) == 0 {
+		return nil
+	}
+	h := m.hash([]byte(key))
+	idx, _ := slices.BinarySearch(m.ring, h)
+	nodes := make([]string, 0, n)
+	for i := 0; i < len(m.ring) && len(nodes) < n; i++ {
+		node := m.owners[m.ring[(idx+i)%len(m.ring)]]
+		if !slices.Contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// KeyHash returns the position of key on the ring.
+func (m *Map) KeyHash(key string) uint32 {
+	return m.hash([]byte(key))
+}
+
+// Shares splits the hash space into equal segments and reports the part of
+// each segment owned by node, the keys it is expected to hold if keys hash
+// evenly.
+//
+// Parameters:
+//   - node: The node whose ownership is reported
+//   - segments: the number of segments, a power of two
+//
+// Returns:
+//   - []float64: per segment, the fraction of the segment owned by node, from 0 to 1
+func (m *Map) Shares(node string, segments int) []float64 {
+	shares := make([]float64, segments)
+	size := uint64(1<<32) / uint64(segments)
+	// add accounts the positions [lo, hi) to node
+	add := func(lo, hi uint64) {
+		for lo < hi {
+			seg := lo / size
+			end := min(hi, (seg+1)*size)
+			shares[seg] += float64(end-lo) / float64(size)
+			lo = end
+		}
+	}
+
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	for i, h := range m.ring {
+		if m.owners[h] != node {
+			continue
+		}
+		// a virtual node owns the positions after its predecessor up to itself
+		if i == 0 {
+			add(uint64(m.ring[len(m.ring)-1])+1, 1<<32)
+			add(0, uint64(h)+1)
+		} else {
+			add(uint64(m.ring[i-1])+1, uint64(h)+1)
+		}
+	}
+	return shares
+}
+
+// Nodes returns the nodes on the ring in order.
+func (m *Map) Nodes() []string {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	nodes := make([]string, 0, len(m.nodes))
+	for node := range m.nodes {
+		nodes = append(nodes, node)
+	}
+	slices.Sort(nodes)
+	return nodes
+}
+
+// signatureProbe is hashed to tell hash functions apart.
+const signatureProbe = "rebelcache/consistenthash/probe"
+
+// Signature describes how the ring places keys: two rings with equal
+// signatures and equal nodes pick the same node for every key.
+//
+// Returns:
+//   - string: the replica count and a fingerprint of the hash function
+func (m *Map) Signature() string {
+	return fmt.Sprintf("replicas=%d hash=%08x", m.replicas, m.hash([]byte(signatureProbe)))
+}
+
+// Len returns the number of nodes on the ring.
+func (m *Map) Len() int {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	return len(m.nodes)
+}
+
+// rebuild places the current nodes on an empty ring.
+// Note: lock must be held before calling this function.
+func (m *Map) rebuild() {
+	nodes := m.nodes
+	m.ring = m.ring[:0]
+	m.owners = make(map[uint32]string, len(nodes)*m.replicas)
+	m.nodes = make(map[string]struct{}, len(nodes))
+	for node := range nodes {
+		m.addLocked(node)
+	}
+	slices.Sort(m.ring)
+}
+
+// addLocked places the virtual nodes of node on the ring, leaving it unsorted.
+// Note: lock must be held before calling this function.
+func (m *Map) addLocked(node string) {
+	m.nodes[node] = struct{}{}
+	n, ok := m.weights[node]
+	if !ok {
+		n = m.replicas
+	}
+	for i := 0; i < n; i++ {
+		h := m.hash([]byte(strconv.Itoa(i) + node))
+		owner, taken := m.owners[h]
+		if !taken {
+			m.ring = append(m.ring, h)
+		} else if owner < node {
+			// on a collision the smaller node wins so every ring agrees
+			continue
+		}
+		m.owners[h] = node
+	}
+}
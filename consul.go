@@ -0,0 +1,293 @@
+package rebelcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultConsulAddr       = "http://127.0.0.1:8500"
+	defaultConsulPrefix     = "rebelcache"
+	defaultConsulSessionTTL = 10 * time.Second // the least consul accepts
+	consulWatchWait         = 5 * time.Minute  // longest wait of a blocking query
+)
+
+// ConsulOptions: connection to consul for DiscoveryConsul. Nodes register as
+// keys of the kv store held by a session, consul deletes them once the
+// session isn't renewed within its ttl, and watch the keys by blocking queries
+type ConsulOptions struct {
+	Addr       string        // url of the consul agent, empty means http://127.0.0.1:8500
+	Token      string        // acl token, empty means the agent's default
+	Datacenter string        // empty means the agent's
+	Prefix     string        // kv prefix, lets several clusters share one consul, empty means rebelcache
+	SessionTTL time.Duration // ttl of a node's session, 0 means 10s
+	HTTPClient *http.Client  // nil means a client without timeout, blocking queries wait minutes
+}
+
+// consulRegistry: Registry of nodes registered in the kv store of consul
+type consulRegistry struct {
+	opts ConsulOptions
+	svc  ServiceName
+	regs registrations
+	// loops: watches, restarted after a panic and joined by Close
+	loops *supervisor
+}
+
+// consulKV: an entry of a consul kv listing
+type consulKV struct {
+	Key     string
+	Value   []byte
+	Session string
+}
+
+// errConsulNotFound: the key or session of a consul request doesn't exist
+var errConsulNotFound = errors.New("not found")
+
+// NewConsulRegistry: Registry of the nodes of svc in consul
+func NewConsulRegistry(svc ServiceName, opts ConsulOptions) Registry {
+	if opts.Addr == "" {
+		opts.Addr = defaultConsulAddr
+	}
+	opts.Addr = strings.TrimSuffix(opts.Addr, "/")
+	if opts.Prefix == "" {
+		opts.Prefix = defaultConsulPrefix
+	}
+	if opts.SessionTTL < defaultConsulSessionTTL {
+		opts.SessionTTL = defaultConsulSessionTTL
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{}
+	}
+	return &consulRegistry{opts: opts, svc: svc, loops: newSupervisor(context.Background())}
+}
+
+// prefix: kv prefix the nodes of the cluster register under
+func (c *consulRegistry) prefix() string {
+	return strings.Trim(c.opts.Prefix, "/") + c.svc.EtcdPrefix()
+}
+
+// do: send a request to consul, decode a json answer into out if not nil
+// and return the index of the answer
+func (c *consulRegistry) do(ctx context.Context, method, path string, query url.Values, body []byte, out any) (uint64, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	if c.opts.Datacenter != "" {
+		query.Set("dc", c.opts.Datacenter)
+	}
+	u := c.opts.Addr + "/v1/" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	if c.opts.Token != "" {
+		req.Header.Set("X-Consul-Token", c.opts.Token)
+	}
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return index, errConsulNotFound
+	case resp.StatusCode != http.StatusOK:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return index, fmt.Errorf("consul %s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(msg))
+	case out != nil:
+		return index, json.NewDecoder(resp.Body).Decode(out)
+	}
+	return index, nil
+}
+
+// createSession: a session of the node at addr, its keys are deleted with it
+func (c *consulRegistry) createSession(ctx context.Context, addr string) (string, error) {
+	body, _ := json.Marshal(map[string]string{
+		"Name":      "rebelcache " + addr,
+		"TTL":       c.opts.SessionTTL.String(),
+		"Behavior":  "delete",
+		"LockDelay": "0s",
+	})
+	var session struct{ ID string }
+	if _, err := c.do(ctx, http.MethodPut, "session/create", nil, body, &session); err != nil {
+		return "", err
+	}
+	return session.ID, nil
+}
+
+// destroySession: end session, deleting its keys
+func (c *consulRegistry) destroySession(ctx context.Context, session string) error {
+	_, err := c.do(ctx, http.MethodPut, "session/destroy/"+session, nil, nil, nil)
+	return err
+}
+
+// put: write value at key held by session, a key held by another session,
+// one of an earlier run of the node, is taken over
+func (c *consulRegistry) put(ctx context.Context, key, value, session string) error {
+	for range 2 {
+		var acquired bool
+		if _, err := c.do(ctx, http.MethodPut, "kv/"+key, url.Values{"acquire": {session}}, []byte(value), &acquired); err != nil || acquired {
+			return err
+		}
+		var kvs []consulKV
+		if _, err := c.do(ctx, http.MethodGet, "kv/"+key, nil, nil, &kvs); err != nil && !errors.Is(err, errConsulNotFound) {
+			return err
+		}
+		if len(kvs) > 0 && kvs[0].Session != "" {
+			if err := c.destroySession(ctx, kvs[0].Session); err != nil && !errors.Is(err, errConsulNotFound) {
+				return err
+			}
+		}
+	}
+	return fmt.Errorf("consul key %s held by another session", key)
+}
+
+// Register: implements Registry
+func (c *consulRegistry) Register(_ context.Context, addr, value string) error {
+	c.regs.start(addr, value, func(ctx context.Context, r *registration) {
+		c.keep(ctx, addr, r)
+	})
+	return nil
+}
+
+// keep: keep the node at addr registered until ctx ends, then destroy its
+// session. A session lost to a consul outage is created again
+func (c *consulRegistry) keep(ctx context.Context, addr string, r *registration) {
+	key := c.prefix() + addr
+	for {
+		session, err := c.createSession(ctx, addr)
+		if err == nil {
+			if err = c.put(ctx, key, r.current(), session); err == nil {
+				err = c.renew(ctx, key, session, r)
+			}
+			destroyCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+			if err := c.destroySession(destroyCtx, session); err != nil && ctx.Err() != nil {
+				log.Printf("rebelcache: destroy consul session of %s: %v", key, err)
+			}
+			cancel()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("rebelcache: register %s in consul: %v", key, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(registerRetryInterval):
+		}
+	}
+}
+
+// renew: renew session well within its ttl and rewrite key on updates of r
+// until ctx ends, nil then, or the session is lost
+func (c *consulRegistry) renew(ctx context.Context, key, session string, r *registration) error {
+	ticker := time.NewTicker(c.opts.SessionTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			_, err := c.do(ctx, http.MethodPut, "session/renew/"+session, nil, nil, nil)
+			if errors.Is(err, errConsulNotFound) {
+				return errors.New("session expired")
+			}
+			if err != nil && ctx.Err() == nil {
+				// retried on the next tick, the session outlives a few failures
+				log.Printf("rebelcache: renew consul session of %s: %v", key, err)
+			}
+		case <-r.updates:
+			if err := c.put(ctx, key, r.current(), session); err != nil && ctx.Err() == nil {
+				return err
+			}
+		}
+	}
+}
+
+// Deregister: implements Registry
+func (c *consulRegistry) Deregister(ctx context.Context, addr string) error {
+	return c.regs.stop(ctx, addr)
+}
+
+// Watch: implements Registry
+func (c *consulRegistry) Watch(ctx context.Context, onChange func(nodes map[string]string)) error {
+	nodes, index, err := c.list(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("rebelcache: list nodes in consul: %w", err)
+	}
+	onChange(maps.Clone(nodes))
+	c.loops.goUntil(ctx, "consul watch", RestartOnFailure, func(ctx context.Context) error {
+		for ctx.Err() == nil {
+			next, nextIndex, err := c.list(ctx, index)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("rebelcache: watch nodes in consul: %v", err)
+					select {
+					case <-ctx.Done():
+					case <-time.After(registerRetryInterval):
+					}
+				}
+				continue
+			}
+			// an index going backwards means consul restarted, start over
+			if index = nextIndex; index == 0 {
+				index = 1
+			}
+			if !maps.Equal(next, nodes) {
+				nodes = next
+				onChange(maps.Clone(nodes))
+			}
+		}
+		return nil
+	})
+	return nil
+}
+
+// list: the registered nodes once the kv index passed index, at once for 0
+func (c *consulRegistry) list(ctx context.Context, index uint64) (map[string]string, uint64, error) {
+	query := url.Values{"recurse": {"true"}}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", consulWatchWait.String())
+	}
+	var kvs []consulKV
+	next, err := c.do(ctx, http.MethodGet, "kv/"+c.prefix(), query, nil, &kvs)
+	if err != nil && !errors.Is(err, errConsulNotFound) {
+		return nil, 0, err
+	}
+	if next < index {
+		next = 0
+	}
+	nodes := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		// keys written without a session would never be deleted
+		if kv.Session != "" {
+			nodes[strings.TrimPrefix(kv.Key, c.prefix())] = string(kv.Value)
+		}
+	}
+	return nodes, next, nil
+}
+
+// Close: implements Registry
+func (c *consulRegistry) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), registryCloseTimeout)
+	defer cancel()
+	err := c.regs.stopAll(ctx)
+	c.loops.Stop()
+	return err
+}
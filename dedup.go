@@ -0,0 +1,117 @@
+package rebelcache
+
+import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+// setDedup: recent sets by key, so a set repeating one within the window is
+// acknowledged without writing, publishing or journaling it again. Any other
+// write of the key, seen on the cache's event feed, forgets its set. Sets are
+// kept in two generations swapped every window, so each is remembered for one
+// to two windows
+type setDedup struct {
+	window    time.Duration
+	seed      maphash.Seed
+	mtx       sync.Mutex
+	rotated   time.Time
+	cur, prev map[string]recentSet
+	collapsed atomic.Int64 // sets acknowledged without writing
+}
+
+// recentSet: a set remembered by setDedup
+type recentSet struct {
+	hash uint64        // hash of the value's bytes
+	ttl  time.Duration // ttl the entry got
+	at   time.Time
+}
+
+// newSetDedup: create a dedup window, nil if window is not positive
+func newSetDedup(window time.Duration) *setDedup {
+	if window <= 0 {
+		return nil
+	}
+	return &setDedup{
+		window:  window,
+		seed:    maphash.MakeSeed(),
+		rotated: time.Now(),
+		cur:     make(map[string]recentSet),
+		prev:    make(map[string]recentSet),
+	}
+}
+
+// hash: hash of value's bytes, ok is false for values without a byte form
+func (d *setDedup) hash(value store.Value) (uint64, bool) {
+	b, err := valueBytes(value)
+	if err != nil {
+		return 0, false
+	}
+	return maphash.Bytes(d.seed, b), true
+}
+
+// duplicate: whether setting key to value with ttl repeats the last write of
+// the key, a set of the window
+// Note: the key's stripe lock must be held
+func (d *setDedup) duplicate(key string, value store.Value, ttl time.Duration) bool {
+	h, ok := d.hash(value)
+	if !ok {
+		return false
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	now := time.Now()
+	d.rotate(now)
+	last, ok := d.cur[key]
+	if !ok {
+		last, ok = d.prev[key]
+	}
+	if !ok || now.Sub(last.at) > d.window || last.hash != h || last.ttl != ttl {
+		return false
+	}
+	d.collapsed.Add(1)
+	return true
+}
+
+// remember: record that key was set to value with ttl
+// Note: the key's stripe lock must be held
+func (d *setDedup) remember(key string, value store.Value, ttl time.Duration) {
+	h, ok := d.hash(value)
+	if !ok {
+		return
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	now := time.Now()
+	d.rotate(now)
+	d.cur[key] = recentSet{hash: h, ttl: ttl, at: now}
+}
+
+// observe: forget the sets a write published on the feed overrides
+func (d *setDedup) observe(ev keyEvent) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if ev.kind == eventClear {
+		clear(d.cur)
+		clear(d.prev)
+		return
+	}
+	delete(d.cur, ev.key)
+	delete(d.prev, ev.key)
+}
+
+// rotate: swap generations once the current one is a window old
+// Note: d.mtx must be held
+func (d *setDedup) rotate(now time.Time) {
+	if now.Sub(d.rotated) < d.window {
+		return
+	}
+	d.prev, d.cur = d.cur, make(map[string]recentSet, len(d.cur))
+	if now.Sub(d.rotated) >= 2*d.window {
+		clear(d.prev)
+	}
+	d.rotated = now
+}
@@ -0,0 +1,234 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// invalidateTimeout: deadline of the deletes sent to peers for one invalidation
+const invalidateTimeout = 5 * time.Second
+
+// invalidateWindow: invalidations of a group within this long of the first
+// are sent to the peers together
+const invalidateWindow = 10 * time.Millisecond
+
+// invalidateBatch: keys deleted on a peer per MDelete
+const invalidateBatch = 1000
+
+// depGraph: which keys derive from which, by normalized key
+type depGraph struct {
+	mtx        sync.RWMutex
+	inputs     map[string][]string            // derived key -> keys it derives from
+	dependents map[string]map[string]struct{} // input key -> keys derived from it
+}
+
+// newDepGraph: create a graph without links
+func newDepGraph() *depGraph {
+	return &depGraph{inputs: make(map[string][]string), dependents: make(map[string]map[string]struct{})}
+}
+
+// link: make key derive from inputs only, no inputs unlinks it
+func (d *depGraph) link(key string, inputs []string) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	for _, in := range d.inputs[key] {
+		delete(d.dependents[in], key)
+		if len(d.dependents[in]) == 0 {
+			delete(d.dependents, in)
+		}
+	}
+	delete(d.inputs, key)
+	if len(inputs) == 0 {
+		return
+	}
+	d.inputs[key] = inputs
+	for _, in := range inputs {
+		if d.dependents[in] == nil {
+			d.dependents[in] = make(map[string]struct{})
+		}
+		d.dependents[in][key] = struct{}{}
+	}
+}
+
+// closure: the keys deriving from key directly or through other keys, key
+// itself left out. A cycle back to key stops there
+func (d *depGraph) closure(key string) []string {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	if len(d.dependents[key]) == 0 {
+		return nil
+	}
+	seen := map[string]struct{}{key: {}}
+	var keys []string
+	queue := []string{key}
+	for len(queue) > 0 {
+		in := queue[0]
+		queue = queue[1:]
+		for dep := range d.dependents[in] {
+			if _, ok := seen[dep]; ok {
+				continue
+			}
+			seen[dep] = struct{}{}
+			keys = append(keys, dep)
+			queue = append(queue, dep)
+		}
+	}
+	return keys
+}
+
+// peerInvalidations: derived keys of a group to delete on the peers once
+// invalidateWindow passes, so a burst of invalidations, like writing many
+// inputs, is sent in a few batches rather than a delete per key
+type peerInvalidations struct {
+	mtx  sync.Mutex
+	keys map[string]struct{} // nil while no send is scheduled
+}
+
+// peerInvalidator: implemented by PeerPickers that can delete keys on all their peers, ClientPicker does
+type peerInvalidator interface {
+	invalidate(ctx context.Context, group string, keys []string) error
+}
+
+// DependsOn: declare that key is derived from inputs, like an aggregate of
+// them: when an input is set or deleted through the group, key and whatever
+// derives from key are deleted too, here and on every peer, so they stop
+// serving values computed from stale inputs. The declaration replaces an
+// earlier one of key, no inputs removes it. Declarations outlive the entries
+// and are local to the process, every node writing the inputs should make them
+func (g *Group) DependsOn(key string, inputs ...string) error {
+	norm, err := g.cache.opts.KeyPolicy.Apply(key)
+	if err != nil {
+		return err
+	}
+	normInputs := make([]string, 0, len(inputs))
+	for _, in := range inputs {
+		if in == "" {
+			return fmt.Errorf("%w: empty input of %s", ErrInvalidKey, FormatKey(key))
+		}
+		n, err := g.cache.opts.KeyPolicy.Apply(in)
+		if err != nil {
+			return err
+		}
+		if n == norm {
+			return fmt.Errorf("%w: %s cannot derive from itself", ErrInvalidKey, FormatKey(key))
+		}
+		normInputs = append(normInputs, n)
+	}
+	g.deps.link(norm, normInputs)
+	return nil
+}
+
+// invalidateDependents: delete the keys deriving from key, locally at once and
+// on the peers in the background, see peerInvalidations. Writes forwarded by a peer don't cascade,
+// the node that forwarded them already deleted the whole closure
+func (g *Group) invalidateDependents(ctx context.Context, key string) {
+	if isForwarded(ctx) {
+		return
+	}
+	norm, err := g.cache.opts.KeyPolicy.Apply(key)
+	if err != nil {
+		return
+	}
+	keys := g.deps.closure(norm)
+	if len(keys) == 0 {
+		return
+	}
+	for _, dep := range keys {
+		g.cache.Delete(dep)
+	}
+	g.invalidated.Add(int64(len(keys)))
+
+	g.mtx.Lock()
+	peers, _ := g.peers.(peerInvalidator)
+	g.mtx.Unlock()
+	if peers == nil {
+		return
+	}
+	g.queueInvalidations(peers, keys)
+}
+
+// queueInvalidations: add keys to those to delete on the peers, scheduling
+// their send if none is
+func (g *Group) queueInvalidations(peers peerInvalidator, keys []string) {
+	q := &g.invalidations
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.keys != nil {
+		for _, key := range keys {
+			q.keys[key] = struct{}{}
+		}
+		return
+	}
+	q.keys = make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		q.keys[key] = struct{}{}
+	}
+	started := g.tasks.Go("invalidate", func() {
+		timer := time.NewTimer(invalidateWindow)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-g.closing.Done():
+		}
+		q.mtx.Lock()
+		batch := slices.Collect(maps.Keys(q.keys))
+		q.keys = nil
+		q.mtx.Unlock()
+
+		// not tied to g.closing, the flush at close must reach the peers
+		ctx, cancel := context.WithTimeout(context.Background(), invalidateTimeout)
+		defer cancel()
+		if err := peers.invalidate(ctx, g.name, batch); err != nil {
+			log.Printf("rebelcache: invalidate %d derived keys of group %s on peers: %v", len(batch), g.name, err)
+		}
+	})
+	if !started {
+		q.keys = nil
+	}
+}
+
+// invalidate: delete keys of group on every peer but the local node, in
+// batches of invalidateBatch, as forwarded deletes so the peers don't
+// cascade them again. Peers without MDelete get a delete per key
+func (p *ClientPicker) invalidate(ctx context.Context, group string, keys []string) error {
+	p.mtx.RLock()
+	clients := make([]*Client, 0, len(p.clients))
+	for _, c := range p.clients {
+		clients = append(clients, c)
+	}
+	p.mtx.RUnlock()
+
+	ctx = withForwarded(ctx)
+	var wg sync.WaitGroup
+	errs := make([]error, len(clients))
+	for i, c := range clients {
+		wg.Go(func() {
+			for batch := range slices.Chunk(keys, invalidateBatch) {
+				if _, err := c.MDelete(ctx, group, batch); status.Code(err) != codes.Unimplemented {
+					if err != nil {
+						errs[i] = fmt.Errorf("peer %s: %w", c.Addr(), err)
+						return
+					}
+					continue
+				}
+				for _, key := range batch {
+					if _, err := c.Delete(ctx, group, key); err != nil {
+						errs[i] = fmt.Errorf("peer %s: %w", c.Addr(), err)
+						return
+					}
+				}
+			}
+		})
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
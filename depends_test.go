@@ -0,0 +1,175 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+// invalidationRecorder: a PeerPicker owning no key that records the
+// invalidations sent to the peers
+type invalidationRecorder struct {
+	mtx     sync.Mutex
+	batches [][]string
+}
+
+// PickPeer: implements PeerPicker
+func (r *invalidationRecorder) PickPeer(key string) (PeerGetter, bool) {
+	return nil, false
+}
+
+// invalidate: implements peerInvalidator
+func (r *invalidationRecorder) invalidate(ctx context.Context, group string, keys []string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.batches = append(r.batches, keys)
+	return nil
+}
+
+// sent: the batches and the keys sent so far
+func (r *invalidationRecorder) sent() (batches int, keys []string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, b := range r.batches {
+		keys = append(keys, b...)
+	}
+	slices.Sort(keys)
+	return len(r.batches), keys
+}
+
+func newRecordingGroup(t *testing.T) (*Group, *invalidationRecorder) {
+	g := NewGroup(t.Name(), 1<<20, GetterFunc(func(ctx context.Context, key string) (store.Value, error) {
+		return byteViewOf([]byte("v-" + key)), nil
+	}))
+	r := &invalidationRecorder{}
+	g.RegisterPeers(r)
+	t.Cleanup(g.Close)
+	return g, r
+}
+
+func TestDependsOnInvalid(t *testing.T) {
+	g, _ := newRecordingGroup(t)
+	tests := []struct {
+		name   string
+		key    string
+		inputs []string
+	}{
+		{"derived from itself", "k", []string{"a", "k"}},
+		{"empty input", "k", []string{""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := g.DependsOn(tt.key, tt.inputs...); !errors.Is(err, ErrInvalidKey) {
+				t.Fatalf("DependsOn: %v, want ErrInvalidKey", err)
+			}
+		})
+	}
+}
+
+func TestInvalidationBatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs int
+		close  bool // the group closes right after the writes
+	}{
+		{"one write", 1, false},
+		{"burst of writes", 500, false},
+		{"flushed at close", 20, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, r := newRecordingGroup(t)
+			ctx := context.Background()
+			var want []string
+			for i := range tt.inputs {
+				in, derived := "in-"+strconv.Itoa(i), "derived-"+strconv.Itoa(i)
+				if err := g.DependsOn(derived, in); err != nil {
+					t.Fatal(err)
+				}
+				want = append(want, derived)
+			}
+			for i := range tt.inputs {
+				if err := g.Set(ctx, "in-"+strconv.Itoa(i), byteViewOf([]byte("v"))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.close {
+				g.Close()
+			}
+			slices.Sort(want)
+			eventually(t, "invalidations sent", func() bool {
+				_, keys := r.sent()
+				return slices.Equal(keys, want)
+			})
+			if batches, _ := r.sent(); batches > 2 {
+				t.Fatalf("%d invalidations sent for %d writes, want them batched", batches, tt.inputs)
+			}
+		})
+	}
+}
+
+func TestInvalidationAcrossNodes(t *testing.T) {
+	c := newTestCluster(t, 3, clusterOptions{})
+	ctx := context.Background()
+	derived := map[string][]string{
+		"total":   {"a", "b"},
+		"average": {"total"},
+		"other":   {"c"},
+	}
+	for _, n := range c.nodes {
+		for key, inputs := range derived {
+			if err := n.group.DependsOn(key, inputs...); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name    string
+		write   func(cli *Client) error
+		deleted []string
+	}{
+		{"set of an input", func(cli *Client) error {
+			return cli.Set(ctx, testGroup, "a", []byte("1"), 0)
+		}, []string{"average", "total"}},
+		{"delete of an input", func(cli *Client) error {
+			_, err := cli.Delete(ctx, testGroup, "c")
+			return err
+		}, []string{"other"}},
+		{"merge of an input", func(cli *Client) error {
+			_, err := cli.Patch(ctx, testGroup, "b", -1, []byte("2"), 0)
+			return err
+		}, []string{"average", "total"}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// every node caches every derived key
+			for _, n := range c.nodes {
+				for key := range derived {
+					if err := n.group.cache.Set(key, byteViewOf([]byte("stale"))); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if err := tt.write(c.client(i%len(c.nodes), nil)); err != nil {
+				t.Fatal(err)
+			}
+			for node := range c.nodes {
+				for _, key := range slices.Sorted(maps.Keys(derived)) {
+					gone := slices.Contains(tt.deleted, key)
+					eventually(t, fmt.Sprintf("%s on node %d", key, node), func() bool {
+						_, ok := c.cached(node, key)
+						return ok != gone
+					})
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package rebelcache
+
+import (
+	"context"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Discovery: maintains the live peer list of a cluster by watching its etcd prefix
+type Discovery struct {
+	cli      *clientv3.Client
+	svc      ServiceName
+	onChange func(peers []string) // called with the sorted peer list after each change
+	mtx      sync.RWMutex
+	peers    map[string]string // registered peer addr -> value of its registration
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// NewDiscovery: create a discovery of svc's peers, onChange may be nil
+func NewDiscovery(cli *clientv3.Client, svc ServiceName, onChange func(peers []string)) *Discovery {
+	return &Discovery{
+		cli:      cli,
+		svc:      svc,
+		onChange: onChange,
+		peers:    make(map[string]string),
+	}
+}
+
+// Start: load the current peers and keep following changes in the background
+// until Stop, onChange is called with the current peers before returning
+func (d *Discovery) Start(ctx context.Context) error {
+	rev, err := d.load(ctx)
+	if err != nil {
+		return err
+	}
+	// load only notifies of changes, an empty cluster is reported too
+	if len(d.Peers()) == 0 {
+		d.notify()
+	}
+	ctx, d.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	d.done = make(chan struct{})
+	go d.watchLoop(ctx, rev)
+	return nil
+}
+
+// Stop: stop following changes
+func (d *Discovery) Stop() {
+	if d.cancel != nil {
+		d.cancel()
+		<-d.done
+	}
+}
+
+// Peers: sorted addrs of the live peers
+func (d *Discovery) Peers() []string {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	return d.sorted()
+}
+
+// Weights: ring weights of the peers registered with one below full, see
+// WarmupOptions.Weight
+func (d *Discovery) Weights() map[string]float64 {
+	return nodeWeights(d.Nodes())
+}
+
+// Nodes: the live peers, addr -> value of its registration
+func (d *Discovery) Nodes() map[string]string {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	return maps.Clone(d.peers)
+}
+
+// load: replace the peer list with the registered peers, return the revision read at
+func (d *Discovery) load(ctx context.Context) (int64, error) {
+	resp, err := d.cli.Get(ctx, d.svc.EtcdPrefix(), clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+	peers := make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		peers[d.addrOf(kv.Key)] = string(kv.Value)
+	}
+
+	d.mtx.Lock()
+	changed := !maps.Equal(d.peers, peers)
+	d.peers = peers
+	d.mtx.Unlock()
+	if changed {
+		d.notify()
+	}
+	return resp.Header.Revision, nil
+}
+
+// watchLoop: apply watch events after rev, reloading the full list whenever
+// the watch breaks (etcd reconnect, lost leader, compacted revision)
+func (d *Discovery) watchLoop(ctx context.Context, rev int64) {
+	defer close(d.done)
+	for ctx.Err() == nil {
+		watchCtx := clientv3.WithRequireLeader(ctx)
+		for resp := range d.cli.Watch(watchCtx, d.svc.EtcdPrefix(), clientv3.WithPrefix(), clientv3.WithRev(rev+1)) {
+			if err := resp.Err(); err != nil {
+				log.Printf("rebelcache: watch %s: %v", d.svc.EtcdPrefix(), err)
+				break
+			}
+			d.apply(resp.Events)
+			rev = resp.Header.Revision
+		}
+
+		// the watch ended, resync from a fresh listing
+		for ctx.Err() == nil {
+			var err error
+			if rev, err = d.load(ctx); err == nil {
+				break
+			}
+			log.Printf("rebelcache: reload peers of %s: %v", d.svc, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(registerRetryInterval):
+			}
+		}
+	}
+}
+
+// apply: update the peer list with watch events
+func (d *Discovery) apply(events []*clientv3.Event) {
+	d.mtx.Lock()
+	changed := false
+	for _, ev := range events {
+		addr := d.addrOf(ev.Kv.Key)
+		value, had := d.peers[addr]
+		switch ev.Type {
+		case clientv3.EventTypePut:
+			d.peers[addr] = string(ev.Kv.Value)
+			// a node registered again with a new weight moves keys too
+			changed = changed || !had || value != string(ev.Kv.Value)
+		case clientv3.EventTypeDelete:
+			delete(d.peers, addr)
+			changed = changed || had
+		}
+	}
+	d.mtx.Unlock()
+	if changed {
+		d.notify()
+	}
+}
+
+// notify: pass the current peer list to onChange
+func (d *Discovery) notify() {
+	if d.onChange != nil {
+		d.onChange(d.Peers())
+	}
+}
+
+// sorted: peer addrs in order
+// Note: lock must be held before calling this function.
+func (d *Discovery) sorted() []string {
+	peers := make([]string, 0, len(d.peers))
+	for addr := range d.peers {
+		peers = append(peers, addr)
+	}
+	slices.Sort(peers)
+	return peers
+}
+
+// addrOf: peer addr encoded in a registration key
+func (d *Discovery) addrOf(key []byte) string {
+	return strings.TrimPrefix(string(key), d.svc.EtcdPrefix())
+}
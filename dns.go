@@ -0,0 +1,177 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// defaultDNSInterval: how often the name of DiscoveryDNS is resolved again
+const defaultDNSInterval = 10 * time.Second
+
+// DNSOptions: membership from DNS with DiscoveryDNS, e.g. the records of a
+// headless Service in Kubernetes, without etcd or sidecars. The nodes are
+// whatever the name resolves to, the orchestrator registers and removes
+// them, so nodes register nowhere and their warmup weight is ignored. A node
+// is on the ring once its addr among the resolved ones is its
+// ServerOptions.AdvertiseAddr, e.g. its pod ip and port. Kubernetes only
+// publishes ready pods unless the Service sets publishNotReadyAddresses,
+// keys of a node not published yet are served by the others meanwhile
+type DNSOptions struct {
+	// Name: SRV name of the nodes, e.g.
+	// _grpc._tcp.rebelcache.default.svc.cluster.local for the port named
+	// grpc of the headless Service rebelcache, their targets resolved to ips.
+	// With Port, the host name of the nodes instead
+	Name string
+	// Port: grpc port of the nodes, makes Name resolved as A and AAAA
+	// records rather than SRV ones
+	Port     int
+	Interval time.Duration // how often Name is resolved again, 0 means 10s
+	Resolver *net.Resolver // nil means net.DefaultResolver
+}
+
+// dnsRegistry: Registry of the nodes a DNS name resolves to
+type dnsRegistry struct {
+	opts  DNSOptions
+	loops *supervisor // watches, restarted after a panic and joined by Close
+}
+
+// NewDNSRegistry: Registry of the nodes opts.Name resolves to. Nodes can't
+// register in it, Register and Deregister do nothing
+func NewDNSRegistry(opts DNSOptions) (Registry, error) {
+	if opts.Name == "" {
+		return nil, errors.New("rebelcache: dns discovery without a name")
+	}
+	if opts.Port < 0 || opts.Port > 65535 {
+		return nil, fmt.Errorf("rebelcache: invalid dns discovery port %d", opts.Port)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = defaultDNSInterval
+	}
+	if opts.Resolver == nil {
+		opts.Resolver = net.DefaultResolver
+	}
+	return &dnsRegistry{opts: opts, loops: newSupervisor(context.Background())}, nil
+}
+
+// Register: implements Registry, the nodes are those DNS publishes
+func (d *dnsRegistry) Register(context.Context, string, string) error {
+	return nil
+}
+
+// Deregister: implements Registry
+func (d *dnsRegistry) Deregister(context.Context, string) error {
+	return nil
+}
+
+// Watch: implements Registry. A name that doesn't resolve yet, e.g. before
+// any pod of the Service is ready, makes an empty cluster rather than an
+// error, and failed lookups later keep the nodes last resolved
+func (d *dnsRegistry) Watch(ctx context.Context, onChange func(nodes map[string]string)) error {
+	nodes, err := d.resolve(ctx)
+	if err != nil {
+		log.Printf("rebelcache: resolve %s: %v", d.opts.Name, err)
+		nodes = map[string]string{}
+	}
+	onChange(maps.Clone(nodes))
+	d.loops.goUntil(ctx, "dns watch", RestartOnFailure, func(ctx context.Context) error {
+		ticker := time.NewTicker(d.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+			next, err := d.resolve(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("rebelcache: resolve %s: %v", d.opts.Name, err)
+				}
+				continue
+			}
+			if !maps.Equal(next, nodes) {
+				nodes = next
+				onChange(maps.Clone(nodes))
+			}
+		}
+	})
+	return nil
+}
+
+// resolve: the addrs Name resolves to, without values. A name without
+// records resolves to no nodes
+func (d *dnsRegistry) resolve(ctx context.Context) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.opts.Interval)
+	defer cancel()
+	nodes := make(map[string]string)
+	if d.opts.Port > 0 {
+		ips, err := d.opts.Resolver.LookupIPAddr(ctx, d.opts.Name)
+		if isNotFound(err) {
+			return nodes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range preferIPv4(ips) {
+			nodes[net.JoinHostPort(ip, strconv.Itoa(d.opts.Port))] = ""
+		}
+		return nodes, nil
+	}
+
+	_, srvs, err := d.opts.Resolver.LookupSRV(ctx, "", "", d.opts.Name)
+	if isNotFound(err) {
+		return nodes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, srv := range srvs {
+		ips, err := d.opts.Resolver.LookupIPAddr(ctx, srv.Target)
+		if isNotFound(err) {
+			// removed since the SRV records were read
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// one addr per target, a dual-stack pod would be on the ring twice
+		if ips := preferIPv4(ips); len(ips) > 0 {
+			nodes[net.JoinHostPort(ips[0], strconv.Itoa(int(srv.Port)))] = ""
+		}
+	}
+	return nodes, nil
+}
+
+// isNotFound: whether err is a lookup of a name without records
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// preferIPv4: the ipv4 addrs of ips if any, else all of them, sorted
+func preferIPv4(ips []net.IPAddr) []string {
+	var v4, all []string
+	for _, ip := range ips {
+		if ip.IP.To4() != nil {
+			v4 = append(v4, ip.IP.String())
+		}
+		all = append(all, ip.IP.String())
+	}
+	if len(v4) > 0 {
+		all = v4
+	}
+	slices.Sort(all)
+	return all
+}
+
+// Close: implements Registry
+func (d *dnsRegistry) Close() error {
+	return d.loops.Stop()
+}
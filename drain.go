@@ -0,0 +1,167 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	"golang.org/x/time/rate"
+)
+
+const (
+	handoffWorkers = 16              // keys handed off at once by Drain
+	handoffTimeout = 5 * time.Second // of the handoff of one key
+)
+
+// ErrDraining: returned by Drain on a node already draining
+var ErrDraining = errors.New("rebelcache: node is draining")
+
+// handoffEntry: an entry Drain or a rebalance hands off to its new owner.
+// The value is read when the entry is handed off, not when it is collected
+type handoffEntry struct {
+	g        *Group
+	key      string
+	value    store.Value
+	expireAt time.Time
+	version  uint64 // of the value handed off
+}
+
+// Drain: take the node out of the cluster without losing its working set,
+// e.g. before a redeploy. It removes the node from its registry, or leaves
+// the gossip, rejects writes with ErrReadOnly, hands the keys the node owns
+// to their owners on the ring without it, then stops the node as Stop does.
+// The new owners keep keys they were written meanwhile rather than the
+// values handed off. With DiscoveryStatic and DiscoveryDNS the other nodes
+// keep the node on their rings until their list or DNS drops it, and load
+// its keys meanwhile. Handing off stops once ctx ends, the node stops then
+// anyway and ctx's error is returned
+func (s *Server) Drain(ctx context.Context) error {
+	if !s.draining.CompareAndSwap(false, true) {
+		return ErrDraining
+	}
+	defer s.Stop()
+	s.SetReadOnly(true)
+	p := s.opts.Picker
+	if p == nil {
+		return nil
+	}
+
+	switch {
+	case s.registry != nil && s.opts.Discovery != DiscoveryDNS:
+		if err := s.registry.Deregister(ctx, p.self); err != nil {
+			log.Printf("rebelcache: drain: deregister %s: %v", p.self, err)
+		}
+	case s.gossip.Load() != nil:
+		s.gossip.Load().Stop()
+	}
+
+	// the keys the node owns, collected before it leaves the ring
+	entries := s.localEntries(func(_ *Group, key string) bool {
+		_, remote := p.PickPeer(key)
+		return !remote
+	})
+	p.leave()
+	moved, failed := s.handOff(ctx, p, entries, handoffWorkers, nil, nil)
+	log.Printf("rebelcache: node %s drained, %d of %d keys handed off, %d failed", p.self, moved, len(entries), failed)
+	return ctx.Err()
+}
+
+// localEntries: the entries of the served groups keep picks, e.g. by owner
+func (s *Server) localEntries(keep func(g *Group, key string) bool) []handoffEntry {
+	var entries []handoffEntry
+	s.groups.Range(func(_, v any) bool {
+		g := v.(*Group)
+		g.cache.Range(func(key string, _ store.Value, _ time.Time) bool {
+			if keep(g, key) {
+				entries = append(entries, handoffEntry{g: g, key: key})
+			}
+			return true
+		})
+		return true
+	})
+	return entries
+}
+
+// handOff: hand entries off to their owners with workers at once, no faster
+// than limiter allows unless nil, until ctx ends. sent is called with the
+// entries handed off
+func (s *Server) handOff(ctx context.Context, p *ClientPicker, entries []handoffEntry, workers int, limiter *rate.Limiter, sent func(e handoffEntry)) (moved, failed int64) {
+	var movedN, failedN atomic.Int64
+	work := make(chan handoffEntry)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for e := range work {
+				ok, err := s.handoff(ctx, p, &e)
+				switch {
+				case err != nil:
+					// the first failure only, those of a peer down would flood the log
+					if failedN.Add(1) == 1 && ctx.Err() == nil {
+						log.Printf("rebelcache: hand off %s of group %s: %v", FormatKey(e.key), e.g.name, err)
+					}
+				case ok:
+					movedN.Add(1)
+					if sent != nil {
+						sent(e)
+					}
+				}
+			}
+		})
+	}
+feed:
+	for _, e := range entries {
+		if limiter != nil && limiter.Wait(ctx) != nil {
+			break
+		}
+		select {
+		case work <- e:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	return movedN.Load(), failedN.Load()
+}
+
+// handoff: set e at its owner on the ring without the local node unless the
+// owner holds the key already. e is filled with the local entry as it is
+// now, so a write since it was collected is handed off rather than the
+// value then. sent is false for entries deleted or expired meanwhile or
+// without a byte form, lost as on Stop
+func (s *Server) handoff(ctx context.Context, p *ClientPicker, e *handoffEntry) (sent bool, err error) {
+	var ok bool
+	if e.value, e.version, e.expireAt, ok = e.g.cache.current(e.key); !ok {
+		return false, nil
+	}
+	ttl := NoExpiration
+	if !e.expireAt.IsZero() {
+		if ttl = time.Until(e.expireAt); ttl <= 0 {
+			return false, nil
+		}
+	}
+	value, err := valueBytes(e.value)
+	if err != nil {
+		return false, nil
+	}
+	addr, c, ok := p.ownerClient(e.key)
+	if !ok {
+		return false, errors.New("no owner to hand it to")
+	}
+	ctx, cancel := context.WithTimeout(withForwarded(ctx), handoffTimeout)
+	defer cancel()
+	req := c.setRequest(e.g.name, e.key, value, ttl)
+	req.IfAbsent = true
+	if err := c.invoke(ctx, "Set", e.g.name, func(ctx context.Context) error {
+		_, err := c.grpcCli.Set(ctx, req)
+		return err
+	}); err != nil {
+		return false, fmt.Errorf("to %s: %w", addr, err)
+	}
+	return true, nil
+}
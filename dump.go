@@ -0,0 +1,59 @@
+package rebelcache
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// dumpMagic: magic of dumps, laid out like snapshots except that the expiry
+// is the ttl left at the time of the dump, so dumps survive moving between
+// hosts whose clocks disagree
+const dumpMagic = "RCDUMP"
+
+// Dump: write the unexpired entries of the cache to w with their remaining
+// ttl, for Load into a cache of another cluster. Entries go out in the order
+// the store ranges them, most recently or frequently used first for LRU and
+// LFU stores, values without a byte form are left out. It returns the number
+// of entries written
+func (c *Cache) Dump(w io.Writer) (int, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return 0, err
+	}
+	dumpedAt := time.Now()
+	return writeEntries(w, dumpMagic, BinaryRecords, entries, func(expireAt time.Time) int64 {
+		// an entry expiring while it is written keeps the shortest ttl
+		return max(int64(expireAt.Sub(dumpedAt)), 1)
+	})
+}
+
+// Load: set the entries of a dump written by Dump, each with the ttl it had
+// left when dumped, counted from now. Entries are set from the end of the
+// dump so the hottest ones end up the most recently used. Nothing is set
+// from a corrupt dump, see ErrSnapshotCorrupt. It returns the number of entries set
+func (c *Cache) Load(r io.Reader) (int, error) {
+	loadedAt := time.Now()
+	entries, err := readEntries(r, dumpMagic, func(ttl int64) time.Time {
+		return loadedAt.Add(time.Duration(ttl))
+	})
+	if err != nil {
+		return 0, fmt.Errorf("rebelcache: load dump: %w", err)
+	}
+	n := 0
+	for _, e := range slices.Backward(entries) {
+		// entries without expiration stay so rather than getting the default ttl
+		ttl := NoExpiration
+		if !e.expireAt.IsZero() {
+			if ttl = time.Until(e.expireAt); ttl <= 0 {
+				continue
+			}
+		}
+		if err := c.setWithOrigin(e.key, e.value, ttl, "load"); err != nil {
+			return n, fmt.Errorf("rebelcache: load dump: %w", err)
+		}
+		n++
+	}
+	return n, nil
+}
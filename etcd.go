@@ -0,0 +1,57 @@
+package rebelcache
+
+import (
+	"crypto/tls"
+	"errors"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/namespace"
+)
+
+// EtcdOptions: etcd connection options shared by server and client
+type EtcdOptions struct {
+	Endpoints   []string      // etcd endpoints
+	DialTimeout time.Duration // dial timeout
+	Username    string        // username for etcd auth, empty disables auth
+	Password    string        // password for etcd auth
+	TLS         *tls.Config   // tls config, nil means plaintext
+	Prefix      string        // key namespace, lets several clusters share one etcd
+}
+
+// DefaultEtcdOptions: return default etcd config
+func DefaultEtcdOptions() EtcdOptions {
+	return EtcdOptions{
+		Endpoints:   []string{"localhost:2379"},
+		DialTimeout: 5 * time.Second,
+		Prefix:      "/rebelcache",
+	}
+}
+
+// newEtcdClient: create an etcd client whose kv, watcher and lease are scoped to opts.Prefix
+func newEtcdClient(opts EtcdOptions) (*clientv3.Client, error) {
+	if len(opts.Endpoints) == 0 {
+		return nil, errors.New("rebelcache: no etcd endpoints")
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = DefaultEtcdOptions().DialTimeout
+	}
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   opts.Endpoints,
+		DialTimeout: opts.DialTimeout,
+		Username:    opts.Username,
+		Password:    opts.Password,
+		TLS:         opts.TLS,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if prefix := strings.TrimSuffix(opts.Prefix, "/"); prefix != "" {
+		cli.KV = namespace.NewKV(cli.KV, prefix)
+		cli.Watcher = namespace.NewWatcher(cli.Watcher, prefix)
+		cli.Lease = namespace.NewLease(cli.Lease, prefix)
+	}
+	return cli, nil
+}
@@ -0,0 +1,381 @@
+package rebelcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+const (
+	defaultEvictionQueueSize   = 10000
+	defaultEvictionBatchSize   = 100
+	defaultEvictionFlush       = time.Second
+	defaultEvictionRetries     = 5
+	defaultEvictionBackoff     = 100 * time.Millisecond
+	maxEvictionBackoff         = 30 * time.Second
+	defaultEvictionSinkTimeout = 10 * time.Second
+)
+
+// EvictedEntry: an entry that left a cache, as delivered to an EvictionSink
+type EvictedEntry struct {
+	Key    string
+	Value  []byte // shared with the cache, must not be modified
+	Reason store.EvictionReason
+	At     time.Time // when it left
+}
+
+// EvictionSink: where an EvictionBridge delivers the entries leaving a
+// cache, e.g. a kafka topic, see NewProducerSink, or a webhook, see
+// NewWebhookSink
+type EvictionSink interface {
+	// Deliver: persist the entries of batch, an error fails the whole batch,
+	// which is delivered again. Entries may so be delivered more than once.
+	// batch is reused once Deliver returns
+	Deliver(ctx context.Context, batch []EvictedEntry) error
+}
+
+// OverflowPolicy: what an EvictionBridge does with entries leaving the
+// cache while its queue is full, the sink falling behind
+type OverflowPolicy int
+
+const (
+	OverflowDropNewest OverflowPolicy = iota // the entries leaving are dropped
+	OverflowDropOldest                       // the oldest queued entries make room
+	// OverflowBlock: the eviction waits for room, slowing down the writes
+	// that evict. Only use it with CacheOptions.EvictionQueue, which takes
+	// the callbacks from under the store's locks
+	OverflowBlock
+)
+
+// EvictionBridgeOptions: batching, retries and overflow of an
+// EvictionBridge. Zero fields take defaults
+type EvictionBridgeOptions struct {
+	// Reasons: the reasons of the entries delivered, empty means capacity
+	// and expired, the entries a cache drops by itself
+	Reasons       []store.EvictionReason
+	QueueSize     int           // entries waiting for delivery, 0 means 10000
+	BatchSize     int           // entries delivered at once, 0 means 100
+	FlushInterval time.Duration // longest a partial batch waits, 0 means 1s
+	// MaxRetries: deliveries of a batch retried before it is dropped, 0
+	// means 5, negative retries until Close
+	MaxRetries   int
+	RetryBackoff time.Duration // wait before the first retry, doubled each retry up to 30s, 0 means 100ms
+	Timeout      time.Duration // of each delivery, 0 means 10s
+	Overflow     OverflowPolicy
+}
+
+// EvictionBridgeStats: counts of the entries an EvictionBridge handled
+type EvictionBridgeStats struct {
+	Queued    int // waiting for delivery
+	Delivered int64
+	Dropped   int64 // by the overflow policy or after Close
+	Failed    int64 // dropped with their batch once its retries ran out
+	Skipped   int64 // values without a byte form
+}
+
+// EvictionBridge: deliver the entries leaving a cache to an EvictionSink in
+// batches from a bounded queue, retrying failed batches, so evicted values
+// can be persisted rather than lost. Plug OnEvicted into
+// CacheOptions.OnEvictedReason, or use WithEvictionBridge
+type EvictionBridge struct {
+	sink    EvictionSink
+	opts    EvictionBridgeOptions
+	queue   chan EvictedEntry
+	closing chan struct{} // closed by Close, the queue is flushed
+	done    chan struct{} // closed once the worker returned
+	once    sync.Once
+	// deliverCtx: ends deliveries still running once Close gives up
+	deliverCtx context.Context
+	cancel     context.CancelFunc
+
+	delivered, dropped, failed, skipped atomic.Int64
+}
+
+// NewEvictionBridge: a bridge delivering to sink, running until Close
+func NewEvictionBridge(sink EvictionSink, opts EvictionBridgeOptions) *EvictionBridge {
+	if len(opts.Reasons) == 0 {
+		opts.Reasons = []store.EvictionReason{store.EvictCapacity, store.EvictExpired}
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaultEvictionQueueSize
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultEvictionBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultEvictionFlush
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = defaultEvictionRetries
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = defaultEvictionBackoff
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultEvictionSinkTimeout
+	}
+	b := &EvictionBridge{
+		sink:    sink,
+		opts:    opts,
+		queue:   make(chan EvictedEntry, opts.QueueSize),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	b.deliverCtx, b.cancel = context.WithCancel(context.Background())
+	go b.run()
+	return b
+}
+
+// WithEvictionBridge: deliver the entries leaving the group's cache through
+// b, see EvictionBridge
+func WithEvictionBridge(b *EvictionBridge) GroupOption {
+	return func(o *CacheOptions) {
+		o.OnEvictedReason = b.OnEvicted
+	}
+}
+
+// OnEvicted: queue an entry leaving the cache for delivery if its reason is
+// delivered, for CacheOptions.OnEvictedReason
+func (b *EvictionBridge) OnEvicted(key string, value store.Value, reason store.EvictionReason) {
+	if !slices.Contains(b.opts.Reasons, reason) {
+		return
+	}
+	data, err := valueBytes(value)
+	if err != nil {
+		b.skipped.Add(1)
+		return
+	}
+	entry := EvictedEntry{Key: key, Value: data, Reason: reason, At: time.Now()}
+	select {
+	case <-b.closing:
+		b.dropped.Add(1)
+		return
+	default:
+	}
+	for {
+		select {
+		case b.queue <- entry:
+			return
+		default:
+		}
+		switch b.opts.Overflow {
+		case OverflowDropOldest:
+			select {
+			case <-b.queue:
+				b.dropped.Add(1)
+			default:
+			}
+		case OverflowBlock:
+			select {
+			case b.queue <- entry:
+			case <-b.done:
+				b.dropped.Add(1)
+			}
+			return
+		default:
+			b.dropped.Add(1)
+			return
+		}
+	}
+}
+
+// run: gather the queued entries into batches and deliver them until Close,
+// then deliver those left
+func (b *EvictionBridge) run() {
+	defer close(b.done)
+	defer recoverPanic("eviction bridge", nil)
+	ticker := time.NewTicker(b.opts.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]EvictedEntry, 0, b.opts.BatchSize)
+	for {
+		select {
+		case entry := <-b.queue:
+			if batch = append(batch, entry); len(batch) < b.opts.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		case <-b.closing:
+			b.flush(batch)
+			return
+		}
+		b.deliver(batch)
+		batch = batch[:0]
+	}
+}
+
+// flush: deliver batch and the entries still queued
+func (b *EvictionBridge) flush(batch []EvictedEntry) {
+	for {
+		select {
+		case entry := <-b.queue:
+			if batch = append(batch, entry); len(batch) < b.opts.BatchSize {
+				continue
+			}
+		default:
+			if len(batch) > 0 {
+				b.deliver(batch)
+			}
+			return
+		}
+		b.deliver(batch)
+		batch = batch[:0]
+	}
+}
+
+// deliver: send batch to the sink, retrying with backoff until it is
+// accepted, its retries ran out or Close gave up on it
+func (b *EvictionBridge) deliver(batch []EvictedEntry) {
+	backoff := b.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(b.deliverCtx, b.opts.Timeout)
+		err := b.sink.Deliver(ctx, batch)
+		cancel()
+		if err == nil {
+			b.delivered.Add(int64(len(batch)))
+			return
+		}
+		if b.opts.MaxRetries >= 0 && attempt >= b.opts.MaxRetries || b.deliverCtx.Err() != nil {
+			log.Printf("rebelcache: dropped %d evicted entries after %d deliveries: %v", len(batch), attempt+1, err)
+			b.failed.Add(int64(len(batch)))
+			return
+		}
+		select {
+		case <-b.deliverCtx.Done():
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxEvictionBackoff)
+	}
+}
+
+// Stats: counts of the entries handled so far
+func (b *EvictionBridge) Stats() EvictionBridgeStats {
+	return EvictionBridgeStats{
+		Queued:    len(b.queue),
+		Delivered: b.delivered.Load(),
+		Dropped:   b.dropped.Load(),
+		Failed:    b.failed.Load(),
+		Skipped:   b.skipped.Load(),
+	}
+}
+
+// Close: stop queueing entries and deliver those queued, giving up on them
+// once ctx ends. Entries leaving the cache afterwards are dropped
+func (b *EvictionBridge) Close(ctx context.Context) error {
+	b.once.Do(func() { close(b.closing) })
+	defer b.cancel()
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		<-b.done
+		return ctx.Err()
+	}
+}
+
+// SinkRecord: a message of a kafka-like topic
+type SinkRecord struct {
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+// RecordProducer: the part of a kafka-like producer NewProducerSink needs,
+// e.g. a thin adapter over a kafka client's synchronous writer
+type RecordProducer interface {
+	// Produce: write records, nil once all of them are acknowledged
+	Produce(ctx context.Context, records []SinkRecord) error
+}
+
+// NewProducerSink: an EvictionSink writing each entry as a record keyed by
+// the entry's key, so the entries of a key stay in order in one partition,
+// with headers reason and evicted_at, RFC 3339
+func NewProducerSink(p RecordProducer) EvictionSink {
+	return producerSink{p}
+}
+
+// producerSink: EvictionSink over a RecordProducer
+type producerSink struct {
+	p RecordProducer
+}
+
+// Deliver: implements EvictionSink
+func (s producerSink) Deliver(ctx context.Context, batch []EvictedEntry) error {
+	records := make([]SinkRecord, len(batch))
+	for i, entry := range batch {
+		records[i] = SinkRecord{
+			Key:   []byte(entry.Key),
+			Value: entry.Value,
+			Headers: map[string]string{
+				"reason":     entry.Reason.String(),
+				"evicted_at": entry.At.Format(time.RFC3339Nano),
+			},
+		}
+	}
+	return s.p.Produce(ctx, records)
+}
+
+// NewWebhookSink: an EvictionSink posting each batch to url as a json array
+// of objects with key, value in base64, reason and evicted_at, any 2xx
+// answer accepting it. A nil client means http.DefaultClient
+func NewWebhookSink(url string, client *http.Client) EvictionSink {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &webhookSink{url: url, client: client}
+}
+
+// webhookSink: EvictionSink posting to a webhook
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// webhookEntry: json of an entry posted to a webhook
+type webhookEntry struct {
+	Key       string    `json:"key"`
+	Value     []byte    `json:"value"`
+	Reason    string    `json:"reason"`
+	EvictedAt time.Time `json:"evicted_at"`
+}
+
+// Deliver: implements EvictionSink
+func (s *webhookSink) Deliver(ctx context.Context, batch []EvictedEntry) error {
+	entries := make([]webhookEntry, len(batch))
+	for i, entry := range batch {
+		entries[i] = webhookEntry{Key: entry.Key, Value: entry.Value, Reason: entry.Reason.String(), EvictedAt: entry.At}
+	}
+	body, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook %s: %s: %s", s.url, resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,79 @@
+package rebelcache
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// expvarStats: stats of a server in the expvar format, kept off the
+// process-wide expvar registry so several servers in a process don't collide
+type expvarStats struct {
+	srv *Server
+}
+
+// groups: the stats of every registered group, by name
+func (e expvarStats) groups() any {
+	stats := make(map[string]map[string]interface{})
+	e.srv.groups.Range(func(_, v any) bool {
+		g := v.(*Group)
+		stats[g.name] = g.Stats()
+		return true
+	})
+	return stats
+}
+
+// runtime: goroutine count and gc stats of the process
+func (e expvarStats) runtime() any {
+	var gc debug.GCStats
+	debug.ReadGCStats(&gc)
+	var lastPause time.Duration
+	if len(gc.Pause) > 0 {
+		lastPause = gc.Pause[0]
+	}
+	return map[string]any{
+		"goroutines":     runtime.NumGoroutine(),
+		"num_gc":         gc.NumGC,
+		"last_gc":        gc.LastGC,
+		"pause_total_ns": gc.PauseTotal.Nanoseconds(),
+		"last_pause_ns":  lastPause.Nanoseconds(),
+	}
+}
+
+// ExpvarHandler: cache stats of the groups, goroutine count and gc stats of
+// the node as expvar json, next to the vars published in the process like
+// cmdline and memstats. Served at /debug/vars of MetricsAddr when
+// ServerOptions.Expvar is set, callers it doesn't allow are rejected
+func (s *Server) ExpvarHandler() http.Handler {
+	e := expvarStats{srv: s}
+	vars := []struct {
+		name string
+		v    expvar.Var
+	}{
+		{"rebelcache_groups", expvar.Func(e.groups)},
+		{"rebelcache_runtime", expvar.Func(e.runtime)},
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, "{\n")
+		first := true
+		write := func(name string, v expvar.Var) {
+			if !first {
+				fmt.Fprint(w, ",\n")
+			}
+			first = false
+			quoted, _ := json.Marshal(name)
+			fmt.Fprintf(w, "%s: %s", quoted, v.String())
+		}
+		expvar.Do(func(kv expvar.KeyValue) { write(kv.Key, kv.Value) })
+		for _, v := range vars {
+			write(v.name, v.v)
+		}
+		fmt.Fprint(w, "\n}\n")
+	})
+	return s.allowlist.httpMiddleware(h)
+}
@@ -0,0 +1,191 @@
+package rebelcache
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FailoverOptions: options of a FailoverClient
+type FailoverOptions struct {
+	FailAfter     int           // consecutive failed calls to the primary before failing over, 0 means 5
+	ProbeInterval time.Duration // health probing of the primary while failed over, 0 means 5s
+	RecoverAfter  int           // consecutive healthy probes before failing back, 0 means 3
+	ProbeGroup    string        // group whose stats the probe asks for, any answer counts as healthy
+}
+
+// DefaultFailoverOptions: return default failover config
+func DefaultFailoverOptions() *FailoverOptions {
+	return &FailoverOptions{
+		FailAfter:     5,
+		ProbeInterval: 5 * time.Second,
+		RecoverAfter:  3,
+	}
+}
+
+// FailoverClient: a client preferring a primary cluster that fails over to a
+// standby cluster once the primary keeps failing, and fails back once probes
+// find the primary healthy again. A call is only sent to one cluster, the
+// call that trips the failover still returns its error
+type FailoverClient struct {
+	primary    *Client
+	standby    *Client
+	opts       FailoverOptions
+	failures   atomic.Int32 // consecutive failed calls to the primary
+	failedOver atomic.Bool
+	mtx        sync.Mutex
+	stopCh     chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewFailoverClient: create a failover client over clients of the primary and
+// the standby cluster, it owns them from then on. nil opts uses the defaults
+func NewFailoverClient(primary, standby *Client, opts *FailoverOptions) *FailoverClient {
+	defaults := DefaultFailoverOptions()
+	if opts == nil {
+		opts = defaults
+	}
+	f := &FailoverClient{primary: primary, standby: standby, opts: *opts, stopCh: make(chan struct{})}
+	if f.opts.FailAfter <= 0 {
+		f.opts.FailAfter = defaults.FailAfter
+	}
+	if f.opts.ProbeInterval <= 0 {
+		f.opts.ProbeInterval = defaults.ProbeInterval
+	}
+	if f.opts.RecoverAfter <= 0 {
+		f.opts.RecoverAfter = defaults.RecoverAfter
+	}
+	return f
+}
+
+// Get: get value by key from a group of the active cluster, see Client.Get
+func (f *FailoverClient) Get(ctx context.Context, group, key string) ([]byte, error) {
+	c := f.active()
+	value, err := c.Get(ctx, group, key)
+	f.record(c, err)
+	return value, err
+}
+
+// Set: set value by key in a group of the active cluster, see Client.Set
+func (f *FailoverClient) Set(ctx context.Context, group, key string, value []byte, ttl time.Duration) error {
+	c := f.active()
+	err := c.Set(ctx, group, key, value, ttl)
+	f.record(c, err)
+	return err
+}
+
+// Delete: delete value by key from a group of the active cluster, see Client.Delete
+func (f *FailoverClient) Delete(ctx context.Context, group, key string) (bool, error) {
+	c := f.active()
+	deleted, err := c.Delete(ctx, group, key)
+	f.record(c, err)
+	return deleted, err
+}
+
+// FailedOver: whether calls go to the standby cluster
+func (f *FailoverClient) FailedOver() bool {
+	return f.failedOver.Load()
+}
+
+// Close: stop probing and close both clients
+func (f *FailoverClient) Close() error {
+	f.mtx.Lock()
+	select {
+	case <-f.stopCh:
+	default:
+		close(f.stopCh)
+	}
+	f.mtx.Unlock()
+	f.wg.Wait()
+
+	err := f.primary.Close()
+	if serr := f.standby.Close(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// active: the client of the cluster calls go to
+func (f *FailoverClient) active() *Client {
+	if f.failedOver.Load() {
+		return f.standby
+	}
+	return f.primary
+}
+
+// record: count the outcome of a call to c, failing over once the primary failed FailAfter times in a row
+func (f *FailoverClient) record(c *Client, err error) {
+	if c != f.primary {
+		return
+	}
+	if !clusterFailure(err) {
+		f.failures.Store(0)
+		return
+	}
+	if int(f.failures.Add(1)) >= f.opts.FailAfter {
+		f.failOver(err)
+	}
+}
+
+// failOver: send calls to the standby and probe the primary until it recovers
+func (f *FailoverClient) failOver(cause error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	select {
+	case <-f.stopCh:
+		return
+	default:
+	}
+	if !f.failedOver.CompareAndSwap(false, true) {
+		return
+	}
+	log.Printf("rebelcache: primary cluster failing: %v, failing over to the standby", cause)
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.probe()
+	}()
+}
+
+// probe: probe the primary every ProbeInterval, failing back after RecoverAfter healthy probes in a row
+func (f *FailoverClient) probe() {
+	ticker := time.NewTicker(f.opts.ProbeInterval)
+	defer ticker.Stop()
+	healthy := 0
+	for {
+		select {
+		case <-f.stopCh:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), f.opts.ProbeInterval)
+		_, err := f.primary.grpcCli.Stats(ctx, &pb.StatsRequest{Group: f.opts.ProbeGroup})
+		cancel()
+		if clusterFailure(err) {
+			healthy = 0
+			continue
+		}
+		if healthy++; healthy >= f.opts.RecoverAfter {
+			f.failures.Store(0)
+			f.failedOver.Store(false)
+			log.Printf("rebelcache: primary cluster healthy again, failing back")
+			return
+		}
+	}
+}
+
+// clusterFailure: whether err means the cluster could not serve the call,
+// as opposed to an answer such as not found or read-only
+func clusterFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal:
+		return true
+	}
+	return false
+}
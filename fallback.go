@@ -0,0 +1,104 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+// SetFallback: read the keys the group misses from fallback before calling
+// its getter, layering caches, e.g. a group per region over a global one.
+// The getter only runs on keys fallback doesn't have or can't be read from,
+// values found are cached with the group's ttl. fallback is read like a
+// caller would, routed by its own peers, a Group or a group of another
+// cluster, see RemoteGroup. nil removes it. It panics if fallback is a Group
+// falling back to g, cycles across processes are not detected
+func (g *Group) SetFallback(fallback GroupGetter) {
+	for next := fallback; next != nil; {
+		f, ok := next.(*Group)
+		if !ok {
+			break
+		}
+		if f == g {
+			panic(fmt.Sprintf("rebelcache: group %q falling back to %q makes a cycle", g.name, fallback.Name()))
+		}
+		next = f.getFallback()
+	}
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.fallback = fallback
+}
+
+// getFallback: the group's fallback, nil if it has none
+func (g *Group) getFallback() GroupGetter {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.fallback
+}
+
+// fromFallback: key read from the group's fallback, ok is false if it has
+// none or it didn't answer with a value, the getter is called then
+func (g *Group) fromFallback(ctx context.Context, key string) (value store.Value, ok bool) {
+	fallback := g.getFallback()
+	if fallback == nil {
+		return nil, false
+	}
+	value, err := fallback.Get(unrouted(ctx), key)
+	switch {
+	case err == nil && value != nil:
+		g.fallbackHits.Add(1)
+		return value, true
+	case err == nil, errors.Is(err, ErrNotFound):
+		g.fallbackMisses.Add(1)
+	default:
+		g.fallbackErrors.Add(1)
+		if ctx.Err() == nil {
+			log.Printf("rebelcache: get %s from fallback group %s of %s: %v, loading", FormatKey(key), fallback.Name(), g.name, err)
+		}
+	}
+	return nil, false
+}
+
+// unrouted: ctx without the marks of the incoming rpc telling how it was
+// routed, so a read of another group made while serving it is routed anew
+func unrouted(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(forwardedKey)) == 0 && len(md.Get(replicaKey)) == 0 {
+		return ctx
+	}
+	md = md.Copy()
+	md.Delete(forwardedKey)
+	md.Delete(replicaKey)
+	return metadata.NewIncomingContext(ctx, md)
+}
+
+// RemoteGroup: the group named group as read through c, e.g. to fall back
+// to a group of another cluster, see Group.SetFallback
+func RemoteGroup(c *Client, group string) GroupGetter {
+	return remoteGroup{c: c, name: group}
+}
+
+// remoteGroup: GroupGetter over a Client
+type remoteGroup struct {
+	c    *Client
+	name string
+}
+
+// Name: implements GroupGetter
+func (r remoteGroup) Name() string {
+	return r.name
+}
+
+// Get: implements GroupGetter
+func (r remoteGroup) Get(ctx context.Context, key string) (store.Value, error) {
+	value, err := r.c.Get(ctx, r.name, key)
+	if err != nil {
+		return nil, err
+	}
+	return byteViewOf(value), nil
+}
@@ -0,0 +1,37 @@
+package rebelcache
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// forwardedKey: rpc metadata marking a request one node forwarded to another
+const forwardedKey = "rebelcache-forwarded"
+
+// withForwarded: mark the outgoing rpcs of ctx as forwarded
+func withForwarded(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, forwardedKey, "1")
+}
+
+// isForwarded: whether the incoming rpc of ctx was forwarded by another node
+func isForwarded(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	return ok && len(md.Get(forwardedKey)) > 0
+}
+
+// ownerKey: rpc metadata marking a write forwarded to the owner of its key,
+// which applies it at the request's consistency level and copies it to the
+// replicas as if a client sent it, unlike the copies the replicas get
+const ownerKey = "rebelcache-owner"
+
+// withOwnerWrite: mark the outgoing rpcs of ctx as writes forwarded to the owner
+func withOwnerWrite(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(withForwarded(ctx), ownerKey, "1")
+}
+
+// isOwnerWrite: whether the incoming rpc of ctx is a write forwarded to the owner
+func isOwnerWrite(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	return ok && len(md.Get(ownerKey)) > 0
+}
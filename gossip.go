@@ -0,0 +1,487 @@
+package rebelcache
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Discovery backends of ServerOptions.Discovery
+const (
+	DiscoveryEtcd      = "etcd"      // nodes register in etcd, see Discovery
+	DiscoveryConsul    = "consul"    // nodes register in consul, see ConsulOptions
+	DiscoveryZooKeeper = "zookeeper" // nodes register in zookeeper, see ZooKeeperOptions
+	DiscoveryGossip    = "gossip"    // nodes find each other by gossip, see Gossip
+	DiscoveryStatic    = "static"    // nodes are listed in the config, see StaticOptions
+	DiscoveryDNS       = "dns"       // nodes are the records of a DNS name, see DNSOptions
+)
+
+const (
+	defaultGossipAddr     = ":7946"
+	defaultProbeInterval  = time.Second
+	defaultProbeTimeout   = 500 * time.Millisecond
+	defaultSuspicionTime  = 5 * time.Second
+	defaultIndirectProbes = 3
+	gossipTombstones      = 10 // suspicion timeouts dead members are remembered, so stale gossip can't revive them
+	maxGossipMessage      = 64 << 10
+	gossipPing            = "ping"
+	gossipAck             = "ack"
+	gossipPingReq         = "ping-req"
+	gossipLeave           = "leave"
+	memberAlive           = 0
+	memberSuspect         = 1
+	memberDead            = 2
+)
+
+// GossipOptions: membership by gossip, see ServerOptions.Discovery. Nodes
+// probe a random member each ProbeInterval over udp, asking IndirectProbes
+// others to probe it too when it doesn't answer, and suspect it once none
+// could reach it. A suspect refuting the suspicion stays, one that doesn't
+// within SuspicionTimeout is dropped from the ring. The state of every
+// member travels with each message, fit for clusters of a few hundred
+// nodes. Zero fields take defaults
+type GossipOptions struct {
+	BindAddr string // udp addr gossip is served on, empty means :7946
+	// AdvertiseAddr: udp addr the other members reach the node at, empty
+	// means BindAddr, with the host of the node's grpc addr if it has none
+	AdvertiseAddr    string
+	Seeds            []string      // gossip addrs of members to join through, retried while no member answers
+	ProbeInterval    time.Duration // 0 means 1s
+	ProbeTimeout     time.Duration // wait of a direct probe, 0 means 500ms
+	SuspicionTimeout time.Duration // 0 means 5s
+	IndirectProbes   int           // members asked to probe a silent member, 0 means 3
+}
+
+// gossipMember: what a node knows of a member, identified by its grpc addr
+type gossipMember struct {
+	Addr        string `json:"addr"`
+	Gossip      string `json:"gossip"`
+	Incarnation uint64 `json:"incarnation"` // raised by the member to refute suspicions of it
+	State       int    `json:"state"`
+
+	since time.Time // when the member entered its state
+}
+
+// gossipMessage: a udp datagram between members
+type gossipMessage struct {
+	Cluster string         `json:"cluster"`
+	Type    string         `json:"type"`
+	Seq     uint64         `json:"seq,omitempty"`
+	From    string         `json:"from"`             // gossip addr of the sender
+	Target  string         `json:"target,omitempty"` // member a ping-req asks to probe
+	Members []gossipMember `json:"members"`
+}
+
+// Gossip: maintains the live peer list of a cluster by gossiping with its
+// members, for clusters without etcd, see GossipOptions
+type Gossip struct {
+	self     gossipMember
+	cluster  string
+	opts     GossipOptions
+	onChange func(peers []string) // called with the sorted peer list after each change
+	conn     net.PacketConn
+
+	mtx     sync.Mutex
+	members map[string]*gossipMember // grpc addr -> member, self excluded
+	pending map[uint64]func()        // seq -> call on its ack
+	seq     uint64
+	probes  []string // members left to probe this round
+	// notifyMtx: orders the calls of onChange, held before mtx
+	notifyMtx sync.Mutex
+	peers     []string // last peer list passed to onChange
+
+	loops    *supervisor // the read and probe loops, nil until Start
+	stopOnce sync.Once
+}
+
+// NewGossip: create the gossip of the node serving grpc on addr in cluster
+// svc, onChange may be nil
+func NewGossip(addr string, svc ServiceName, opts GossipOptions, onChange func(peers []string)) *Gossip {
+	if opts.BindAddr == "" {
+		opts.BindAddr = defaultGossipAddr
+	}
+	if opts.ProbeInterval <= 0 {
+		opts.ProbeInterval = defaultProbeInterval
+	}
+	if opts.ProbeTimeout <= 0 {
+		opts.ProbeTimeout = defaultProbeTimeout
+	}
+	if opts.ProbeTimeout >= opts.ProbeInterval {
+		opts.ProbeTimeout = opts.ProbeInterval / 2
+	}
+	if opts.SuspicionTimeout <= 0 {
+		opts.SuspicionTimeout = defaultSuspicionTime
+	}
+	if opts.IndirectProbes <= 0 {
+		opts.IndirectProbes = defaultIndirectProbes
+	}
+	return &Gossip{
+		self:     gossipMember{Addr: addr},
+		cluster:  svc.String(),
+		opts:     opts,
+		onChange: onChange,
+		members:  make(map[string]*gossipMember),
+		pending:  make(map[uint64]func()),
+	}
+}
+
+// Start: listen for gossip, join the seeds and keep probing the members in
+// the background until Stop
+func (g *Gossip) Start(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", g.opts.BindAddr)
+	if err != nil {
+		return err
+	}
+	g.conn = conn
+	g.self.Gossip = g.advertised()
+	g.notify()
+
+	g.loops = newSupervisor(context.WithoutCancel(ctx))
+	g.loops.Go("gossip reads", RestartOnFailure, g.readLoop)
+	g.loops.Go("gossip probes", RestartOnFailure, g.probeLoop)
+	return nil
+}
+
+// Stop: tell the members the node leaves and stop gossiping
+func (g *Gossip) Stop() {
+	if g.loops == nil {
+		return
+	}
+	g.stopOnce.Do(func() {
+		// the loops see they are stopped before the conn closes under them
+		g.loops.cancel()
+		g.leave()
+		g.conn.Close()
+		g.loops.Stop()
+	})
+}
+
+// Peers: sorted grpc addrs of the members not known to be dead, the local
+// node included
+func (g *Gossip) Peers() []string {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.peersLocked()
+}
+
+// advertised: the gossip addr of the node, see GossipOptions.AdvertiseAddr
+func (g *Gossip) advertised() string {
+	if g.opts.AdvertiseAddr != "" {
+		return g.opts.AdvertiseAddr
+	}
+	host, _, _ := net.SplitHostPort(g.opts.BindAddr)
+	_, port, _ := net.SplitHostPort(g.conn.LocalAddr().String())
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host, _, _ = net.SplitHostPort(g.self.Addr)
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// probeLoop: probe a member each ProbeInterval, and the seeds while no
+// member is known
+func (g *Gossip) probeLoop(ctx context.Context) error {
+	ticker := time.NewTicker(g.opts.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		g.mtx.Lock()
+		alone := !slices.ContainsFunc(g.sortedLocked(), func(m *gossipMember) bool { return m.State != memberDead })
+		g.mtx.Unlock()
+		if alone {
+			for _, seed := range g.opts.Seeds {
+				if seed != g.self.Gossip {
+					g.send(seed, gossipMessage{Type: gossipPing, Seq: g.nextSeq(nil)})
+				}
+			}
+		} else if target := g.nextProbe(); target != nil {
+			g.probe(ctx, target)
+		}
+		g.expire()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// nextProbe: the next live member to probe, members are probed once per
+// round in random order
+func (g *Gossip) nextProbe() *gossipMember {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	for range 2 {
+		for len(g.probes) > 0 {
+			m, ok := g.members[g.probes[0]]
+			g.probes = g.probes[1:]
+			if ok && m.State != memberDead {
+				copied := *m
+				return &copied
+			}
+		}
+		for addr, m := range g.members {
+			if m.State != memberDead {
+				g.probes = append(g.probes, addr)
+			}
+		}
+		rand.Shuffle(len(g.probes), func(i, j int) { g.probes[i], g.probes[j] = g.probes[j], g.probes[i] })
+	}
+	return nil
+}
+
+// probe: ping m, through other members if it doesn't answer, and suspect
+// it if none of them reaches it within the probe interval
+func (g *Gossip) probe(ctx context.Context, m *gossipMember) {
+	acked := make(chan struct{}, 1)
+	ack := func() {
+		select {
+		case acked <- struct{}{}:
+		default:
+		}
+	}
+	seq := g.nextSeq(ack)
+	defer g.dropSeq(seq)
+	g.send(m.Gossip, gossipMessage{Type: gossipPing, Seq: seq})
+
+	timer := time.NewTimer(g.opts.ProbeTimeout)
+	defer timer.Stop()
+	select {
+	case <-acked:
+		return
+	case <-ctx.Done():
+		return
+	case <-timer.C:
+	}
+	for _, relay := range g.relays(m.Addr) {
+		g.send(relay, gossipMessage{Type: gossipPingReq, Seq: seq, Target: m.Gossip})
+	}
+	timer.Reset(g.opts.ProbeInterval - g.opts.ProbeTimeout)
+	select {
+	case <-acked:
+		return
+	case <-ctx.Done():
+		return
+	case <-timer.C:
+	}
+	g.suspect(m)
+}
+
+// relays: gossip addrs of up to IndirectProbes live members other than addr
+func (g *Gossip) relays(addr string) []string {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	var relays []string
+	for _, m := range g.members {
+		if m.Addr != addr && m.State == memberAlive {
+			relays = append(relays, m.Gossip)
+		}
+	}
+	rand.Shuffle(len(relays), func(i, j int) { relays[i], relays[j] = relays[j], relays[i] })
+	return relays[:min(len(relays), g.opts.IndirectProbes)]
+}
+
+// suspect: mark m suspect unless it refuted a suspicion since it was probed
+func (g *Gossip) suspect(m *gossipMember) {
+	g.mtx.Lock()
+	known, ok := g.members[m.Addr]
+	if !ok || known.Incarnation != m.Incarnation || known.State != memberAlive {
+		g.mtx.Unlock()
+		return
+	}
+	known.State, known.since = memberSuspect, time.Now()
+	g.mtx.Unlock()
+	log.Printf("rebelcache: gossip: member %s suspected", m.Addr)
+}
+
+// expire: declare dead the suspects past the suspicion timeout and forget
+// the dead past their tombstone
+func (g *Gossip) expire() {
+	g.mtx.Lock()
+	for addr, m := range g.members {
+		switch age := time.Since(m.since); {
+		case m.State == memberSuspect && age > g.opts.SuspicionTimeout:
+			m.State, m.since = memberDead, time.Now()
+			log.Printf("rebelcache: gossip: member %s dead", addr)
+		case m.State == memberDead && age > gossipTombstones*g.opts.SuspicionTimeout:
+			delete(g.members, addr)
+		}
+	}
+	g.mtx.Unlock()
+	g.notify()
+}
+
+// readLoop: handle the messages received until the conn is closed
+func (g *Gossip) readLoop(context.Context) error {
+	buf := make([]byte, maxGossipMessage)
+	for {
+		n, from, err := g.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				// closed by Stop, once it stopped the loops
+				return nil
+			}
+			continue
+		}
+		var msg gossipMessage
+		if err := json.Unmarshal(buf[:n], &msg); err != nil || msg.Cluster != g.cluster {
+			continue
+		}
+		if msg.From == "" {
+			msg.From = from.String()
+		}
+		g.handle(msg)
+	}
+}
+
+// handle: merge the members msg carries and answer it
+func (g *Gossip) handle(msg gossipMessage) {
+	g.merge(msg.Members)
+	switch msg.Type {
+	case gossipPing:
+		g.send(msg.From, gossipMessage{Type: gossipAck, Seq: msg.Seq})
+	case gossipPingReq:
+		// relay the target's ack under the seq of the member asking
+		seq := g.nextSeq(func() {
+			g.send(msg.From, gossipMessage{Type: gossipAck, Seq: msg.Seq})
+		})
+		g.send(msg.Target, gossipMessage{Type: gossipPing, Seq: seq})
+		time.AfterFunc(g.opts.ProbeInterval, func() { g.dropSeq(seq) })
+	case gossipAck:
+		g.mtx.Lock()
+		ack := g.pending[msg.Seq]
+		g.mtx.Unlock()
+		if ack != nil {
+			ack()
+		}
+	}
+}
+
+// merge: update the members with what another member knows of them. Higher
+// incarnations win, then the worse state. Suspicions of the local node are
+// refuted with a higher incarnation
+func (g *Gossip) merge(members []gossipMember) {
+	g.mtx.Lock()
+	for _, m := range members {
+		if m.Addr == g.self.Addr {
+			if m.State != memberAlive && m.Incarnation >= g.self.Incarnation {
+				g.self.Incarnation = m.Incarnation + 1
+			}
+			continue
+		}
+		known, ok := g.members[m.Addr]
+		switch {
+		case !ok:
+			m.since = time.Now()
+			g.members[m.Addr] = &m
+		case m.Incarnation > known.Incarnation, m.Incarnation == known.Incarnation && m.State > known.State:
+			if m.State != known.State {
+				known.since = time.Now()
+			}
+			known.Gossip, known.Incarnation, known.State = m.Gossip, m.Incarnation, m.State
+		}
+	}
+	g.mtx.Unlock()
+	g.notify()
+}
+
+// leave: tell the live members the node leaves
+func (g *Gossip) leave() {
+	g.mtx.Lock()
+	g.self.Incarnation++
+	g.self.State = memberDead
+	var addrs []string
+	for _, m := range g.members {
+		if m.State != memberDead {
+			addrs = append(addrs, m.Gossip)
+		}
+	}
+	g.mtx.Unlock()
+	for _, addr := range addrs {
+		g.send(addr, gossipMessage{Type: gossipLeave})
+	}
+}
+
+// send: send msg to the member at the gossip addr to, with the members known
+func (g *Gossip) send(to string, msg gossipMessage) {
+	addr, err := net.ResolveUDPAddr("udp", to)
+	if err != nil {
+		log.Printf("rebelcache: gossip: resolve %s: %v", to, err)
+		return
+	}
+	g.mtx.Lock()
+	msg.Cluster, msg.From = g.cluster, g.self.Gossip
+	msg.Members = append(msg.Members, g.self)
+	for _, m := range g.sortedLocked() {
+		msg.Members = append(msg.Members, *m)
+	}
+	g.mtx.Unlock()
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	if _, err := g.conn.WriteTo(b, addr); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("rebelcache: gossip: send to %s: %v", to, err)
+	}
+}
+
+// nextSeq: a new sequence number, ack is called on its ack if not nil
+func (g *Gossip) nextSeq(ack func()) uint64 {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.seq++
+	if ack != nil {
+		g.pending[g.seq] = ack
+	}
+	return g.seq
+}
+
+// dropSeq: stop waiting for the ack of seq
+func (g *Gossip) dropSeq(seq uint64) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	delete(g.pending, seq)
+}
+
+// notify: pass the peer list to onChange if it changed
+func (g *Gossip) notify() {
+	g.notifyMtx.Lock()
+	defer g.notifyMtx.Unlock()
+	g.mtx.Lock()
+	peers := g.peersLocked()
+	changed := !slices.Equal(peers, g.peers)
+	g.peers = peers
+	g.mtx.Unlock()
+	if changed && g.onChange != nil {
+		g.onChange(peers)
+	}
+}
+
+// peersLocked: see Peers
+// Note: lock must be held before calling this function.
+func (g *Gossip) peersLocked() []string {
+	peers := []string{g.self.Addr}
+	for addr, m := range g.members {
+		if m.State != memberDead {
+			peers = append(peers, addr)
+		}
+	}
+	slices.Sort(peers)
+	return peers
+}
+
+// sortedLocked: the members in addr order
+// Note: lock must be held before calling this function.
+func (g *Gossip) sortedLocked() []*gossipMember {
+	members := make([]*gossipMember, 0, len(g.members))
+	for _, m := range g.members {
+		members = append(members, m)
+	}
+	slices.SortFunc(members, func(a, b *gossipMember) int { return cmp.Compare(a.Addr, b.Addr) })
+	return members
+}
@@ -0,0 +1,645 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// ErrGroupNotFound: returned when an rpc names an unknown group
+var ErrGroupNotFound = errors.New("rebelcache: group not found")
+
+// ErrReadOnly: returned by writes to a read-only group or node
+var ErrReadOnly = errors.New("rebelcache: read-only")
+
+// groupRegistry: all live groups by name
+var groupRegistry sync.Map
+
+// Getter: loads the value of a key missing from a group's cache
+type Getter interface {
+	Get(ctx context.Context, key string) (store.Value, error)
+}
+
+// GetterFunc: adapts a function to Getter
+type GetterFunc func(ctx context.Context, key string) (store.Value, error)
+
+// Get: call f
+func (f GetterFunc) Get(ctx context.Context, key string) (store.Value, error) {
+	return f(ctx, key)
+}
+
+// GroupGetter: the reads of a named group, implemented by Group, so code
+// reading through a group can take a wrapper or a fake of it instead
+type GroupGetter interface {
+	Name() string
+	Get(ctx context.Context, key string) (store.Value, error)
+}
+
+var _ GroupGetter = (*Group)(nil)
+
+// Group: a namespaced cache with its own store and loader
+type Group struct {
+	name        string             // group name, unique in the process
+	getter      Getter             // loads values on cache miss
+	cache       *Cache             // the group's cache
+	peers       PeerPicker         // owners of remote keys, nil serves every key locally
+	flights     singleflight.Group // in-flight peer fetches and uncached loads by key
+	served      *segmentRates      // gets served locally by ring position, see Server.Ownership
+	mtx         sync.Mutex
+	closed      bool
+	readOnly    atomic.Bool  // writes are rejected with ErrReadOnly, reads and loads go on
+	deps        *depGraph    // keys derived from other keys, see DependsOn
+	invalidated atomic.Int64 // derived keys deleted after their inputs changed
+
+	// prefetches, see Prefetch
+	prefetchRate    *rate.Limiter
+	prefetching     sync.Map     // keys queued or being prefetched
+	prefetchPending atomic.Int64 // keys in prefetching
+	prefetched      atomic.Int64 // keys warmed
+	prefetchDropped atomic.Int64 // keys dropped over the queue limit or at the deadline
+	prefetchErrors  atomic.Int64 // keys whose prefetch failed
+	closing         context.Context
+	stopPrefetch    context.CancelFunc // cancels closing
+
+	hot hotFlags // keys flagged hot by their owner, see HotKeyOptions
+
+	// replication, see ServerOptions.ReplicaCount
+	replicaWriteErrors atomic.Int64 // writes not copied to a replica
+	replicaReads       atomic.Int64 // gets served by a replica of an unreachable owner
+	readRepairs        atomic.Int64 // replica copies overwritten by read repair
+	repairing          atomic.Int32 // read repairs running
+	hintsPending       atomic.Int64 // writes kept for replicas that missed them, see HintOptions
+	hintsReplayed      atomic.Int64 // hints applied on their replica
+	hintsDropped       atomic.Int64 // hints dropped past their ttl or the bounds of the hint store
+
+	// scheduled refreshes, see RefreshRule
+	refreshed     atomic.Int64 // keys reloaded
+	refreshErrors atomic.Int64 // keys whose reload failed
+
+	// reads from the fallback group, see SetFallback
+	fallback       GroupGetter
+	fallbackHits   atomic.Int64 // keys the fallback had
+	fallbackMisses atomic.Int64 // keys the fallback didn't have
+	fallbackErrors atomic.Int64 // keys the fallback failed to read
+
+	rebalanced atomic.Int64 // keys handed off to their new owner, see RebalanceOptions
+
+	// tasks: prefetches, invalidations of peers, copies to replicas and read
+	// repairs in the background, joined by Close and waited for by Server.Stop
+	tasks tasks
+	// invalidations: derived keys waiting to be deleted on the peers
+	invalidations peerInvalidations
+}
+
+// GroupOption: configures a group
+type GroupOption func(opts *CacheOptions)
+
+// WithCacheOptions: use opts for the group's cache, MaxBytes is still set from cacheBytes
+func WithCacheOptions(opts CacheOptions) GroupOption {
+	return func(o *CacheOptions) {
+		maxBytes := o.MaxBytes
+		*o = opts
+		o.MaxBytes = maxBytes
+	}
+}
+
+// WithExpiration: default ttl of entries in the group
+func WithExpiration(ttl time.Duration) GroupOption {
+	return func(o *CacheOptions) {
+		o.DefaultTTL = ttl
+	}
+}
+
+// WithSetDedup: acknowledge sets repeating the key's last set within window
+// without writing them, see CacheOptions.SetDedupWindow
+func WithSetDedup(window time.Duration) GroupOption {
+	return func(o *CacheOptions) {
+		o.SetDedupWindow = window
+	}
+}
+
+// WithHotWrites: coalesce the events watchers get of keys written at extreme
+// rates, see CacheOptions.HotWrites
+func WithHotWrites(opts HotWriteOptions) GroupOption {
+	return func(o *CacheOptions) {
+		o.HotWrites = &opts
+	}
+}
+
+// WithTopKeys: track the read rates of the n hottest keys of the group, see
+// CacheOptions.TopKeys
+func WithTopKeys(n int) GroupOption {
+	return func(o *CacheOptions) {
+		o.TopKeys = n
+	}
+}
+
+// WithCompression: store values of the group above a size threshold
+// compressed, see CacheOptions.Compression
+func WithCompression(opts CompressionOptions) GroupOption {
+	return func(o *CacheOptions) {
+		o.Compression = &opts
+	}
+}
+
+// WithLifetimes: count how the entries of the group were read by the time
+// they leave the cache, see CacheOptions.Lifetimes
+func WithLifetimes() GroupOption {
+	return func(o *CacheOptions) {
+		o.Lifetimes = true
+	}
+}
+
+// NewGroup: create and register a group, it panics on a nil getter or a duplicate name
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
+	if getter == nil {
+		panic("rebelcache: nil Getter")
+	}
+	cacheOpts := DefaultCacheOptions()
+	cacheOpts.MaxBytes = cacheBytes
+	for _, opt := range opts {
+		opt(&cacheOpts)
+	}
+
+	g := &Group{
+		name:         name,
+		getter:       getter,
+		cache:        NewCache(cacheOpts),
+		served:       newSegmentRates(),
+		deps:         newDepGraph(),
+		prefetchRate: newLimiter(defaultPrefetchRate, defaultPrefetchBurst),
+	}
+	g.closing, g.stopPrefetch = context.WithCancel(context.Background())
+	if _, dup := groupRegistry.LoadOrStore(name, g); dup {
+		g.stopPrefetch()
+		panic(fmt.Sprintf("rebelcache: duplicate registration of group %q", name))
+	}
+	return g
+}
+
+// GetGroup: return the group registered under name, or nil
+func GetGroup(name string) *Group {
+	if g, ok := groupRegistry.Load(name); ok {
+		return g.(*Group)
+	}
+	return nil
+}
+
+// Name: the group name
+func (g *Group) Name() string {
+	return g.name
+}
+
+// RegisterPeers: route keys owned by other nodes to them, it panics if called more than once
+func (g *Group) RegisterPeers(peers PeerPicker) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if g.peers != nil {
+		panic(fmt.Sprintf("rebelcache: RegisterPeers called more than once on group %q", g.name))
+	}
+	g.peers = peers
+}
+
+// getFromPeer: get a key owned by peer, from the local cache if present, else
+// from the owner. If the owner cannot be reached the key is loaded locally
+// without being cached, the owner stays the only node caching it.
+// Concurrent misses of a key share one fetch
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (store.Value, error) {
+	if value, ok := g.cache.Get(key); ok {
+		return value, nil
+	}
+	if trace := traceFromContext(ctx); trace != nil {
+		trace.missed.Store(true)
+	}
+	return g.shared(ctx, key, func(ctx context.Context) (store.Value, error) {
+		value, hot, err := getFlagged(ctx, peer, g.name, key)
+		if err == nil {
+			if hot {
+				g.markHot(key)
+			}
+			return byteViewOf(value), nil
+		}
+		if status.Code(err) != codes.Unavailable {
+			return nil, err
+		}
+		if value, ok := g.getFromReplicas(ctx, key); ok {
+			return value, nil
+		}
+		log.Printf("rebelcache: get %s from peer: %v, loading locally", FormatKey(key), err)
+		return g.loadUncached(ctx, key)
+	})
+}
+
+// loadUncached: call the getter for key without caching the result, if the
+// caller's deadline leaves enough for a load
+func (g *Group) loadUncached(ctx context.Context, key string) (store.Value, error) {
+	if err := checkBudget(ctx, g.cache.opts.MinLoadBudget, "load"); err != nil {
+		return nil, err
+	}
+	return g.load(ctx, key)
+}
+
+// shared: call fn once for all concurrent callers asking for key, like
+// Cache.GetOrLoad does for loads that fill the cache. fn runs under the
+// deadline of the first caller, not its cancellation, each caller stops
+// waiting on its own ctx
+func (g *Group) shared(ctx context.Context, key string, fn func(ctx context.Context) (store.Value, error)) (store.Value, error) {
+	ch := g.flights.DoChan(key, func() (_ interface{}, err error) {
+		// singleflight rethrows panics where nobody can recover them
+		defer recoverPanic("load", &err)
+		ctx, cancel := detachBudget(ctx)
+		defer cancel()
+		return fn(ctx)
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		value, _ := res.Val.(store.Value)
+		return value, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// load: read key from the group's fallback, else call the getter for it,
+// traced as a span of the request
+func (g *Group) load(ctx context.Context, key string) (store.Value, error) {
+	ctx, span := tracerFor(ctx, nil).Start(ctx, "rebelcache.load",
+		trace.WithAttributes(attribute.String("rebelcache.group", g.name)))
+	if value, ok := g.fromFallback(ctx, key); ok {
+		endSpan(span, nil)
+		return value, nil
+	}
+	value, err := g.getter.Get(ctx, key)
+	if err == nil && value != nil {
+		if err = checkPlain(value); err != nil {
+			err = fmt.Errorf("load of %s: %w", FormatKey(key), err)
+		}
+	}
+	endSpan(span, err)
+	return value, err
+}
+
+// pickPeer: the remote owner of key, if any
+func (g *Group) pickPeer(key string) (PeerGetter, bool) {
+	g.mtx.Lock()
+	peers := g.peers
+	g.mtx.Unlock()
+	if peers == nil {
+		return nil, false
+	}
+	return peers.PickPeer(key)
+}
+
+// Get: get value by key; keys owned by a peer are fetched from it on a
+// local miss, others are loaded with the group's getter on a miss
+func (g *Group) Get(ctx context.Context, key string) (store.Value, error) {
+	if key == "" {
+		return nil, fmt.Errorf("%w: empty key", ErrInvalidKey)
+	}
+	// owners are picked by the normalized key so all spellings of a key meet on one node
+	norm, err := g.cache.opts.KeyPolicy.Apply(key)
+	if err != nil {
+		return nil, err
+	}
+	if level, _ := consistencyFrom(ctx); level != ConsistencyOne && !isForwarded(ctx) {
+		if value, ok, err := g.getConsistent(ctx, key, norm, level); ok {
+			return value, err
+		}
+	}
+	// a forwarded request is served here whatever our ring says, so nodes
+	// whose rings disagree cannot bounce a key between them
+	switch {
+	case isReplicaRead(ctx):
+		if peer, ok := g.pickPeer(norm); ok {
+			return g.getReplica(ctx, peer, key, norm)
+		}
+	case !isForwarded(ctx):
+		if peer, ok := g.pickPeer(norm); ok {
+			if value, hot, err := g.getHot(ctx, peer, key, norm); hot {
+				return value, err
+			}
+			return g.getFromPeer(ctx, peer, key)
+		}
+	}
+	g.served.record(keyHash(g.ring(), norm))
+	trace := traceFromContext(ctx)
+	if trace != nil && trace.noFill {
+		// a scan: serve hits, load misses without letting them evict the working set
+		if value, ok := g.cache.Get(key); ok {
+			return value, nil
+		}
+		trace.missed.Store(true)
+		return g.shared(ctx, key, func(ctx context.Context) (store.Value, error) {
+			return g.loadUncached(ctx, key)
+		})
+	}
+	ctx = WithOrigin(ctx, "loader:"+g.name)
+	value, err := g.cache.GetOrLoad(ctx, key, func(ctx context.Context) (store.Value, time.Duration, error) {
+		if trace != nil {
+			trace.missed.Store(true)
+		}
+		value, err := g.load(ctx, key)
+		return value, 0, err
+	})
+	if err == nil && value != nil {
+		g.readRepair(key, norm, value)
+	}
+	return value, err
+}
+
+// Set: set value by key with the group's default ttl
+func (g *Group) Set(ctx context.Context, key string, value store.Value) error {
+	return g.SetWithExpiration(ctx, key, value, 0)
+}
+
+// SetWithExpiration: set value by key, ttl <= 0 means the group's default ttl
+// and NoExpiration none.
+// Keys derived from it are deleted, see DependsOn. A value starting as the
+// collections do is ErrReservedValue
+func (g *Group) SetWithExpiration(ctx context.Context, key string, value store.Value, ttl time.Duration) error {
+	if err := g.checkWritable(); err != nil {
+		return err
+	}
+	if key == "" {
+		return fmt.Errorf("%w: empty key", ErrInvalidKey)
+	}
+	if err := checkWrite(ctx, value); err != nil {
+		return err
+	}
+	written, err := g.cache.setUnlessDuplicate(key, value, ttl, originFromContext(ctx, "client"))
+	if err != nil || !written {
+		return err
+	}
+	g.invalidateDependents(ctx, key)
+	return g.replicateSet(ctx, key, value, ttl)
+}
+
+// SetNX: set value by key only if it is absent, return whether it was set.
+// The condition is checked on the key's owner, so callers on any node agree
+// on one winner, and an unreachable owner fails the set. A set is copied to
+// the replicas by the owner and deletes derived keys as SetWithExpiration
+// does, a copy here of a key a peer owns is dropped
+func (g *Group) SetNX(ctx context.Context, key string, value store.Value, ttl time.Duration) (bool, error) {
+	return g.setIf(ctx, key, value, ttl, &pb.SetRequest{IfAbsent: true}, func() (bool, error) {
+		return g.cache.SetNX(key, value, ttl)
+	})
+}
+
+// SetXX: set value by key only if it is present, see SetNX
+func (g *Group) SetXX(ctx context.Context, key string, value store.Value, ttl time.Duration) (bool, error) {
+	return g.setIf(ctx, key, value, ttl, &pb.SetRequest{IfPresent: true}, func() (bool, error) {
+		return g.cache.SetXX(key, value, ttl)
+	})
+}
+
+// CompareAndSwap: set value by key only if the version of its entry on the
+// key's owner equals version, 0 meaning absent, see GetWithVersion and SetNX
+func (g *Group) CompareAndSwap(ctx context.Context, key string, version uint64, value store.Value, ttl time.Duration) (bool, error) {
+	return g.setIf(ctx, key, value, ttl, &pb.SetRequest{IfVersion: &version}, func() (bool, error) {
+		return g.cache.CompareAndSwap(key, version, value, ttl)
+	})
+}
+
+// GetWithVersion: the cached value of key on its owner and the version of
+// its entry there, for CompareAndSwap. A miss isn't loaded, the value is nil
+func (g *Group) GetWithVersion(ctx context.Context, key string) (store.Value, uint64, error) {
+	if key == "" {
+		return nil, 0, fmt.Errorf("%w: empty key", ErrInvalidKey)
+	}
+	norm, err := g.cache.opts.KeyPolicy.Apply(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !isForwarded(ctx) {
+		if peer, ok := g.pickPeer(norm); ok {
+			if cp, ok := peer.(conditionalPeer); ok {
+				b, version, err := cp.getCached(ctx, g.name, key)
+				if errors.Is(err, ErrNotFound) {
+					return nil, 0, nil
+				}
+				if err != nil {
+					return nil, 0, err
+				}
+				return byteViewOf(b), version, nil
+			}
+		}
+	}
+	value, version, _ := g.cache.GetWithVersion(key)
+	return value, version, nil
+}
+
+// setIf: the conditional write set of key on the key's owner, replicated and
+// deleting the keys derived from it if it applied. req tells a peer owning
+// the key the condition, its group, key, value and ttl are filled in
+func (g *Group) setIf(ctx context.Context, key string, value store.Value, ttl time.Duration, req *pb.SetRequest, set func() (bool, error)) (bool, error) {
+	if err := g.checkWritable(); err != nil {
+		return false, err
+	}
+	if key == "" {
+		return false, fmt.Errorf("%w: empty key", ErrInvalidKey)
+	}
+	if err := checkWrite(ctx, value); err != nil {
+		return false, err
+	}
+	norm, err := g.cache.opts.KeyPolicy.Apply(key)
+	if err != nil {
+		return false, err
+	}
+	if !isForwarded(ctx) {
+		if peer, ok := g.pickPeer(norm); ok {
+			if cp, ok := peer.(conditionalPeer); ok {
+				return g.setIfOnPeer(ctx, cp, req, key, norm, value, ttl)
+			}
+		}
+	}
+	applied, err := set()
+	if err != nil || !applied {
+		return false, err
+	}
+	g.invalidateDependents(ctx, key)
+	return true, g.replicateSet(ctx, key, value, ttl)
+}
+
+// setIfOnPeer: the conditional set req of key on its owner peer, dropping the
+// copy of key here once it applied
+func (g *Group) setIfOnPeer(ctx context.Context, peer conditionalPeer, req *pb.SetRequest, key, norm string, value store.Value, ttl time.Duration) (bool, error) {
+	b, err := valueBytes(value)
+	if err != nil {
+		return false, err
+	}
+	req.Group, req.Key, req.Value = g.name, []byte(key), b
+	if ttl > 0 || ttl == NoExpiration {
+		req.Ttl = durationpb.New(ttl)
+	}
+	applied, err := peer.setIf(ctx, req)
+	if err != nil || !applied {
+		return false, err
+	}
+	g.dropPeerCopy(norm)
+	g.invalidateDependents(ctx, key)
+	return true, nil
+}
+
+// dropPeerCopy: evict the copy here of a key a peer owns once a write of it
+// was made there, unless the node is a replica of the key, which the owner
+// copies the write to
+func (g *Group) dropPeerCopy(norm string) {
+	if slices.Contains(g.replicaSet(norm), nil) {
+		return
+	}
+	if _, version, _, ok := g.cache.current(norm); ok {
+		g.cache.evictIfVersion(norm, version)
+	}
+}
+
+// conditionalPeer: implemented by PeerGetters checking the conditional sets
+// of a key on its owner, the peers of ClientPicker do
+type conditionalPeer interface {
+	// setIf: send the conditional set req to the peer, return whether it applied
+	setIf(ctx context.Context, req *pb.SetRequest) (bool, error)
+	// getCached: the cached value of key of group on the peer and the version
+	// of its entry there, ErrNotFound if it has none
+	getCached(ctx context.Context, group, key string) ([]byte, uint64, error)
+}
+
+// setIf: implements conditionalPeer, under the caller's deadline less reserve
+func (p peerClient) setIf(ctx context.Context, req *pb.SetRequest) (bool, error) {
+	ctx, cancel, err := hopContext(ctx, p.reserve)
+	if err != nil {
+		return false, err
+	}
+	defer cancel()
+	p.stats.forwards.Add(1)
+	applied, err := p.Client.setIf(withOwnerWrite(ctx), req)
+	if err != nil {
+		p.stats.failures.Add(1)
+	}
+	return applied, err
+}
+
+// getCached: implements conditionalPeer, under the caller's deadline less reserve
+func (p peerClient) getCached(ctx context.Context, group, key string) ([]byte, uint64, error) {
+	ctx, cancel, err := hopContext(ctx, p.reserve)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cancel()
+	p.stats.forwards.Add(1)
+	resp, value, err := p.Client.getResponse(withForwarded(ctx), &pb.GetRequest{Group: group, Key: []byte(key), Cached: true})
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		p.stats.failures.Add(1)
+	}
+	return value, resp.GetVersion(), err
+}
+
+// GetEntryInfo: return provenance, version and size of the entry at key
+func (g *Group) GetEntryInfo(key string) (EntryInfo, bool) {
+	return g.cache.GetEntryInfo(key)
+}
+
+// Delete: delete value by key, return whether the key existed. Keys derived
+// from it are deleted whether it existed or not, see DependsOn
+func (g *Group) Delete(ctx context.Context, key string) (bool, error) {
+	if err := g.checkWritable(); err != nil {
+		return false, err
+	}
+	deleted := g.cache.Delete(key)
+	g.invalidateDependents(ctx, key)
+	return deleted, g.replicateDelete(ctx, key)
+}
+
+// Undelete: restore a soft-deleted key, see CacheOptions.SoftDeleteWindow
+func (g *Group) Undelete(ctx context.Context, key string) (bool, error) {
+	if err := g.checkWritable(); err != nil {
+		return false, err
+	}
+	return g.cache.Undelete(key), nil
+}
+
+// Clear: remove all entries of the group
+func (g *Group) Clear() error {
+	if err := g.checkWritable(); err != nil {
+		return err
+	}
+	g.cache.Clear()
+	return nil
+}
+
+// SetReadOnly: freeze or unfreeze the group's entries
+func (g *Group) SetReadOnly(readOnly bool) {
+	g.readOnly.Store(readOnly)
+}
+
+// ReadOnly: whether the group rejects writes
+func (g *Group) ReadOnly() bool {
+	return g.readOnly.Load()
+}
+
+// checkWritable: ErrReadOnly if the group is read-only
+func (g *Group) checkWritable() error {
+	if g.readOnly.Load() {
+		return fmt.Errorf("%w: group %q", ErrReadOnly, g.name)
+	}
+	return nil
+}
+
+// Stats: return group statistics
+func (g *Group) Stats() map[string]interface{} {
+	stats := g.cache.Stats()
+	stats["name"] = g.name
+	stats["read_only"] = g.readOnly.Load()
+	stats["invalidated"] = g.invalidated.Load()
+	stats["prefetched"] = g.prefetched.Load()
+	stats["prefetch_pending"] = g.prefetchPending.Load()
+	stats["prefetch_dropped"] = g.prefetchDropped.Load()
+	stats["prefetch_errors"] = g.prefetchErrors.Load()
+	stats["replica_fills"] = g.hot.fills.Load()
+	stats["replica_write_errors"] = g.replicaWriteErrors.Load()
+	stats["replica_reads"] = g.replicaReads.Load()
+	stats["read_repairs"] = g.readRepairs.Load()
+	stats["hints_pending"] = g.hintsPending.Load()
+	stats["hints_replayed"] = g.hintsReplayed.Load()
+	stats["hints_dropped"] = g.hintsDropped.Load()
+	stats["refreshed"] = g.refreshed.Load()
+	stats["refresh_errors"] = g.refreshErrors.Load()
+	stats["fallback_hits"] = g.fallbackHits.Load()
+	stats["fallback_misses"] = g.fallbackMisses.Load()
+	stats["fallback_errors"] = g.fallbackErrors.Load()
+	stats["rebalanced"] = g.rebalanced.Load()
+	return stats
+}
+
+// Close: unregister the group, wait for its background work and close its
+// cache
+func (g *Group) Close() {
+	g.mtx.Lock()
+	if g.closed {
+		g.mtx.Unlock()
+		return
+	}
+	g.closed = true
+	g.stopPrefetch()
+	groupRegistry.CompareAndDelete(g.name, g)
+	// joined unlocked, background work may lock the group
+	g.mtx.Unlock()
+	g.tasks.close()
+	g.cache.Close()
+}
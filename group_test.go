@@ -0,0 +1,106 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConditionalSetAcrossNodes(t *testing.T) {
+	c := newTestCluster(t, 3, clusterOptions{})
+	ctx := context.Background()
+	clients := []*Client{c.client(0, nil), c.client(1, nil), c.client(2, nil)}
+
+	tests := []struct {
+		name  string
+		owner int
+		via   [2]int // nodes receiving the two racing SetNX
+	}{
+		{"owner and other node", 0, [2]int{0, 1}},
+		{"two non-owners", 0, [2]int{1, 2}},
+		{"same non-owner", 2, [2]int{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := c.keyOwnedBy(tt.owner, tt.name)
+			values := [2]string{"first", "second"}
+			var applied [2]bool
+			var wg sync.WaitGroup
+			for i, node := range tt.via {
+				wg.Go(func() {
+					ok, err := clients[node].SetNX(ctx, testGroup, key, []byte(values[i]), time.Minute)
+					if err != nil {
+						t.Errorf("SetNX via node %d: %v", node, err)
+					}
+					applied[i] = ok
+				})
+			}
+			wg.Wait()
+			if applied[0] == applied[1] {
+				t.Fatalf("SetNX applied %v, want exactly one winner", applied)
+			}
+			want := values[0]
+			if applied[1] {
+				want = values[1]
+			}
+			for i, cli := range clients {
+				got, _, err := cli.GetWithVersion(ctx, testGroup, key)
+				if err != nil || string(got) != want {
+					t.Errorf("node %d: got %q, %v, want %q", i, got, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConditionalSetOwnerVersion(t *testing.T) {
+	c := newTestCluster(t, 3, clusterOptions{})
+	ctx := context.Background()
+	key := c.keyOwnedBy(0, "cas")
+	owner, other := c.client(0, nil), c.client(1, nil)
+
+	if ok, err := other.SetXX(ctx, testGroup, key, []byte("x"), 0); err != nil || ok {
+		t.Fatalf("SetXX of absent key: %v, %v, want false", ok, err)
+	}
+	if _, _, err := other.GetWithVersion(ctx, testGroup, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetWithVersion of absent key: %v, want ErrNotFound", err)
+	}
+	if ok, err := owner.CompareAndSwap(ctx, testGroup, key, 0, []byte("a"), 0); err != nil || !ok {
+		t.Fatalf("CompareAndSwap from absent: %v, %v", ok, err)
+	}
+	_, ownerVersion, err := owner.GetWithVersion(ctx, testGroup, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, version, err := other.GetWithVersion(ctx, testGroup, key)
+	if err != nil || string(value) != "a" || version != ownerVersion {
+		t.Fatalf("GetWithVersion via other node: %q, %d, %v, want %q, %d", value, version, err, "a", ownerVersion)
+	}
+
+	tests := []struct {
+		name    string
+		version uint64
+		want    bool
+	}{
+		{"stale version", version + 1, false},
+		{"absent version", 0, false},
+		{"owner version", version, true},
+		{"replaced version", version, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := other.CompareAndSwap(ctx, testGroup, key, tt.version, []byte(tt.name), 0)
+			if err != nil || ok != tt.want {
+				t.Fatalf("CompareAndSwap: %v, %v, want %v", ok, err, tt.want)
+			}
+		})
+	}
+	if got, _, _ := owner.GetWithVersion(ctx, testGroup, key); string(got) != "owner version" {
+		t.Fatalf("owner holds %q, want %q", got, "owner version")
+	}
+	if ok, err := other.SetXX(ctx, testGroup, key, []byte("xx"), 0); err != nil || !ok {
+		t.Fatalf("SetXX of present key: %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,216 @@
+package rebelcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// groupsPrefix: etcd directory holding the group configurations, under EtcdOptions.Prefix
+const groupsPrefix = "/groups/"
+
+// GroupConfig: settings of a group kept centrally in etcd, see GroupConfigs.
+// Nodes following the registry apply them to their group as they change, a
+// zero field keeps what the group was created with. Durations are in
+// nanoseconds in the stored json
+type GroupConfig struct {
+	CacheBytes int64           `json:"cache_bytes,omitempty"` // quota of the group's cache on each node
+	CacheType  store.CacheType `json:"cache_type,omitempty"`  // eviction policy, types unknown to a node fall back to LRU
+	DefaultTTL time.Duration   `json:"default_ttl,omitempty"` // ttl of writes carrying none
+	MinTTL     time.Duration   `json:"min_ttl,omitempty"`     // lower bound of ttl
+	MaxTTL     time.Duration   `json:"max_ttl,omitempty"`     // upper bound of ttl
+}
+
+// Validate: check the configuration can be applied
+func (c GroupConfig) Validate() error {
+	switch {
+	case c.CacheBytes < 0:
+		return fmt.Errorf("rebelcache: group config: negative cache bytes %d", c.CacheBytes)
+	case c.DefaultTTL < 0, c.MinTTL < 0, c.MaxTTL < 0:
+		return errors.New("rebelcache: group config: negative ttl")
+	case c.MaxTTL > 0 && c.MinTTL > c.MaxTTL:
+		return fmt.Errorf("rebelcache: group config: min ttl %v above max ttl %v", c.MinTTL, c.MaxTTL)
+	}
+	return nil
+}
+
+// apply: opts with the fields set in c replaced
+func (c GroupConfig) apply(opts CacheOptions) CacheOptions {
+	if c.CacheBytes > 0 {
+		opts.MaxBytes = c.CacheBytes
+	}
+	if c.CacheType != "" {
+		opts.CacheType = c.CacheType
+	}
+	if c.DefaultTTL > 0 {
+		opts.DefaultTTL = c.DefaultTTL
+	}
+	if c.MinTTL > 0 {
+		opts.MinTTL = c.MinTTL
+	}
+	if c.MaxTTL > 0 {
+		opts.MaxTTL = c.MaxTTL
+	}
+	return opts
+}
+
+// GroupConfigs: the registry of group configurations in etcd, so creating
+// or retuning a group is a write here rather than a redeploy of every node.
+// Nodes follow it with ServerOptions.GroupConfigs
+type GroupConfigs struct {
+	cli *clientv3.Client
+}
+
+// NewGroupConfigs: connect to the registry of the cluster sharing opts' etcd and prefix
+func NewGroupConfigs(opts EtcdOptions) (*GroupConfigs, error) {
+	cli, err := newEtcdClient(opts)
+	if err != nil {
+		return nil, fmt.Errorf("rebelcache: connect etcd: %w", err)
+	}
+	return &GroupConfigs{cli: cli}, nil
+}
+
+// groupConfigKey: etcd key of the configuration of group
+func groupConfigKey(group string) string {
+	return groupsPrefix + group
+}
+
+// Put: store the configuration of group, nodes following the registry apply it
+func (r *GroupConfigs) Put(ctx context.Context, group string, cfg GroupConfig) error {
+	if group == "" || strings.Contains(group, "/") {
+		return fmt.Errorf("rebelcache: group config: invalid group name %q", group)
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = r.cli.Put(ctx, groupConfigKey(group), string(b))
+	return err
+}
+
+// Get: the configuration of group, ok is false if it has none
+func (r *GroupConfigs) Get(ctx context.Context, group string) (cfg GroupConfig, ok bool, err error) {
+	resp, err := r.cli.Get(ctx, groupConfigKey(group))
+	if err != nil || len(resp.Kvs) == 0 {
+		return GroupConfig{}, false, err
+	}
+	if err := json.Unmarshal(resp.Kvs[0].Value, &cfg); err != nil {
+		return GroupConfig{}, false, fmt.Errorf("rebelcache: group config of %q: %w", group, err)
+	}
+	return cfg, true, nil
+}
+
+// Delete: remove the configuration of group, nodes return the group to the
+// settings it was created with
+func (r *GroupConfigs) Delete(ctx context.Context, group string) error {
+	_, err := r.cli.Delete(ctx, groupConfigKey(group))
+	return err
+}
+
+// List: the configurations of all groups by name
+func (r *GroupConfigs) List(ctx context.Context) (map[string]GroupConfig, error) {
+	configs, _, err := listGroupConfigs(ctx, r.cli)
+	return configs, err
+}
+
+// Close: close the etcd client
+func (r *GroupConfigs) Close() error {
+	return r.cli.Close()
+}
+
+// listGroupConfigs: the stored configurations and the revision read at,
+// configurations that don't decode are logged and left out
+func listGroupConfigs(ctx context.Context, cli *clientv3.Client) (map[string]GroupConfig, int64, error) {
+	resp, err := cli.Get(ctx, groupsPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+	configs := make(map[string]GroupConfig, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		group := strings.TrimPrefix(string(kv.Key), groupsPrefix)
+		var cfg GroupConfig
+		if err := json.Unmarshal(kv.Value, &cfg); err != nil {
+			log.Printf("rebelcache: group config of %q: %v", group, err)
+			continue
+		}
+		configs[group] = cfg
+	}
+	return configs, resp.Header.Revision, nil
+}
+
+// followGroupConfigs: apply the stored group configurations, then their
+// changes until ctx is done, resyncing from a fresh listing whenever the
+// watch breaks
+func (s *Server) followGroupConfigs(ctx context.Context) error {
+	configs, rev, err := listGroupConfigs(ctx, s.etcdCli)
+	if err != nil {
+		return err
+	}
+	for group, cfg := range configs {
+		s.applyGroupConfig(group, cfg)
+	}
+	watchCtx := clientv3.WithRequireLeader(ctx)
+	for resp := range s.etcdCli.Watch(watchCtx, groupsPrefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1)) {
+		if err := resp.Err(); err != nil {
+			return fmt.Errorf("watch group configs: %w", err)
+		}
+		for _, ev := range resp.Events {
+			group := strings.TrimPrefix(string(ev.Kv.Key), groupsPrefix)
+			var cfg GroupConfig
+			if ev.Type == clientv3.EventTypePut {
+				if err := json.Unmarshal(ev.Kv.Value, &cfg); err != nil {
+					log.Printf("rebelcache: group config of %q: %v", group, err)
+					continue
+				}
+			}
+			s.applyGroupConfig(group, cfg)
+		}
+	}
+	if ctx.Err() == nil {
+		return errors.New("watch group configs ended")
+	}
+	return nil
+}
+
+// applyGroupConfig: retune the served group, creating it with GroupGetter
+// when the node doesn't define it
+func (s *Server) applyGroupConfig(group string, cfg GroupConfig) {
+	if err := cfg.Validate(); err != nil {
+		log.Printf("rebelcache: group config of %q: %v", group, err)
+		return
+	}
+	if g, ok := s.groups.Load(group); ok {
+		g.(*Group).Configure(cfg)
+		return
+	}
+	if s.opts.GroupGetter == nil {
+		return
+	}
+	getter := s.opts.GroupGetter(group)
+	if getter == nil {
+		return
+	}
+	cacheBytes := cfg.CacheBytes
+	if cacheBytes <= 0 {
+		cacheBytes = DefaultCacheOptions().MaxBytes
+	}
+	g := NewGroup(group, cacheBytes, getter)
+	g.Configure(cfg)
+	log.Printf("rebelcache: created group %q from its configuration", group)
+}
+
+// Configure: apply cfg over the options the group was created with, a zero
+// cfg restores them. See Cache.Reconfigure for how entries are kept
+func (g *Group) Configure(cfg GroupConfig) {
+	g.cache.Reconfigure(cfg)
+}
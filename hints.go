@@ -0,0 +1,225 @@
+package rebelcache
+
+import (
+	"context"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultHintTTL            = 30 * time.Minute
+	defaultMaxHints           = 10000
+	defaultMaxHintBytes       = 64 << 20
+	defaultHintReplayInterval = 10 * time.Second
+)
+
+// HintOptions: hinted handoff, a node copying a write to the replica set of a
+// key keeps the copies that failed as hints and replays them once their node
+// answers again, so a node down for a while catches up on the writes it
+// missed without waiting for read repair. Hints are kept in memory only and
+// don't count towards the Consistency of a write. Zero fields take defaults
+type HintOptions struct {
+	TTL            time.Duration // age past which a hint is dropped, 0 means 30m
+	MaxHints       int           // hints kept by the node, the oldest are dropped past it, 0 means 10000
+	MaxBytes       int64         // bytes of the values of the hints kept, 0 means 64MiB
+	ReplayInterval time.Duration // how often the nodes hinted are retried, 0 means 10s
+}
+
+// hintStore: the writes nodes missed, by node. A newer write of a key to a
+// node supersedes its hint there, so the replay of a key only sends the
+// last write this node made of it
+type hintStore struct {
+	opts  HintOptions
+	mtx   sync.Mutex
+	nodes map[string][]*replicaWrite // node addr -> missed writes, oldest first
+	count int
+	bytes int64
+}
+
+// newHintStore: an empty store bounded by opts
+func newHintStore(opts HintOptions) *hintStore {
+	if opts.TTL <= 0 {
+		opts.TTL = defaultHintTTL
+	}
+	if opts.MaxHints <= 0 {
+		opts.MaxHints = defaultMaxHints
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultMaxHintBytes
+	}
+	if opts.ReplayInterval <= 0 {
+		opts.ReplayInterval = defaultHintReplayInterval
+	}
+	return &hintStore{opts: opts, nodes: make(map[string][]*replicaWrite)}
+}
+
+// hints: the hint store of the group's peers, nil without hinted handoff
+func (g *Group) hints() *hintStore {
+	g.mtx.Lock()
+	peers, _ := g.peers.(*ClientPicker)
+	g.mtx.Unlock()
+	if peers == nil {
+		return nil
+	}
+	return peers.hints.Load()
+}
+
+// add: keep w for node, dropping the oldest hints past the bounds
+func (s *hintStore) add(node string, w *replicaWrite) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if i := slices.IndexFunc(s.nodes[node], w.sameKey); i >= 0 {
+		if s.nodes[node][i].at.After(w.at) {
+			return
+		}
+		s.removeLocked(node, i)
+	}
+	size := int64(len(w.value))
+	if size > s.opts.MaxBytes {
+		w.g.hintsDropped.Add(1)
+		return
+	}
+	for s.count >= s.opts.MaxHints || s.bytes+size > s.opts.MaxBytes {
+		s.dropOldestLocked()
+	}
+	// copies fail after retries of varying length, hints are kept in write order
+	i, _ := slices.BinarySearchFunc(s.nodes[node], w.at, func(h *replicaWrite, at time.Time) int {
+		return h.at.Compare(at)
+	})
+	s.nodes[node] = slices.Insert(s.nodes[node], i, w)
+	s.count++
+	s.bytes += size
+	w.g.hintsPending.Add(1)
+}
+
+// forget: drop the hint of w's key for node, w reached it
+func (s *hintStore) forget(node string, w *replicaWrite) {
+	if s == nil {
+		return
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if i := slices.IndexFunc(s.nodes[node], w.sameKey); i >= 0 && s.nodes[node][i].at.Before(w.at) {
+		s.removeLocked(node, i)
+	}
+}
+
+// remove: drop w from the hints of node if it is still there
+func (s *hintStore) remove(node string, w *replicaWrite) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if i := slices.Index(s.nodes[node], w); i >= 0 {
+		s.removeLocked(node, i)
+	}
+}
+
+// removeLocked: drop the i-th hint of node
+func (s *hintStore) removeLocked(node string, i int) {
+	w := s.nodes[node][i]
+	if s.nodes[node] = slices.Delete(s.nodes[node], i, i+1); len(s.nodes[node]) == 0 {
+		delete(s.nodes, node)
+	}
+	s.count--
+	s.bytes -= int64(len(w.value))
+	w.g.hintsPending.Add(-1)
+}
+
+// dropOldestLocked: drop the oldest hint of any node
+func (s *hintStore) dropOldestLocked() {
+	var oldest string
+	for node, hints := range s.nodes {
+		if oldest == "" || hints[0].at.Before(s.nodes[oldest][0].at) {
+			oldest = node
+		}
+	}
+	if oldest == "" {
+		return
+	}
+	s.nodes[oldest][0].g.hintsDropped.Add(1)
+	s.removeLocked(oldest, 0)
+}
+
+// replay: send the hints of every node among clients in order, stopping at
+// the first a node doesn't take while unreachable. Hints of nodes not among
+// clients, e.g. deregistered while down, wait for them to come back
+func (s *hintStore) replay(ctx context.Context, clients map[string]*Client) {
+	s.mtx.Lock()
+	nodes := slices.Collect(maps.Keys(s.nodes))
+	s.mtx.Unlock()
+	for _, node := range nodes {
+		if c, ok := clients[node]; ok {
+			s.replayNode(ctx, node, c)
+		}
+		s.expire(node)
+	}
+}
+
+// replayNode: send the hints of node to c, oldest first
+func (s *hintStore) replayNode(ctx context.Context, node string, c *Client) {
+	for ctx.Err() == nil {
+		s.mtx.Lock()
+		hints := s.nodes[node]
+		s.mtx.Unlock()
+		if len(hints) == 0 {
+			return
+		}
+		w := hints[0]
+		if time.Since(w.at) > s.opts.TTL {
+			w.g.hintsDropped.Add(1)
+			s.remove(node, w)
+			continue
+		}
+		sendCtx, cancel := context.WithTimeout(withForwarded(ctx), replicaWriteTimeout)
+		err := w.send(sendCtx, c)
+		timedOut := sendCtx.Err() != nil
+		cancel()
+		switch code := status.Code(err); {
+		case err == nil:
+			w.g.hintsReplayed.Add(1)
+		case timedOut, code == codes.Unavailable, code == codes.DeadlineExceeded, code == codes.Canceled:
+			// still down, retried on the next replay
+			return
+		default:
+			// a write the node refuses won't be taken on a retry either
+			w.g.hintsDropped.Add(1)
+			log.Printf("rebelcache: replay hint of %s to %s: %v", FormatKey(w.key), node, err)
+		}
+		s.remove(node, w)
+	}
+}
+
+// expire: drop the hints of node past the ttl
+func (s *hintStore) expire(node string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for len(s.nodes[node]) > 0 && time.Since(s.nodes[node][0].at) > s.opts.TTL {
+		s.nodes[node][0].g.hintsDropped.Add(1)
+		s.removeLocked(node, 0)
+	}
+}
+
+// sameKey: whether o writes the same key of the same group as w
+func (w *replicaWrite) sameKey(o *replicaWrite) bool {
+	return o.g == w.g && o.key == w.key
+}
+
+// hintLoop: replay the hints of the node periodically until ctx ends
+func (s *Server) hintLoop(ctx context.Context) error {
+	hints := s.opts.Picker.hints.Load()
+	ticker := time.NewTicker(hints.opts.ReplayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		hints.replay(ctx, s.opts.Picker.peerClients())
+	}
+}
@@ -0,0 +1,149 @@
+package rebelcache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HotWriteOptions: coalescing of the events of keys written at extreme rates,
+// like a counter bumped thousands of times a second. Watchers, followers
+// among them, get the latest write of a hot key once per Interval instead of
+// every write, the journal of the append-only log still gets all of them
+type HotWriteOptions struct {
+	Threshold int           // writes of a key within Window that make it hot
+	Window    time.Duration // window writes are counted in, 0 means 1s, a key stays hot for a window after its last busy one
+	Interval  time.Duration // how often the latest write of a hot key is sent, 0 means 100ms
+}
+
+// hotWrites: detects hot keys and holds back their events, see HotWriteOptions
+type hotWrites struct {
+	opts      HotWriteOptions
+	feed      *eventFeed
+	mtx       sync.Mutex // held while a held back event is sent, so it can't overtake a clear
+	rotated   time.Time
+	counts    map[string]int       // writes of each key in the current window
+	hot       map[string]time.Time // hot key -> end of the window it cools down at
+	pending   map[string]keyEvent  // latest held back event of a key
+	started   bool                 // the flush loop runs
+	closed    bool
+	loops     *supervisor  // the flush loop, started with the first event held back
+	coalesced atomic.Int64 // events replaced by a later one before they were sent
+}
+
+// newHotWrites: create the hot key detection of feed, nil without a positive Threshold
+func newHotWrites(opts *HotWriteOptions, feed *eventFeed) *hotWrites {
+	if opts == nil || opts.Threshold <= 0 {
+		return nil
+	}
+	h := &hotWrites{
+		opts:    *opts,
+		feed:    feed,
+		rotated: time.Now(),
+		counts:  make(map[string]int),
+		hot:     make(map[string]time.Time),
+		pending: make(map[string]keyEvent),
+		loops:   newSupervisor(context.Background()),
+	}
+	if h.opts.Window <= 0 {
+		h.opts.Window = time.Second
+	}
+	if h.opts.Interval <= 0 {
+		h.opts.Interval = 100 * time.Millisecond
+	}
+	return h
+}
+
+// hold: count the write of ev and whether its event is held back to be sent
+// by the flush loop. A clear drops the events held back, they predate it.
+// Note: the stripe lock of ev's key must be held, or all writes excluded
+func (h *hotWrites) hold(ev keyEvent) bool {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if ev.kind == eventClear {
+		clear(h.pending)
+		return false
+	}
+	if h.closed {
+		return false
+	}
+	now := time.Now()
+	if now.Sub(h.rotated) >= h.opts.Window {
+		clear(h.counts)
+		for key, until := range h.hot {
+			if now.After(until) {
+				delete(h.hot, key)
+			}
+		}
+		h.rotated = now
+	}
+	h.counts[ev.key]++
+	if h.counts[ev.key] > h.opts.Threshold {
+		h.hot[ev.key] = h.rotated.Add(2 * h.opts.Window)
+	}
+	_, held := h.pending[ev.key]
+	if _, hot := h.hot[ev.key]; !hot && !held {
+		return false
+	}
+	if held {
+		h.coalesced.Add(1)
+	}
+	h.pending[ev.key] = ev
+	if !h.started {
+		h.started = true
+		h.loops.Go("hot write flushes", RestartOnFailure, h.flushLoop)
+	}
+	return true
+}
+
+// flushLoop: send the events held back every Interval until close
+func (h *hotWrites) flushLoop(ctx context.Context) error {
+	ticker := time.NewTicker(h.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.flush()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// flush: send the events held back, each under its key's stripe lock
+func (h *hotWrites) flush() {
+	h.mtx.Lock()
+	keys := make([]string, 0, len(h.pending))
+	for key := range h.pending {
+		keys = append(keys, key)
+	}
+	h.mtx.Unlock()
+	for _, key := range keys {
+		unlock := h.feed.lock(key)
+		h.mtx.Lock()
+		if ev, ok := h.pending[key]; ok {
+			delete(h.pending, key)
+			h.feed.send(ev)
+		}
+		h.mtx.Unlock()
+		unlock()
+	}
+}
+
+// hotKeys: number of keys currently hot
+func (h *hotWrites) hotKeys() int {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return len(h.hot)
+}
+
+// close: stop the flush loop and wait for it, events still held back are dropped
+func (h *hotWrites) close() {
+	h.mtx.Lock()
+	h.closed = true
+	clear(h.pending)
+	h.mtx.Unlock()
+	// the loop takes mtx to flush
+	h.loops.Stop()
+}
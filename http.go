@@ -0,0 +1,287 @@
+package rebelcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// maxHTTPValueBytes: largest value accepted by PUT
+const maxHTTPValueBytes = 32 << 20
+
+// HTTPHandler: REST api over the groups served by the node:
+//
+//	GET    /api/v1/groups/{group}/keys/{key}  value of key, loaded on a miss
+//	PUT    /api/v1/groups/{group}/keys/{key}  set key to the body, ?ttl=30s sets a ttl, ?ttl=none no expiration
+//	DELETE /api/v1/groups/{group}/keys/{key}  delete key
+//	GET    /api/v1/groups/{group}/stats       group statistics as json
+//	GET    /api/v1/groups/{group}/topkeys     hottest keys read as json, ?n=20 sets how many
+//	GET    /api/v1/groups/{group}/immortal    keys without expiration as json, ?limit=500 sets how many
+//	POST   /api/v1/groups/{group}/immortal    give keys without expiration ?ttl=1h, ?limit=500 sets how many
+//	GET    /api/v1/groups/{group}/sample      random sample of keys as json, ?n=20 sets how many, ?details=true adds sizes, ttls and last access
+//	GET    /api/v1/sample                     the same over all the groups
+//	GET    /livez                             200 while the node serves
+//	GET    /readyz                            readiness as json, 503 while warming, see Server.Readiness
+func (s *Server) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/groups/{group}/keys/{key...}", s.httpGet)
+	mux.HandleFunc("PUT /api/v1/groups/{group}/keys/{key...}", s.httpPut)
+	mux.HandleFunc("DELETE /api/v1/groups/{group}/keys/{key...}", s.httpDelete)
+	mux.HandleFunc("GET /api/v1/groups/{group}/stats", s.httpStats)
+	mux.HandleFunc("GET /api/v1/groups/{group}/topkeys", s.httpTopKeys)
+	mux.HandleFunc("GET /api/v1/groups/{group}/immortal", s.httpImmortal)
+	mux.HandleFunc("POST /api/v1/groups/{group}/immortal", s.httpImmortal)
+	mux.HandleFunc("GET /api/v1/groups/{group}/sample", s.httpSample)
+	mux.HandleFunc("GET /api/v1/sample", s.httpSample)
+	mux.Handle("GET /livez", s.LivezHandler())
+	mux.Handle("GET /readyz", s.ReadyzHandler())
+	h := recoverHTTP(mux)
+	if s.shaper != nil {
+		h = s.shaper.httpMiddleware(h)
+	}
+	if s.auth != nil {
+		h = s.auth.httpMiddleware(h)
+	}
+	return s.allowlist.httpMiddleware(h)
+}
+
+// httpGet: GET a key
+func (s *Server) httpGet(w http.ResponseWriter, r *http.Request) {
+	g, err := s.getGroup(r.PathValue("group"))
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	key := r.PathValue("key")
+	value, err := g.Get(r.Context(), key)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	if value == nil {
+		httpError(w, status.Errorf(codes.NotFound, "rebelcache: key %s not found", FormatKey(key)))
+		return
+	}
+	b, err := valueBytes(value)
+	if err == nil {
+		b, err = s.transforms.apply(r.Context(), g.name, key, b)
+	}
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(b)
+}
+
+// httpPut: PUT a key
+func (s *Server) httpPut(w http.ResponseWriter, r *http.Request) {
+	g, err := s.writableGroup(r.PathValue("group"))
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	var ttl time.Duration
+	if v := r.URL.Query().Get("ttl"); v == "none" {
+		ttl = NoExpiration
+	} else if v != "" {
+		if ttl, err = time.ParseDuration(v); err != nil {
+			http.Error(w, fmt.Sprintf("rebelcache: invalid ttl %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+	value, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHTTPValueBytes))
+	if err != nil {
+		http.Error(w, "rebelcache: "+err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := g.SetWithExpiration(WithOrigin(r.Context(), "http"), r.PathValue("key"), byteViewOf(value), ttl); err != nil {
+		httpError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// httpDelete: DELETE a key, 404 if it did not exist
+func (s *Server) httpDelete(w http.ResponseWriter, r *http.Request) {
+	g, err := s.writableGroup(r.PathValue("group"))
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	deleted, err := g.Delete(r.Context(), r.PathValue("key"))
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	if !deleted {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// httpStats: GET the statistics of a group
+func (s *Server) httpStats(w http.ResponseWriter, r *http.Request) {
+	g, err := s.getGroup(r.PathValue("group"))
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(g.Stats())
+}
+
+// httpTopKeys: GET the hottest keys of a group
+func (s *Server) httpTopKeys(w http.ResponseWriter, r *http.Request) {
+	var n int64
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.ParseInt(v, 10, 32); err != nil {
+			http.Error(w, fmt.Sprintf("rebelcache: invalid n %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+	resp, err := s.TopKeys(r.Context(), &pb.TopKeysRequest{Group: r.PathValue("group"), N: int32(n)})
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	type keyRate struct {
+		Key string  `json:"key"`
+		QPS float64 `json:"qps"`
+	}
+	keys := make([]keyRate, 0, len(resp.GetKeys()))
+	for _, kr := range resp.GetKeys() {
+		keys = append(keys, keyRate{Key: string(kr.GetKey()), QPS: kr.GetQps()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// httpSample: GET a random sample of the keys of a group, or of all of them
+func (s *Server) httpSample(w http.ResponseWriter, r *http.Request) {
+	req := &pb.SampleKeysRequest{Group: r.PathValue("group")}
+	if v := r.URL.Query().Get("n"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("rebelcache: invalid n %q", v), http.StatusBadRequest)
+			return
+		}
+		req.N = int32(n)
+	}
+	if v := r.URL.Query().Get("details"); v != "" {
+		details, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("rebelcache: invalid details %q", v), http.StatusBadRequest)
+			return
+		}
+		req.Details = details
+	}
+	resp, err := s.SampleKeys(r.Context(), req)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	type sampledKey struct {
+		Group      string     `json:"group"`
+		Key        string     `json:"key"`
+		Size       int64      `json:"size,omitempty"`
+		TTL        string     `json:"ttl,omitempty"`
+		LastAccess *time.Time `json:"last_access,omitempty"`
+	}
+	keys := make([]sampledKey, 0, len(resp.GetKeys()))
+	for _, k := range resp.GetKeys() {
+		key := sampledKey{Group: k.GetGroup(), Key: string(k.GetKey()), Size: k.GetSize()}
+		if k.Ttl != nil {
+			key.TTL = k.GetTtl().AsDuration().String()
+		}
+		if k.GetLastAccess() != 0 {
+			at := time.Unix(0, k.GetLastAccess())
+			key.LastAccess = &at
+		}
+		keys = append(keys, key)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Node    string       `json:"node"`
+		Entries int64        `json:"entries"`
+		Keys    []sampledKey `json:"keys"`
+	}{resp.GetNode(), resp.GetEntries(), keys})
+}
+
+// httpImmortal: GET the keys of a group without expiration, or POST a ttl for them
+func (s *Server) httpImmortal(w http.ResponseWriter, r *http.Request) {
+	req := &pb.ImmortalKeysRequest{Group: r.PathValue("group")}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("rebelcache: invalid limit %q", v), http.StatusBadRequest)
+			return
+		}
+		req.Limit = int32(limit)
+	}
+	if r.Method == http.MethodPost {
+		v := r.URL.Query().Get("ttl")
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("rebelcache: invalid ttl %q", v), http.StatusBadRequest)
+			return
+		}
+		req.Ttl = durationpb.New(ttl)
+	}
+	resp, err := s.ImmortalKeys(r.Context(), req)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	keys := make([]string, 0, len(resp.GetKeys()))
+	for _, key := range resp.GetKeys() {
+		keys = append(keys, string(key))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Keys    []string `json:"keys"`
+		Entries int64    `json:"entries"`
+		Bytes   int64    `json:"bytes"`
+	}{keys, resp.GetEntries(), resp.GetBytes()})
+}
+
+// httpError: write err with the http status matching its grpc code
+func httpError(w http.ResponseWriter, err error) {
+	st := status.Convert(toStatus(err))
+	http.Error(w, st.Message(), httpStatus(st.Code()))
+}
+
+// httpStatus: http status of a grpc code
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.FailedPrecondition, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
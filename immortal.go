@@ -0,0 +1,98 @@
+package rebelcache
+
+import (
+	"errors"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+// NoExpiration: ttl of a write that never expires whatever the group's
+// DefaultTTL, still capped by MaxTTL. A ttl of 0 means the default ttl, which
+// is no expiration only in groups without one. Entries without expiration are
+// counted apart in stats as immortal_entries and immortal_bytes: they only
+// leave on a delete or an eviction, see Cache.ExpireImmortal
+const NoExpiration time.Duration = -1
+
+// defaultImmortalKeys: keys listed by the ImmortalKeys rpc by default
+const defaultImmortalKeys = 100
+
+// errNoTTL: ExpireImmortal needs a ttl
+var errNoTTL = errors.New("rebelcache: no ttl to give")
+
+// Immortal: number of entries without expiration and the bytes of their keys
+// and values, ok is false if the store doesn't count them, see store.ImmortalCounter
+func (c *Cache) Immortal() (entries, bytes int64, ok bool) {
+	m := c.metrics()
+	if m.immortalEntries < 0 {
+		return 0, 0, false
+	}
+	return m.immortalEntries, m.immortalBytes, true
+}
+
+// ImmortalKeys: up to limit keys of entries without expiration, limit <= 0
+// lists them all. ok is false if the store cannot be ranged over
+func (c *Cache) ImmortalKeys(limit int) (keys []string, ok bool) {
+	ok = c.Range(func(key string, _ store.Value, expireAt time.Time) bool {
+		if expireAt.IsZero() {
+			keys = append(keys, key)
+		}
+		return limit <= 0 || len(keys) < limit
+	})
+	return keys, ok
+}
+
+// ExpireImmortal: give up to limit entries without expiration ttl, bounded by
+// MinTTL and MaxTTL, limit <= 0 gives it to them all. Entries keep their value
+// and provenance, watchers see them set again with the ttl. Entries written in
+// the meantime are left as they are. Returns the keys given the ttl
+func (c *Cache) ExpireImmortal(ttl time.Duration, limit int) ([]string, error) {
+	if ttl <= 0 {
+		return nil, errNoTTL
+	}
+	keys, ok := c.ImmortalKeys(limit)
+	if !ok {
+		return nil, errors.New("rebelcache: store cannot list its entries")
+	}
+	expired := keys[:0]
+	for _, key := range keys {
+		var set bool
+		err := c.write(key, func(s store.Store, key string) (err error) {
+			value, version, found := s.GetWithVersion(key)
+			if !found {
+				return nil
+			}
+			if left, found := s.TTL(key); !found || left != 0 {
+				return nil
+			}
+			ttl := c.boundTTL(ttl)
+			// the stored value is kept as it is, wrapped with its provenance
+			if set, err = s.CompareAndSwap(key, version, value, ttl); set {
+				c.feed.publish(setEvent(key, unwrapValue(value), ttl))
+			}
+			return err
+		})
+		if err != nil {
+			return expired, err
+		}
+		if set {
+			expired = append(expired, key)
+		}
+	}
+	return expired, nil
+}
+
+// ImmortalKeys: up to limit keys of the group's entries without expiration on
+// this node, see Cache.ImmortalKeys
+func (g *Group) ImmortalKeys(limit int) ([]string, bool) {
+	return g.cache.ImmortalKeys(limit)
+}
+
+// ExpireImmortal: give up to limit of the group's entries without expiration
+// on this node ttl, see Cache.ExpireImmortal
+func (g *Group) ExpireImmortal(ttl time.Duration, limit int) ([]string, error) {
+	if err := g.checkWritable(); err != nil {
+		return nil, err
+	}
+	return g.cache.ExpireImmortal(ttl, limit)
+}
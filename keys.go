@@ -0,0 +1,76 @@
+package rebelcache
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxLoggedKeyLen: keys longer than this are truncated by FormatKey
+const maxLoggedKeyLen = 128
+
+// ErrInvalidKey: returned when a key is rejected by the key policy
+var ErrInvalidKey = errors.New("rebelcache: invalid key")
+
+// KeyPolicy: validation and normalization applied to every key,
+// share one policy between client and server so both see the same key
+type KeyPolicy struct {
+	MaxLen    int                     // max key length in bytes after normalization, 0 means no limit
+	Charset   func(r rune) bool       // allowed characters, nil allows all
+	Prefix    string                  // required key prefix, empty means none
+	Normalize func(key string) string // applied before validation, e.g. strings.TrimSpace
+}
+
+// Apply: normalize and validate key, return the key to use
+func (p *KeyPolicy) Apply(key string) (string, error) {
+	if p == nil {
+		return key, nil
+	}
+	if p.Normalize != nil {
+		key = p.Normalize(key)
+	}
+	if key == "" {
+		return "", fmt.Errorf("%w: empty key", ErrInvalidKey)
+	}
+	if p.MaxLen > 0 && len(key) > p.MaxLen {
+		return "", fmt.Errorf("%w: length %d exceeds %d", ErrInvalidKey, len(key), p.MaxLen)
+	}
+	if p.Prefix != "" && !strings.HasPrefix(key, p.Prefix) {
+		return "", fmt.Errorf("%w: missing prefix %q", ErrInvalidKey, p.Prefix)
+	}
+	if p.Charset != nil {
+		// invalid utf-8 bytes are passed to Charset as utf8.RuneError
+		for i, r := range key {
+			if !p.Charset(r) {
+				return "", fmt.Errorf("%w: character %q at %d not allowed", ErrInvalidKey, r, i)
+			}
+		}
+	}
+	return key, nil
+}
+
+// FormatKey: render a key for logs and errors,
+// keys are arbitrary bytes so non-printable or non-utf8 keys are quoted
+// and long keys are truncated
+func FormatKey(key string) string {
+	truncated := len(key) > maxLoggedKeyLen
+	if truncated {
+		key = key[:maxLoggedKeyLen]
+	}
+	printable := utf8.ValidString(key)
+	for _, r := range key {
+		if !printable || !strconv.IsPrint(r) {
+			printable = false
+			break
+		}
+	}
+	if !printable {
+		key = strconv.Quote(key)
+	}
+	if truncated {
+		key += "..."
+	}
+	return key
+}
@@ -0,0 +1,70 @@
+package rebelcache
+
+import (
+	"slices"
+	"sync"
+)
+
+// defaultMaxGroupLabels: groups labeled by name when no limit is set
+const defaultMaxGroupLabels = 100
+
+// GroupLabelOptions: cardinality control of the group label of metrics
+type GroupLabelOptions struct {
+	Allow     []string // groups always labeled by their name
+	MaxGroups int      // further groups labeled by name, first come first served, 0 means 100, negative means none
+	Other     string   // label of all remaining groups, empty means "other"
+}
+
+// GroupLabeler: maps group names to metric label values, keeping the number
+// of distinct values bounded however many dynamic groups a cluster serves
+type GroupLabeler struct {
+	opts    GroupLabelOptions
+	mtx     sync.RWMutex
+	dynamic map[string]struct{} // groups admitted beyond Allow
+}
+
+// NewGroupLabeler: create a labeler, nil opts uses the defaults
+func NewGroupLabeler(opts *GroupLabelOptions) *GroupLabeler {
+	l := &GroupLabeler{dynamic: make(map[string]struct{})}
+	if opts != nil {
+		l.opts = *opts
+	}
+	if l.opts.MaxGroups == 0 {
+		l.opts.MaxGroups = defaultMaxGroupLabels
+	}
+	if l.opts.Other == "" {
+		l.opts.Other = "other"
+	}
+	return l
+}
+
+// Label: the label value of group, its name if allowed or admitted, else the Other value
+func (l *GroupLabeler) Label(group string) string {
+	if slices.Contains(l.opts.Allow, group) {
+		return group
+	}
+	l.mtx.RLock()
+	_, ok := l.dynamic[group]
+	l.mtx.RUnlock()
+	if ok {
+		return group
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if _, ok := l.dynamic[group]; ok {
+		return group
+	}
+	if len(l.dynamic) < l.opts.MaxGroups {
+		l.dynamic[group] = struct{}{}
+		return group
+	}
+	return l.opts.Other
+}
+
+// Forget: release the label of a group that went away, freeing room for another
+func (l *GroupLabeler) Forget(group string) {
+	l.mtx.Lock()
+	delete(l.dynamic, group)
+	l.mtx.Unlock()
+}
@@ -0,0 +1,307 @@
+package rebelcache
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	latencyBuckets = 80                    // buckets of a latency histogram
+	latencyBase    = 50 * time.Microsecond // upper bound of the first bucket
+	latencyGrowth  = 1.2                   // each bucket ends this much later than the one before
+)
+
+// AdaptiveTimeouts: derive the deadline of each attempt and the delay before a
+// hedged get from the recent latencies of each peer instead of fixed numbers,
+// so they follow the cluster as it speeds up or slows down
+type AdaptiveTimeouts struct {
+	Percentile float64 // latency percentile deadlines follow, 0 means 0.99
+	Multiplier float64 // deadline as a multiple of that percentile, 0 means 2
+	// HedgePercentile: latency percentile after which a get still waiting is
+	// sent again, the first answer wins. 0 means 0.95, negative disables hedging
+	HedgePercentile float64
+	Floor           time.Duration // lower bound of deadlines and hedging delays, 0 means 5ms
+	Ceiling         time.Duration // upper bound, used until peers have enough samples, 0 means Timeout or 1s
+	Window          time.Duration // latencies older than one to two windows are forgotten, 0 means 30s
+	MinSamples      int           // samples of a peer before its percentiles count, 0 means 20
+}
+
+// withDefaults: the options with zero values replaced by their defaults,
+// timeout is the client's static per-attempt deadline
+func (o AdaptiveTimeouts) withDefaults(timeout time.Duration) AdaptiveTimeouts {
+	if o.Percentile <= 0 || o.Percentile > 1 {
+		o.Percentile = 0.99
+	}
+	if o.Multiplier <= 0 {
+		o.Multiplier = 2
+	}
+	if o.HedgePercentile == 0 || o.HedgePercentile > 1 {
+		o.HedgePercentile = 0.95
+	}
+	if o.Floor <= 0 {
+		o.Floor = 5 * time.Millisecond
+	}
+	if o.Ceiling <= 0 {
+		o.Ceiling = cmp.Or(timeout, time.Second)
+	}
+	o.Ceiling = max(o.Ceiling, o.Floor)
+	if o.Window <= 0 {
+		o.Window = 30 * time.Second
+	}
+	if o.MinSamples <= 0 {
+		o.MinSamples = 20
+	}
+	return o
+}
+
+// latencyHistogram: latencies of one peer in log-scale buckets, counted over
+// the current and the last complete window
+type latencyHistogram struct {
+	mtx     sync.Mutex
+	started time.Time // start of the current window
+	cur     [latencyBuckets]int64
+	prev    [latencyBuckets]int64
+}
+
+// latencyBucket: bucket of latency d
+func latencyBucket(d time.Duration) int {
+	if d <= latencyBase {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(float64(d)/float64(latencyBase)) / math.Log(latencyGrowth)))
+	return min(i, latencyBuckets-1)
+}
+
+// bucketBound: upper bound of bucket i
+func bucketBound(i int) time.Duration {
+	return time.Duration(float64(latencyBase) * math.Pow(latencyGrowth, float64(i)))
+}
+
+// roll: start a new window if the current one is over, forgetting the last one
+// and the current one too after a whole window without samples
+func (h *latencyHistogram) roll(now time.Time, window time.Duration) {
+	elapsed := now.Sub(h.started)
+	if elapsed < window {
+		return
+	}
+	h.prev = h.cur
+	if elapsed >= 2*window {
+		h.prev = [latencyBuckets]int64{}
+	}
+	h.cur = [latencyBuckets]int64{}
+	h.started = now
+}
+
+// record: count a latency
+func (h *latencyHistogram) record(d time.Duration, window time.Duration) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.roll(time.Now(), window)
+	h.cur[latencyBucket(d)]++
+}
+
+// percentile: upper bound of the bucket holding percentile p of the recent
+// latencies, ok is false with fewer than minSamples of them
+func (h *latencyHistogram) percentile(p float64, window time.Duration, minSamples int) (d time.Duration, samples int64, ok bool) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.roll(time.Now(), window)
+	var counts [latencyBuckets]int64
+	for i := range counts {
+		counts[i] = h.cur[i] + h.prev[i]
+		samples += counts[i]
+	}
+	if samples == 0 || samples < int64(minSamples) {
+		return 0, samples, false
+	}
+	rank := int64(math.Ceil(p * float64(samples)))
+	var seen int64
+	for i, n := range counts {
+		if seen += n; seen >= rank {
+			return bucketBound(i), samples, true
+		}
+	}
+	return bucketBound(latencyBuckets - 1), samples, true
+}
+
+// peerLatencies: latency histograms of the peers a client talks to, by addr
+type peerLatencies struct {
+	opts  AdaptiveTimeouts
+	mtx   sync.Mutex
+	peers map[string]*latencyHistogram
+}
+
+// newPeerLatencies: track latencies under opts, timeout is the client's static deadline
+func newPeerLatencies(opts AdaptiveTimeouts, timeout time.Duration) *peerLatencies {
+	return &peerLatencies{opts: opts.withDefaults(timeout), peers: make(map[string]*latencyHistogram)}
+}
+
+// record: count a latency of the peer at addr
+func (l *peerLatencies) record(addr string, d time.Duration) {
+	l.mtx.Lock()
+	h, ok := l.peers[addr]
+	if !ok {
+		h = &latencyHistogram{started: time.Now()}
+		l.peers[addr] = h
+	}
+	l.mtx.Unlock()
+	h.record(d, l.opts.Window)
+}
+
+// histograms: the histograms of all peers seen
+func (l *peerLatencies) histograms() map[string]*latencyHistogram {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	peers := make(map[string]*latencyHistogram, len(l.peers))
+	for addr, h := range l.peers {
+		peers[addr] = h
+	}
+	return peers
+}
+
+// derive: percentile p of the slowest peer with enough samples, scaled by
+// multiplier and clamped between Floor and Ceiling. The balancer picks the peer
+// after the deadline is set, so the deadline must suit any of them. ok is false
+// while no peer has enough samples
+func (l *peerLatencies) derive(p, multiplier float64) (time.Duration, bool) {
+	var slowest time.Duration
+	found := false
+	for _, h := range l.histograms() {
+		if d, _, ok := h.percentile(p, l.opts.Window, l.opts.MinSamples); ok {
+			slowest, found = max(slowest, d), true
+		}
+	}
+	if !found {
+		return 0, false
+	}
+	d := time.Duration(float64(slowest) * multiplier)
+	return min(max(d, l.opts.Floor), l.opts.Ceiling), true
+}
+
+// timeout: deadline of an attempt, Ceiling until the peers have enough samples
+func (l *peerLatencies) timeout() time.Duration {
+	if d, ok := l.derive(l.opts.Percentile, l.opts.Multiplier); ok {
+		return d
+	}
+	return l.opts.Ceiling
+}
+
+// hedgeDelay: wait before a get still waiting is sent again, ok is false when
+// hedging is disabled or the peers don't have enough samples yet
+func (l *peerLatencies) hedgeDelay() (time.Duration, bool) {
+	if l.opts.HedgePercentile < 0 {
+		return 0, false
+	}
+	return l.derive(l.opts.HedgePercentile, 1)
+}
+
+// PeerLatency: recent latencies of a peer and the deadline they give it
+type PeerLatency struct {
+	Addr    string
+	Samples int64         // latencies in the recent windows
+	P50     time.Duration // median, 0 without enough samples
+	P99     time.Duration // 99th percentile, 0 without enough samples
+	Timeout time.Duration // deadline the peer's latencies alone would give, Ceiling without enough samples
+}
+
+// PeerLatencies: recent latencies of the peers the client talked to, sorted by
+// addr, nil unless ClientOptions.Adaptive is set
+func (c *Client) PeerLatencies() []PeerLatency {
+	if c.latencies == nil {
+		return nil
+	}
+	opts := c.latencies.opts
+	var out []PeerLatency
+	for addr, h := range c.latencies.histograms() {
+		pl := PeerLatency{Addr: addr, Timeout: opts.Ceiling}
+		pl.P50, pl.Samples, _ = h.percentile(0.5, opts.Window, opts.MinSamples)
+		pl.P99, _, _ = h.percentile(0.99, opts.Window, opts.MinSamples)
+		if d, _, ok := h.percentile(opts.Percentile, opts.Window, opts.MinSamples); ok {
+			pl.Timeout = min(max(time.Duration(float64(d)*opts.Multiplier), opts.Floor), opts.Ceiling)
+		}
+		out = append(out, pl)
+	}
+	slices.SortFunc(out, func(a, b PeerLatency) int { return cmp.Compare(a.Addr, b.Addr) })
+	return out
+}
+
+// timedMethods: rpcs whose latencies drive adaptive deadlines, the others do
+// more work per call and keep the static Ceiling
+var timedMethods = map[string]bool{
+	pb.Cache_Get_FullMethodName:    true,
+	pb.Cache_Set_FullMethodName:    true,
+	pb.Cache_Delete_FullMethodName: true,
+}
+
+// measureUnary: client interceptor recording the latency of each call by the
+// peer that served it. Calls that failed before reaching a peer or were
+// canceled, as hedged attempts that lost are, say nothing of its latency; calls
+// past their deadline count with the time they waited
+func (c *Client) measureUnary(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if !timedMethods[method] {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	var p peer.Peer
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Peer(&p))...)
+	elapsed := time.Since(start)
+	switch status.Code(err) {
+	case codes.Canceled, codes.Unavailable:
+		return err
+	}
+	if addr := peerAddr(p.Addr, c.addr); addr != "" {
+		c.latencies.record(addr, elapsed)
+	}
+	return err
+}
+
+// peerAddr: addr of the peer a call went to, fallback if grpc didn't tell
+func peerAddr(addr net.Addr, fallback string) string {
+	if addr != nil {
+		return addr.String()
+	}
+	return fallback
+}
+
+// hedge: call fn, and again if the first call is still waiting after delay,
+// each under its own deadline of timeout. The first answer wins and cancels the
+// other call; an attempt past its own deadline or unavailable waits for the other
+func (c *Client) hedge(ctx context.Context, timeout, delay time.Duration, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan error, 2)
+	run := func() {
+		actx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		results <- fn(actx)
+	}
+	go run()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	inflight, hedged := 1, false
+	for {
+		select {
+		case <-timer.C:
+			inflight, hedged = inflight+1, true
+			go run()
+		case err := <-results:
+			inflight--
+			// a first call failing early is retried by invoke, not hedged
+			if inflight == 0 || !hedged || !retryable(ctx, err) {
+				return err
+			}
+		}
+	}
+}
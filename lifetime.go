@@ -0,0 +1,168 @@
+package rebelcache
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+var (
+	// lifetimeReadBounds: upper bounds of the buckets of the time from set to last get
+	lifetimeReadBounds = []time.Duration{time.Second, 10 * time.Second, time.Minute, 10 * time.Minute, time.Hour, 24 * time.Hour}
+	// lifetimeGetBounds: upper bounds of the buckets of the gets of an entry
+	lifetimeGetBounds = []int64{0, 1, 3, 10, 100, 1000}
+)
+
+// LifetimeStats: how the entries that left a cache were used while cached,
+// to tell groups caching values nobody reads, see CacheOptions.Lifetimes.
+// Entries still cached are not counted
+type LifetimeStats struct {
+	Entries        int64 `json:"entries"`          // entries evicted, expired, deleted or overwritten
+	NeverRead      int64 `json:"never_read"`       // of these, entries no get read
+	NeverReadBytes int64 `json:"never_read_bytes"` // bytes the entries never read held
+	// LastReadAfter: entries read by the time from their set to their last
+	// get, by the upper bound of the bucket, e.g. "1m", or "+Inf"
+	LastReadAfter map[string]int64 `json:"last_read_after"`
+	// Gets: entries by the gets they served, by range, e.g. "4-10", or "1001+"
+	Gets map[string]int64 `json:"gets"`
+}
+
+// lifetimes: counters behind LifetimeStats
+type lifetimes struct {
+	entries        atomic.Int64
+	neverRead      atomic.Int64
+	neverReadBytes atomic.Int64
+	readAfter      []atomic.Int64 // by lifetimeReadBounds, then beyond
+	gets           []atomic.Int64 // by lifetimeGetBounds, then beyond
+}
+
+// newLifetimes: the lifetime counters of a cache, nil unless enabled
+func newLifetimes(enabled bool) *lifetimes {
+	if !enabled {
+		return nil
+	}
+	return &lifetimes{
+		readAfter: make([]atomic.Int64, len(lifetimeReadBounds)+1),
+		gets:      make([]atomic.Int64, len(lifetimeGetBounds)+1),
+	}
+}
+
+// read: count a get served by a stored value
+func (l *lifetimes) read(value store.Value) {
+	if l == nil {
+		return
+	}
+	if v, ok := value.(*provenanceValue); ok {
+		v.gets.Add(1)
+		v.lastGet.Store(time.Now().UnixNano())
+	}
+}
+
+// end: count a stored value leaving the cache
+func (l *lifetimes) end(value store.Value) {
+	if l == nil {
+		return
+	}
+	v, ok := value.(*provenanceValue)
+	if !ok {
+		return
+	}
+	l.entries.Add(1)
+	gets := v.gets.Load()
+	bucket := len(lifetimeGetBounds)
+	for i, bound := range lifetimeGetBounds {
+		if gets <= bound {
+			bucket = i
+			break
+		}
+	}
+	l.gets[bucket].Add(1)
+	if gets == 0 {
+		l.neverRead.Add(1)
+		l.neverReadBytes.Add(int64(v.Value.Len()))
+		return
+	}
+	after := time.Duration(v.lastGet.Load() - v.created)
+	bucket = len(lifetimeReadBounds)
+	for i, bound := range lifetimeReadBounds {
+		if after <= bound {
+			bucket = i
+			break
+		}
+	}
+	l.readAfter[bucket].Add(1)
+}
+
+// stats: the counters as LifetimeStats
+func (l *lifetimes) stats() LifetimeStats {
+	s := LifetimeStats{
+		Entries:        l.entries.Load(),
+		NeverRead:      l.neverRead.Load(),
+		NeverReadBytes: l.neverReadBytes.Load(),
+		LastReadAfter:  make(map[string]int64, len(l.readAfter)),
+		Gets:           make(map[string]int64, len(l.gets)),
+	}
+	for i := range l.readAfter {
+		label := "+Inf"
+		if i < len(lifetimeReadBounds) {
+			label = shortDuration(lifetimeReadBounds[i])
+		}
+		s.LastReadAfter[label] = l.readAfter[i].Load()
+	}
+	for i := range l.gets {
+		var label string
+		switch {
+		case i == len(lifetimeGetBounds):
+			label = strconv.FormatInt(lifetimeGetBounds[i-1]+1, 10) + "+"
+		case i == 0 || lifetimeGetBounds[i-1]+1 == lifetimeGetBounds[i]:
+			label = strconv.FormatInt(lifetimeGetBounds[i], 10)
+		default:
+			label = fmt.Sprintf("%d-%d", lifetimeGetBounds[i-1]+1, lifetimeGetBounds[i])
+		}
+		s.Gets[label] = l.gets[i].Load()
+	}
+	return s
+}
+
+// shortDuration: d as 10s, 1m or 24h rather than 1m0s or 24h0m0s
+func shortDuration(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return strconv.FormatInt(int64(d/time.Hour), 10) + "h"
+	case d >= time.Minute && d%time.Minute == 0:
+		return strconv.FormatInt(int64(d/time.Minute), 10) + "m"
+	}
+	return d.String()
+}
+
+// endOverwritten: count the value key held before a write as ended if the
+// write replaced it. Stores that can't peek, see store.Peeker, only count
+// entries leaving them
+func (l *lifetimes) endOverwritten(s store.Store, key string, before store.Value) {
+	if l == nil || before == nil {
+		return
+	}
+	after, _ := s.(store.Peeker).Peek(key)
+	if old, ok := before.(*provenanceValue); ok {
+		if v, ok := after.(*provenanceValue); ok && v != old {
+			l.end(old)
+		}
+	}
+}
+
+// peek: the value of key before a write, nil if the lifetimes are not
+// counted or the store can't peek
+func (l *lifetimes) peek(s store.Store, key string) store.Value {
+	if l == nil {
+		return nil
+	}
+	p, ok := s.(store.Peeker)
+	if !ok {
+		return nil
+	}
+	value, _ := p.Peek(key)
+	return value
+}
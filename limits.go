@@ -0,0 +1,183 @@
+package rebelcache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ConcurrencyOptions: caps on the unary rpcs a node serves at once, so
+// overload shows as fast ResourceExhausted rejections instead of unbounded
+// goroutines and memory. An rpc over a cap waits in a queue for a slot,
+// bounded in length and time. Streams, like Watch, are not capped
+type ConcurrencyOptions struct {
+	MaxConcurrent int // rpcs served at once by the node, 0 means no limit
+	MaxPerConn    int // rpcs served at once for one connection, 0 means no limit
+	// MaxQueued: rpcs waiting for a slot, those beyond are rejected at once,
+	// 0 rejects rpcs over a cap without waiting
+	MaxQueued int
+	// QueueTimeout: longest wait of an rpc for a slot, 0 means 100ms. Bounds
+	// the wait of forwarded rpcs on nodes whose slots wait on forwards too
+	QueueTimeout time.Duration
+}
+
+// ConcurrencyStats: what the concurrency caps let through and turned away
+type ConcurrencyStats struct {
+	InFlight         int64         // rpcs being served
+	Queued           int64         // rpcs waiting for a slot
+	QueuedTotal      int64         // rpcs that got a slot after waiting
+	QueueWait        time.Duration // summed waits of QueuedTotal
+	RejectedNode     int64         // rpcs rejected over MaxConcurrent
+	RejectedConn     int64         // rpcs rejected over MaxPerConn
+	RejectedQueue    int64         // of the rejected, those over MaxQueued
+	RejectedTimeouts int64         // of the rejected, those waiting QueueTimeout
+}
+
+// concurrencyLimiter: slots of the node and of each connection
+type concurrencyLimiter struct {
+	opts ConcurrencyOptions
+	node chan struct{} // a token per rpc served, nil without MaxConcurrent
+	mtx  sync.Mutex
+	// conns: slots by remote addr of the connection, dropped once unused
+	conns map[string]*connSlots
+	// counters of ConcurrencyStats
+	inFlight, queued, queuedTotal, queueWait atomic.Int64
+	rejectedNode, rejectedConn               atomic.Int64
+	rejectedQueue, rejectedTimeouts          atomic.Int64
+}
+
+// connSlots: slots of one connection and the rpcs holding or waiting for them
+type connSlots struct {
+	tokens chan struct{}
+	users  int
+}
+
+// newConcurrencyLimiter: create a limiter, nil if opts is nil
+func newConcurrencyLimiter(opts *ConcurrencyOptions) *concurrencyLimiter {
+	if opts == nil {
+		return nil
+	}
+	l := &concurrencyLimiter{opts: *opts, conns: make(map[string]*connSlots)}
+	if l.opts.QueueTimeout <= 0 {
+		l.opts.QueueTimeout = 100 * time.Millisecond
+	}
+	if l.opts.MaxConcurrent > 0 {
+		l.node = make(chan struct{}, l.opts.MaxConcurrent)
+	}
+	return l
+}
+
+// limitUnary: server interceptor serving an rpc once it holds a slot of its
+// connection and of the node. Pings take none, their wait would count as rtt
+func (l *concurrencyLimiter) limitUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if info.FullMethod == pb.Cache_Ping_FullMethodName {
+		return handler(ctx, req)
+	}
+	// the connection's slot first, so one busy connection queues on its own cap
+	if conn := l.conn(ctx); conn != nil {
+		defer l.releaseConn(ctx, conn)
+		if err := l.acquire(ctx, conn.tokens, &l.rejectedConn, "connection"); err != nil {
+			return nil, err
+		}
+		defer func() { <-conn.tokens }()
+	}
+	if l.node != nil {
+		if err := l.acquire(ctx, l.node, &l.rejectedNode, "node"); err != nil {
+			return nil, err
+		}
+		defer func() { <-l.node }()
+	}
+	l.inFlight.Add(1)
+	defer l.inFlight.Add(-1)
+	return handler(ctx, req)
+}
+
+// acquire: put a token in slots, waiting in the queue if they are full,
+// rejections are counted in rejected
+func (l *concurrencyLimiter) acquire(ctx context.Context, slots chan struct{}, rejected *atomic.Int64, scope string) error {
+	select {
+	case slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if l.queued.Add(1) > int64(l.opts.MaxQueued) {
+		l.queued.Add(-1)
+		rejected.Add(1)
+		l.rejectedQueue.Add(1)
+		return status.Errorf(codes.ResourceExhausted, "rebelcache: %s at its concurrency limit", scope)
+	}
+	defer l.queued.Add(-1)
+	start := time.Now()
+	timer := time.NewTimer(l.opts.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		l.queuedTotal.Add(1)
+		l.queueWait.Add(int64(time.Since(start)))
+		return nil
+	case <-timer.C:
+		rejected.Add(1)
+		l.rejectedTimeouts.Add(1)
+		return status.Errorf(codes.ResourceExhausted, "rebelcache: no slot of the %s after %v", scope, l.opts.QueueTimeout)
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// conn: the slots of the connection of ctx, nil without MaxPerConn or a
+// known peer. Pair with releaseConn
+func (l *concurrencyLimiter) conn(ctx context.Context) *connSlots {
+	p, ok := peer.FromContext(ctx)
+	if l.opts.MaxPerConn <= 0 || !ok || p.Addr == nil {
+		return nil
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	c := l.conns[p.Addr.String()]
+	if c == nil {
+		c = &connSlots{tokens: make(chan struct{}, l.opts.MaxPerConn)}
+		l.conns[p.Addr.String()] = c
+	}
+	c.users++
+	return c
+}
+
+// releaseConn: drop the connection's slots once no rpc uses them
+func (l *concurrencyLimiter) releaseConn(ctx context.Context, c *connSlots) {
+	p, _ := peer.FromContext(ctx)
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if c.users--; c.users == 0 {
+		delete(l.conns, p.Addr.String())
+	}
+}
+
+// stats: current ConcurrencyStats
+func (l *concurrencyLimiter) stats() ConcurrencyStats {
+	return ConcurrencyStats{
+		InFlight:         l.inFlight.Load(),
+		Queued:           l.queued.Load(),
+		QueuedTotal:      l.queuedTotal.Load(),
+		QueueWait:        time.Duration(l.queueWait.Load()),
+		RejectedNode:     l.rejectedNode.Load(),
+		RejectedConn:     l.rejectedConn.Load(),
+		RejectedQueue:    l.rejectedQueue.Load(),
+		RejectedTimeouts: l.rejectedTimeouts.Load(),
+	}
+}
+
+// ConcurrencyStats: what the concurrency caps let through and turned away,
+// false if ServerOptions.Concurrency is not set
+func (s *Server) ConcurrencyStats() (ConcurrencyStats, bool) {
+	if s.limiter == nil {
+		return ConcurrencyStats{}, false
+	}
+	return s.limiter.stats(), true
+}
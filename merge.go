@@ -0,0 +1,291 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// ErrNoMerger: the group has no merge operator, see WithMerger
+var ErrNoMerger = errors.New("rebelcache: group has no merge operator")
+
+// ErrInvalidPatch: a patch starts past the end of the value, see Cache.Patch
+var ErrInvalidPatch = errors.New("rebelcache: invalid patch")
+
+// Merger: combines an operand into the value of a key where the key is
+// held, so counters, sets or logs are updated without a read-modify-write
+// round trip. existing is nil for an absent key, the result must not be nil.
+// It runs under the key's lock and must not call back into the cache
+type Merger interface {
+	Merge(key string, existing, operand store.Value) (store.Value, error)
+}
+
+// MergerFunc: adapter allowing ordinary functions as Mergers
+type MergerFunc func(key string, existing, operand store.Value) (store.Value, error)
+
+// Merge: implements Merger
+func (f MergerFunc) Merge(key string, existing, operand store.Value) (store.Value, error) {
+	return f(key, existing, operand)
+}
+
+// WithMerger: combine operands into values of the group with m, see Group.Merge
+func WithMerger(m Merger) GroupOption {
+	return func(o *CacheOptions) {
+		o.Merger = m
+	}
+}
+
+// Merge: combine operand into the value of key with the Merger and store the
+// result, return it. expiration <= 0 keeps the remaining ttl of a present key
+// and is DefaultTTL for an absent one
+func (c *Cache) Merge(key string, operand store.Value, expiration time.Duration) (store.Value, error) {
+	if c.opts.Merger == nil {
+		return nil, ErrNoMerger
+	}
+	merged, _, err := c.merge(key, c.opts.Merger, operand, expiration, "")
+	return merged, err
+}
+
+// Patch: write data over the value of key at offset, extending it as needed,
+// and return the result. A negative offset appends, an absent key is empty
+// and an offset past the value's end is ErrInvalidPatch. See Merge for
+// expiration
+func (c *Cache) Patch(key string, offset int64, data []byte, expiration time.Duration) (store.Value, error) {
+	merged, _, err := c.merge(key, patchAt(offset), ByteView{b: data}, expiration, "")
+	return merged, err
+}
+
+// merge: Merge with m recording origin in the entry's provenance, ttl is the
+// one the result was stored with, NoExpiration for a present key without any
+func (c *Cache) merge(key string, m Merger, operand store.Value, expiration time.Duration, origin string) (merged store.Value, ttl time.Duration, err error) {
+	ttl = expiration
+	err = c.write(key, func(s store.Store, key string) (err error) {
+		existing, ok := s.Get(key)
+		if ok {
+			existing = unwrapValue(existing)
+		}
+		if remaining, live := s.TTL(key); ok && live && expiration <= 0 && expiration != NoExpiration {
+			ttl = remaining
+			if remaining == 0 {
+				ttl = NoExpiration
+			}
+		}
+		defer recoverPanic("merger", &err)
+		if merged, err = m.Merge(key, existing, operand); err != nil {
+			return err
+		}
+		if merged == nil {
+			return fmt.Errorf("rebelcache: merge of %s: %w", FormatKey(key), store.ErrNilValue)
+		}
+		_, err = c.set(s, key, merged, ttl, origin)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return merged, ttl, nil
+}
+
+// patchAt: the Merger writing the operand over the value at offset, see Cache.Patch
+func patchAt(offset int64) Merger {
+	return MergerFunc(func(key string, existing, operand store.Value) (store.Value, error) {
+		var b []byte
+		if existing != nil {
+			var err error
+			if b, err = valueBytes(existing); err != nil {
+				return nil, err
+			}
+		}
+		data, err := valueBytes(operand)
+		if err != nil {
+			return nil, err
+		}
+		at := offset
+		if at < 0 {
+			at = int64(len(b))
+		}
+		if at > int64(len(b)) {
+			return nil, fmt.Errorf("%w: offset %d past the end %d of %s", ErrInvalidPatch, at, len(b), FormatKey(key))
+		}
+		patched := make([]byte, max(len(b), int(at)+len(data)))
+		copy(patched, b)
+		copy(patched[at:], data)
+		return ByteView{b: patched}, nil
+	})
+}
+
+// mergePeer: implemented by PeerGetters merging on the owner of a key, the
+// peers of ClientPicker do
+type mergePeer interface {
+	// merge: send the merge req to the peer, return the merged value
+	merge(ctx context.Context, req *pb.MergeRequest) ([]byte, error)
+}
+
+// merge: implements mergePeer, under the caller's deadline less reserve
+func (p peerClient) merge(ctx context.Context, req *pb.MergeRequest) ([]byte, error) {
+	ctx, cancel, err := hopContext(ctx, p.reserve)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	p.stats.forwards.Add(1)
+	value, err := p.Client.mergeOp(withOwnerWrite(ctx), req)
+	if err != nil {
+		p.stats.failures.Add(1)
+	}
+	return value, err
+}
+
+// Merge: combine operand into the value of key with the group's Merger on
+// the key's owner, return the merged value, see Cache.Merge for ttl. The
+// merged value is copied to the replicas and deletes the keys derived from
+// key as SetWithExpiration does, a copy here of a key a peer owns is dropped
+// as it would miss the merges made through other nodes, unless the node is a
+// replica the owner copies them to. An unreachable owner fails the merge,
+// merging locally would fork the value
+func (g *Group) Merge(ctx context.Context, key string, operand store.Value, ttl time.Duration) (store.Value, error) {
+	if g.cache.opts.Merger == nil {
+		return nil, fmt.Errorf("%w: group %q", ErrNoMerger, g.name)
+	}
+	return g.merge(ctx, key, plainMerger(g.cache.opts.Merger), operand, ttl, &pb.MergeRequest{})
+}
+
+// Patch: write data over the value of key at offset on the key's owner, see
+// Cache.Patch and Merge. Only the patch travels to the owner, its replicas
+// get the whole value
+func (g *Group) Patch(ctx context.Context, key string, offset int64, data []byte, ttl time.Duration) (store.Value, error) {
+	return g.merge(ctx, key, plainMerger(patchAt(offset)), byteViewOf(data), ttl, &pb.MergeRequest{Patch: true, Offset: offset})
+}
+
+// merge: combine operand into the value of key with m on the key's owner, req
+// tells a peer owning it how, its group, key, operand and ttl are filled in
+func (g *Group) merge(ctx context.Context, key string, m Merger, operand store.Value, ttl time.Duration, req *pb.MergeRequest) (store.Value, error) {
+	if err := g.checkWritable(); err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, fmt.Errorf("%w: empty key", ErrInvalidKey)
+	}
+	norm, err := g.cache.opts.KeyPolicy.Apply(key)
+	if err != nil {
+		return nil, err
+	}
+	if !isForwarded(ctx) {
+		if peer, ok := g.pickPeer(norm); ok {
+			if mp, ok := peer.(mergePeer); ok {
+				return g.mergeOnPeer(ctx, mp, req, key, norm, operand, ttl)
+			}
+		}
+	}
+	merged, ttl, err := g.cache.merge(key, m, operand, ttl, originFromContext(ctx, "merge"))
+	if err != nil {
+		return nil, err
+	}
+	g.invalidateDependents(ctx, key)
+	return merged, g.replicateSet(ctx, key, merged, ttl)
+}
+
+// mergeOnPeer: the merge req of key on its owner peer, see dropPeerCopy
+func (g *Group) mergeOnPeer(ctx context.Context, peer mergePeer, req *pb.MergeRequest, key, norm string, operand store.Value, ttl time.Duration) (store.Value, error) {
+	b, err := valueBytes(operand)
+	if err != nil {
+		return nil, err
+	}
+	req.Group, req.Key, req.Operand = g.name, []byte(key), b
+	if ttl > 0 || ttl == NoExpiration {
+		req.Ttl = durationpb.New(ttl)
+	}
+	value, err := peer.merge(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	g.dropPeerCopy(norm)
+	g.invalidateDependents(ctx, key)
+	return byteViewOf(value), nil
+}
+
+// MergeOp: merge an operand into the value of a key of a group, or patch it
+// or add it to a collection
+func (s *Server) MergeOp(ctx context.Context, req *pb.MergeRequest) (*pb.MergeResponse, error) {
+	g, err := s.writableGroup(req.GetGroup())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	key, ttl := string(req.GetKey()), req.GetTtl().AsDuration()
+	var merged store.Value
+	switch {
+	case req.GetPatch():
+		merged, err = g.Patch(ctx, key, req.GetOffset(), req.GetOperand(), ttl)
+	case req.GetCollection() != pb.CollectionOp_COLLECTION_NONE:
+		merged, err = g.collection(ctx, key, req.GetCollection(), req.GetMaxLen(), req.GetOperand())
+	default:
+		merged, err = g.Merge(ctx, key, byteViewOf(req.GetOperand()), ttl)
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	value, err := valueBytes(merged)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.MergeResponse{Value: value}, nil
+}
+
+// Merge: combine operand into the value of key in a group with the group's
+// merge operator on the node owning the key, return the merged value. ttl <= 0
+// keeps the remaining ttl of a present key. A retry after a failed attempt
+// may merge the operand twice
+func (c *Client) Merge(ctx context.Context, group, key string, operand []byte, ttl time.Duration) ([]byte, error) {
+	key, err := c.key(key)
+	if err != nil {
+		return nil, err
+	}
+	return c.mergeOp(ctx, c.mergeRequest(group, key, operand, ttl))
+}
+
+// Patch: write data over the value of key in a group at offset on the node
+// owning the key, return the patched value, so a large value changing in
+// parts is updated without sending it whole. A negative offset appends, an
+// absent key is empty, see Merge for ttl and retries
+func (c *Client) Patch(ctx context.Context, group, key string, offset int64, data []byte, ttl time.Duration) ([]byte, error) {
+	key, err := c.key(key)
+	if err != nil {
+		return nil, err
+	}
+	req := c.mergeRequest(group, key, data, ttl)
+	req.Patch, req.Offset = true, offset
+	return c.mergeOp(ctx, req)
+}
+
+// mergeRequest: the request merging operand into key with ttl
+func (c *Client) mergeRequest(group, key string, operand []byte, ttl time.Duration) *pb.MergeRequest {
+	req := &pb.MergeRequest{Group: group, Key: []byte(key), Operand: operand}
+	if ttl > 0 || ttl == NoExpiration {
+		req.Ttl = durationpb.New(ttl)
+	}
+	return req
+}
+
+// mergeOp: send the merge req, return the merged value
+func (c *Client) mergeOp(ctx context.Context, req *pb.MergeRequest) ([]byte, error) {
+	if server, ok := c.ServerProtocol(); ok {
+		if !server.Supports(CapMerge) || req.GetPatch() && !server.Supports(CapPatch) ||
+			req.GetCollection() != pb.CollectionOp_COLLECTION_NONE && !server.Supports(CapCollections) {
+			return nil, fmt.Errorf("rebelcache: %s doesn't support merges", c.addr)
+		}
+	}
+	var resp *pb.MergeResponse
+	err := c.invoke(ctx, "MergeOp", req.GetGroup(), func(ctx context.Context) (err error) {
+		resp, err = c.grpcCli.MergeOp(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetValue(), nil
+}
@@ -0,0 +1,114 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sumMerger: adds decimal operands to a decimal value
+var sumMerger = MergerFunc(func(key string, existing, operand store.Value) (store.Value, error) {
+	var sum int
+	for _, v := range []store.Value{existing, operand} {
+		if v == nil {
+			continue
+		}
+		b, err := valueBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(string(b))
+		if err != nil {
+			return nil, err
+		}
+		sum += n
+	}
+	return byteViewOf([]byte(strconv.Itoa(sum))), nil
+})
+
+func TestMergeReplicatedFromOwner(t *testing.T) {
+	c := newTestCluster(t, 3, clusterOptions{replicas: 1, groupOpts: []GroupOption{WithMerger(sumMerger)}})
+	ctx := context.Background()
+	key := c.keyOwnedBy(0, "counter")
+	set := c.replicaSet(key)
+	via := slices.IndexFunc([]int{0, 1, 2}, func(i int) bool { return !slices.Contains(set, i) })
+
+	tests := []struct {
+		name string
+		node int
+		want string
+	}{
+		{"via owner", set[0], "1"},
+		{"via replica", set[1], "3"},
+		{"via other node", via, "6"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.client(tt.node, nil).Merge(ctx, testGroup, key, []byte(strconv.Itoa(i+1)), time.Minute)
+			if err != nil || string(got) != tt.want {
+				t.Fatalf("Merge: %q, %v, want %q", got, err, tt.want)
+			}
+			for _, node := range set {
+				eventually(t, "copy on node "+strconv.Itoa(node), func() bool {
+					v, ok := c.cached(node, key)
+					return ok && v == tt.want
+				})
+			}
+			if v, ok := c.cached(via, key); ok {
+				t.Fatalf("node %d outside the replica set caches %q", via, v)
+			}
+		})
+	}
+}
+
+func TestPatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		preset string // value before the patch, empty for none
+		offset int64
+		data   string
+		want   string
+		err    error
+	}{
+		{"absent key", "", 0, "abc", "abc", nil},
+		{"append to absent key", "", -1, "abc", "abc", nil},
+		{"overwrite inside", "hello world", 6, "there", "hello there", nil},
+		{"extend past the end", "hello", 3, "p me", "help me", nil},
+		{"append", "hello", -1, "!", "hello!", nil},
+		{"at the end", "hello", 5, "!", "hello!", nil},
+		{"past the end", "hello", 6, "!", "", ErrInvalidPatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCache(DefaultCacheOptions())
+			defer c.Close()
+			if tt.preset != "" {
+				if err := c.Set("k", byteViewOf([]byte(tt.preset))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := c.Patch("k", tt.offset, []byte(tt.data), 0)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Patch: %v, want %v", err, tt.err)
+			}
+			if err == nil && got.(ByteView).String() != tt.want {
+				t.Fatalf("Patch: %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeWithoutMerger(t *testing.T) {
+	c := newTestCluster(t, 2, clusterOptions{})
+	_, err := c.client(0, nil).Merge(context.Background(), testGroup, c.keyOwnedBy(1, "merge"), []byte("1"), 0)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Merge: %v, want FailedPrecondition", err)
+	}
+}
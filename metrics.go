@@ -0,0 +1,192 @@
+package rebelcache
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// descriptions of the metrics collected at scrape time
+var (
+	hitsDesc      = prometheus.NewDesc("rebelcache_hits_total", "Cache hits.", []string{"group"}, nil)
+	missesDesc    = prometheus.NewDesc("rebelcache_misses_total", "Cache misses.", []string{"group"}, nil)
+	evictionsDesc = prometheus.NewDesc("rebelcache_evictions_total", "Entries evicted to make room.", []string{"group"}, nil)
+	expiredDesc   = prometheus.NewDesc("rebelcache_expired_total", "Entries removed because their ttl passed.", []string{"group"}, nil)
+	usedBytesDesc = prometheus.NewDesc("rebelcache_used_bytes", "Bytes used by the cache entries.", []string{"group"}, nil)
+	entriesDesc   = prometheus.NewDesc("rebelcache_entries", "Number of cache entries.", []string{"group"}, nil)
+	immortalDesc  = prometheus.NewDesc("rebelcache_immortal_entries", "Cache entries without expiration.", []string{"group"}, nil)
+	immBytesDesc  = prometheus.NewDesc("rebelcache_immortal_bytes", "Bytes used by the cache entries without expiration.", []string{"group"}, nil)
+	forwardsDesc  = prometheus.NewDesc("rebelcache_peer_forwards_total", "Gets forwarded to the owning peer.", []string{"peer"}, nil)
+	failuresDesc  = prometheus.NewDesc("rebelcache_peer_forward_failures_total", "Forwarded gets that failed, not found excluded.", []string{"peer"}, nil)
+	panicsDesc    = prometheus.NewDesc("rebelcache_panics_recovered_total", "Panics recovered in the process, by handler or goroutine.", []string{"where"}, nil)
+	aofBytesDesc  = prometheus.NewDesc("rebelcache_aof_disk_bytes", "Bytes of the append-only log files.", nil, nil)
+	compactDesc   = prometheus.NewDesc("rebelcache_aof_compactions_total", "Compactions of the append-only log, by result.", []string{"result"}, nil)
+	reclaimedDesc = prometheus.NewDesc("rebelcache_aof_reclaimed_bytes_total", "Bytes of the append-only log reclaimed by compactions.", nil, nil)
+	lastCompDesc  = prometheus.NewDesc("rebelcache_aof_last_compaction_seconds", "Duration of the last completed compaction of the append-only log.", nil, nil)
+	inFlightDesc  = prometheus.NewDesc("rebelcache_rpc_in_flight", "Rpcs being served under the concurrency caps.", nil, nil)
+	queuedDesc    = prometheus.NewDesc("rebelcache_rpc_queued", "Rpcs waiting for a slot of the concurrency caps.", nil, nil)
+	queuedTotDesc = prometheus.NewDesc("rebelcache_rpc_queued_total", "Rpcs served after waiting for a slot.", nil, nil)
+	queueWaitDesc = prometheus.NewDesc("rebelcache_rpc_queue_wait_seconds_total", "Time rpcs served after waiting spent waiting for a slot.", nil, nil)
+	rejectedDesc  = prometheus.NewDesc("rebelcache_rpc_rejected_total", "Rpcs rejected by the concurrency caps, by cap.", []string{"scope"}, nil)
+	skewedDesc    = prometheus.NewDesc("rebelcache_client_clock_skewed_total", "Rpcs of clients whose clock was off from the node's beyond the max skew.", nil, nil)
+	worstSkewDesc = prometheus.NewDesc("rebelcache_client_clock_skew_worst_seconds", "Skew of the client clock furthest off from the node's so far, positive when behind.", nil, nil)
+)
+
+// metrics: prometheus metrics of a server. Cache and peer metrics are read
+// from the groups and the picker on each scrape, rpc latencies are observed
+type metrics struct {
+	srv         *Server
+	registry    *prometheus.Registry
+	rpcDuration *prometheus.HistogramVec
+	exemplarMin time.Duration // latency from which rpcs attach their trace as exemplar
+	// callerRPCs: rpcs served by caller and feature, see WithCaller
+	callerRPCs *prometheus.CounterVec
+}
+
+// newMetrics: create the metrics of s in a registry of their own
+func newMetrics(s *Server) *metrics {
+	m := &metrics{
+		srv:         s,
+		registry:    prometheus.NewRegistry(),
+		exemplarMin: s.opts.ExemplarLatency,
+		rpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "rebelcache_rpc_duration_seconds",
+			Help:    "Latency of the rpcs served, by method and status code.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10), // 100us to 26s
+		}, []string{"method", "code"}),
+		callerRPCs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rebelcache_caller_rpcs_total",
+			Help: "Rpcs served, by announced caller, feature and method.",
+		}, []string{"caller", "feature", "method"}),
+	}
+	m.registry.MustRegister(
+		m,
+		m.rpcDuration,
+		m.callerRPCs,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Describe: implements prometheus.Collector
+func (m *metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{hitsDesc, missesDesc, evictionsDesc, expiredDesc, usedBytesDesc, entriesDesc, immortalDesc, immBytesDesc, forwardsDesc, failuresDesc, panicsDesc, aofBytesDesc, compactDesc, reclaimedDesc, lastCompDesc, inFlightDesc, queuedDesc, queuedTotDesc, queueWaitDesc, rejectedDesc, skewedDesc, worstSkewDesc} {
+		ch <- d
+	}
+}
+
+// Collect: implements prometheus.Collector. Groups sharing a label, see
+// GroupLabeler, are summed up
+func (m *metrics) Collect(ch chan<- prometheus.Metric) {
+	byLabel := make(map[string]*cacheMetrics)
+	m.srv.groups.Range(func(_, v any) bool {
+		g := v.(*Group)
+		gm := g.cache.metrics()
+		label := m.srv.labels.Label(g.name)
+		sum, ok := byLabel[label]
+		if !ok {
+			byLabel[label] = &gm
+			return true
+		}
+		sum.hits += gm.hits
+		sum.misses += gm.misses
+		sum.evicted += gm.evicted
+		sum.expired += gm.expired
+		if gm.usedBytes >= 0 {
+			sum.usedBytes = max(sum.usedBytes, 0) + gm.usedBytes
+		}
+		sum.entries += gm.entries
+		if gm.immortalEntries >= 0 {
+			sum.immortalEntries = max(sum.immortalEntries, 0) + gm.immortalEntries
+			sum.immortalBytes = max(sum.immortalBytes, 0) + gm.immortalBytes
+		}
+		return true
+	})
+	for label, gm := range byLabel {
+		ch <- prometheus.MustNewConstMetric(hitsDesc, prometheus.CounterValue, float64(gm.hits), label)
+		ch <- prometheus.MustNewConstMetric(missesDesc, prometheus.CounterValue, float64(gm.misses), label)
+		ch <- prometheus.MustNewConstMetric(evictionsDesc, prometheus.CounterValue, float64(gm.evicted), label)
+		ch <- prometheus.MustNewConstMetric(expiredDesc, prometheus.CounterValue, float64(gm.expired), label)
+		if gm.usedBytes >= 0 {
+			ch <- prometheus.MustNewConstMetric(usedBytesDesc, prometheus.GaugeValue, float64(gm.usedBytes), label)
+		}
+		ch <- prometheus.MustNewConstMetric(entriesDesc, prometheus.GaugeValue, float64(gm.entries), label)
+		if gm.immortalEntries >= 0 {
+			ch <- prometheus.MustNewConstMetric(immortalDesc, prometheus.GaugeValue, float64(gm.immortalEntries), label)
+			ch <- prometheus.MustNewConstMetric(immBytesDesc, prometheus.GaugeValue, float64(gm.immortalBytes), label)
+		}
+	}
+
+	if picker := m.srv.opts.Picker; picker != nil {
+		for peer, fc := range picker.forwardCounts() {
+			ch <- prometheus.MustNewConstMetric(forwardsDesc, prometheus.CounterValue, float64(fc.forwards), peer)
+			ch <- prometheus.MustNewConstMetric(failuresDesc, prometheus.CounterValue, float64(fc.failures), peer)
+		}
+	}
+
+	if st, ok := m.srv.AOFStats(); ok {
+		ch <- prometheus.MustNewConstMetric(aofBytesDesc, prometheus.GaugeValue, float64(st.DiskBytes))
+		ch <- prometheus.MustNewConstMetric(compactDesc, prometheus.CounterValue, float64(st.Compactions), "ok")
+		ch <- prometheus.MustNewConstMetric(compactDesc, prometheus.CounterValue, float64(st.CompactionErrors), "error")
+		ch <- prometheus.MustNewConstMetric(reclaimedDesc, prometheus.CounterValue, float64(st.ReclaimedBytes))
+		ch <- prometheus.MustNewConstMetric(lastCompDesc, prometheus.GaugeValue, st.LastCompaction.Seconds())
+	}
+
+	if st, ok := m.srv.ConcurrencyStats(); ok {
+		ch <- prometheus.MustNewConstMetric(inFlightDesc, prometheus.GaugeValue, float64(st.InFlight))
+		ch <- prometheus.MustNewConstMetric(queuedDesc, prometheus.GaugeValue, float64(st.Queued))
+		ch <- prometheus.MustNewConstMetric(queuedTotDesc, prometheus.CounterValue, float64(st.QueuedTotal))
+		ch <- prometheus.MustNewConstMetric(queueWaitDesc, prometheus.CounterValue, st.QueueWait.Seconds())
+		ch <- prometheus.MustNewConstMetric(rejectedDesc, prometheus.CounterValue, float64(st.RejectedNode), "node")
+		ch <- prometheus.MustNewConstMetric(rejectedDesc, prometheus.CounterValue, float64(st.RejectedConn), "connection")
+	}
+	if st, ok := m.srv.ClockSkewStats(); ok {
+		ch <- prometheus.MustNewConstMetric(skewedDesc, prometheus.CounterValue, float64(st.Skewed))
+		ch <- prometheus.MustNewConstMetric(worstSkewDesc, prometheus.GaugeValue, st.WorstSkew.Seconds())
+	}
+
+	panicCounts.Range(func(where, n any) bool {
+		ch <- prometheus.MustNewConstMetric(panicsDesc, prometheus.CounterValue, float64(n.(*atomic.Int64).Load()), where.(string))
+		return true
+	})
+}
+
+// unaryInterceptor: observe the latency of unary rpcs and count them per
+// announced caller, slow rpcs traced under a sampled span carry its ids as exemplar
+func (m *metrics) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	elapsed := time.Since(start)
+	method := path.Base(info.FullMethod)
+	caller, feature := CallerFromContext(ctx)
+	if caller == "" {
+		caller = anonymousCaller
+	}
+	m.callerRPCs.WithLabelValues(caller, feature, method).Inc()
+	obs := m.rpcDuration.WithLabelValues(method, status.Code(err).String())
+	if sc := trace.SpanContextFromContext(ctx); sc.IsSampled() && elapsed >= m.exemplarMin {
+		obs.(prometheus.ExemplarObserver).ObserveWithExemplar(elapsed.Seconds(),
+			prometheus.Labels{"trace_id": sc.TraceID().String(), "span_id": sc.SpanID().String()})
+		return resp, err
+	}
+	obs.Observe(elapsed.Seconds())
+	return resp, err
+}
+
+// MetricsHandler: prometheus metrics of the node, served at /metrics of
+// MetricsAddr when set, callers it doesn't allow are rejected. Scrapers
+// negotiating OpenMetrics get the exemplars of the latency histogram too
+func (s *Server) MetricsHandler() http.Handler {
+	h := promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{EnableOpenMetrics: true})
+	return s.allowlist.httpMiddleware(h)
+}
@@ -0,0 +1,76 @@
+package rebelcache
+
+import (
+	"fmt"
+	"strings"
+)
+
+// servicesPrefix: etcd directory holding all registered services, under EtcdOptions.Prefix
+const servicesPrefix = "/services"
+
+// resolverScheme: grpc target scheme for cache clusters
+const resolverScheme = "rebelcache"
+
+// ServiceName: identity of a cache cluster, reflected in etcd paths,
+// metrics labels and client dial targets, so one application can
+// talk to several distinct clusters at the same time
+type ServiceName struct {
+	Cluster string // cluster name, required
+	Group   string // group of nodes within the cluster, empty means "default"
+}
+
+// ParseServiceName: parse "cluster" or "cluster/group"
+func ParseServiceName(s string) (ServiceName, error) {
+	cluster, group, _ := strings.Cut(s, "/")
+	name := ServiceName{Cluster: cluster, Group: group}
+	if err := name.Validate(); err != nil {
+		return ServiceName{}, err
+	}
+	return name, nil
+}
+
+// Validate: check the name can be used in paths and targets
+func (n ServiceName) Validate() error {
+	if n.Cluster == "" {
+		return fmt.Errorf("rebelcache: service name %q: empty cluster", n.String())
+	}
+	for _, part := range []string{n.Cluster, n.Group} {
+		if strings.ContainsAny(part, "/ ") {
+			return fmt.Errorf("rebelcache: service name %q: %q contains '/' or space", n.String(), part)
+		}
+	}
+	return nil
+}
+
+// group: group name with the default applied
+func (n ServiceName) group() string {
+	if n.Group == "" {
+		return "default"
+	}
+	return n.Group
+}
+
+// String: "cluster/group"
+func (n ServiceName) String() string {
+	return n.Cluster + "/" + n.group()
+}
+
+// EtcdPrefix: etcd directory the cluster's nodes register under
+func (n ServiceName) EtcdPrefix() string {
+	return servicesPrefix + "/" + n.String() + "/"
+}
+
+// EtcdKey: etcd key a node at addr registers under
+func (n ServiceName) EtcdKey(addr string) string {
+	return n.EtcdPrefix() + addr
+}
+
+// Target: grpc dial target of the cluster
+func (n ServiceName) Target() string {
+	return resolverScheme + ":///" + n.String()
+}
+
+// Labels: metrics labels identifying the cluster
+func (n ServiceName) Labels() map[string]string {
+	return map[string]string{"cluster": n.Cluster, "group": n.group()}
+}
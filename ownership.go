@@ -0,0 +1,232 @@
+package rebelcache
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+const (
+	rateBuckets     = 256              // finest ring segments gets are counted in
+	rateWindow      = 10 * time.Second // window request rates are measured over
+	defaultSegments = 16               // ring segments of an ownership report by default
+)
+
+// ringView: the ring a PeerPicker places keys on, ClientPicker implements it
+type ringView interface {
+	keyHash(key string) uint32
+	shares(segments int) []float64
+}
+
+// segmentRates: gets served by ring position, counted over fixed windows
+type segmentRates struct {
+	mtx     sync.Mutex
+	started atomic.Int64 // unix nanos of the current window
+	cur     [rateBuckets]atomic.Int64
+	prev    [rateBuckets]int64 // counts of the last complete window
+	prevLen time.Duration      // length of the last complete window, 0 before the first
+}
+
+// newSegmentRates: create rates whose first window starts now
+func newSegmentRates() *segmentRates {
+	r := &segmentRates{}
+	r.started.Store(time.Now().UnixNano())
+	return r
+}
+
+// record: count a get of the key at ring position h
+func (r *segmentRates) record(h uint32) {
+	r.roll(time.Now())
+	r.cur[h>>24].Add(1)
+}
+
+// roll: start a new window if the current one is over
+func (r *segmentRates) roll(now time.Time) {
+	if now.UnixNano()-r.started.Load() < int64(rateWindow) {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	started := r.started.Load()
+	if now.UnixNano()-started < int64(rateWindow) {
+		return
+	}
+	// an idle window can last longer, its rates are averaged over all of it
+	for i := range r.cur {
+		r.prev[i] = r.cur[i].Swap(0)
+	}
+	r.prevLen = time.Duration(now.UnixNano() - started)
+	r.started.Store(now.UnixNano())
+}
+
+// rates: gets per second of each bucket over the last complete window, or
+// over the current one before a window completed
+func (r *segmentRates) rates() [rateBuckets]float64 {
+	now := time.Now()
+	r.roll(now)
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	var rates [rateBuckets]float64
+	if r.prevLen > 0 {
+		for i, n := range r.prev {
+			rates[i] = float64(n) / r.prevLen.Seconds()
+		}
+		return rates
+	}
+	elapsed := time.Duration(now.UnixNano() - r.started.Load())
+	if elapsed <= 0 {
+		return rates
+	}
+	for i := range r.cur {
+		rates[i] = float64(r.cur[i].Load()) / elapsed.Seconds()
+	}
+	return rates
+}
+
+// OwnershipReport: what a node holds and serves of a group by ring segment,
+// for checking that the ring spreads the load evenly, see Client.Ownership
+type OwnershipReport struct {
+	Group    string
+	Node     string
+	Segments []SegmentLoad // in ring order
+}
+
+// SegmentLoad: a slice of the ring in an OwnershipReport
+type SegmentLoad struct {
+	Start     uint32  // first ring position, the segment ends where the next one starts
+	RingShare float64 // part of the segment the node owns on its ring, 0 to 1
+	Keys      int64   // entries held by the node
+	Bytes     int64   // bytes of their keys and values
+	QPS       float64 // gets served by the node
+}
+
+// totals: the node's share of the ring and its keys, bytes and gets over all segments
+func (r *OwnershipReport) totals() (share float64, keys, bytes int64, qps float64) {
+	for _, seg := range r.Segments {
+		share += seg.RingShare
+		keys += seg.Keys
+		bytes += seg.Bytes
+		qps += seg.QPS
+	}
+	if len(r.Segments) > 0 {
+		share /= float64(len(r.Segments))
+	}
+	return share, keys, bytes, qps
+}
+
+// errNotRangeable: the group's store cannot be ranged over, see store.Ranger
+var errNotRangeable = errors.New("rebelcache: store cannot list its entries")
+
+// keyHash: position of the normalized key on ring, nil is a ring with the default hash
+func keyHash(ring ringView, key string) uint32 {
+	if ring != nil {
+		return ring.keyHash(key)
+	}
+	// the default hash of consistenthash
+	return crc32.ChecksumIEEE([]byte(key))
+}
+
+// ring: the ring of the group's peers, nil if they don't expose one
+func (g *Group) ring() ringView {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	ring, _ := g.peers.(ringView)
+	return ring
+}
+
+// ownership: the group's entries and gets on this node in segments slices of
+// the ring, segments is a power of two up to rateBuckets
+func (g *Group) ownership(segments int) (*OwnershipReport, error) {
+	report := &OwnershipReport{Group: g.name, Segments: make([]SegmentLoad, segments)}
+	for i := range report.Segments {
+		report.Segments[i].Start = uint32(uint64(i) << 32 / uint64(segments))
+		report.Segments[i].RingShare = 1
+	}
+	ring := g.ring()
+	if ring != nil {
+		for i, share := range ring.shares(segments) {
+			report.Segments[i].RingShare = share
+		}
+	}
+
+	ok := g.cache.Range(func(key string, value store.Value, _ time.Time) bool {
+		seg := &report.Segments[uint64(keyHash(ring, key))*uint64(segments)>>32]
+		seg.Keys++
+		seg.Bytes += int64(len(key) + value.Len())
+		return true
+	})
+	if !ok {
+		return nil, fmt.Errorf("%w: group %q", errNotRangeable, g.name)
+	}
+	for i, qps := range g.served.rates() {
+		report.Segments[i*segments/rateBuckets].QPS += qps
+	}
+	return report, nil
+}
+
+// RenderOwnership: write the reports of the nodes of a group as tables, one
+// line per node with its share of the ring, keys, bytes and gets, the skew of
+// the busiest node over the mean, and one line per segment and node
+func RenderOwnership(w io.Writer, reports []*OwnershipReport) error {
+	reports = slices.Clone(reports)
+	slices.SortFunc(reports, func(a, b *OwnershipReport) int { return cmp.Compare(a.Node, b.Node) })
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	var sumKeys, sumBytes int64
+	var sumQPS float64
+	for _, r := range reports {
+		_, keys, bytes, qps := r.totals()
+		sumKeys, sumBytes, sumQPS = sumKeys+keys, sumBytes+bytes, sumQPS+qps
+	}
+	// pct: part as a percentage of total
+	pct := func(part, total float64) string {
+		if total == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", 100*part/total)
+	}
+
+	fmt.Fprintln(tw, "NODE\tRING\tKEYS\tKEYS%\tBYTES\tBYTES%\tQPS\tQPS%\t")
+	var maxKeys, maxBytes int64
+	var maxQPS float64
+	for _, r := range reports {
+		share, keys, bytes, qps := r.totals()
+		maxKeys, maxBytes, maxQPS = max(maxKeys, keys), max(maxBytes, bytes), max(maxQPS, qps)
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%d\t%s\t%.1f\t%s\t\n", r.Node, pct(share, 1),
+			keys, pct(float64(keys), float64(sumKeys)), bytes, pct(float64(bytes), float64(sumBytes)), qps, pct(qps, sumQPS))
+	}
+	// skew: busiest node over the mean, 1 is perfectly balanced
+	skew := func(most, total float64) string {
+		if total == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.2f", most*float64(len(reports))/total)
+	}
+	fmt.Fprintf(tw, "skew (max/mean)\t\t%s\t\t%s\t\t%s\t\t\n",
+		skew(float64(maxKeys), float64(sumKeys)), skew(float64(maxBytes), float64(sumBytes)), skew(maxQPS, sumQPS))
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "SEGMENT\tNODE\tRING\tKEYS\tBYTES\tQPS\t")
+	segments := 0
+	for _, r := range reports {
+		segments = max(segments, len(r.Segments))
+	}
+	for i := range segments {
+		for _, r := range reports {
+			if i >= len(r.Segments) {
+				continue
+			}
+			seg := r.Segments[i]
+			fmt.Fprintf(tw, "%08x\t%s\t%s\t%d\t%d\t%.1f\t\n", seg.Start, r.Node, pct(seg.RingShare, 1), seg.Keys, seg.Bytes, seg.QPS)
+		}
+	}
+	return tw.Flush()
+}
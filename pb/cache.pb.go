@@ -0,0 +1,2740 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        v5.29.3
+// source: pb/cache.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Consistency: nodes of a key's replica set a get, set or delete waits for,
+// sent only to peers announcing the consistency capability
+type Consistency int32
+
+const (
+	Consistency_CONSISTENCY_ONE    Consistency = 0
+	Consistency_CONSISTENCY_QUORUM Consistency = 1 // a majority of them
+	Consistency_CONSISTENCY_ALL    Consistency = 2
+)
+
+// Enum value maps for Consistency.
+var (
+	Consistency_name = map[int32]string{
+		0: "CONSISTENCY_ONE",
+		1: "CONSISTENCY_QUORUM",
+		2: "CONSISTENCY_ALL",
+	}
+	Consistency_value = map[string]int32{
+		"CONSISTENCY_ONE":    0,
+		"CONSISTENCY_QUORUM": 1,
+		"CONSISTENCY_ALL":    2,
+	}
+)
+
+func (x Consistency) Enum() *Consistency {
+	p := new(Consistency)
+	*p = x
+	return p
+}
+
+func (x Consistency) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Consistency) Descriptor() protoreflect.EnumDescriptor {
+	return file_pb_cache_proto_enumTypes[0].Descriptor()
+}
+
+func (Consistency) Type() protoreflect.EnumType {
+	return &file_pb_cache_proto_enumTypes[0]
+}
+
+func (x Consistency) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Consistency.Descriptor instead.
+func (Consistency) EnumDescriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{0}
+}
+
+// Compression: algorithm a value is compressed with, sent only to and by
+// peers announcing the compression capability
+type Compression int32
+
+const (
+	Compression_COMPRESSION_NONE   Compression = 0
+	Compression_COMPRESSION_SNAPPY Compression = 1
+	Compression_COMPRESSION_GZIP   Compression = 2
+)
+
+// Enum value maps for Compression.
+var (
+	Compression_name = map[int32]string{
+		0: "COMPRESSION_NONE",
+		1: "COMPRESSION_SNAPPY",
+		2: "COMPRESSION_GZIP",
+	}
+	Compression_value = map[string]int32{
+		"COMPRESSION_NONE":   0,
+		"COMPRESSION_SNAPPY": 1,
+		"COMPRESSION_GZIP":   2,
+	}
+)
+
+func (x Compression) Enum() *Compression {
+	p := new(Compression)
+	*p = x
+	return p
+}
+
+func (x Compression) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Compression) Descriptor() protoreflect.EnumDescriptor {
+	return file_pb_cache_proto_enumTypes[1].Descriptor()
+}
+
+func (Compression) Type() protoreflect.EnumType {
+	return &file_pb_cache_proto_enumTypes[1]
+}
+
+func (x Compression) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Compression.Descriptor instead.
+func (Compression) EnumDescriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{1}
+}
+
+// CollectionOp: built-in merge of elements into a set or list value
+type CollectionOp int32
+
+const (
+	CollectionOp_COLLECTION_NONE  CollectionOp = 0
+	CollectionOp_COLLECTION_SADD  CollectionOp = 1 // add to a set
+	CollectionOp_COLLECTION_LPUSH CollectionOp = 2 // push to the head of a list
+)
+
+// Enum value maps for CollectionOp.
+var (
+	CollectionOp_name = map[int32]string{
+		0: "COLLECTION_NONE",
+		1: "COLLECTION_SADD",
+		2: "COLLECTION_LPUSH",
+	}
+	CollectionOp_value = map[string]int32{
+		"COLLECTION_NONE":  0,
+		"COLLECTION_SADD":  1,
+		"COLLECTION_LPUSH": 2,
+	}
+)
+
+func (x CollectionOp) Enum() *CollectionOp {
+	p := new(CollectionOp)
+	*p = x
+	return p
+}
+
+func (x CollectionOp) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (CollectionOp) Descriptor() protoreflect.EnumDescriptor {
+	return file_pb_cache_proto_enumTypes[2].Descriptor()
+}
+
+func (CollectionOp) Type() protoreflect.EnumType {
+	return &file_pb_cache_proto_enumTypes[2]
+}
+
+func (x CollectionOp) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use CollectionOp.Descriptor instead.
+func (CollectionOp) EnumDescriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{2}
+}
+
+type KeyEvent_Type int32
+
+const (
+	KeyEvent_SET    KeyEvent_Type = 0
+	KeyEvent_DELETE KeyEvent_Type = 1
+	KeyEvent_CLEAR  KeyEvent_Type = 2 // all entries of the group were removed, key is unset
+)
+
+// Enum value maps for KeyEvent_Type.
+var (
+	KeyEvent_Type_name = map[int32]string{
+		0: "SET",
+		1: "DELETE",
+		2: "CLEAR",
+	}
+	KeyEvent_Type_value = map[string]int32{
+		"SET":    0,
+		"DELETE": 1,
+		"CLEAR":  2,
+	}
+)
+
+func (x KeyEvent_Type) Enum() *KeyEvent_Type {
+	p := new(KeyEvent_Type)
+	*p = x
+	return p
+}
+
+func (x KeyEvent_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (KeyEvent_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_pb_cache_proto_enumTypes[3].Descriptor()
+}
+
+func (KeyEvent_Type) Type() protoreflect.EnumType {
+	return &file_pb_cache_proto_enumTypes[3]
+}
+
+func (x KeyEvent_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use KeyEvent_Type.Descriptor instead.
+func (KeyEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{9, 0}
+}
+
+type GetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Key           []byte                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`        // keys are binary-safe
+	Cached        bool                   `protobuf:"varint,3,opt,name=cached,proto3" json:"cached,omitempty"` // only a cached value, NotFound on a miss rather than a load
+	Consistency   Consistency            `protobuf:"varint,4,opt,name=consistency,proto3,enum=pb.Consistency" json:"consistency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRequest) Reset() {
+	*x = GetRequest{}
+	mi := &file_pb_cache_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRequest) ProtoMessage() {}
+
+func (x *GetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRequest.ProtoReflect.Descriptor instead.
+func (*GetRequest) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *GetRequest) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *GetRequest) GetCached() bool {
+	if x != nil {
+		return x.Cached
+	}
+	return false
+}
+
+func (x *GetRequest) GetConsistency() Consistency {
+	if x != nil {
+		return x.Consistency
+	}
+	return Consistency_CONSISTENCY_ONE
+}
+
+type GetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Value         []byte                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	Compression   Compression            `protobuf:"varint,2,opt,name=compression,proto3,enum=pb.Compression" json:"compression,omitempty"` // value is compressed with it
+	Hot           bool                   `protobuf:"varint,3,opt,name=hot,proto3" json:"hot,omitempty"`                                     // the key is hot, callers may spread its gets over its replicas
+	Version       uint64                 `protobuf:"varint,4,opt,name=version,proto3" json:"version,omitempty"`                             // version of the entry on the node, set on cached gets
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetResponse) Reset() {
+	*x = GetResponse{}
+	mi := &file_pb_cache_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetResponse) ProtoMessage() {}
+
+func (x *GetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetResponse.ProtoReflect.Descriptor instead.
+func (*GetResponse) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetResponse) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *GetResponse) GetCompression() Compression {
+	if x != nil {
+		return x.Compression
+	}
+	return Compression_COMPRESSION_NONE
+}
+
+func (x *GetResponse) GetHot() bool {
+	if x != nil {
+		return x.Hot
+	}
+	return false
+}
+
+func (x *GetResponse) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type SetRequest struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Group       string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Key         []byte                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Value       []byte                 `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	Ttl         *durationpb.Duration   `protobuf:"bytes,4,opt,name=ttl,proto3" json:"ttl,omitempty"`                                      // unset or zero uses the group's default ttl
+	Compression Compression            `protobuf:"varint,5,opt,name=compression,proto3,enum=pb.Compression" json:"compression,omitempty"` // value is compressed with it
+	Consistency Consistency            `protobuf:"varint,6,opt,name=consistency,proto3,enum=pb.Consistency" json:"consistency,omitempty"`
+	// if_absent: only set the key if it is absent, e.g. so keys handed off by
+	// a draining node don't overwrite newer writes. Sent only to peers
+	// announcing the handoff capability
+	IfAbsent bool `protobuf:"varint,7,opt,name=if_absent,json=ifAbsent,proto3" json:"if_absent,omitempty"`
+	// if_present, if_version: only set the key if it is present, or if its
+	// entry on the node has the version, 0 meaning absent, see
+	// GetResponse.version. At most one condition is set, sent only to peers
+	// announcing the conditional-set capability
+	IfPresent     bool    `protobuf:"varint,8,opt,name=if_present,json=ifPresent,proto3" json:"if_present,omitempty"`
+	IfVersion     *uint64 `protobuf:"varint,9,opt,name=if_version,json=ifVersion,proto3,oneof" json:"if_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetRequest) Reset() {
+	*x = SetRequest{}
+	mi := &file_pb_cache_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetRequest) ProtoMessage() {}
+
+func (x *SetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetRequest.ProtoReflect.Descriptor instead.
+func (*SetRequest) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SetRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *SetRequest) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *SetRequest) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *SetRequest) GetTtl() *durationpb.Duration {
+	if x != nil {
+		return x.Ttl
+	}
+	return nil
+}
+
+func (x *SetRequest) GetCompression() Compression {
+	if x != nil {
+		return x.Compression
+	}
+	return Compression_COMPRESSION_NONE
+}
+
+func (x *SetRequest) GetConsistency() Consistency {
+	if x != nil {
+		return x.Consistency
+	}
+	return Consistency_CONSISTENCY_ONE
+}
+
+func (x *SetRequest) GetIfAbsent() bool {
+	if x != nil {
+		return x.IfAbsent
+	}
+	return false
+}
+
+func (x *SetRequest) GetIfPresent() bool {
+	if x != nil {
+		return x.IfPresent
+	}
+	return false
+}
+
+func (x *SetRequest) GetIfVersion() uint64 {
+	if x != nil && x.IfVersion != nil {
+		return *x.IfVersion
+	}
+	return 0
+}
+
+type SetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Applied       bool                   `protobuf:"varint,1,opt,name=applied,proto3" json:"applied,omitempty"` // false if the condition of the set didn't hold
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetResponse) Reset() {
+	*x = SetResponse{}
+	mi := &file_pb_cache_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetResponse) ProtoMessage() {}
+
+func (x *SetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetResponse.ProtoReflect.Descriptor instead.
+func (*SetResponse) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SetResponse) GetApplied() bool {
+	if x != nil {
+		return x.Applied
+	}
+	return false
+}
+
+type DeleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Key           []byte                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Consistency   Consistency            `protobuf:"varint,3,opt,name=consistency,proto3,enum=pb.Consistency" json:"consistency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRequest) Reset() {
+	*x = DeleteRequest{}
+	mi := &file_pb_cache_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DeleteRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *DeleteRequest) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *DeleteRequest) GetConsistency() Consistency {
+	if x != nil {
+		return x.Consistency
+	}
+	return Consistency_CONSISTENCY_ONE
+}
+
+type DeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Deleted       bool                   `protobuf:"varint,1,opt,name=deleted,proto3" json:"deleted,omitempty"` // whether the key existed
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteResponse) Reset() {
+	*x = DeleteResponse{}
+	mi := &file_pb_cache_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteResponse) ProtoMessage() {}
+
+func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteResponse.ProtoReflect.Descriptor instead.
+func (*DeleteResponse) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *DeleteResponse) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+type StatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatsRequest) Reset() {
+	*x = StatsRequest{}
+	mi := &file_pb_cache_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsRequest) ProtoMessage() {}
+
+func (x *StatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsRequest.ProtoReflect.Descriptor instead.
+func (*StatsRequest) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *StatsRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+type StatsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Hits          int64                  `protobuf:"varint,2,opt,name=hits,proto3" json:"hits,omitempty"`
+	Misses        int64                  `protobuf:"varint,3,opt,name=misses,proto3" json:"misses,omitempty"`
+	HitRate       float64                `protobuf:"fixed64,4,opt,name=hit_rate,json=hitRate,proto3" json:"hit_rate,omitempty"`
+	Size          int64                  `protobuf:"varint,5,opt,name=size,proto3" json:"size,omitempty"`
+	Closed        bool                   `protobuf:"varint,6,opt,name=closed,proto3" json:"closed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatsResponse) Reset() {
+	*x = StatsResponse{}
+	mi := &file_pb_cache_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsResponse) ProtoMessage() {}
+
+func (x *StatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsResponse.ProtoReflect.Descriptor instead.
+func (*StatsResponse) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *StatsResponse) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *StatsResponse) GetHits() int64 {
+	if x != nil {
+		return x.Hits
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetMisses() int64 {
+	if x != nil {
+		return x.Misses
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetHitRate() float64 {
+	if x != nil {
+		return x.HitRate
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetClosed() bool {
+	if x != nil {
+		return x.Closed
+	}
+	return false
+}
+
+type WatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Groups        []string               `protobuf:"bytes,1,rep,name=groups,proto3" json:"groups,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchRequest) Reset() {
+	*x = WatchRequest{}
+	mi := &file_pb_cache_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRequest) ProtoMessage() {}
+
+func (x *WatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRequest.ProtoReflect.Descriptor instead.
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *WatchRequest) GetGroups() []string {
+	if x != nil {
+		return x.Groups
+	}
+	return nil
+}
+
+type KeyEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Type          KeyEvent_Type          `protobuf:"varint,2,opt,name=type,proto3,enum=pb.KeyEvent_Type" json:"type,omitempty"`
+	Key           []byte                 `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	Value         []byte                 `protobuf:"bytes,4,opt,name=value,proto3" json:"value,omitempty"`
+	Ttl           *durationpb.Duration   `protobuf:"bytes,5,opt,name=ttl,proto3" json:"ttl,omitempty"`          // remaining ttl at the time of the write, unset if none
+	Counter       bool                   `protobuf:"varint,6,opt,name=counter,proto3" json:"counter,omitempty"` // value is the decimal form of a counter, see store.Counter
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeyEvent) Reset() {
+	*x = KeyEvent{}
+	mi := &file_pb_cache_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeyEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyEvent) ProtoMessage() {}
+
+func (x *KeyEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyEvent.ProtoReflect.Descriptor instead.
+func (*KeyEvent) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *KeyEvent) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *KeyEvent) GetType() KeyEvent_Type {
+	if x != nil {
+		return x.Type
+	}
+	return KeyEvent_SET
+}
+
+func (x *KeyEvent) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *KeyEvent) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *KeyEvent) GetTtl() *durationpb.Duration {
+	if x != nil {
+		return x.Ttl
+	}
+	return nil
+}
+
+func (x *KeyEvent) GetCounter() bool {
+	if x != nil {
+		return x.Counter
+	}
+	return false
+}
+
+type OwnershipRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Segments      int32                  `protobuf:"varint,2,opt,name=segments,proto3" json:"segments,omitempty"` // slices of the ring reported, a power of two up to 256, 0 means 16
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OwnershipRequest) Reset() {
+	*x = OwnershipRequest{}
+	mi := &file_pb_cache_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OwnershipRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OwnershipRequest) ProtoMessage() {}
+
+func (x *OwnershipRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OwnershipRequest.ProtoReflect.Descriptor instead.
+func (*OwnershipRequest) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *OwnershipRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *OwnershipRequest) GetSegments() int32 {
+	if x != nil {
+		return x.Segments
+	}
+	return 0
+}
+
+type OwnershipResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Node          string                 `protobuf:"bytes,2,opt,name=node,proto3" json:"node,omitempty"`
+	Segments      []*RingSegment         `protobuf:"bytes,3,rep,name=segments,proto3" json:"segments,omitempty"` // in ring order
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OwnershipResponse) Reset() {
+	*x = OwnershipResponse{}
+	mi := &file_pb_cache_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OwnershipResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OwnershipResponse) ProtoMessage() {}
+
+func (x *OwnershipResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OwnershipResponse.ProtoReflect.Descriptor instead.
+func (*OwnershipResponse) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *OwnershipResponse) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *OwnershipResponse) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+func (x *OwnershipResponse) GetSegments() []*RingSegment {
+	if x != nil {
+		return x.Segments
+	}
+	return nil
+}
+
+// RingSegment: a slice of the hash ring, from start up to the start of the next one
+type RingSegment struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Start         uint32                 `protobuf:"varint,1,opt,name=start,proto3" json:"start,omitempty"`
+	RingShare     float64                `protobuf:"fixed64,2,opt,name=ring_share,json=ringShare,proto3" json:"ring_share,omitempty"` // part of the segment the node owns on its ring, 0 to 1
+	Keys          int64                  `protobuf:"varint,3,opt,name=keys,proto3" json:"keys,omitempty"`                             // entries held by the node
+	Bytes         int64                  `protobuf:"varint,4,opt,name=bytes,proto3" json:"bytes,omitempty"`                           // bytes of their keys and values
+	Qps           float64                `protobuf:"fixed64,5,opt,name=qps,proto3" json:"qps,omitempty"`                              // gets served by the node
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RingSegment) Reset() {
+	*x = RingSegment{}
+	mi := &file_pb_cache_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RingSegment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RingSegment) ProtoMessage() {}
+
+func (x *RingSegment) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RingSegment.ProtoReflect.Descriptor instead.
+func (*RingSegment) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *RingSegment) GetStart() uint32 {
+	if x != nil {
+		return x.Start
+	}
+	return 0
+}
+
+func (x *RingSegment) GetRingShare() float64 {
+	if x != nil {
+		return x.RingShare
+	}
+	return 0
+}
+
+func (x *RingSegment) GetKeys() int64 {
+	if x != nil {
+		return x.Keys
+	}
+	return 0
+}
+
+func (x *RingSegment) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *RingSegment) GetQps() float64 {
+	if x != nil {
+		return x.Qps
+	}
+	return 0
+}
+
+type TopKeysRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	N             int32                  `protobuf:"varint,2,opt,name=n,proto3" json:"n,omitempty"` // keys reported, 0 means 10
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TopKeysRequest) Reset() {
+	*x = TopKeysRequest{}
+	mi := &file_pb_cache_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TopKeysRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TopKeysRequest) ProtoMessage() {}
+
+func (x *TopKeysRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TopKeysRequest.ProtoReflect.Descriptor instead.
+func (*TopKeysRequest) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *TopKeysRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *TopKeysRequest) GetN() int32 {
+	if x != nil {
+		return x.N
+	}
+	return 0
+}
+
+type TopKeysResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Node          string                 `protobuf:"bytes,2,opt,name=node,proto3" json:"node,omitempty"`
+	Keys          []*KeyRate             `protobuf:"bytes,3,rep,name=keys,proto3" json:"keys,omitempty"` // hottest first
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TopKeysResponse) Reset() {
+	*x = TopKeysResponse{}
+	mi := &file_pb_cache_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TopKeysResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TopKeysResponse) ProtoMessage() {}
+
+func (x *TopKeysResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TopKeysResponse.ProtoReflect.Descriptor instead.
+func (*TopKeysResponse) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *TopKeysResponse) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *TopKeysResponse) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+func (x *TopKeysResponse) GetKeys() []*KeyRate {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+// KeyRate: a hot key and its estimated gets per second
+type KeyRate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           []byte                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Qps           float64                `protobuf:"fixed64,2,opt,name=qps,proto3" json:"qps,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeyRate) Reset() {
+	*x = KeyRate{}
+	mi := &file_pb_cache_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeyRate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyRate) ProtoMessage() {}
+
+func (x *KeyRate) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyRate.ProtoReflect.Descriptor instead.
+func (*KeyRate) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *KeyRate) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *KeyRate) GetQps() float64 {
+	if x != nil {
+		return x.Qps
+	}
+	return 0
+}
+
+type ImmortalKeysRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Limit         int32                  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"` // keys listed, 0 means 100
+	Ttl           *durationpb.Duration   `protobuf:"bytes,3,opt,name=ttl,proto3" json:"ttl,omitempty"`      // if set, the keys listed are given this ttl
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImmortalKeysRequest) Reset() {
+	*x = ImmortalKeysRequest{}
+	mi := &file_pb_cache_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImmortalKeysRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImmortalKeysRequest) ProtoMessage() {}
+
+func (x *ImmortalKeysRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImmortalKeysRequest.ProtoReflect.Descriptor instead.
+func (*ImmortalKeysRequest) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ImmortalKeysRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *ImmortalKeysRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ImmortalKeysRequest) GetTtl() *durationpb.Duration {
+	if x != nil {
+		return x.Ttl
+	}
+	return nil
+}
+
+type ImmortalKeysResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Node          string                 `protobuf:"bytes,2,opt,name=node,proto3" json:"node,omitempty"`
+	Keys          [][]byte               `protobuf:"bytes,3,rep,name=keys,proto3" json:"keys,omitempty"`        // keys without expiration, or given the ttl
+	Entries       int64                  `protobuf:"varint,4,opt,name=entries,proto3" json:"entries,omitempty"` // entries without expiration left
+	Bytes         int64                  `protobuf:"varint,5,opt,name=bytes,proto3" json:"bytes,omitempty"`     // bytes of their keys and values
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ImmortalKeysResponse) Reset() {
+	*x = ImmortalKeysResponse{}
+	mi := &file_pb_cache_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ImmortalKeysResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ImmortalKeysResponse) ProtoMessage() {}
+
+func (x *ImmortalKeysResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ImmortalKeysResponse.ProtoReflect.Descriptor instead.
+func (*ImmortalKeysResponse) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *ImmortalKeysResponse) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *ImmortalKeysResponse) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+func (x *ImmortalKeysResponse) GetKeys() [][]byte {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+func (x *ImmortalKeysResponse) GetEntries() int64 {
+	if x != nil {
+		return x.Entries
+	}
+	return 0
+}
+
+func (x *ImmortalKeysResponse) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+type RefreshRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Keys          [][]byte               `protobuf:"bytes,2,rep,name=keys,proto3" json:"keys,omitempty"`         // reloaded whether cached or not
+	Prefixes      [][]byte               `protobuf:"bytes,3,rep,name=prefixes,proto3" json:"prefixes,omitempty"` // cached keys starting with one are reloaded
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RefreshRequest) Reset() {
+	*x = RefreshRequest{}
+	mi := &file_pb_cache_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RefreshRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RefreshRequest) ProtoMessage() {}
+
+func (x *RefreshRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RefreshRequest.ProtoReflect.Descriptor instead.
+func (*RefreshRequest) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *RefreshRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *RefreshRequest) GetKeys() [][]byte {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+func (x *RefreshRequest) GetPrefixes() [][]byte {
+	if x != nil {
+		return x.Prefixes
+	}
+	return nil
+}
+
+type RefreshResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Refreshed     int64                  `protobuf:"varint,1,opt,name=refreshed,proto3" json:"refreshed,omitempty"` // keys reloaded on the node
+	Failed        int64                  `protobuf:"varint,2,opt,name=failed,proto3" json:"failed,omitempty"`       // keys whose reload failed
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RefreshResponse) Reset() {
+	*x = RefreshResponse{}
+	mi := &file_pb_cache_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RefreshResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RefreshResponse) ProtoMessage() {}
+
+func (x *RefreshResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RefreshResponse.ProtoReflect.Descriptor instead.
+func (*RefreshResponse) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *RefreshResponse) GetRefreshed() int64 {
+	if x != nil {
+		return x.Refreshed
+	}
+	return 0
+}
+
+func (x *RefreshResponse) GetFailed() int64 {
+	if x != nil {
+		return x.Failed
+	}
+	return 0
+}
+
+type SampleKeysRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`      // empty samples every group of the node
+	N             int32                  `protobuf:"varint,2,opt,name=n,proto3" json:"n,omitempty"`             // keys sampled, 0 means 20
+	Details       bool                   `protobuf:"varint,3,opt,name=details,proto3" json:"details,omitempty"` // report the size, ttl and last access of each key
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SampleKeysRequest) Reset() {
+	*x = SampleKeysRequest{}
+	mi := &file_pb_cache_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SampleKeysRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SampleKeysRequest) ProtoMessage() {}
+
+func (x *SampleKeysRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SampleKeysRequest.ProtoReflect.Descriptor instead.
+func (*SampleKeysRequest) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *SampleKeysRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *SampleKeysRequest) GetN() int32 {
+	if x != nil {
+		return x.N
+	}
+	return 0
+}
+
+func (x *SampleKeysRequest) GetDetails() bool {
+	if x != nil {
+		return x.Details
+	}
+	return false
+}
+
+type SampleKeysResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Node          string                 `protobuf:"bytes,1,opt,name=node,proto3" json:"node,omitempty"`
+	Entries       int64                  `protobuf:"varint,2,opt,name=entries,proto3" json:"entries,omitempty"` // entries sampled from
+	Keys          []*SampledKey          `protobuf:"bytes,3,rep,name=keys,proto3" json:"keys,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SampleKeysResponse) Reset() {
+	*x = SampleKeysResponse{}
+	mi := &file_pb_cache_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SampleKeysResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SampleKeysResponse) ProtoMessage() {}
+
+func (x *SampleKeysResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SampleKeysResponse.ProtoReflect.Descriptor instead.
+func (*SampleKeysResponse) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *SampleKeysResponse) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+func (x *SampleKeysResponse) GetEntries() int64 {
+	if x != nil {
+		return x.Entries
+	}
+	return 0
+}
+
+func (x *SampleKeysResponse) GetKeys() []*SampledKey {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+// SampledKey: a key of a SampleKeysResponse, with details if requested
+type SampledKey struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Key           []byte                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Size          int64                  `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`                               // bytes of the value, uncompressed
+	Ttl           *durationpb.Duration   `protobuf:"bytes,4,opt,name=ttl,proto3" json:"ttl,omitempty"`                                  // time left, unset if the entry never expires
+	LastAccess    int64                  `protobuf:"varint,5,opt,name=last_access,json=lastAccess,proto3" json:"last_access,omitempty"` // unix nanoseconds of the last read or write, 0 unless the store tracks them
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SampledKey) Reset() {
+	*x = SampledKey{}
+	mi := &file_pb_cache_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SampledKey) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SampledKey) ProtoMessage() {}
+
+func (x *SampledKey) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SampledKey.ProtoReflect.Descriptor instead.
+func (*SampledKey) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *SampledKey) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *SampledKey) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *SampledKey) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *SampledKey) GetTtl() *durationpb.Duration {
+	if x != nil {
+		return x.Ttl
+	}
+	return nil
+}
+
+func (x *SampledKey) GetLastAccess() int64 {
+	if x != nil {
+		return x.LastAccess
+	}
+	return 0
+}
+
+type MGetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Keys          [][]byte               `protobuf:"bytes,2,rep,name=keys,proto3" json:"keys,omitempty"`
+	Cached        bool                   `protobuf:"varint,3,opt,name=cached,proto3" json:"cached,omitempty"` // only cached values, misses are not loaded
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MGetRequest) Reset() {
+	*x = MGetRequest{}
+	mi := &file_pb_cache_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MGetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MGetRequest) ProtoMessage() {}
+
+func (x *MGetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MGetRequest.ProtoReflect.Descriptor instead.
+func (*MGetRequest) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *MGetRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *MGetRequest) GetKeys() [][]byte {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+func (x *MGetRequest) GetCached() bool {
+	if x != nil {
+		return x.Cached
+	}
+	return false
+}
+
+type MGetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Values        []*KeyValue            `protobuf:"bytes,1,rep,name=values,proto3" json:"values,omitempty"` // keys found, keys neither found nor failed have no value
+	Errors        []*KeyError            `protobuf:"bytes,2,rep,name=errors,proto3" json:"errors,omitempty"` // keys whose get failed
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MGetResponse) Reset() {
+	*x = MGetResponse{}
+	mi := &file_pb_cache_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MGetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MGetResponse) ProtoMessage() {}
+
+func (x *MGetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MGetResponse.ProtoReflect.Descriptor instead.
+func (*MGetResponse) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *MGetResponse) GetValues() []*KeyValue {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+func (x *MGetResponse) GetErrors() []*KeyError {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+// KeyValue: a key and its value in a batch
+type KeyValue struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           []byte                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value         []byte                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeyValue) Reset() {
+	*x = KeyValue{}
+	mi := &file_pb_cache_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeyValue) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyValue) ProtoMessage() {}
+
+func (x *KeyValue) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyValue.ProtoReflect.Descriptor instead.
+func (*KeyValue) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *KeyValue) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *KeyValue) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+// KeyError: a key of a batch that failed, with the status of its failure
+type KeyError struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           []byte                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Code          int32                  `protobuf:"varint,2,opt,name=code,proto3" json:"code,omitempty"` // grpc status code
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeyError) Reset() {
+	*x = KeyError{}
+	mi := &file_pb_cache_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeyError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyError) ProtoMessage() {}
+
+func (x *KeyError) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyError.ProtoReflect.Descriptor instead.
+func (*KeyError) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *KeyError) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *KeyError) GetCode() int32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *KeyError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type MSetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Entries       []*KeyValue            `protobuf:"bytes,2,rep,name=entries,proto3" json:"entries,omitempty"`
+	Ttl           *durationpb.Duration   `protobuf:"bytes,3,opt,name=ttl,proto3" json:"ttl,omitempty"` // of every entry, unset or zero uses the group's default ttl
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MSetRequest) Reset() {
+	*x = MSetRequest{}
+	mi := &file_pb_cache_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MSetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MSetRequest) ProtoMessage() {}
+
+func (x *MSetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MSetRequest.ProtoReflect.Descriptor instead.
+func (*MSetRequest) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *MSetRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *MSetRequest) GetEntries() []*KeyValue {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+func (x *MSetRequest) GetTtl() *durationpb.Duration {
+	if x != nil {
+		return x.Ttl
+	}
+	return nil
+}
+
+type MSetResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MSetResponse) Reset() {
+	*x = MSetResponse{}
+	mi := &file_pb_cache_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MSetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MSetResponse) ProtoMessage() {}
+
+func (x *MSetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MSetResponse.ProtoReflect.Descriptor instead.
+func (*MSetResponse) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{28}
+}
+
+type MDeleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Keys          [][]byte               `protobuf:"bytes,2,rep,name=keys,proto3" json:"keys,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MDeleteRequest) Reset() {
+	*x = MDeleteRequest{}
+	mi := &file_pb_cache_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MDeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MDeleteRequest) ProtoMessage() {}
+
+func (x *MDeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MDeleteRequest.ProtoReflect.Descriptor instead.
+func (*MDeleteRequest) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *MDeleteRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *MDeleteRequest) GetKeys() [][]byte {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+type MDeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Deleted       int64                  `protobuf:"varint,1,opt,name=deleted,proto3" json:"deleted,omitempty"` // keys that existed
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MDeleteResponse) Reset() {
+	*x = MDeleteResponse{}
+	mi := &file_pb_cache_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MDeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MDeleteResponse) ProtoMessage() {}
+
+func (x *MDeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MDeleteResponse.ProtoReflect.Descriptor instead.
+func (*MDeleteResponse) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *MDeleteResponse) GetDeleted() int64 {
+	if x != nil {
+		return x.Deleted
+	}
+	return 0
+}
+
+type MergeRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Group   string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	Key     []byte                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Operand []byte                 `protobuf:"bytes,3,opt,name=operand,proto3" json:"operand,omitempty"`
+	// unset or zero keeps the remaining ttl of a present key and uses the
+	// group's default ttl for an absent one
+	Ttl *durationpb.Duration `protobuf:"bytes,4,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	// patch: write operand over the value at offset instead of merging it
+	// with the group's merge operator, sent only to peers announcing the
+	// patch capability
+	Patch  bool  `protobuf:"varint,5,opt,name=patch,proto3" json:"patch,omitempty"`
+	Offset int64 `protobuf:"varint,6,opt,name=offset,proto3" json:"offset,omitempty"` // offset of a patch, negative appends
+	// collection: add operand's elements to a set or list value instead of
+	// merging it with the group's merge operator, sent only to peers
+	// announcing the collections capability
+	Collection    CollectionOp `protobuf:"varint,7,opt,name=collection,proto3,enum=pb.CollectionOp" json:"collection,omitempty"`
+	MaxLen        int64        `protobuf:"varint,8,opt,name=max_len,json=maxLen,proto3" json:"max_len,omitempty"` // elements a list keeps, the oldest are dropped, 0 keeps all
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MergeRequest) Reset() {
+	*x = MergeRequest{}
+	mi := &file_pb_cache_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MergeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MergeRequest) ProtoMessage() {}
+
+func (x *MergeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MergeRequest.ProtoReflect.Descriptor instead.
+func (*MergeRequest) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *MergeRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *MergeRequest) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *MergeRequest) GetOperand() []byte {
+	if x != nil {
+		return x.Operand
+	}
+	return nil
+}
+
+func (x *MergeRequest) GetTtl() *durationpb.Duration {
+	if x != nil {
+		return x.Ttl
+	}
+	return nil
+}
+
+func (x *MergeRequest) GetPatch() bool {
+	if x != nil {
+		return x.Patch
+	}
+	return false
+}
+
+func (x *MergeRequest) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *MergeRequest) GetCollection() CollectionOp {
+	if x != nil {
+		return x.Collection
+	}
+	return CollectionOp_COLLECTION_NONE
+}
+
+func (x *MergeRequest) GetMaxLen() int64 {
+	if x != nil {
+		return x.MaxLen
+	}
+	return 0
+}
+
+type MergeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Value         []byte                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"` // value of the key after the merge
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MergeResponse) Reset() {
+	*x = MergeResponse{}
+	mi := &file_pb_cache_proto_msgTypes[32]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MergeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MergeResponse) ProtoMessage() {}
+
+func (x *MergeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[32]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MergeResponse.ProtoReflect.Descriptor instead.
+func (*MergeResponse) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *MergeResponse) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+type PingRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PingRequest) Reset() {
+	*x = PingRequest{}
+	mi := &file_pb_cache_proto_msgTypes[33]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PingRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PingRequest) ProtoMessage() {}
+
+func (x *PingRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[33]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PingRequest.ProtoReflect.Descriptor instead.
+func (*PingRequest) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{33}
+}
+
+type PingResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PingResponse) Reset() {
+	*x = PingResponse{}
+	mi := &file_pb_cache_proto_msgTypes[34]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PingResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PingResponse) ProtoMessage() {}
+
+func (x *PingResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[34]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PingResponse.ProtoReflect.Descriptor instead.
+func (*PingResponse) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{34}
+}
+
+// Record: an entry or write in a snapshot, dump or append-only log written
+// with the protobuf record codec, fields added later are skipped by older readers
+type Record struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Op            uint32                 `protobuf:"varint,1,opt,name=op,proto3" json:"op,omitempty"`      // 1 set, 2 counter, 3 delete, 4 clear, later ops are skipped by older readers
+	Group         []byte                 `protobuf:"bytes,2,opt,name=group,proto3" json:"group,omitempty"` // group of the write, unset in snapshots and dumps
+	Key           []byte                 `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	Value         []byte                 `protobuf:"bytes,4,opt,name=value,proto3" json:"value,omitempty"`        // value of a set
+	Counter       int64                  `protobuf:"zigzag64,5,opt,name=counter,proto3" json:"counter,omitempty"` // value of a counter
+	Expiry        int64                  `protobuf:"zigzag64,6,opt,name=expiry,proto3" json:"expiry,omitempty"`   // expiration in unix nanos, the remaining ttl in dumps, 0 if none
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Record) Reset() {
+	*x = Record{}
+	mi := &file_pb_cache_proto_msgTypes[35]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Record) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Record) ProtoMessage() {}
+
+func (x *Record) ProtoReflect() protoreflect.Message {
+	mi := &file_pb_cache_proto_msgTypes[35]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Record.ProtoReflect.Descriptor instead.
+func (*Record) Descriptor() ([]byte, []int) {
+	return file_pb_cache_proto_rawDescGZIP(), []int{35}
+}
+
+func (x *Record) GetOp() uint32 {
+	if x != nil {
+		return x.Op
+	}
+	return 0
+}
+
+func (x *Record) GetGroup() []byte {
+	if x != nil {
+		return x.Group
+	}
+	return nil
+}
+
+func (x *Record) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *Record) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *Record) GetCounter() int64 {
+	if x != nil {
+		return x.Counter
+	}
+	return 0
+}
+
+func (x *Record) GetExpiry() int64 {
+	if x != nil {
+		return x.Expiry
+	}
+	return 0
+}
+
+var File_pb_cache_proto protoreflect.FileDescriptor
+
+const file_pb_cache_proto_rawDesc = "" +
+	"\n" +
+	"\x0epb/cache.proto\x12\x02pb\x1a\x1egoogle/protobuf/duration.proto\"\x7f\n" +
+	"\n" +
+	"GetRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\fR\x03key\x12\x16\n" +
+	"\x06cached\x18\x03 \x01(\bR\x06cached\x121\n" +
+	"\vconsistency\x18\x04 \x01(\x0e2\x0f.pb.ConsistencyR\vconsistency\"\x82\x01\n" +
+	"\vGetResponse\x12\x14\n" +
+	"\x05value\x18\x01 \x01(\fR\x05value\x121\n" +
+	"\vcompression\x18\x02 \x01(\x0e2\x0f.pb.CompressionR\vcompression\x12\x10\n" +
+	"\x03hot\x18\x03 \x01(\bR\x03hot\x12\x18\n" +
+	"\aversion\x18\x04 \x01(\x04R\aversion\"\xcc\x02\n" +
+	"\n" +
+	"SetRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\fR\x03key\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\fR\x05value\x12+\n" +
+	"\x03ttl\x18\x04 \x01(\v2\x19.google.protobuf.DurationR\x03ttl\x121\n" +
+	"\vcompression\x18\x05 \x01(\x0e2\x0f.pb.CompressionR\vcompression\x121\n" +
+	"\vconsistency\x18\x06 \x01(\x0e2\x0f.pb.ConsistencyR\vconsistency\x12\x1b\n" +
+	"\tif_absent\x18\a \x01(\bR\bifAbsent\x12\x1d\n" +
+	"\n" +
+	"if_present\x18\b \x01(\bR\tifPresent\x12\"\n" +
+	"\n" +
+	"if_version\x18\t \x01(\x04H\x00R\tifVersion\x88\x01\x01B\r\n" +
+	"\v_if_version\"'\n" +
+	"\vSetResponse\x12\x18\n" +
+	"\aapplied\x18\x01 \x01(\bR\aapplied\"j\n" +
+	"\rDeleteRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\fR\x03key\x121\n" +
+	"\vconsistency\x18\x03 \x01(\x0e2\x0f.pb.ConsistencyR\vconsistency\"*\n" +
+	"\x0eDeleteResponse\x12\x18\n" +
+	"\adeleted\x18\x01 \x01(\bR\adeleted\"$\n" +
+	"\fStatsRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\"\x98\x01\n" +
+	"\rStatsResponse\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x12\n" +
+	"\x04hits\x18\x02 \x01(\x03R\x04hits\x12\x16\n" +
+	"\x06misses\x18\x03 \x01(\x03R\x06misses\x12\x19\n" +
+	"\bhit_rate\x18\x04 \x01(\x01R\ahitRate\x12\x12\n" +
+	"\x04size\x18\x05 \x01(\x03R\x04size\x12\x16\n" +
+	"\x06closed\x18\x06 \x01(\bR\x06closed\"&\n" +
+	"\fWatchRequest\x12\x16\n" +
+	"\x06groups\x18\x01 \x03(\tR\x06groups\"\xde\x01\n" +
+	"\bKeyEvent\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12%\n" +
+	"\x04type\x18\x02 \x01(\x0e2\x11.pb.KeyEvent.TypeR\x04type\x12\x10\n" +
+	"\x03key\x18\x03 \x01(\fR\x03key\x12\x14\n" +
+	"\x05value\x18\x04 \x01(\fR\x05value\x12+\n" +
+	"\x03ttl\x18\x05 \x01(\v2\x19.google.protobuf.DurationR\x03ttl\x12\x18\n" +
+	"\acounter\x18\x06 \x01(\bR\acounter\"&\n" +
+	"\x04Type\x12\a\n" +
+	"\x03SET\x10\x00\x12\n" +
+	"\n" +
+	"\x06DELETE\x10\x01\x12\t\n" +
+	"\x05CLEAR\x10\x02\"D\n" +
+	"\x10OwnershipRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x1a\n" +
+	"\bsegments\x18\x02 \x01(\x05R\bsegments\"j\n" +
+	"\x11OwnershipResponse\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x12\n" +
+	"\x04node\x18\x02 \x01(\tR\x04node\x12+\n" +
+	"\bsegments\x18\x03 \x03(\v2\x0f.pb.RingSegmentR\bsegments\"~\n" +
+	"\vRingSegment\x12\x14\n" +
+	"\x05start\x18\x01 \x01(\rR\x05start\x12\x1d\n" +
+	"\n" +
+	"ring_share\x18\x02 \x01(\x01R\tringShare\x12\x12\n" +
+	"\x04keys\x18\x03 \x01(\x03R\x04keys\x12\x14\n" +
+	"\x05bytes\x18\x04 \x01(\x03R\x05bytes\x12\x10\n" +
+	"\x03qps\x18\x05 \x01(\x01R\x03qps\"4\n" +
+	"\x0eTopKeysRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\f\n" +
+	"\x01n\x18\x02 \x01(\x05R\x01n\"\\\n" +
+	"\x0fTopKeysResponse\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x12\n" +
+	"\x04node\x18\x02 \x01(\tR\x04node\x12\x1f\n" +
+	"\x04keys\x18\x03 \x03(\v2\v.pb.KeyRateR\x04keys\"-\n" +
+	"\aKeyRate\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\fR\x03key\x12\x10\n" +
+	"\x03qps\x18\x02 \x01(\x01R\x03qps\"n\n" +
+	"\x13ImmortalKeysRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\x12+\n" +
+	"\x03ttl\x18\x03 \x01(\v2\x19.google.protobuf.DurationR\x03ttl\"\x84\x01\n" +
+	"\x14ImmortalKeysResponse\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x12\n" +
+	"\x04node\x18\x02 \x01(\tR\x04node\x12\x12\n" +
+	"\x04keys\x18\x03 \x03(\fR\x04keys\x12\x18\n" +
+	"\aentries\x18\x04 \x01(\x03R\aentries\x12\x14\n" +
+	"\x05bytes\x18\x05 \x01(\x03R\x05bytes\"V\n" +
+	"\x0eRefreshRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x12\n" +
+	"\x04keys\x18\x02 \x03(\fR\x04keys\x12\x1a\n" +
+	"\bprefixes\x18\x03 \x03(\fR\bprefixes\"G\n" +
+	"\x0fRefreshResponse\x12\x1c\n" +
+	"\trefreshed\x18\x01 \x01(\x03R\trefreshed\x12\x16\n" +
+	"\x06failed\x18\x02 \x01(\x03R\x06failed\"Q\n" +
+	"\x11SampleKeysRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\f\n" +
+	"\x01n\x18\x02 \x01(\x05R\x01n\x12\x18\n" +
+	"\adetails\x18\x03 \x01(\bR\adetails\"f\n" +
+	"\x12SampleKeysResponse\x12\x12\n" +
+	"\x04node\x18\x01 \x01(\tR\x04node\x12\x18\n" +
+	"\aentries\x18\x02 \x01(\x03R\aentries\x12\"\n" +
+	"\x04keys\x18\x03 \x03(\v2\x0e.pb.SampledKeyR\x04keys\"\x96\x01\n" +
+	"\n" +
+	"SampledKey\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\fR\x03key\x12\x12\n" +
+	"\x04size\x18\x03 \x01(\x03R\x04size\x12+\n" +
+	"\x03ttl\x18\x04 \x01(\v2\x19.google.protobuf.DurationR\x03ttl\x12\x1f\n" +
+	"\vlast_access\x18\x05 \x01(\x03R\n" +
+	"lastAccess\"O\n" +
+	"\vMGetRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x12\n" +
+	"\x04keys\x18\x02 \x03(\fR\x04keys\x12\x16\n" +
+	"\x06cached\x18\x03 \x01(\bR\x06cached\"Z\n" +
+	"\fMGetResponse\x12$\n" +
+	"\x06values\x18\x01 \x03(\v2\f.pb.KeyValueR\x06values\x12$\n" +
+	"\x06errors\x18\x02 \x03(\v2\f.pb.KeyErrorR\x06errors\"2\n" +
+	"\bKeyValue\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\fR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\fR\x05value\"J\n" +
+	"\bKeyError\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\fR\x03key\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\x05R\x04code\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\"x\n" +
+	"\vMSetRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12&\n" +
+	"\aentries\x18\x02 \x03(\v2\f.pb.KeyValueR\aentries\x12+\n" +
+	"\x03ttl\x18\x03 \x01(\v2\x19.google.protobuf.DurationR\x03ttl\"\x0e\n" +
+	"\fMSetResponse\":\n" +
+	"\x0eMDeleteRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x12\n" +
+	"\x04keys\x18\x02 \x03(\fR\x04keys\"+\n" +
+	"\x0fMDeleteResponse\x12\x18\n" +
+	"\adeleted\x18\x01 \x01(\x03R\adeleted\"\xf6\x01\n" +
+	"\fMergeRequest\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\fR\x03key\x12\x18\n" +
+	"\aoperand\x18\x03 \x01(\fR\aoperand\x12+\n" +
+	"\x03ttl\x18\x04 \x01(\v2\x19.google.protobuf.DurationR\x03ttl\x12\x14\n" +
+	"\x05patch\x18\x05 \x01(\bR\x05patch\x12\x16\n" +
+	"\x06offset\x18\x06 \x01(\x03R\x06offset\x120\n" +
+	"\n" +
+	"collection\x18\a \x01(\x0e2\x10.pb.CollectionOpR\n" +
+	"collection\x12\x17\n" +
+	"\amax_len\x18\b \x01(\x03R\x06maxLen\"%\n" +
+	"\rMergeResponse\x12\x14\n" +
+	"\x05value\x18\x01 \x01(\fR\x05value\"\r\n" +
+	"\vPingRequest\"\x0e\n" +
+	"\fPingResponse\"\x88\x01\n" +
+	"\x06Record\x12\x0e\n" +
+	"\x02op\x18\x01 \x01(\rR\x02op\x12\x14\n" +
+	"\x05group\x18\x02 \x01(\fR\x05group\x12\x10\n" +
+	"\x03key\x18\x03 \x01(\fR\x03key\x12\x14\n" +
+	"\x05value\x18\x04 \x01(\fR\x05value\x12\x18\n" +
+	"\acounter\x18\x05 \x01(\x12R\acounter\x12\x16\n" +
+	"\x06expiry\x18\x06 \x01(\x12R\x06expiry*O\n" +
+	"\vConsistency\x12\x13\n" +
+	"\x0fCONSISTENCY_ONE\x10\x00\x12\x16\n" +
+	"\x12CONSISTENCY_QUORUM\x10\x01\x12\x13\n" +
+	"\x0fCONSISTENCY_ALL\x10\x02*Q\n" +
+	"\vCompression\x12\x14\n" +
+	"\x10COMPRESSION_NONE\x10\x00\x12\x16\n" +
+	"\x12COMPRESSION_SNAPPY\x10\x01\x12\x14\n" +
+	"\x10COMPRESSION_GZIP\x10\x02*N\n" +
+	"\fCollectionOp\x12\x13\n" +
+	"\x0fCOLLECTION_NONE\x10\x00\x12\x13\n" +
+	"\x0fCOLLECTION_SADD\x10\x01\x12\x14\n" +
+	"\x10COLLECTION_LPUSH\x10\x022\xe8\x05\n" +
+	"\x05Cache\x12&\n" +
+	"\x03Get\x12\x0e.pb.GetRequest\x1a\x0f.pb.GetResponse\x12&\n" +
+	"\x03Set\x12\x0e.pb.SetRequest\x1a\x0f.pb.SetResponse\x12/\n" +
+	"\x06Delete\x12\x11.pb.DeleteRequest\x1a\x12.pb.DeleteResponse\x12,\n" +
+	"\x05Stats\x12\x10.pb.StatsRequest\x1a\x11.pb.StatsResponse\x12)\n" +
+	"\x05Watch\x12\x10.pb.WatchRequest\x1a\f.pb.KeyEvent0\x01\x128\n" +
+	"\tOwnership\x12\x14.pb.OwnershipRequest\x1a\x15.pb.OwnershipResponse\x122\n" +
+	"\aTopKeys\x12\x12.pb.TopKeysRequest\x1a\x13.pb.TopKeysResponse\x12A\n" +
+	"\fImmortalKeys\x12\x17.pb.ImmortalKeysRequest\x1a\x18.pb.ImmortalKeysResponse\x122\n" +
+	"\aRefresh\x12\x12.pb.RefreshRequest\x1a\x13.pb.RefreshResponse\x12;\n" +
+	"\n" +
+	"SampleKeys\x12\x15.pb.SampleKeysRequest\x1a\x16.pb.SampleKeysResponse\x12)\n" +
+	"\x04MGet\x12\x0f.pb.MGetRequest\x1a\x10.pb.MGetResponse\x12)\n" +
+	"\x04MSet\x12\x0f.pb.MSetRequest\x1a\x10.pb.MSetResponse\x122\n" +
+	"\aMDelete\x12\x12.pb.MDeleteRequest\x1a\x13.pb.MDeleteResponse\x12.\n" +
+	"\aMergeOp\x12\x10.pb.MergeRequest\x1a\x11.pb.MergeResponse\x12)\n" +
+	"\x04Ping\x12\x0f.pb.PingRequest\x1a\x10.pb.PingResponseB/Z-github.com/RebellioN-YonG/Distrbuted-Cache/pbb\x06proto3"
+
+var (
+	file_pb_cache_proto_rawDescOnce sync.Once
+	file_pb_cache_proto_rawDescData []byte
+)
+
+func file_pb_cache_proto_rawDescGZIP() []byte {
+	file_pb_cache_proto_rawDescOnce.Do(func() {
+		file_pb_cache_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pb_cache_proto_rawDesc), len(file_pb_cache_proto_rawDesc)))
+	})
+	return file_pb_cache_proto_rawDescData
+}
+
+var file_pb_cache_proto_enumTypes = make([]protoimpl.EnumInfo, 4)
+var file_pb_cache_proto_msgTypes = make([]protoimpl.MessageInfo, 36)
+var file_pb_cache_proto_goTypes = []any{
+	(Consistency)(0),             // 0: pb.Consistency
+	(Compression)(0),             // 1: pb.Compression
+	(CollectionOp)(0),            // 2: pb.CollectionOp
+	(KeyEvent_Type)(0),           // 3: pb.KeyEvent.Type
+	(*GetRequest)(nil),           // 4: pb.GetRequest
+	(*GetResponse)(nil),          // 5: pb.GetResponse
+	(*SetRequest)(nil),           // 6: pb.SetRequest
+	(*SetResponse)(nil),          // 7: pb.SetResponse
+	(*DeleteRequest)(nil),        // 8: pb.DeleteRequest
+	(*DeleteResponse)(nil),       // 9: pb.DeleteResponse
+	(*StatsRequest)(nil),         // 10: pb.StatsRequest
+	(*StatsResponse)(nil),        // 11: pb.StatsResponse
+	(*WatchRequest)(nil),         // 12: pb.WatchRequest
+	(*KeyEvent)(nil),             // 13: pb.KeyEvent
+	(*OwnershipRequest)(nil),     // 14: pb.OwnershipRequest
+	(*OwnershipResponse)(nil),    // 15: pb.OwnershipResponse
+	(*RingSegment)(nil),          // 16: pb.RingSegment
+	(*TopKeysRequest)(nil),       // 17: pb.TopKeysRequest
+	(*TopKeysResponse)(nil),      // 18: pb.TopKeysResponse
+	(*KeyRate)(nil),              // 19: pb.KeyRate
+	(*ImmortalKeysRequest)(nil),  // 20: pb.ImmortalKeysRequest
+	(*ImmortalKeysResponse)(nil), // 21: pb.ImmortalKeysResponse
+	(*RefreshRequest)(nil),       // 22: pb.RefreshRequest
+	(*RefreshResponse)(nil),      // 23: pb.RefreshResponse
+	(*SampleKeysRequest)(nil),    // 24: pb.SampleKeysRequest
+	(*SampleKeysResponse)(nil),   // 25: pb.SampleKeysResponse
+	(*SampledKey)(nil),           // 26: pb.SampledKey
+	(*MGetRequest)(nil),          // 27: pb.MGetRequest
+	(*MGetResponse)(nil),         // 28: pb.MGetResponse
+	(*KeyValue)(nil),             // 29: pb.KeyValue
+	(*KeyError)(nil),             // 30: pb.KeyError
+	(*MSetRequest)(nil),          // 31: pb.MSetRequest
+	(*MSetResponse)(nil),         // 32: pb.MSetResponse
+	(*MDeleteRequest)(nil),       // 33: pb.MDeleteRequest
+	(*MDeleteResponse)(nil),      // 34: pb.MDeleteResponse
+	(*MergeRequest)(nil),         // 35: pb.MergeRequest
+	(*MergeResponse)(nil),        // 36: pb.MergeResponse
+	(*PingRequest)(nil),          // 37: pb.PingRequest
+	(*PingResponse)(nil),         // 38: pb.PingResponse
+	(*Record)(nil),               // 39: pb.Record
+	(*durationpb.Duration)(nil),  // 40: google.protobuf.Duration
+}
+var file_pb_cache_proto_depIdxs = []int32{
+	0,  // 0: pb.GetRequest.consistency:type_name -> pb.Consistency
+	1,  // 1: pb.GetResponse.compression:type_name -> pb.Compression
+	40, // 2: pb.SetRequest.ttl:type_name -> google.protobuf.Duration
+	1,  // 3: pb.SetRequest.compression:type_name -> pb.Compression
+	0,  // 4: pb.SetRequest.consistency:type_name -> pb.Consistency
+	0,  // 5: pb.DeleteRequest.consistency:type_name -> pb.Consistency
+	3,  // 6: pb.KeyEvent.type:type_name -> pb.KeyEvent.Type
+	40, // 7: pb.KeyEvent.ttl:type_name -> google.protobuf.Duration
+	16, // 8: pb.OwnershipResponse.segments:type_name -> pb.RingSegment
+	19, // 9: pb.TopKeysResponse.keys:type_name -> pb.KeyRate
+	40, // 10: pb.ImmortalKeysRequest.ttl:type_name -> google.protobuf.Duration
+	26, // 11: pb.SampleKeysResponse.keys:type_name -> pb.SampledKey
+	40, // 12: pb.SampledKey.ttl:type_name -> google.protobuf.Duration
+	29, // 13: pb.MGetResponse.values:type_name -> pb.KeyValue
+	30, // 14: pb.MGetResponse.errors:type_name -> pb.KeyError
+	29, // 15: pb.MSetRequest.entries:type_name -> pb.KeyValue
+	40, // 16: pb.MSetRequest.ttl:type_name -> google.protobuf.Duration
+	40, // 17: pb.MergeRequest.ttl:type_name -> google.protobuf.Duration
+	2,  // 18: pb.MergeRequest.collection:type_name -> pb.CollectionOp
+	4,  // 19: pb.Cache.Get:input_type -> pb.GetRequest
+	6,  // 20: pb.Cache.Set:input_type -> pb.SetRequest
+	8,  // 21: pb.Cache.Delete:input_type -> pb.DeleteRequest
+	10, // 22: pb.Cache.Stats:input_type -> pb.StatsRequest
+	12, // 23: pb.Cache.Watch:input_type -> pb.WatchRequest
+	14, // 24: pb.Cache.Ownership:input_type -> pb.OwnershipRequest
+	17, // 25: pb.Cache.TopKeys:input_type -> pb.TopKeysRequest
+	20, // 26: pb.Cache.ImmortalKeys:input_type -> pb.ImmortalKeysRequest
+	22, // 27: pb.Cache.Refresh:input_type -> pb.RefreshRequest
+	24, // 28: pb.Cache.SampleKeys:input_type -> pb.SampleKeysRequest
+	27, // 29: pb.Cache.MGet:input_type -> pb.MGetRequest
+	31, // 30: pb.Cache.MSet:input_type -> pb.MSetRequest
+	33, // 31: pb.Cache.MDelete:input_type -> pb.MDeleteRequest
+	35, // 32: pb.Cache.MergeOp:input_type -> pb.MergeRequest
+	37, // 33: pb.Cache.Ping:input_type -> pb.PingRequest
+	5,  // 34: pb.Cache.Get:output_type -> pb.GetResponse
+	7,  // 35: pb.Cache.Set:output_type -> pb.SetResponse
+	9,  // 36: pb.Cache.Delete:output_type -> pb.DeleteResponse
+	11, // 37: pb.Cache.Stats:output_type -> pb.StatsResponse
+	13, // 38: pb.Cache.Watch:output_type -> pb.KeyEvent
+	15, // 39: pb.Cache.Ownership:output_type -> pb.OwnershipResponse
+	18, // 40: pb.Cache.TopKeys:output_type -> pb.TopKeysResponse
+	21, // 41: pb.Cache.ImmortalKeys:output_type -> pb.ImmortalKeysResponse
+	23, // 42: pb.Cache.Refresh:output_type -> pb.RefreshResponse
+	25, // 43: pb.Cache.SampleKeys:output_type -> pb.SampleKeysResponse
+	28, // 44: pb.Cache.MGet:output_type -> pb.MGetResponse
+	32, // 45: pb.Cache.MSet:output_type -> pb.MSetResponse
+	34, // 46: pb.Cache.MDelete:output_type -> pb.MDeleteResponse
+	36, // 47: pb.Cache.MergeOp:output_type -> pb.MergeResponse
+	38, // 48: pb.Cache.Ping:output_type -> pb.PingResponse
+	34, // [34:49] is the sub-list for method output_type
+	19, // [19:34] is the sub-list for method input_type
+	19, // [19:19] is the sub-list for extension type_name
+	19, // [19:19] is the sub-list for extension extendee
+	0,  // [0:19] is the sub-list for field type_name
+}
+
+func init() { file_pb_cache_proto_init() }
+func file_pb_cache_proto_init() {
+	if File_pb_cache_proto != nil {
+		return
+	}
+	file_pb_cache_proto_msgTypes[2].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pb_cache_proto_rawDesc), len(file_pb_cache_proto_rawDesc)),
+			NumEnums:      4,
+			NumMessages:   36,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_pb_cache_proto_goTypes,
+		DependencyIndexes: file_pb_cache_proto_depIdxs,
+		EnumInfos:         file_pb_cache_proto_enumTypes,
+		MessageInfos:      file_pb_cache_proto_msgTypes,
+	}.Build()
+	File_pb_cache_proto = out.File
+	file_pb_cache_proto_goTypes = nil
+	file_pb_cache_proto_depIdxs = nil
+}
@@ -0,0 +1,4 @@
+// Package pb holds the rpc protocol spoken between clients and cache nodes.
+package pb
+
+//go:generate protoc --proto_path=.. --go_out=.. --go_opt=paths=source_relative --go-grpc_out=.. --go-grpc_opt=paths=source_relative ../pb/cache.proto
@@ -0,0 +1,292 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/consistenthash"
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// PeerGetter: fetches values from a remote peer
+type PeerGetter interface {
+	Get(ctx context.Context, group, key string) ([]byte, error)
+}
+
+// PeerPicker: locates the peer owning a key
+type PeerPicker interface {
+	// PickPeer: the owner of key, ok is false when the local node owns it
+	PickPeer(key string) (peer PeerGetter, ok bool)
+}
+
+// PickerOptions: options for ClientPicker
+type PickerOptions struct {
+	Replicas    int                 // virtual nodes per peer on the hash ring, 0 means the default
+	Hash        consistenthash.Hash // hash function of the ring, nil means crc32
+	DialOptions []grpc.DialOption   // extra options when dialing peers
+	// HopReserve: part of the caller's remaining deadline a forwarded get leaves
+	// for its reply, gets with less left fail fast, 0 means 2ms
+	HopReserve time.Duration
+	// HotKeys: spread the gets of hot keys over replicas, see HotKeyOptions,
+	// nil keeps every key on its owner alone
+	HotKeys *HotKeyOptions
+	// Nearest: probe the peers' round trip times and read from the nearest
+	// replicas of a key where several can serve it, see NearestOptions. The
+	// probes run while a Server serves the picker's node, nil picks replicas
+	// by ring order or at random
+	Nearest *NearestOptions
+	// PeerToken: sent with every call to the peers for nodes with
+	// ServerOptions.Auth, one of their PeerTokens, empty sends none
+	PeerToken string
+}
+
+// ClientPicker: PeerPicker over a consistent hashing ring of grpc peers,
+// the ring follows the membership fed by Set or by etcd discovery
+type ClientPicker struct {
+	self      string // addr of the local node as registered
+	svcName   ServiceName
+	opts      PickerOptions
+	mtx       sync.RWMutex
+	ring      *consistenthash.Map
+	clients   map[string]*Client    // peer addr -> client
+	stats     map[string]*peerStats // peer addr -> forwarded gets
+	discovery *Discovery
+	etcdCli   *clientv3.Client
+	// replicaCount: copies of every key after its owner's, see ServerOptions.ReplicaCount
+	replicaCount atomic.Int32
+	// hints: writes replicas missed, nil without hinted handoff, see ServerOptions.HintedHandoff
+	hints atomic.Pointer[hintStore]
+	// left: the local node left the ring for good, see Server.Drain
+	left atomic.Bool
+	// changes: ring updates so far, by SetWeighted or leave
+	changes atomic.Uint64
+	// rtts: round trip times of the peers, nil unless opts.Nearest is set
+	rtts *peerRTTs
+}
+
+// NewClientPicker: create a picker for the node at self with no peers, see Set and Discover
+func NewClientPicker(self string, svcName ServiceName, opts PickerOptions) *ClientPicker {
+	if opts.HopReserve <= 0 {
+		opts.HopReserve = defaultHopReserve
+	}
+	return &ClientPicker{
+		self:    self,
+		svcName: svcName,
+		opts:    opts,
+		ring:    consistenthash.New(opts.Replicas, opts.Hash),
+		clients: make(map[string]*Client),
+		stats:   make(map[string]*peerStats),
+		rtts:    newPeerRTTs(opts.Nearest),
+	}
+}
+
+// Discover: follow the peers registered in etcd under the picker's service
+func (p *ClientPicker) Discover(ctx context.Context, etcdOpts EtcdOptions) error {
+	cli, err := newEtcdClient(etcdOpts)
+	if err != nil {
+		return err
+	}
+	var d *Discovery
+	d = NewDiscovery(cli, p.svcName, func(peers []string) { p.SetWeighted(peers, d.Weights()) })
+	if err := d.Start(ctx); err != nil {
+		cli.Close()
+		return err
+	}
+	p.mtx.Lock()
+	p.discovery, p.etcdCli = d, cli
+	p.mtx.Unlock()
+	return nil
+}
+
+// Watch: follow the peers registered in reg until ctx ends, see Registry
+func (p *ClientPicker) Watch(ctx context.Context, reg Registry) error {
+	return reg.Watch(ctx, func(nodes map[string]string) {
+		p.SetWeighted(slices.Sorted(maps.Keys(nodes)), nodeWeights(nodes))
+	})
+}
+
+// Set: replace the peers, the local node should be among them
+func (p *ClientPicker) Set(peers ...string) {
+	p.SetWeighted(peers, nil)
+}
+
+// SetWeighted: replace the peers, those in weights get that share of their
+// place on the ring, see consistenthash.Map.SetWeighted. Every node of a
+// cluster must be given the same weights for the nodes to agree on the owners
+func (p *ClientPicker) SetWeighted(peers []string, weights map[string]float64) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	live := make(map[string]struct{}, len(peers))
+	for _, addr := range peers {
+		live[addr] = struct{}{}
+		if _, ok := p.clients[addr]; ok || addr == p.self {
+			continue
+		}
+		// a single attempt, an unavailable owner is better served by a local load than by retries
+		c, err := NewClient(addr, p.svcName, &ClientOptions{MaxAttempts: 1, DialOptions: p.opts.DialOptions, Token: p.opts.PeerToken})
+		if err != nil {
+			log.Printf("rebelcache: dial peer %s: %v", addr, err)
+			continue
+		}
+		p.clients[addr] = c
+		p.stats[addr] = &peerStats{}
+	}
+	for addr, c := range p.clients {
+		if _, ok := live[addr]; !ok {
+			c.Close()
+			delete(p.clients, addr)
+			delete(p.stats, addr)
+		}
+	}
+	if p.left.Load() {
+		peers = slices.DeleteFunc(slices.Clone(peers), func(addr string) bool { return addr == p.self })
+	}
+	p.ring.SetWeighted(peers, weights)
+	p.changes.Add(1)
+}
+
+// leave: take the local node off the ring for good, its keys are picked on
+// the other peers from then on, whatever the membership says
+func (p *ClientPicker) leave() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.left.Store(true)
+	p.ring.Remove(p.self)
+	p.changes.Add(1)
+}
+
+// ownerClient: the addr and client of the peer owning key, ok is false when
+// the local node owns it or the peer can't be reached
+func (p *ClientPicker) ownerClient(key string) (addr string, c *Client, ok bool) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	addr = p.ring.Get(key)
+	if addr == "" || addr == p.self {
+		return "", nil, false
+	}
+	c, ok = p.clients[addr]
+	return addr, c, ok
+}
+
+// PickPeer: the client of the peer owning key, ok is false when the local node owns it
+func (p *ClientPicker) PickPeer(key string) (PeerGetter, bool) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	addr := p.ring.Get(key)
+	if addr == "" || addr == p.self {
+		return nil, false
+	}
+	c, ok := p.clients[addr]
+	if !ok {
+		return nil, false
+	}
+	return peerClient{Client: c, reserve: p.opts.HopReserve, stats: p.stats[addr]}, true
+}
+
+// peerStats: counts of the gets forwarded to a peer
+type peerStats struct {
+	forwards atomic.Int64
+	failures atomic.Int64 // forwards answered with an error other than NotFound
+}
+
+// peerClient: the client of a peer, forwarded gets keep reserve of the caller's budget
+type peerClient struct {
+	*Client
+	reserve time.Duration
+	stats   *peerStats
+}
+
+// Get: get value by key from the peer under the caller's deadline less reserve
+func (p peerClient) Get(ctx context.Context, group, key string) ([]byte, error) {
+	value, _, err := p.getFlagged(ctx, group, key)
+	return value, err
+}
+
+// getFlagged: Get, hot is true if the peer flagged the key hot
+func (p peerClient) getFlagged(ctx context.Context, group, key string) ([]byte, bool, error) {
+	ctx, cancel, err := hopContext(ctx, p.reserve)
+	if err != nil {
+		return nil, false, err
+	}
+	defer cancel()
+	ctx, span := tracerFor(ctx, nil).Start(ctx, "rebelcache.forward",
+		trace.WithAttributes(attribute.String("rebelcache.group", group), attribute.String("rebelcache.peer", p.addr)))
+	p.stats.forwards.Add(1)
+	value, hot, err := p.Client.get(ctx, &pb.GetRequest{Group: group, Key: []byte(key)})
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		p.stats.failures.Add(1)
+		endSpan(span, err)
+		return nil, false, err
+	}
+	span.End()
+	return value, hot, err
+}
+
+// forwardCount: snapshot of a peerStats
+type forwardCount struct {
+	forwards int64
+	failures int64
+}
+
+// forwardCounts: forwarded and failed gets by peer addr
+func (p *ClientPicker) forwardCounts() map[string]forwardCount {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	counts := make(map[string]forwardCount, len(p.stats))
+	for addr, st := range p.stats {
+		counts[addr] = forwardCount{forwards: st.forwards.Load(), failures: st.failures.Load()}
+	}
+	return counts
+}
+
+// keyHash: position of key on the ring
+func (p *ClientPicker) keyHash(key string) uint32 {
+	return p.ring.KeyHash(key)
+}
+
+// shares: part of each of segments slices of the ring owned by the local node
+func (p *ClientPicker) shares(segments int) []float64 {
+	return p.ring.Shares(p.self, segments)
+}
+
+// Peers: addrs of the peers on the ring, the local node included
+func (p *ClientPicker) Peers() []string {
+	return p.ring.Nodes()
+}
+
+// RingSignature: how the picker's ring places keys, see consistenthash.Map.Signature
+func (p *ClientPicker) RingSignature() string {
+	return p.ring.Signature()
+}
+
+// Close: stop discovery and close all peer connections
+func (p *ClientPicker) Close() {
+	p.mtx.Lock()
+	d, cli := p.discovery, p.etcdCli
+	p.discovery, p.etcdCli = nil, nil
+	p.mtx.Unlock()
+	if d != nil {
+		d.Stop()
+		cli.Close()
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for addr, c := range p.clients {
+		c.Close()
+		delete(p.clients, addr)
+		delete(p.stats, addr)
+	}
+	p.ring.Set()
+}
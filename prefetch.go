@@ -0,0 +1,100 @@
+package rebelcache
+
+import (
+	"context"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultPrefetchRate  = 100  // prefetched keys per second of a group by default
+	defaultPrefetchBurst = 100  // burst of prefetched keys
+	maxPendingPrefetch   = 4096 // keys waiting to be prefetched, more are dropped
+)
+
+// Prefetch: warm keys the application expects to need soon, like the next page
+// of results, in the background. Keys already cached or being loaded cost
+// nothing more, keys owned by a peer are warmed on the peer. Prefetches run at
+// most at the group's prefetch rate, see SetPrefetchRate, under the deadline of
+// ctx but not its cancellation, and stop when the group closes. Keys beyond
+// what can wait are dropped, it returns the number of keys queued
+func (g *Group) Prefetch(ctx context.Context, keys ...string) int {
+	var queued []string
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if g.prefetchPending.Add(1) > maxPendingPrefetch {
+			g.prefetchPending.Add(-1)
+			g.prefetchDropped.Add(1)
+			continue
+		}
+		// a key queued twice is prefetched once
+		if _, dup := g.prefetching.LoadOrStore(key, struct{}{}); dup {
+			g.prefetchPending.Add(-1)
+			continue
+		}
+		queued = append(queued, key)
+	}
+	if len(queued) == 0 {
+		return 0
+	}
+
+	ctx, cancel := detachBudget(ctx)
+	stop := context.AfterFunc(g.closing, cancel)
+	prefetch := func() {
+		defer cancel()
+		defer stop()
+		for _, key := range queued {
+			g.prefetchKey(ctx, key)
+			g.prefetching.Delete(key)
+			g.prefetchPending.Add(-1)
+		}
+	}
+	if !g.tasks.Go("prefetch", prefetch) {
+		// the group closed meanwhile
+		cancel()
+		prefetch()
+	}
+	return len(queued)
+}
+
+// prefetchKey: warm one key once the prefetch rate allows, errors are only counted
+func (g *Group) prefetchKey(ctx context.Context, key string) {
+	defer recoverPanic("prefetch", nil)
+	if err := g.prefetchRate.Wait(ctx); err != nil {
+		g.prefetchDropped.Add(1)
+		return
+	}
+	norm, err := g.cache.opts.KeyPolicy.Apply(key)
+	if err != nil {
+		g.prefetchErrors.Add(1)
+		return
+	}
+	// unlike Get, a prefetch is no read served, the ownership rates leave it out
+	if peer, ok := g.pickPeer(norm); ok {
+		_, err = g.getFromPeer(ctx, peer, key)
+	} else {
+		ctx = WithOrigin(ctx, "prefetch:"+g.name)
+		_, err = g.cache.GetOrLoad(ctx, key, func(ctx context.Context) (store.Value, time.Duration, error) {
+			value, err := g.load(ctx, key)
+			return value, 0, err
+		})
+	}
+	if err != nil {
+		g.prefetchErrors.Add(1)
+		return
+	}
+	g.prefetched.Add(1)
+}
+
+// SetPrefetchRate: limit prefetched keys to r per second with burst, r <= 0 means unlimited
+func (g *Group) SetPrefetchRate(r rate.Limit, burst int) {
+	if r <= 0 {
+		r = rate.Inf
+	}
+	g.prefetchRate.SetLimit(r)
+	g.prefetchRate.SetBurst(max(burst, 1))
+}
@@ -0,0 +1,166 @@
+package rebelcache
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ProtocolVersion: version of the rpc protocol spoken by this build
+const ProtocolVersion = 1
+
+// MinProtocolVersion: oldest client protocol servers of this build accept,
+// clients sending no version are treated as version 1
+const MinProtocolVersion = 1
+
+// rpc metadata keys of the negotiation, sent by clients in requests and by servers in response headers
+const (
+	protocolKey     = "rebelcache-protocol"
+	capabilitiesKey = "rebelcache-capabilities"
+)
+
+// Capability: an optional protocol feature, a server only uses features
+// the calling client announced, so old clients keep working across upgrades
+type Capability string
+
+const (
+	CapTTL        Capability = "ttl"        // Set carries a ttl
+	CapForwarding Capability = "forwarding" // forwarded requests are marked, see forwardedKey
+	CapWatch      Capability = "watch"      // Watch streams the writes to groups
+	// CapCompression: values of Get and Set may be compressed, see CompressionOptions
+	CapCompression Capability = "compression"
+	// CapConsistency: Get, Set and Delete carry a consistency level, see Consistency
+	CapConsistency Capability = "consistency"
+	// CapHandoff: Set may only set absent keys, for keys handed off by Server.Drain
+	CapHandoff Capability = "handoff"
+	// CapConditionalSet: Set may only set present keys or entries of a
+	// version and tells whether it applied, cached Gets return the version
+	CapConditionalSet Capability = "conditional-set"
+	// CapMerge: MergeOp merges operands with the group's merge operator
+	CapMerge Capability = "merge"
+	// CapPatch: MergeOp may patch a value at an offset, see Client.Patch
+	CapPatch Capability = "patch"
+	// CapCollections: MergeOp may add to sets and lists, see Client.SAdd and Client.LPush
+	CapCollections Capability = "collections"
+	// CapPing: Ping answers without touching a cache, see PickerOptions.Nearest
+	CapPing Capability = "ping"
+)
+
+// capabilities: features this build supports, in announcement order
+var capabilities = []Capability{CapTTL, CapForwarding, CapWatch, CapCompression, CapConsistency, CapHandoff, CapConditionalSet, CapMerge, CapPatch, CapCollections, CapPing}
+
+// ProtocolInfo: protocol version and capabilities announced by the other side of an rpc
+type ProtocolInfo struct {
+	Version      int
+	Capabilities []Capability
+}
+
+// Supports: whether the other side announced c
+func (p ProtocolInfo) Supports(c Capability) bool {
+	return slices.Contains(p.Capabilities, c)
+}
+
+// Intersect: the capabilities both sides support
+func (p ProtocolInfo) Intersect() []Capability {
+	var common []Capability
+	for _, c := range capabilities {
+		if p.Supports(c) {
+			common = append(common, c)
+		}
+	}
+	return common
+}
+
+// localProtocol: protocol metadata of this build
+func localProtocol() metadata.MD {
+	caps := make([]string, len(capabilities))
+	for i, c := range capabilities {
+		caps[i] = string(c)
+	}
+	return metadata.Pairs(protocolKey, strconv.Itoa(ProtocolVersion), capabilitiesKey, strings.Join(caps, ","))
+}
+
+// parseProtocol: read announced protocol from md, ok is false if none was announced
+func parseProtocol(md metadata.MD) (info ProtocolInfo, ok bool) {
+	versions := md.Get(protocolKey)
+	if len(versions) == 0 {
+		return ProtocolInfo{Version: MinProtocolVersion}, false
+	}
+	info.Version, _ = strconv.Atoi(versions[0])
+	for _, list := range md.Get(capabilitiesKey) {
+		for _, c := range strings.Split(list, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				info.Capabilities = append(info.Capabilities, Capability(c))
+			}
+		}
+	}
+	return info, true
+}
+
+// protocolCtxKey: context key of the client's ProtocolInfo
+type protocolCtxKey struct{}
+
+// ClientProtocol: protocol the client of an incoming rpc announced,
+// handlers consult it to leave out features old clients do not know
+func ClientProtocol(ctx context.Context) ProtocolInfo {
+	if info, ok := ctx.Value(protocolCtxKey{}).(ProtocolInfo); ok {
+		return info
+	}
+	return ProtocolInfo{Version: MinProtocolVersion}
+}
+
+// negotiateUnary: server interceptor rejecting clients outside the supported
+// versions with a clear error and announcing the server's protocol in the header
+func negotiateUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	client, _ := parseProtocol(md)
+	grpc.SetHeader(ctx, localProtocol())
+	if client.Version < MinProtocolVersion {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"rebelcache: client protocol %d is too old, server accepts %d to %d", client.Version, MinProtocolVersion, ProtocolVersion)
+	}
+	// newer clients are served at our version, they downgrade from our header
+	return handler(context.WithValue(ctx, protocolCtxKey{}, client), req)
+}
+
+// announceUnary: client interceptor sending our protocol, caller, feature, clock and trace context and recording the server's protocol
+func (c *Client) announceUnary(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	for key, values := range localProtocol() {
+		for _, v := range values {
+			ctx = metadata.AppendToOutgoingContext(ctx, key, v)
+		}
+	}
+	caller, feature := CallerFromContext(ctx)
+	if caller == "" {
+		caller = c.opts.CallerID
+	}
+	if caller != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, callerKey, caller)
+	}
+	if feature != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, featureKey, feature)
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, sentAtKey, strconv.FormatInt(time.Now().UnixNano(), 10))
+	ctx = injectTrace(ctx)
+	var header metadata.MD
+	err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Header(&header))...)
+	if info, ok := parseProtocol(header); ok {
+		c.server.Store(&info)
+	}
+	return err
+}
+
+// ServerProtocol: protocol announced by the server of the last call, ok is false before any call
+func (c *Client) ServerProtocol() (ProtocolInfo, bool) {
+	if info := c.server.Load(); info != nil {
+		return *info, true
+	}
+	return ProtocolInfo{}, false
+}
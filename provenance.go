@@ -0,0 +1,106 @@
+package rebelcache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+// originKey: context key of the origin recorded in provenance
+type originKey struct{}
+
+// WithOrigin: tag writes made with ctx with origin, e.g. the calling service
+func WithOrigin(ctx context.Context, origin string) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// originFromContext: the origin set by WithOrigin, or fallback
+func originFromContext(ctx context.Context, fallback string) string {
+	if origin, ok := ctx.Value(originKey{}).(string); ok && origin != "" {
+		return origin
+	}
+	return fallback
+}
+
+// Provenance: who produced an entry and when
+type Provenance struct {
+	Node      string    // node that stored the entry
+	Origin    string    // client or loader that produced the value
+	CreatedAt time.Time // when the entry was written
+}
+
+// EntryInfo: metadata of a cache entry
+type EntryInfo struct {
+	Provenance Provenance // zero unless CacheOptions.Provenance is set
+	Version    uint64     // entry version, see CompareAndSwap
+	Size       int        // value size in bytes
+	// Compression: algorithm the value is stored with, see CacheOptions.Compression
+	Compression Compression
+}
+
+// provenanceValue: a stored value carrying compact provenance and, with
+// CacheOptions.Lifetimes, its reads. node is shared by all entries of a
+// cache and not accounted
+type provenanceValue struct {
+	store.Value
+	node    string
+	origin  string
+	created int64        // unix nanoseconds
+	gets    atomic.Int64 // gets served, see lifetimes
+	lastGet atomic.Int64 // unix nanoseconds of the last get
+}
+
+// Len: value size plus metadata
+func (v *provenanceValue) Len() int {
+	return v.Value.Len() + len(v.origin) + 8
+}
+
+// wrapValue: compress value if it is large enough and attach provenance if
+// enabled or lifetimes counted, counters stay bare so Incr keeps working
+func (c *Cache) wrapValue(value store.Value, origin string) store.Value {
+	value = compressValue(c.opts.Compression, value, &c.compressionSaved)
+	if !c.opts.Provenance && c.lifetimes == nil || value == nil {
+		return value
+	}
+	if _, ok := value.(store.Counter); ok {
+		return value
+	}
+	return &provenanceValue{Value: value, node: c.opts.NodeName, origin: origin, created: time.Now().UnixNano()}
+}
+
+// unwrapValue: strip provenance from a stored value and decompress it
+func unwrapValue(value store.Value) store.Value {
+	if v, ok := value.(*provenanceValue); ok {
+		value = v.Value
+	}
+	if v, ok := value.(*compressedValue); ok {
+		return v.view()
+	}
+	return value
+}
+
+// GetEntryInfo: return provenance, version and size of the entry at key
+func (c *Cache) GetEntryInfo(key string) (EntryInfo, bool) {
+	var info EntryInfo
+	ok := c.read(key, func(s store.Store, key string) bool {
+		value, version, ok := s.GetWithVersion(key)
+		if !ok {
+			return false
+		}
+		info.Version = version
+		if v, ok := value.(*provenanceValue); ok {
+			if c.opts.Provenance {
+				info.Provenance = Provenance{Node: v.node, Origin: v.origin, CreatedAt: time.Unix(0, v.created)}
+			}
+			value = v.Value
+		}
+		info.Size = value.Len()
+		if v, ok := value.(*compressedValue); ok {
+			info.Size, info.Compression = v.size, v.algo
+		}
+		return true
+	})
+	return info, ok
+}
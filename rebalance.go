@@ -0,0 +1,83 @@
+package rebelcache
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultRebalanceRate   = 1000 // keys handed off per second
+	defaultRebalanceSettle = 5 * time.Second
+	rebalanceCheckInterval = time.Second // how often the ring is compared with the last one rebalanced
+	rebalanceWorkers       = 4           // keys handed off at once by a rebalance
+)
+
+// RebalanceOptions: hand the keys a node no longer owns after a change of
+// its ring, peers joining or leaving, to their new owners rather than
+// leaving them to miss there. Zero fields take defaults
+type RebalanceOptions struct {
+	// Rate: keys handed off per second, so a rebalance doesn't saturate the
+	// network, 0 means 1000
+	Rate float64
+	// Settle: how long the ring must stay unchanged before its keys are
+	// moved, so nodes joining together cause one rebalance, 0 means 5s
+	Settle time.Duration
+}
+
+// rebalanceLoop: rebalance the served groups once the Picker's ring
+// changed and settled, until ctx ends
+func (s *Server) rebalanceLoop(ctx context.Context) error {
+	p := s.opts.Picker
+	opts := *s.opts.Rebalance
+	if opts.Rate <= 0 {
+		opts.Rate = defaultRebalanceRate
+	}
+	if opts.Settle <= 0 {
+		opts.Settle = defaultRebalanceSettle
+	}
+	limiter := newLimiter(rate.Limit(opts.Rate), rebalanceWorkers)
+	ticker := time.NewTicker(rebalanceCheckInterval)
+	defer ticker.Stop()
+	last, changed := p.changes.Load(), time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		switch n := p.changes.Load(); {
+		case n != last:
+			last, changed = n, time.Now()
+		case !changed.IsZero() && time.Since(changed) >= opts.Settle && !s.draining.Load():
+			changed = time.Time{}
+			s.rebalance(ctx, p, limiter)
+		}
+	}
+}
+
+// rebalance: hand the entries of keys owned by other nodes to them and evict
+// them here once handed off, unless written since. Entries the node keeps as
+// a replica of the key stay, see ServerOptions.ReplicaCount
+func (s *Server) rebalance(ctx context.Context, p *ClientPicker, limiter *rate.Limiter) {
+	entries := s.localEntries(func(_ *Group, key string) bool {
+		if _, remote := p.PickPeer(key); !remote {
+			return false
+		}
+		return !slices.Contains(p.replicaSet(key), nil)
+	})
+	if len(entries) == 0 {
+		return
+	}
+	start := time.Now()
+	moved, failed := s.handOff(ctx, p, entries, rebalanceWorkers, limiter, func(e handoffEntry) {
+		if e.g.cache.evictIfVersion(e.key, e.version) {
+			e.g.rebalanced.Add(1)
+		}
+	})
+	log.Printf("rebelcache: node %s rebalanced in %s, %d of %d keys handed off, %d failed",
+		p.self, time.Since(start).Round(time.Millisecond), moved, len(entries), failed)
+}
@@ -0,0 +1,303 @@
+// Package rebelcachetest provides an in-memory fake of the rebelcache client
+// for unit tests of code using a cache, without etcd or cache servers.
+package rebelcachetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	rebelcache "github.com/RebellioN-YonG/Distrbuted-Cache"
+)
+
+// ErrInjected: the default error of the calls failed on purpose, see
+// Options.ErrorRate and Fake.FailNext
+var ErrInjected = errors.New("rebelcachetest: injected failure")
+
+// ErrClosed: calls made after Close
+var ErrClosed = errors.New("rebelcachetest: client closed")
+
+// Op: a call of the fake, to inject failures in and count
+type Op string
+
+const (
+	OpGet    Op = "Get"
+	OpSet    Op = "Set"
+	OpDelete Op = "Delete"
+)
+
+// Options: behaviour of a Fake
+type Options struct {
+	// Latency: delay of every call, plus up to Jitter at random. Calls return
+	// early with the error of their ctx if it ends first
+	Latency time.Duration
+	Jitter  time.Duration
+	// ErrorRate: share of the calls failing with Err, from 0 to 1
+	ErrorRate float64
+	// Err: error of the failing calls, nil means ErrInjected
+	Err error
+	// Codec: encoding of the values of SetObject and GetObject, nil means JSON
+	Codec rebelcache.ValueCodec
+	// Clock: time entries expire by, nil means time.Now. Tests advance it to
+	// expire entries without sleeping
+	Clock func() time.Time
+}
+
+// entry: a value of the fake and its expiration, zero if none
+type entry struct {
+	value    []byte
+	expireAt time.Time
+}
+
+// failure: an error the next calls of an op return
+type failure struct {
+	err error
+	n   int
+}
+
+// Fake: an in-memory rebelcache.CacheClient, with the GetObject and SetObject
+// of rebelcache.Client. Groups exist once written to, values are copied in
+// and out. A ttl of 0 or rebelcache.NoExpiration means no expiration, there
+// are no group policies. Consistency levels are accepted and ignored. Safe
+// for concurrent use
+type Fake struct {
+	opts Options
+
+	mtx      sync.Mutex
+	groups   map[string]map[string]entry
+	failures map[Op][]failure
+	calls    map[Op]int
+	closed   bool
+}
+
+var _ rebelcache.CacheClient = (*Fake)(nil)
+
+// New: an empty fake, nil opts means no latency nor failures
+func New(opts *Options) *Fake {
+	f := &Fake{
+		groups:   make(map[string]map[string]entry),
+		failures: make(map[Op][]failure),
+		calls:    make(map[Op]int),
+	}
+	if opts != nil {
+		f.opts = *opts
+	}
+	if f.opts.Codec == nil {
+		f.opts.Codec = rebelcache.JSON
+	}
+	if f.opts.Clock == nil {
+		f.opts.Clock = time.Now
+	}
+	return f
+}
+
+// SetLatency: change the latency and jitter of the calls made from now on
+func (f *Fake) SetLatency(latency, jitter time.Duration) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.opts.Latency, f.opts.Jitter = latency, jitter
+}
+
+// SetErrorRate: change the share of the calls failing with err, nil means ErrInjected
+func (f *Fake) SetErrorRate(rate float64, err error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.opts.ErrorRate, f.opts.Err = rate, err
+}
+
+// FailNext: fail the next n calls of op with err, nil means ErrInjected.
+// Failures queued for an op are returned in order, before any ErrorRate one
+func (f *Fake) FailNext(op Op, n int, err error) {
+	if n <= 0 {
+		return
+	}
+	if err == nil {
+		err = ErrInjected
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.failures[op] = append(f.failures[op], failure{err: err, n: n})
+}
+
+// Calls: calls of op made so far, failed ones included
+func (f *Fake) Calls(op Op) int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.calls[op]
+}
+
+// Keys: sorted keys of the unexpired entries of group
+func (f *Fake) Keys(group string) []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	now := f.opts.Clock()
+	var keys []string
+	for key, e := range f.groups[group] {
+		if e.live(now) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Reset: drop every entry, queued failure and call count, the options are kept
+func (f *Fake) Reset() {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	clear(f.groups)
+	clear(f.failures)
+	clear(f.calls)
+}
+
+// Get: the value of key in group, an error wrapping rebelcache.ErrNotFound if
+// there is none. Unlike a cluster the fake has no getters to load misses with
+func (f *Fake) Get(ctx context.Context, group, key string) ([]byte, error) {
+	if err := f.call(ctx, OpGet); err != nil {
+		return nil, err
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	e, ok := f.groups[group][key]
+	if !ok || !e.live(f.opts.Clock()) {
+		return nil, fmt.Errorf("%w: key %s of group %s", rebelcache.ErrNotFound, rebelcache.FormatKey(key), group)
+	}
+	return slices.Clone(e.value), nil
+}
+
+// Set: set key of group to value, expiring after ttl, see Fake
+func (f *Fake) Set(ctx context.Context, group, key string, value []byte, ttl time.Duration) error {
+	if err := f.call(ctx, OpSet); err != nil {
+		return err
+	}
+	if key == "" {
+		return fmt.Errorf("%w: empty key", rebelcache.ErrInvalidKey)
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	e := entry{value: slices.Clone(value)}
+	if ttl > 0 {
+		e.expireAt = f.opts.Clock().Add(ttl)
+	}
+	if f.groups[group] == nil {
+		f.groups[group] = make(map[string]entry)
+	}
+	f.groups[group][key] = e
+	return nil
+}
+
+// Delete: delete key from group, return whether it had an unexpired value
+func (f *Fake) Delete(ctx context.Context, group, key string) (bool, error) {
+	if err := f.call(ctx, OpDelete); err != nil {
+		return false, err
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	e, ok := f.groups[group][key]
+	delete(f.groups[group], key)
+	return ok && e.live(f.opts.Clock()), nil
+}
+
+// GetObject: decode the value of key of group into v, a pointer, with the
+// fake's Codec, see Get. Counted as a Get
+func (f *Fake) GetObject(ctx context.Context, group, key string, v any) error {
+	data, err := f.Get(ctx, group, key)
+	if err != nil {
+		return err
+	}
+	if err := f.opts.Codec.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("rebelcachetest: decode %s: %w", rebelcache.FormatKey(key), err)
+	}
+	return nil
+}
+
+// SetObject: encode v with the fake's Codec and set key of group to it, see
+// Set. Counted as a Set
+func (f *Fake) SetObject(ctx context.Context, group, key string, v any, ttl time.Duration) error {
+	data, err := f.opts.Codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("rebelcachetest: encode %s: %w", rebelcache.FormatKey(key), err)
+	}
+	return f.Set(ctx, group, key, data, ttl)
+}
+
+// Close: fail the calls made from now on with ErrClosed, the entries are kept
+// for the test to inspect
+func (f *Fake) Close() error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.closed = true
+	return nil
+}
+
+// Snapshot: copy of the unexpired entries of group
+func (f *Fake) Snapshot(group string) map[string][]byte {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	now := f.opts.Clock()
+	snap := make(map[string][]byte, len(f.groups[group]))
+	for key, e := range f.groups[group] {
+		if e.live(now) {
+			snap[key] = slices.Clone(e.value)
+		}
+	}
+	return snap
+}
+
+// call: count a call of op, wait its latency and return the failure injected
+// in it, if any
+func (f *Fake) call(ctx context.Context, op Op) error {
+	f.mtx.Lock()
+	f.calls[op]++
+	if f.closed {
+		f.mtx.Unlock()
+		return ErrClosed
+	}
+	delay := f.opts.Latency
+	if f.opts.Jitter > 0 {
+		delay += rand.N(f.opts.Jitter)
+	}
+	err := f.failureLocked(op)
+	f.mtx.Unlock()
+
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return err
+}
+
+// failureLocked: the error a call of op fails with, nil if it doesn't
+func (f *Fake) failureLocked(op Op) error {
+	if queued := f.failures[op]; len(queued) > 0 {
+		err := queued[0].err
+		if queued[0].n--; queued[0].n == 0 {
+			f.failures[op] = queued[1:]
+		}
+		return err
+	}
+	if f.opts.ErrorRate > 0 && rand.Float64() < f.opts.ErrorRate {
+		if f.opts.Err != nil {
+			return f.opts.Err
+		}
+		return ErrInjected
+	}
+	return nil
+}
+
+// live: whether e hasn't expired at now
+func (e entry) live(now time.Time) bool {
+	return e.expireAt.IsZero() || now.Before(e.expireAt)
+}
@@ -0,0 +1,266 @@
+package rebelcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	"google.golang.org/protobuf/proto"
+)
+
+// recordFormat: version of the layout of the snapshots, dumps and
+// append-only logs this release writes. A file starts with its magic, the
+// version byte and a uvarint-prefixed header: the uvarint-prefixed name of
+// the codec of its records, then the oldest version able to read the file.
+// Readers take files of every version up to theirs, and of later versions
+// whose oldest reader they are not older than: the fields later versions
+// append to a header or a record are skipped, so are records of ops a
+// reader doesn't know. A version whose files older readers would misread
+// names itself as their oldest reader
+const recordFormat = 2
+
+// minReaderFormat: the oldest reader of the files this release writes
+const minReaderFormat = 2
+
+// maxRecordHeader: longest file header, longer lengths mean corruption
+const maxRecordHeader = 1 << 16
+
+// ErrUnsupportedFormat: a snapshot, dump or log needs a newer release or a
+// record codec that isn't registered
+var ErrUnsupportedFormat = errors.New("rebelcache: unsupported file format")
+
+// RecordOp: what a Record holds
+type RecordOp uint8
+
+const (
+	RecordSet     RecordOp = 1 // Key was set to Value
+	RecordCounter RecordOp = 2 // Key was set to the store.Counter Counter
+	RecordDelete  RecordOp = 3 // Key was deleted, logs only
+	RecordClear   RecordOp = 4 // all entries of Group were removed, logs only
+)
+
+// Record: an entry of a snapshot or dump, or a write of an append-only log
+type Record struct {
+	Op      RecordOp
+	Group   string // group of a logged write, empty in snapshots and dumps
+	Key     string
+	Value   []byte // RecordSet only
+	Counter int64  // RecordCounter only
+	// Expiry: expiration in unix nanos, the ttl left when dumped in dumps, 0 if none
+	Expiry int64
+}
+
+// newRecord: the record of a set or counter of key to value, ok is false
+// for a value without a byte form
+func newRecord(group, key string, value store.Value, expiry int64) (_ Record, ok bool) {
+	if counter, ok := value.(store.Counter); ok {
+		return Record{Op: RecordCounter, Group: group, Key: key, Counter: int64(counter), Expiry: expiry}, true
+	}
+	b, err := valueBytes(value)
+	if err != nil {
+		return Record{}, false
+	}
+	return Record{Op: RecordSet, Group: group, Key: key, Value: b, Expiry: expiry}, true
+}
+
+// value: the value of a set or counter record
+func (r *Record) value() store.Value {
+	if r.Op == RecordCounter {
+		return store.Counter(r.Counter)
+	}
+	return byteViewOf(r.Value)
+}
+
+// RecordCodec: encoding of the records of snapshots, dumps and append-only
+// logs. Files name the codec they were written with, so every registered
+// codec can read them back whatever the server is configured to write
+type RecordCodec interface {
+	// Name: the name files record, unique among the codecs
+	Name() string
+	// AppendRecord: append the encoding of r to b
+	AppendRecord(b []byte, r *Record) ([]byte, error)
+	// DecodeRecord: decode data into r, skipping what later releases add
+	DecodeRecord(data []byte, r *Record) error
+}
+
+// BinaryRecords: the default record codec, a compact varint layout
+var BinaryRecords RecordCodec = binaryRecordCodec{}
+
+// ProtobufRecords: records as pb.Record messages, for tools reading the
+// files of a cluster with protobuf
+var ProtobufRecords RecordCodec = protobufRecordCodec{}
+
+var (
+	recordCodecsMtx sync.RWMutex
+	recordCodecs    = map[string]RecordCodec{"binary": BinaryRecords, "protobuf": ProtobufRecords}
+)
+
+// RegisterRecordCodec: make codec available to write files with, by the name
+// SnapshotOptions.Format and AOFOptions.Format give, and to read the files it
+// wrote. It panics if codec is nil or its name is empty or already registered
+func RegisterRecordCodec(codec RecordCodec) {
+	recordCodecsMtx.Lock()
+	defer recordCodecsMtx.Unlock()
+	if codec == nil {
+		panic("rebelcache: RegisterRecordCodec codec is nil")
+	}
+	name := codec.Name()
+	if name == "" {
+		panic("rebelcache: RegisterRecordCodec codec without a name")
+	}
+	if _, dup := recordCodecs[name]; dup {
+		panic(fmt.Sprintf("rebelcache: RegisterRecordCodec called twice for %q", name))
+	}
+	recordCodecs[name] = codec
+}
+
+// recordCodecNamed: the record codec registered as name, empty means BinaryRecords
+func recordCodecNamed(name string) (RecordCodec, error) {
+	if name == "" {
+		return BinaryRecords, nil
+	}
+	recordCodecsMtx.RLock()
+	defer recordCodecsMtx.RUnlock()
+	codec, ok := recordCodecs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown record codec %q", ErrUnsupportedFormat, name)
+	}
+	return codec, nil
+}
+
+// appendHeader: append magic, recordFormat and the header of a file whose
+// records codec encodes
+func appendHeader(b []byte, magic string, codec RecordCodec) []byte {
+	b = append(b, magic...)
+	b = append(b, recordFormat)
+	h := binary.AppendUvarint(nil, uint64(len(codec.Name())))
+	h = append(h, codec.Name()...)
+	h = binary.AppendUvarint(h, minReaderFormat)
+	b = binary.AppendUvarint(b, uint64(len(h)))
+	return append(b, h...)
+}
+
+// parseHeader: the codec of the records of a file from its header, an
+// ErrUnsupportedFormat if this release cannot read them
+func parseHeader(h []byte) (RecordCodec, error) {
+	n, size := binary.Uvarint(h)
+	if size <= 0 || uint64(len(h)-size) < n {
+		return nil, errors.New("malformed header")
+	}
+	name := string(h[size : size+int(n)])
+	readers, size := binary.Uvarint(h[size+int(n):])
+	if size <= 0 {
+		return nil, errors.New("malformed header")
+	}
+	if readers > recordFormat {
+		return nil, fmt.Errorf("%w: needs format %d, this release reads up to %d", ErrUnsupportedFormat, readers, recordFormat)
+	}
+	return recordCodecNamed(name)
+}
+
+// binaryRecordCodec: a record is its op, the uvarint-prefixed group and key,
+// then the uvarint-prefixed value of a set or the varint of a counter, and
+// for both the varint expiry. Bytes after the fields of the op are skipped,
+// records of later ops start with the group and key too
+type binaryRecordCodec struct{}
+
+func (binaryRecordCodec) Name() string { return "binary" }
+
+func (binaryRecordCodec) AppendRecord(b []byte, r *Record) ([]byte, error) {
+	b = append(b, byte(r.Op))
+	b = binary.AppendUvarint(b, uint64(len(r.Group)))
+	b = append(b, r.Group...)
+	b = binary.AppendUvarint(b, uint64(len(r.Key)))
+	b = append(b, r.Key...)
+	switch r.Op {
+	case RecordSet:
+		b = binary.AppendUvarint(b, uint64(len(r.Value)))
+		b = append(b, r.Value...)
+	case RecordCounter:
+		b = binary.AppendVarint(b, r.Counter)
+	default:
+		return b, nil
+	}
+	return binary.AppendVarint(b, r.Expiry), nil
+}
+
+func (binaryRecordCodec) DecodeRecord(data []byte, r *Record) error {
+	ok := true
+	// next: the uvarint-prefixed bytes at the front of data
+	next := func() []byte {
+		n, size := binary.Uvarint(data)
+		if !ok || size <= 0 || uint64(len(data)-size) < n {
+			ok = false
+			return nil
+		}
+		b := data[size : size+int(n)]
+		data = data[size+int(n):]
+		return b
+	}
+	// varint: the varint at the front of data
+	varint := func() int64 {
+		v, size := binary.Varint(data)
+		if !ok || size <= 0 {
+			ok = false
+			return 0
+		}
+		data = data[size:]
+		return v
+	}
+	if len(data) == 0 {
+		return errors.New("empty record")
+	}
+	*r = Record{Op: RecordOp(data[0])}
+	data = data[1:]
+	r.Group, r.Key = string(next()), string(next())
+	switch r.Op {
+	case RecordSet:
+		r.Value = next()
+		r.Expiry = varint()
+	case RecordCounter:
+		r.Counter = varint()
+		r.Expiry = varint()
+	}
+	if !ok {
+		return errors.New("malformed record")
+	}
+	return nil
+}
+
+// protobufRecordCodec: records as pb.Record messages
+type protobufRecordCodec struct{}
+
+func (protobufRecordCodec) Name() string { return "protobuf" }
+
+func (protobufRecordCodec) AppendRecord(b []byte, r *Record) ([]byte, error) {
+	return proto.MarshalOptions{}.MarshalAppend(b, &pb.Record{
+		Op:      uint32(r.Op),
+		Group:   []byte(r.Group),
+		Key:     []byte(r.Key),
+		Value:   r.Value,
+		Counter: r.Counter,
+		Expiry:  r.Expiry,
+	})
+}
+
+func (protobufRecordCodec) DecodeRecord(data []byte, r *Record) error {
+	var m pb.Record
+	if err := proto.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	if m.GetOp() == 0 || m.GetOp() > 0xff {
+		return fmt.Errorf("record op %d", m.GetOp())
+	}
+	*r = Record{
+		Op:      RecordOp(m.GetOp()),
+		Group:   string(m.GetGroup()),
+		Key:     string(m.GetKey()),
+		Value:   m.GetValue(),
+		Counter: m.GetCounter(),
+		Expiry:  m.GetExpiry(),
+	}
+	return nil
+}
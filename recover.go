@@ -0,0 +1,105 @@
+package rebelcache
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"path"
+	"sync"
+	"sync/atomic"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PanicError: a panic recovered in a handler or a background goroutine, with
+// the stack it happened on
+type PanicError = store.PanicError
+
+var (
+	crashHook   atomic.Pointer[func(err *PanicError)] // set by SetCrashHook
+	panicCounts sync.Map                              // where -> *atomic.Int64, panics recovered
+)
+
+// SetCrashHook: call fn with every panic recovered in the process, in rpc,
+// http and redis protocol handlers, in the stores' and groups' background
+// goroutines and in followers, after it is logged and counted, e.g. to send
+// it to a crash reporting service. nil removes the hook. fn must not panic
+func SetCrashHook(fn func(err *PanicError)) {
+	if fn == nil {
+		crashHook.Store(nil)
+		return
+	}
+	crashHook.Store(&fn)
+}
+
+// reportPanic: convert r, recovered in where, to an error, log it, count it
+// by where and hand it to the crash hook
+func reportPanic(where string, r any) *PanicError {
+	err := store.NewPanicError(where, r)
+	countPanic(err)
+	return err
+}
+
+// countPanic: log err, count it by where and hand it to the crash hook, the
+// stores report their panics here
+func countPanic(err *PanicError) {
+	log.Printf("rebelcache: %v\n%s", err, err.Stack)
+	n, _ := panicCounts.LoadOrStore(err.Where, new(atomic.Int64))
+	n.(*atomic.Int64).Add(1)
+	if hook := crashHook.Load(); hook != nil {
+		(*hook)(err)
+	}
+}
+
+// recoverPanic: recover a panic of the calling goroutine and report it, the
+// error it becomes is stored in errp unless nil. Must be deferred directly
+func recoverPanic(where string, errp *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	err := reportPanic(where, r)
+	if errp != nil {
+		*errp = err
+	}
+}
+
+// recoverUnary: turn a panic of a unary rpc into an internal error
+func recoverUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp, err = nil, status.Error(codes.Internal, reportPanic("rpc "+path.Base(info.FullMethod), r).Error())
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// recoverStream: turn a panic of a streaming rpc into an internal error
+func recoverStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = status.Error(codes.Internal, reportPanic("rpc "+path.Base(info.FullMethod), r).Error())
+		}
+	}()
+	return handler(srv, ss)
+}
+
+// recoverHTTP: answer a panic of an http handler with 500, the panic
+// http.ErrAbortHandler aborting a response on purpose passes through
+func recoverHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				reportPanic("http", p)
+				http.Error(w, "rebelcache: internal error", http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,399 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/bits"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	refreshTimeout   = 30 * time.Second // bound of a refresh run across the cluster
+	maxRefreshIdle   = time.Minute      // longest sleep of the refresh loop between rules due
+	cronSearchWindow = 5 * 366 * 24 * time.Hour
+)
+
+// RefreshRule: keys of a group reloaded on a schedule whether read or not, to
+// keep entries every request needs, like feature flags or exchange rates,
+// always fresh. Runs are coordinated by a leader, the node with the lowest
+// addr among its peers, which has every node reload the keys it owns, see
+// ServerOptions.Refresh. Every node should be given the same rules
+type RefreshRule struct {
+	Group    string
+	Keys     []string // reloaded whether cached or not
+	Prefixes []string // cached keys starting with one are reloaded
+	// Interval: time between runs, the first one when the node starts
+	Interval time.Duration
+	// Schedule: cron spec of the runs instead of an Interval, minute, hour,
+	// day of month, month and day of week in UTC, each a *, a value, a range
+	// or a list of them, with an optional /step, e.g. "*/5 * * * *"
+	Schedule string
+}
+
+// refreshEntry: a rule with its schedule
+type refreshEntry struct {
+	rule RefreshRule
+	cron *cronSchedule // nil for an Interval
+	next time.Time     // next run
+}
+
+// refresher: the refresh rules of a server
+type refresher struct {
+	mtx     sync.Mutex
+	entries []*refreshEntry
+	wake    chan struct{} // a rule was added
+}
+
+// newRefresher: a refresher of rules, an error names the first invalid rule
+func newRefresher(rules []RefreshRule) (*refresher, error) {
+	r := &refresher{wake: make(chan struct{}, 1)}
+	for _, rule := range rules {
+		if err := r.add(rule); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// add: schedule rule from now
+func (r *refresher) add(rule RefreshRule) error {
+	e := &refreshEntry{rule: rule}
+	switch {
+	case rule.Group == "":
+		return errors.New("rebelcache: refresh rule without a group")
+	case len(rule.Keys) == 0 && len(rule.Prefixes) == 0:
+		return fmt.Errorf("rebelcache: refresh rule of group %s without keys or prefixes", rule.Group)
+	case rule.Schedule != "" && rule.Interval != 0:
+		return fmt.Errorf("rebelcache: refresh rule of group %s with both an interval and a schedule", rule.Group)
+	case rule.Schedule != "":
+		cron, err := parseCron(rule.Schedule)
+		if err != nil {
+			return fmt.Errorf("rebelcache: refresh rule of group %s: %w", rule.Group, err)
+		}
+		e.cron, e.next = cron, cron.next(time.Now())
+	case rule.Interval > 0:
+		e.next = time.Now()
+	default:
+		return fmt.Errorf("rebelcache: refresh rule of group %s without an interval or a schedule", rule.Group)
+	}
+	r.mtx.Lock()
+	r.entries = append(r.entries, e)
+	r.mtx.Unlock()
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// due: the rules whose run is due at now, scheduled for their next run, and
+// the time the next rule is due
+func (r *refresher) due(now time.Time) (due []RefreshRule, next time.Time) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	next = now.Add(maxRefreshIdle)
+	for _, e := range r.entries {
+		if !e.next.After(now) {
+			due = append(due, e.rule)
+			if e.cron != nil {
+				e.next = e.cron.next(now)
+			} else {
+				e.next = now.Add(e.rule.Interval)
+			}
+		}
+		if e.next.Before(next) {
+			next = e.next
+		}
+	}
+	return due, next
+}
+
+// RegisterRefresh: add rule to the rules of ServerOptions.Refresh
+func (s *Server) RegisterRefresh(rule RefreshRule) error {
+	return s.refresher.add(rule)
+}
+
+// refreshLoop: run the rules as they come due, on the leader only
+func (s *Server) refreshLoop(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		case <-s.refresher.wake:
+		}
+		due, next := s.refresher.due(time.Now())
+		if len(due) > 0 && s.refreshLeader() {
+			for _, rule := range due {
+				s.runRefresh(ctx, rule)
+			}
+		}
+		timer.Reset(time.Until(next))
+	}
+}
+
+// refreshLeader: whether the node runs the refreshes of the cluster, the
+// node with the lowest addr among the Picker's peers
+func (s *Server) refreshLeader() bool {
+	p := s.opts.Picker
+	if p == nil {
+		return true
+	}
+	for addr := range p.peerClients() {
+		if addr < p.self {
+			return false
+		}
+	}
+	return true
+}
+
+// runRefresh: have every node reload the keys of rule it owns
+func (s *Server) runRefresh(ctx context.Context, rule RefreshRule) {
+	ctx, cancel := context.WithTimeout(ctx, refreshTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	if g, err := s.getGroup(rule.Group); err == nil {
+		wg.Go(func() { g.refreshOwned(ctx, rule.Keys, rule.Prefixes) })
+	}
+	if p := s.opts.Picker; p != nil {
+		for addr, c := range p.peerClients() {
+			wg.Go(func() {
+				if _, _, err := c.Refresh(ctx, rule.Group, rule.Keys, rule.Prefixes); err != nil {
+					log.Printf("rebelcache: refresh group %s on %s: %v", rule.Group, addr, err)
+				}
+			})
+		}
+	}
+	wg.Wait()
+}
+
+// refreshOwned: reload the keys the node owns and its cached keys under
+// prefixes, returning the keys reloaded and those that failed. Values equal
+// to the cached ones are left as they are
+func (g *Group) refreshOwned(ctx context.Context, keys, prefixes []string) (refreshed, failed int64) {
+	keys = slices.Clone(keys)
+	if len(prefixes) > 0 {
+		g.cache.Range(func(key string, _ store.Value, _ time.Time) bool {
+			if slices.ContainsFunc(prefixes, func(prefix string) bool { return strings.HasPrefix(key, prefix) }) {
+				keys = append(keys, key)
+			}
+			return true
+		})
+	}
+	ctx = WithOrigin(ctx, "refresh:"+g.name)
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			break
+		}
+		norm, err := g.cache.opts.KeyPolicy.Apply(key)
+		if err != nil {
+			continue
+		}
+		if _, remote := g.pickPeer(norm); remote {
+			continue
+		}
+		if err := g.refreshKey(ctx, key); err != nil {
+			failed++
+			g.refreshErrors.Add(1)
+			log.Printf("rebelcache: refresh %s of group %s: %v", FormatKey(key), g.name, err)
+			continue
+		}
+		refreshed++
+		g.refreshed.Add(1)
+	}
+	return refreshed, failed
+}
+
+// refreshKey: load key and write it like a set
+func (g *Group) refreshKey(ctx context.Context, key string) (err error) {
+	defer recoverPanic("refresh", &err)
+	value, err := g.load(ctx, key)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		return fmt.Errorf("%w: the loader found no value", ErrNotFound)
+	}
+	return g.SetWithExpiration(ctx, key, value, 0)
+}
+
+// Refresh: reload the keys of a group the node owns and its cached keys under prefixes
+func (s *Server) Refresh(ctx context.Context, req *pb.RefreshRequest) (*pb.RefreshResponse, error) {
+	g, err := s.getGroup(req.GetGroup())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if err := g.checkWritable(); err != nil {
+		return nil, toStatus(err)
+	}
+	if len(req.GetKeys()) == 0 && len(req.GetPrefixes()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "rebelcache: no keys nor prefixes to refresh")
+	}
+	keys := make([]string, 0, len(req.GetKeys()))
+	for _, key := range req.GetKeys() {
+		keys = append(keys, string(key))
+	}
+	prefixes := make([]string, 0, len(req.GetPrefixes()))
+	for _, prefix := range req.GetPrefixes() {
+		prefixes = append(prefixes, string(prefix))
+	}
+	refreshed, failed := g.refreshOwned(ctx, keys, prefixes)
+	return &pb.RefreshResponse{Refreshed: refreshed, Failed: failed}, nil
+}
+
+// Refresh: have the node reload the keys of group it owns, and its cached
+// keys under prefixes, see RefreshRule. Returns the keys reloaded and those
+// that failed. Nothing is sent if the KeyPolicy rejects a key
+func (c *Client) Refresh(ctx context.Context, group string, keys, prefixes []string) (refreshed, failed int64, err error) {
+	req := &pb.RefreshRequest{Group: group}
+	for _, key := range keys {
+		norm, err := c.key(key)
+		if err != nil {
+			return 0, 0, err
+		}
+		req.Keys = append(req.Keys, []byte(norm))
+	}
+	for _, prefix := range prefixes {
+		req.Prefixes = append(req.Prefixes, []byte(prefix))
+	}
+	var resp *pb.RefreshResponse
+	err = c.invoke(ctx, "Refresh", group, func(ctx context.Context) (err error) {
+		resp, err = c.grpcCli.Refresh(ctx, req)
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return resp.GetRefreshed(), resp.GetFailed(), nil
+}
+
+// cronSchedule: the minutes a cron spec matches, as bit sets
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny, dowAny: the day of month or of week is *, when neither is a
+	// day matching either matches as in cron
+	domAny, dowAny bool
+}
+
+// cronFields: bounds of the fields of a cron spec
+var cronFields = [5]struct{ min, max int }{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// parseCron: parse a five-field cron spec, see RefreshRule.Schedule
+func parseCron(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron spec %q: want 5 fields, got %d", spec, len(fields))
+	}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("cron spec %q: %w", spec, err)
+		}
+		sets[i] = set
+	}
+	// a 7 in the day of week is sunday too
+	if sets[4]&(1<<7) != 0 {
+		sets[4] = sets[4]&^(1<<7) | 1
+	}
+	c := &cronSchedule{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domAny: fields[2] == "*", dowAny: fields[4] == "*",
+	}
+	if c.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron spec %q matches no day", spec)
+	}
+	return c, nil
+}
+
+// parseCronField: the values of a field between lo and hi a spec matches
+func parseCronField(field string, lo, hi int) (uint64, error) {
+	var set uint64
+	for part := range strings.SplitSeq(field, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			rng, step = part[:i], n
+		}
+		from, to := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("bad value in %q", part)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("bad range in %q", part)
+				}
+			} else if step > 1 {
+				to = hi
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return 0, fmt.Errorf("%q out of %d-%d", part, lo, hi)
+		}
+		for v := from; v <= to; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// next: the first minute matching the schedule after t, in UTC, zero if
+// none does within five years
+func (c *cronSchedule) next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	end := t.Add(cronSearchWindow)
+	for t.Before(end) {
+		switch {
+		case c.month&(1<<t.Month()) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<t.Hour()) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case c.minute&(1<<t.Minute()) == 0:
+			// the next matching minute of the hour, or the next hour
+			if rest := c.minute >> t.Minute(); rest != 0 {
+				t = t.Add(time.Duration(bits.TrailingZeros64(rest)) * time.Minute)
+			} else {
+				t = t.Truncate(time.Hour).Add(time.Hour)
+			}
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches: whether the day of t matches, by day of month or day of week
+// when both are restricted as in cron
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<t.Weekday()) != 0
+	switch {
+	case c.domAny && c.dowAny, c.dowAny:
+		return dom
+	case c.domAny:
+		return dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,275 @@
+package rebelcache
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Registry: where the nodes of a cluster register and find each other, see
+// ServerOptions.Discovery. A node registers its addr with the json of its
+// NodeConfig as value. NewEtcdRegistry, NewConsulRegistry,
+// NewZooKeeperRegistry and NewDNSRegistry implement it
+type Registry interface {
+	// Register: keep the node at addr registered with value in the background
+	// until Deregister, retrying while the backend is unreachable and
+	// registering the node again whenever the backend lost it. Registering an
+	// addr again only replaces its value
+	Register(ctx context.Context, addr, value string) error
+	// Deregister: stop keeping the node at addr registered and remove it
+	Deregister(ctx context.Context, addr string) error
+	// Watch: call onChange with the registered nodes, addr -> value, once
+	// before returning and after every change until ctx ends. Calls are
+	// made one at a time
+	Watch(ctx context.Context, onChange func(nodes map[string]string)) error
+	// Close: deregister the nodes still registered and release the
+	// connections the registry opened
+	Close() error
+}
+
+// registration: a node a Registry keeps registered
+type registration struct {
+	mtx     sync.Mutex
+	value   string
+	updates chan struct{} // signaled when value changes
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// current: the value the node is registered with
+func (r *registration) current() string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.value
+}
+
+// registrations: the nodes a Registry keeps registered, by addr
+type registrations struct {
+	mtx   sync.Mutex
+	nodes map[string]*registration
+}
+
+// start: keep addr registered with value by running keep in the background
+// until stop, only replace its value if it is already kept. keep removes the
+// registration once its ctx ends
+func (rs *registrations) start(addr, value string, keep func(ctx context.Context, r *registration)) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	if r, ok := rs.nodes[addr]; ok {
+		r.mtx.Lock()
+		changed := r.value != value
+		r.value = value
+		r.mtx.Unlock()
+		if changed {
+			select {
+			case r.updates <- struct{}{}:
+			default:
+			}
+		}
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &registration{value: value, updates: make(chan struct{}, 1), cancel: cancel, done: make(chan struct{})}
+	if rs.nodes == nil {
+		rs.nodes = make(map[string]*registration)
+	}
+	rs.nodes[addr] = r
+	go func() {
+		defer close(r.done)
+		defer recoverPanic("registration", nil)
+		keep(ctx, r)
+	}()
+}
+
+// stop: stop keeping addr registered and wait until its registration is
+// removed or ctx ends
+func (rs *registrations) stop(ctx context.Context, addr string) error {
+	rs.mtx.Lock()
+	r, ok := rs.nodes[addr]
+	delete(rs.nodes, addr)
+	rs.mtx.Unlock()
+	if !ok {
+		return nil
+	}
+	r.cancel()
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stopAll: stop every registration, see stop
+func (rs *registrations) stopAll(ctx context.Context) error {
+	rs.mtx.Lock()
+	addrs := make([]string, 0, len(rs.nodes))
+	for addr := range rs.nodes {
+		addrs = append(addrs, addr)
+	}
+	rs.mtx.Unlock()
+	for _, addr := range addrs {
+		if err := rs.stop(ctx, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registeredNodes: the nodes registered in reg now
+func registeredNodes(ctx context.Context, reg Registry) (map[string]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var mtx sync.Mutex
+	var nodes map[string]string
+	err := reg.Watch(ctx, func(n map[string]string) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if nodes == nil {
+			nodes = n
+		}
+	})
+	mtx.Lock()
+	defer mtx.Unlock()
+	return nodes, err
+}
+
+// nodeWeights: ring weights of the nodes registered with one below full,
+// see WarmupOptions.Weight
+func nodeWeights(nodes map[string]string) map[string]float64 {
+	weights := make(map[string]float64)
+	for addr, value := range nodes {
+		var conf NodeConfig
+		if json.Unmarshal([]byte(value), &conf) == nil && conf.Weight > 0 && conf.Weight < 1 {
+			weights[addr] = conf.Weight
+		}
+	}
+	return weights
+}
+
+// etcdRegistry: Registry of nodes registered in etcd on keepalive leases
+type etcdRegistry struct {
+	cli  *clientv3.Client
+	svc  ServiceName
+	ttl  time.Duration
+	regs registrations
+}
+
+// NewEtcdRegistry: Registry of the nodes of svc in the etcd of cli, on
+// leases of ttl, 0 means 10s. Closing it leaves cli open
+func NewEtcdRegistry(cli *clientv3.Client, svc ServiceName, ttl time.Duration) Registry {
+	return &etcdRegistry{cli: cli, svc: svc, ttl: ttl}
+}
+
+// Register: implements Registry
+func (e *etcdRegistry) Register(_ context.Context, addr, value string) error {
+	e.regs.start(addr, value, func(ctx context.Context, r *registration) {
+		register(ctx, e.cli, e.svc, addr, r.current, r.updates, e.ttl)
+	})
+	return nil
+}
+
+// Deregister: implements Registry
+func (e *etcdRegistry) Deregister(ctx context.Context, addr string) error {
+	return e.regs.stop(ctx, addr)
+}
+
+// Watch: implements Registry
+func (e *etcdRegistry) Watch(ctx context.Context, onChange func(nodes map[string]string)) error {
+	var d *Discovery
+	d = NewDiscovery(e.cli, e.svc, func([]string) { onChange(d.Nodes()) })
+	if err := d.Start(ctx); err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		d.Stop()
+	}()
+	return nil
+}
+
+// Close: implements Registry
+func (e *etcdRegistry) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), registryCloseTimeout)
+	defer cancel()
+	return e.regs.stopAll(ctx)
+}
+
+// defaultLeaseTTL: ttl of a node's registration lease
+const defaultLeaseTTL = 10 * time.Second
+
+// registerRetryInterval: wait between two attempts to (re)register
+const registerRetryInterval = time.Second
+
+// registryCloseTimeout: bound of deregistering the nodes of a closed Registry
+const registryCloseTimeout = 5 * time.Second
+
+// register: keep addr registered under svc's prefix with value on a keepalive lease
+// until ctx is done, then revoke the lease. A lease lost to an etcd
+// outage or a long partition is granted again once etcd is reachable. The
+// registration is rewritten with a fresh value on every receive from updates
+func register(ctx context.Context, cli *clientv3.Client, svc ServiceName, addr string, value func() string, updates <-chan struct{}, ttl time.Duration) {
+	if ttl < time.Second {
+		ttl = defaultLeaseTTL
+	}
+
+	key := svc.EtcdKey(addr)
+	for {
+		leaseID, keepAlive, err := grantAndPut(ctx, cli, key, value(), ttl)
+		if err == nil {
+			// drain keepalive responses, the channel closes once the lease
+			// is gone or ctx is canceled
+			for alive := true; alive; {
+				select {
+				case _, alive = <-keepAlive:
+				case <-updates:
+					putCtx, cancel := context.WithTimeout(ctx, ttl)
+					if _, err := cli.Put(putCtx, key, value(), clientv3.WithLease(leaseID)); err != nil {
+						// the value is written again with the next lease
+						log.Printf("rebelcache: update registration of %s: %v", key, err)
+					}
+					cancel()
+				}
+			}
+			if ctx.Err() != nil {
+				revokeCtx, revokeCancel := context.WithTimeout(context.Background(), time.Second)
+				if _, err := cli.Revoke(revokeCtx, leaseID); err != nil {
+					log.Printf("rebelcache: revoke lease of %s: %v", key, err)
+				}
+				revokeCancel()
+				return
+			}
+			log.Printf("rebelcache: lease of %s lost, registering again", key)
+		} else if ctx.Err() == nil {
+			log.Printf("rebelcache: register %s: %v", key, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(registerRetryInterval):
+		}
+	}
+}
+
+// grantAndPut: grant a lease, put key on it and start keeping it alive
+func grantAndPut(ctx context.Context, cli *clientv3.Client, key, value string, ttl time.Duration) (clientv3.LeaseID, <-chan *clientv3.LeaseKeepAliveResponse, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, ttl)
+	defer cancel()
+	lease, err := cli.Grant(reqCtx, int64(ttl/time.Second))
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, err := cli.Put(reqCtx, key, value, clientv3.WithLease(lease.ID)); err != nil {
+		return 0, nil, err
+	}
+	keepAlive, err := cli.KeepAlive(ctx, lease.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return lease.ID, keepAlive, nil
+}
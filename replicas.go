@@ -0,0 +1,287 @@
+package rebelcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+const (
+	replicaWriteTimeout = 5 * time.Second // bound of copying a write to the replicas, or repairing one
+	readRepairChance    = 0.05            // share of the gets an owner serves that check the replicas of the key
+	maxReadRepairs      = 4               // read repairs running at once per group, more are skipped
+)
+
+// replicatedPicker: implemented by PeerPickers keeping copies of every key on
+// the nodes following its owner on the ring, ClientPicker does once a server
+// sets its ServerOptions.ReplicaCount
+type replicatedPicker interface {
+	// replicaSet: clients of the nodes holding key, its owner first, nil for
+	// the local node. Empty when keys aren't replicated
+	replicaSet(key string) []*Client
+	// nearestFirst: sort clients by their rtt if it is probed, see
+	// PickerOptions.Nearest
+	nearestFirst(clients []*Client)
+}
+
+// replicaSet: implements replicatedPicker
+func (p *ClientPicker) replicaSet(key string) []*Client {
+	n := int(p.replicaCount.Load())
+	if n <= 0 {
+		return nil
+	}
+	nodes := p.ring.GetN(key, 1+n)
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	set := make([]*Client, 0, len(nodes))
+	for _, addr := range nodes {
+		if addr == p.self {
+			set = append(set, nil)
+			continue
+		}
+		if c, ok := p.clients[addr]; ok {
+			set = append(set, c)
+		}
+	}
+	return set
+}
+
+// nearestFirst: implements replicatedPicker
+func (p *ClientPicker) nearestFirst(clients []*Client) {
+	if p.rtts != nil {
+		p.rtts.sortClients(clients)
+	}
+}
+
+// replicaSet: the replica set of a normalized key, see replicatedPicker,
+// empty unless the group's peers replicate keys
+func (g *Group) replicaSet(norm string) []*Client {
+	g.mtx.Lock()
+	peers, _ := g.peers.(replicatedPicker)
+	g.mtx.Unlock()
+	if peers == nil {
+		return nil
+	}
+	return peers.replicaSet(norm)
+}
+
+// replicaWrite: a write of a key copied to the nodes of its replica set
+type replicaWrite struct {
+	g     *Group
+	key   string
+	value []byte // of a set
+	del   bool
+	ttl   time.Duration // of a set as written, 0 and NoExpiration aren't counted down
+	at    time.Time
+}
+
+// ttlLeft: the ttl of a set copied now, ok is false once its value expired
+func (w *replicaWrite) ttlLeft() (_ time.Duration, ok bool) {
+	if w.ttl <= 0 {
+		return w.ttl, true
+	}
+	left := w.ttl - time.Since(w.at)
+	return left, left > 0
+}
+
+// send: apply w on the node of c
+func (w *replicaWrite) send(ctx context.Context, c *Client) error {
+	if w.del {
+		_, err := c.Delete(ctx, w.g.name, w.key)
+		return err
+	}
+	ttl, ok := w.ttlLeft()
+	if !ok {
+		return nil
+	}
+	return c.Set(ctx, w.g.name, w.key, w.value, ttl)
+}
+
+// replicateWrite: send w to the other nodes of the replica set of its key as
+// forwarded writes the nodes don't pass on. At ConsistencyOne the write is
+// acknowledged once applied locally and copied in the background, copies
+// that fail are kept as hints if the node hands off writes, see HintOptions,
+// else left to read repair. At higher levels it waits until enough nodes of
+// the set hold it, the local one included if it is among them, see
+// Consistency, the copies still missing then go on in the background
+func (g *Group) replicateWrite(ctx context.Context, w *replicaWrite) error {
+	if isForwarded(ctx) && !isOwnerWrite(ctx) {
+		return nil
+	}
+	norm, err := g.cache.opts.KeyPolicy.Apply(w.key)
+	if err != nil {
+		return nil
+	}
+	set := g.replicaSet(norm)
+	if len(set) == 0 {
+		return nil
+	}
+	hints := g.hints()
+	level, _ := consistencyFrom(ctx)
+	need, acks := level.needed(len(set)), 0
+	if slices.Contains(set, nil) {
+		acks++
+	}
+	copied := make(chan bool, len(set))
+	started := g.tasks.Go("replicate", func() {
+		ctx, cancel := context.WithTimeout(withForwarded(context.WithoutCancel(ctx)), replicaWriteTimeout)
+		defer cancel()
+		var wg sync.WaitGroup
+		for _, c := range set {
+			if c == nil {
+				continue
+			}
+			wg.Go(func() {
+				err := w.send(ctx, c)
+				switch {
+				case err == nil:
+					hints.forget(c.Addr(), w)
+				case hints != nil:
+					g.replicaWriteErrors.Add(1)
+					hints.add(c.Addr(), w)
+				default:
+					g.replicaWriteErrors.Add(1)
+					log.Printf("rebelcache: copy write of %s to replica %s: %v", FormatKey(w.key), c.Addr(), err)
+				}
+				copied <- err == nil
+			})
+		}
+		wg.Wait()
+		close(copied)
+	})
+	if !started {
+		// the group is closed, no copy is made
+		close(copied)
+	}
+	if level == ConsistencyOne {
+		return nil
+	}
+	for acks < need {
+		select {
+		case ok, more := <-copied:
+			if !more {
+				return fmt.Errorf("%w: %d of %d nodes holding %s took the write, %s needs %d",
+					ErrConsistency, acks, len(set), FormatKey(w.key), level, need)
+			}
+			if ok {
+				acks++
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// replicateSet: copy a set of key to its replicas, see replicateWrite.
+// Values without a byte representation stay local
+func (g *Group) replicateSet(ctx context.Context, key string, value store.Value, ttl time.Duration) error {
+	b, err := valueBytes(value)
+	if err != nil {
+		return nil
+	}
+	return g.replicateWrite(ctx, &replicaWrite{g: g, key: key, value: b, ttl: ttl, at: time.Now()})
+}
+
+// replicateDelete: copy a delete of key to its replicas, see replicateWrite
+func (g *Group) replicateDelete(ctx context.Context, key string) error {
+	return g.replicateWrite(ctx, &replicaWrite{g: g, key: key, del: true, at: time.Now()})
+}
+
+// getFromReplicas: the copy of key held by a replica of its unreachable
+// owner, the nearest asked first, ok is false if none answers with one.
+// Replicas only serve what they cache, a miss there isn't loaded
+func (g *Group) getFromReplicas(ctx context.Context, key string) (_ store.Value, ok bool) {
+	norm, err := g.cache.opts.KeyPolicy.Apply(key)
+	if err != nil {
+		return nil, false
+	}
+	set := g.replicaSet(norm)
+	if len(set) < 2 {
+		return nil, false
+	}
+	// the local copy, if any, was served before asking the owner
+	replicas := slices.DeleteFunc(slices.Clone(set[1:]), func(c *Client) bool { return c == nil })
+	g.mtx.Lock()
+	peers, _ := g.peers.(replicatedPicker)
+	g.mtx.Unlock()
+	if peers != nil {
+		peers.nearestFirst(replicas)
+	}
+	req := &pb.GetRequest{Group: g.name, Key: []byte(key), Cached: true}
+	for _, c := range replicas {
+		b, _, err := c.get(withForwarded(ctx), req)
+		if err == nil {
+			g.replicaReads.Add(1)
+			return byteViewOf(b), true
+		}
+		if ctx.Err() != nil {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// readRepair: on a sample of the gets the owner of key serves, compare the
+// copies of its replicas with value in the background and overwrite those
+// missing or differing. Unreachable replicas are left for a later get
+func (g *Group) readRepair(key, norm string, value store.Value) {
+	if rand.Float64() >= readRepairChance {
+		return
+	}
+	set := g.replicaSet(norm)
+	if len(set) < 2 || set[0] != nil {
+		return
+	}
+	b, err := valueBytes(value)
+	if err != nil {
+		return
+	}
+	if g.repairing.Add(1) > maxReadRepairs {
+		g.repairing.Add(-1)
+		return
+	}
+	started := g.tasks.Go("read repair", func() {
+		defer g.repairing.Add(-1)
+		// the entry's ttl is copied too, a value loaded without being cached isn't
+		ttl, ok := g.cache.TTL(key)
+		if !ok {
+			return
+		}
+		if ttl == 0 {
+			ttl = NoExpiration
+		}
+		ctx, cancel := context.WithTimeout(withForwarded(context.Background()), replicaWriteTimeout)
+		defer cancel()
+		req := &pb.GetRequest{Group: g.name, Key: []byte(key), Cached: true}
+		for _, c := range set[1:] {
+			if c == nil {
+				continue
+			}
+			got, _, err := c.get(ctx, req)
+			if err == nil && bytes.Equal(got, b) {
+				continue
+			}
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err := c.Set(ctx, g.name, key, b, ttl); err != nil {
+				log.Printf("rebelcache: repair %s on replica %s: %v", FormatKey(key), c.Addr(), err)
+				continue
+			}
+			g.readRepairs.Add(1)
+		}
+	})
+	if !started {
+		g.repairing.Add(-1)
+	}
+}
@@ -0,0 +1,98 @@
+package rebelcache
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestReplicatedWrites(t *testing.T) {
+	c := newTestCluster(t, 4, clusterOptions{replicas: 1})
+	ctx := context.Background()
+
+	for via := range c.nodes {
+		t.Run("via node "+strconv.Itoa(via), func(t *testing.T) {
+			key := c.keyOwnedBy(via, "replicated")
+			set := c.replicaSet(key)
+			cli := c.client((via+1)%len(c.nodes), nil)
+			if err := cli.Set(ctx, testGroup, key, []byte("set"), time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			for _, i := range set {
+				eventually(t, "copy on node "+strconv.Itoa(i), func() bool {
+					v, ok := c.cached(i, key)
+					return ok && v == "set"
+				})
+			}
+			if _, err := cli.Delete(ctx, testGroup, key); err != nil {
+				t.Fatal(err)
+			}
+			for _, i := range set {
+				eventually(t, "delete on node "+strconv.Itoa(i), func() bool {
+					_, ok := c.cached(i, key)
+					return !ok
+				})
+			}
+		})
+	}
+}
+
+func TestReadFromReplicaOfStoppedOwner(t *testing.T) {
+	c := newTestCluster(t, 4, clusterOptions{replicas: 1})
+	ctx := context.Background()
+	key := c.keyOwnedBy(0, "failover")
+	set := c.replicaSet(key)
+	via := 0
+	for slices.Contains(set, via) {
+		via++
+	}
+	// written through the replica, which caches it at once
+	if err := c.client(set[1], nil).Set(ctx, testGroup, key, []byte("set"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	c.nodes[0].server.Stop()
+
+	// the loader would answer "v-" + key
+	got, err := c.client(via, nil).Get(ctx, testGroup, key)
+	if err != nil || string(got) != "set" {
+		t.Fatalf("Get: %q, %v, want the replica's %q", got, err, "set")
+	}
+	if reads := c.nodes[via].group.replicaReads.Load(); reads != 1 {
+		t.Fatalf("%d replica reads, want 1", reads)
+	}
+}
+
+func TestConsistencyLevels(t *testing.T) {
+	c := newTestCluster(t, 3, clusterOptions{replicas: 2})
+	ctx := context.Background()
+	key := c.keyOwnedBy(0, "levels")
+	set := c.replicaSet(key)
+	c.nodes[set[2]].server.Stop()
+	cli := c.client(0, nil)
+
+	tests := []struct {
+		level Consistency
+		code  codes.Code
+	}{
+		{ConsistencyOne, codes.OK},
+		{ConsistencyQuorum, codes.OK},
+		{ConsistencyAll, codes.Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			ctx := WithConsistency(ctx, tt.level)
+			err := cli.Set(ctx, testGroup, key, []byte(tt.level.String()), time.Minute)
+			if status.Code(err) != tt.code {
+				t.Fatalf("Set: %v, want code %v", err, tt.code)
+			}
+			if _, err := cli.Get(ctx, testGroup, key); status.Code(err) != tt.code {
+				t.Fatalf("Get: %v, want code %v", err, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	"google.golang.org/grpc/metadata"
+)
+
+// replicaKey: rpc metadata marking a get one node sent to a replica of a hot
+// key rather than to its owner
+const replicaKey = "rebelcache-replica"
+
+const (
+	defaultHotReplicas = 2               // replicas of a hot key besides its owner
+	defaultHotTTL      = 5 * time.Second // life of a replica's copy and of a hot flag
+)
+
+// HotKeyOptions: replication of hot keys. The owner of a key read at least
+// Threshold times a second, as its group's top key tracking measures it, see
+// WithTopKeys, flags the key hot in its answers. Nodes told so spread their
+// gets of the key over the owner and the next Replicas nodes of the ring,
+// which serve a copy fetched from the owner and kept for TTL, so their
+// answers are at most TTL stale. A flag lapses after TTL unless renewed
+type HotKeyOptions struct {
+	Threshold float64       // gets per second at the owner from which a key is hot
+	Replicas  int           // nodes serving a hot key besides its owner, 0 means 2
+	TTL       time.Duration // life of the copies and of the flags, 0 means 5s, bounded by the group's MinTTL and MaxTTL
+}
+
+// replicas: the effective Replicas
+func (o *HotKeyOptions) replicas() int {
+	if o.Replicas <= 0 {
+		return defaultHotReplicas
+	}
+	return o.Replicas
+}
+
+// ttl: the effective TTL
+func (o *HotKeyOptions) ttl() time.Duration {
+	if o.TTL <= 0 {
+		return defaultHotTTL
+	}
+	return o.TTL
+}
+
+// withReplicaRead: mark the outgoing rpcs of ctx as gets sent to a replica
+func withReplicaRead(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, replicaKey, "1")
+}
+
+// isReplicaRead: whether the incoming rpc of ctx was sent here as a replica
+func isReplicaRead(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	return ok && len(md.Get(replicaKey)) > 0
+}
+
+// replicaPicker: implemented by PeerPickers spreading the gets of hot keys
+// over their replicas, ClientPicker does
+type replicaPicker interface {
+	hotKeyOptions() *HotKeyOptions
+	// pickReplica: the node a get of a hot key goes to, self is true if it is
+	// the local node, else peer is its client
+	pickReplica(key string) (peer PeerGetter, self bool)
+}
+
+// hotFlags: hot keys of a group by the unix nanos their flag lapses at, on
+// owners as well, so a key stays hot while replicas take most of its gets
+type hotFlags struct {
+	flags sync.Map
+	fills atomic.Int64 // copies fetched from owners as a replica
+}
+
+// flag: mark key hot for ttl
+func (h *hotFlags) flag(key string, ttl time.Duration) {
+	h.flags.Store(key, time.Now().Add(ttl).UnixNano())
+}
+
+// flagged: whether key is marked hot, lapsed flags are dropped
+func (h *hotFlags) flagged(key string) bool {
+	until, ok := h.flags.Load(key)
+	if !ok {
+		return false
+	}
+	if time.Now().UnixNano() < until.(int64) {
+		return true
+	}
+	h.flags.CompareAndDelete(key, until)
+	return false
+}
+
+// replicator: the peers of the group if they replicate hot keys
+func (g *Group) replicator() (replicaPicker, *HotKeyOptions) {
+	g.mtx.Lock()
+	peers, _ := g.peers.(replicaPicker)
+	g.mtx.Unlock()
+	if peers == nil {
+		return nil, nil
+	}
+	opts := peers.hotKeyOptions()
+	if opts == nil {
+		return nil, nil
+	}
+	return peers, opts
+}
+
+// isHot: whether the owner should flag key hot in its answer. A key already
+// hot stays so down to a share of Threshold, the gets its replicas take no
+// longer reach the owner
+func (g *Group) isHot(key string) bool {
+	_, opts := g.replicator()
+	if opts == nil || g.cache.top == nil {
+		return false
+	}
+	norm, err := g.cache.opts.KeyPolicy.Apply(key)
+	if err != nil {
+		return false
+	}
+	threshold := opts.Threshold
+	if g.hot.flagged(norm) {
+		threshold /= float64(1 + opts.replicas())
+	}
+	if g.cache.top.rate(norm) < threshold {
+		return false
+	}
+	g.hot.flag(norm, opts.ttl())
+	return true
+}
+
+// markHot: flag key hot as its owner told
+func (g *Group) markHot(key string) {
+	_, opts := g.replicator()
+	if opts == nil {
+		return
+	}
+	if norm, err := g.cache.opts.KeyPolicy.Apply(key); err == nil {
+		g.hot.flag(norm, opts.ttl())
+	}
+}
+
+// getHot: get a key flagged hot from the replica picked for it, hot is false
+// if the key is not flagged
+func (g *Group) getHot(ctx context.Context, owner PeerGetter, key, norm string) (_ store.Value, hot bool, err error) {
+	if !g.hot.flagged(norm) {
+		return nil, false, nil
+	}
+	peers, _ := g.replicator()
+	if peers == nil {
+		return nil, false, nil
+	}
+	peer, self := peers.pickReplica(norm)
+	if self {
+		value, err := g.getReplica(ctx, owner, key, norm)
+		return value, true, err
+	}
+	if value, ok := g.cache.Get(key); ok {
+		return value, true, nil
+	}
+	b, err := peer.Get(withReplicaRead(ctx), g.name, key)
+	if err != nil && ctx.Err() == nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("rebelcache: get %s from replica: %v, asking its owner", FormatKey(key), err)
+		value, err := g.getFromPeer(ctx, owner, key)
+		return value, true, err
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	return byteViewOf(b), true, nil
+}
+
+// getReplica: serve key as one of its replicas, from the local copy or else
+// from a copy fetched from the owner and kept for HotKeyOptions.TTL
+func (g *Group) getReplica(ctx context.Context, owner PeerGetter, key, norm string) (store.Value, error) {
+	if value, ok := g.cache.Get(key); ok {
+		return value, nil
+	}
+	_, opts := g.replicator()
+	if opts == nil {
+		return g.getFromPeer(ctx, owner, key)
+	}
+	return g.shared(ctx, key, func(ctx context.Context) (store.Value, error) {
+		b, hot, err := getFlagged(ctx, owner, g.name, key)
+		if err != nil {
+			return nil, err
+		}
+		value := byteViewOf(b)
+		if err := g.cache.setWithOrigin(key, value, opts.ttl(), "replica"); err != nil {
+			return nil, err
+		}
+		g.hot.fills.Add(1)
+		if hot {
+			g.hot.flag(norm, opts.ttl())
+		}
+		return value, nil
+	})
+}
+
+// getFlagged: get key from a peer as a forwarded get, hot is true if the
+// owner flagged the key hot
+func getFlagged(ctx context.Context, peer PeerGetter, group, key string) (value []byte, hot bool, err error) {
+	ctx = withForwarded(ctx)
+	if p, ok := peer.(peerClient); ok {
+		return p.getFlagged(ctx, group, key)
+	}
+	value, err = peer.Get(ctx, group, key)
+	return value, false, err
+}
+
+// hotKeyOptions: implements replicaPicker
+func (p *ClientPicker) hotKeyOptions() *HotKeyOptions {
+	return p.opts.HotKeys
+}
+
+// pickReplica: implements replicaPicker, a random one of the owner of key and
+// the nodes following it on the ring, of the nearest of them if rtts are
+// probed, see PickerOptions.Nearest
+func (p *ClientPicker) pickReplica(key string) (PeerGetter, bool) {
+	nodes := p.ring.GetN(key, 1+p.opts.HotKeys.replicas())
+	if len(nodes) == 0 {
+		return nil, true
+	}
+	addr := p.pickNearest(nodes)
+	if addr == p.self {
+		return nil, true
+	}
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	c, ok := p.clients[addr]
+	if !ok {
+		return nil, true
+	}
+	return peerClient{Client: c, reserve: p.opts.HopReserve, stats: p.stats[addr]}, false
+}
@@ -0,0 +1,62 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// discoveryBuilder: grpc resolver of ServiceName.Target() targets backed by a Registry
+type discoveryBuilder struct {
+	registry func(svc ServiceName) Registry // registry of the nodes of svc
+}
+
+// Build: start following the nodes of the target's service
+func (b *discoveryBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	svc, err := ParseServiceName(target.Endpoint())
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &discoveryResolver{cc: cc, cancel: cancel}
+	if err := b.registry(svc).Watch(ctx, r.update); err != nil {
+		cancel()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Scheme: the scheme of cache cluster targets
+func (b *discoveryBuilder) Scheme() string {
+	return resolverScheme
+}
+
+// discoveryResolver: pushes the discovered nodes to a grpc client conn
+type discoveryResolver struct {
+	cc     resolver.ClientConn
+	cancel context.CancelFunc // stops following the nodes
+}
+
+// update: hand the current nodes to grpc
+func (r *discoveryResolver) update(nodes map[string]string) {
+	if len(nodes) == 0 {
+		r.cc.ReportError(errors.New("rebelcache: no nodes registered"))
+		return
+	}
+	addrs := make([]resolver.Address, 0, len(nodes))
+	for _, addr := range slices.Sorted(maps.Keys(nodes)) {
+		addrs = append(addrs, resolver.Address{Addr: addr})
+	}
+	r.cc.UpdateState(resolver.State{Addresses: addrs})
+}
+
+// ResolveNow: nothing to do, the watch pushes changes as they happen
+func (r *discoveryResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+// Close: stop following the nodes
+func (r *discoveryResolver) Close() {
+	r.cancel()
+}
@@ -0,0 +1,512 @@
+package rebelcache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+// maxRESPBulkLen: largest bulk string accepted from a redis client
+const maxRESPBulkLen = 32 << 20
+
+// errRESPProtocol: the client sent something that is not RESP
+var errRESPProtocol = errors.New("rebelcache: resp protocol error")
+
+// respServer: serves one group over the redis protocol (RESP2). It speaks
+// GET, SET with EX/PX/NX/XX, SETNX, DEL, EXISTS, TTL, PTTL, INCR, DECR and MGET plus
+// the connection commands clients send on connect. Like redis it only sees
+// what was written to the cache: GET neither loads nor asks peers
+type respServer struct {
+	srv   *Server
+	group string
+	lis   net.Listener
+	mtx   sync.Mutex
+	conns map[net.Conn]struct{}
+	done  bool // set by close, later connections are dropped
+	wg    sync.WaitGroup
+}
+
+// serve: accept redis connections on r.lis until close
+func (r *respServer) serve() {
+	for {
+		conn, err := r.lis.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("rebelcache: resp accept: %v", err)
+			}
+			return
+		}
+		if !r.srv.allowlist.allowedRemote(conn.RemoteAddr().String()) {
+			conn.Close()
+			continue
+		}
+		r.mtx.Lock()
+		if r.done {
+			r.mtx.Unlock()
+			conn.Close()
+			return
+		}
+		r.conns[conn] = struct{}{}
+		r.wg.Add(1)
+		r.mtx.Unlock()
+		go r.handle(conn)
+	}
+}
+
+// close: stop accepting and drop all connections
+func (r *respServer) close() {
+	if r.lis != nil {
+		r.lis.Close()
+	}
+	r.mtx.Lock()
+	r.done = true
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.mtx.Unlock()
+	r.wg.Wait()
+}
+
+// handle: run the commands of one connection
+func (r *respServer) handle(conn net.Conn) {
+	defer recoverPanic("resp", nil)
+	defer r.wg.Done()
+	defer func() {
+		r.mtx.Lock()
+		delete(r.conns, conn)
+		r.mtx.Unlock()
+		conn.Close()
+	}()
+
+	rd := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	// authed: the connection sent AUTH with a token of ServerOptions.Auth
+	authed := r.srv.auth == nil
+	for {
+		args, err := readCommand(rd)
+		if err != nil {
+			if errors.Is(err, errRESPProtocol) {
+				writeError(w, "ERR "+err.Error())
+				w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := r.exec(w, args, &authed)
+		// flush only once the pipelined commands already read are answered
+		if rd.Buffered() == 0 || quit {
+			if err := w.Flush(); err != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+// exec: run one command, return whether the connection should close. Only
+// AUTH and QUIT run before the connection authed
+func (r *respServer) exec(w *bufio.Writer, args []string, authed *bool) bool {
+	cmd := strings.ToUpper(args[0])
+	switch {
+	case cmd == "AUTH":
+		// AUTH token or AUTH username token, the username is ignored
+		switch {
+		case len(args) < 2 || len(args) > 3:
+			writeArity(w, cmd)
+		case r.srv.auth == nil:
+			writeError(w, "ERR AUTH called without any password configured")
+		case r.srv.auth.role(args[len(args)-1]) == roleNone:
+			writeError(w, "WRONGPASS invalid token")
+		default:
+			*authed = true
+			w.WriteString("+OK\r\n")
+		}
+		return false
+	case !*authed && cmd != "QUIT":
+		writeError(w, "NOAUTH Authentication required.")
+		return false
+	}
+	switch cmd {
+	case "PING":
+		if len(args) > 1 {
+			writeBulk(w, []byte(args[1]))
+		} else {
+			w.WriteString("+PONG\r\n")
+		}
+		return false
+	case "ECHO":
+		if len(args) != 2 {
+			writeArity(w, cmd)
+		} else {
+			writeBulk(w, []byte(args[1]))
+		}
+		return false
+	case "QUIT":
+		w.WriteString("+OK\r\n")
+		return true
+	case "SELECT":
+		if len(args) != 2 || args[1] != "0" {
+			writeError(w, "ERR DB index is out of range")
+		} else {
+			w.WriteString("+OK\r\n")
+		}
+		return false
+	case "CLIENT":
+		w.WriteString("+OK\r\n")
+		return false
+	case "COMMAND":
+		w.WriteString("*0\r\n")
+		return false
+	}
+
+	g, err := r.srv.getGroup(r.group)
+	if err != nil {
+		writeError(w, "ERR "+err.Error())
+		return false
+	}
+	switch cmd {
+	case "GET":
+		r.get(w, g, args)
+	case "SET":
+		r.set(w, g, args)
+	case "SETNX":
+		r.setnx(w, g, args)
+	case "DEL":
+		r.del(w, g, args)
+	case "EXISTS":
+		r.exists(w, g, args)
+	case "TTL", "PTTL":
+		r.ttl(w, g, args, cmd == "PTTL")
+	case "INCR", "DECR":
+		delta := int64(1)
+		if cmd == "DECR" {
+			delta = -1
+		}
+		r.incr(w, g, args, delta)
+	case "MGET":
+		r.mget(w, g, args)
+	default:
+		writeError(w, fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+	return false
+}
+
+// get: GET key
+func (r *respServer) get(w *bufio.Writer, g *Group, args []string) {
+	if len(args) != 2 {
+		writeArity(w, "get")
+		return
+	}
+	value, ok := g.cache.Get(args[1])
+	if !ok {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	r.writeValue(w, g, args[1], value)
+}
+
+// set: SET key value [EX seconds | PX milliseconds] [NX | XX]
+func (r *respServer) set(w *bufio.Writer, g *Group, args []string) {
+	if len(args) < 3 {
+		writeArity(w, "set")
+		return
+	}
+	var ttl time.Duration
+	var nx, xx bool
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				writeError(w, "ERR syntax error")
+				return
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				writeError(w, "ERR invalid expire time in 'set' command")
+				return
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			ttl = time.Duration(n) * unit
+			i++
+		default:
+			writeError(w, "ERR syntax error")
+			return
+		}
+	}
+	if nx && xx {
+		writeError(w, "ERR syntax error")
+		return
+	}
+	if err := r.checkWritable(g); err != nil {
+		writeError(w, "READONLY "+err.Error())
+		return
+	}
+
+	key, value := args[1], byteViewOf([]byte(args[2]))
+	var set bool
+	var err error
+	switch {
+	case nx:
+		set, err = g.SetNX(context.Background(), key, value, ttl)
+	case xx:
+		set, err = g.SetXX(context.Background(), key, value, ttl)
+	default:
+		set, err = true, g.cache.setWithOrigin(key, value, ttl, "resp")
+	}
+	if err != nil {
+		writeError(w, "ERR "+err.Error())
+	} else if !set {
+		w.WriteString("$-1\r\n")
+	} else {
+		w.WriteString("+OK\r\n")
+	}
+}
+
+// setnx: SETNX key value, the legacy form of SET NX
+func (r *respServer) setnx(w *bufio.Writer, g *Group, args []string) {
+	if len(args) != 3 {
+		writeArity(w, "setnx")
+		return
+	}
+	if err := r.checkWritable(g); err != nil {
+		writeError(w, "READONLY "+err.Error())
+		return
+	}
+	set, err := g.SetNX(context.Background(), args[1], byteViewOf([]byte(args[2])), 0)
+	switch {
+	case err != nil:
+		writeError(w, "ERR "+err.Error())
+	case set:
+		writeInt(w, 1)
+	default:
+		writeInt(w, 0)
+	}
+}
+
+// del: DEL key [key ...]
+func (r *respServer) del(w *bufio.Writer, g *Group, args []string) {
+	if len(args) < 2 {
+		writeArity(w, "del")
+		return
+	}
+	if err := r.checkWritable(g); err != nil {
+		writeError(w, "READONLY "+err.Error())
+		return
+	}
+	writeInt(w, int64(g.cache.MDelete(args[1:])))
+}
+
+// exists: EXISTS key [key ...], a key given twice counts twice
+func (r *respServer) exists(w *bufio.Writer, g *Group, args []string) {
+	if len(args) < 2 {
+		writeArity(w, "exists")
+		return
+	}
+	var n int64
+	for _, key := range args[1:] {
+		if _, ok := g.cache.TTL(key); ok {
+			n++
+		}
+	}
+	writeInt(w, n)
+}
+
+// ttl: TTL or PTTL key, -2 if absent, -1 if it never expires
+func (r *respServer) ttl(w *bufio.Writer, g *Group, args []string, millis bool) {
+	if len(args) != 2 {
+		writeArity(w, strings.ToLower(args[0]))
+		return
+	}
+	ttl, ok := g.cache.TTL(args[1])
+	switch {
+	case !ok:
+		writeInt(w, -2)
+	case ttl == 0:
+		writeInt(w, -1)
+	case millis:
+		writeInt(w, int64((ttl+time.Millisecond/2)/time.Millisecond))
+	default:
+		writeInt(w, int64((ttl+time.Second/2)/time.Second))
+	}
+}
+
+// incr: INCR or DECR key, a string holding an integer becomes a counter
+func (r *respServer) incr(w *bufio.Writer, g *Group, args []string, delta int64) {
+	if len(args) != 2 {
+		writeArity(w, strings.ToLower(args[0]))
+		return
+	}
+	if err := r.checkWritable(g); err != nil {
+		writeError(w, "READONLY "+err.Error())
+		return
+	}
+	key := args[1]
+	for {
+		n, err := g.cache.Incr(key, delta)
+		if err == nil {
+			writeInt(w, n)
+			return
+		}
+		if !errors.Is(err, store.ErrNotCounter) {
+			writeError(w, "ERR "+err.Error())
+			return
+		}
+
+		// set with SET: convert the integer string into a counter, keeping its ttl
+		value, version, ok := g.cache.GetWithVersion(key)
+		if !ok {
+			continue
+		}
+		b, err := valueBytes(value)
+		if err != nil {
+			writeError(w, "ERR value is not an integer or out of range")
+			return
+		}
+		cur, err := strconv.ParseInt(string(b), 10, 64)
+		if err != nil {
+			writeError(w, "ERR value is not an integer or out of range")
+			return
+		}
+		ttl, ok := g.cache.TTL(key)
+		if !ok || ttl < 0 {
+			continue
+		}
+		if ttl == 0 {
+			ttl = NoExpiration
+		}
+		swapped, err := g.cache.CompareAndSwap(key, version, store.Counter(cur+delta), ttl)
+		if err != nil {
+			writeError(w, "ERR "+err.Error())
+			return
+		}
+		if swapped {
+			writeInt(w, cur+delta)
+			return
+		}
+	}
+}
+
+// mget: MGET key [key ...]
+func (r *respServer) mget(w *bufio.Writer, g *Group, args []string) {
+	if len(args) < 2 {
+		writeArity(w, "mget")
+		return
+	}
+	values := g.cache.MGet(args[1:])
+	fmt.Fprintf(w, "*%d\r\n", len(args)-1)
+	for _, key := range args[1:] {
+		if value, ok := values[key]; ok {
+			r.writeValue(w, g, key, value)
+		} else {
+			w.WriteString("$-1\r\n")
+		}
+	}
+}
+
+// checkWritable: ErrReadOnly if the node or the group is read-only
+func (r *respServer) checkWritable(g *Group) error {
+	if r.srv.readOnly.Load() {
+		return fmt.Errorf("%w: node %s", ErrReadOnly, r.srv.addr)
+	}
+	return g.checkWritable()
+}
+
+// readCommand: read one command, an array of bulk strings or an inline command
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := readLine(rd)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > 1024*1024 {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errRESPProtocol)
+	}
+	args := make([]string, 0, max(n, 0))
+	for i := 0; i < n; i++ {
+		line, err := readLine(rd)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("%w: expected '$', got %q", errRESPProtocol, line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxRESPBulkLen {
+			return nil, fmt.Errorf("%w: invalid bulk length", errRESPProtocol)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// readLine: read a line without its \r\n
+func readLine(rd *bufio.Reader) (string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// writeValue: write the cached value of key as a bulk string after the
+// group's transforms
+func (r *respServer) writeValue(w *bufio.Writer, g *Group, key string, value store.Value) {
+	b, err := valueBytes(value)
+	if err != nil {
+		writeError(w, "WRONGTYPE "+err.Error())
+		return
+	}
+	if b, err = r.srv.transforms.apply(context.Background(), g.name, key, b); err != nil {
+		writeError(w, "ERR "+err.Error())
+		return
+	}
+	writeBulk(w, b)
+}
+
+// writeBulk: write a bulk string
+func writeBulk(w *bufio.Writer, b []byte) {
+	fmt.Fprintf(w, "$%d\r\n", len(b))
+	w.Write(b)
+	w.WriteString("\r\n")
+}
+
+// writeInt: write an integer reply
+func writeInt(w *bufio.Writer, n int64) {
+	fmt.Fprintf(w, ":%d\r\n", n)
+}
+
+// writeError: write an error reply, msg must not contain newlines
+func writeError(w *bufio.Writer, msg string) {
+	w.WriteString("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(msg) + "\r\n")
+}
+
+// writeArity: write the error of a command called with the wrong number of arguments
+func writeArity(w *bufio.Writer, cmd string) {
+	writeError(w, fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+}
@@ -0,0 +1,172 @@
+package rebelcache
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+)
+
+const (
+	defaultRTTProbeInterval = 5 * time.Second
+	defaultRTTTolerance     = time.Millisecond
+	rttSmoothing            = 0.3 // weight of a new probe in a peer's rtt
+)
+
+// NearestOptions: prefer the replicas with the lowest round trip times when
+// several can serve a read, e.g. those in the node's zone. The rtts are
+// probed periodically so the choice follows the network. Zero fields take
+// defaults
+type NearestOptions struct {
+	ProbeInterval time.Duration // how often each peer's rtt is probed, 0 means 5s
+	// Tolerance: replicas within it of the nearest count as near too, the
+	// reads of hot keys are spread over these, 0 means 1ms
+	Tolerance time.Duration
+}
+
+// peerRTTs: smoothed round trip times of the peers, by addr. Peers not
+// probed yet or failing their probes have none
+type peerRTTs struct {
+	opts NearestOptions
+	mtx  sync.RWMutex
+	rtts map[string]time.Duration
+}
+
+// newPeerRTTs: rtts probed under opts, nil unless opts is set
+func newPeerRTTs(opts *NearestOptions) *peerRTTs {
+	if opts == nil {
+		return nil
+	}
+	r := &peerRTTs{opts: *opts, rtts: make(map[string]time.Duration)}
+	if r.opts.ProbeInterval <= 0 {
+		r.opts.ProbeInterval = defaultRTTProbeInterval
+	}
+	if r.opts.Tolerance <= 0 {
+		r.opts.Tolerance = defaultRTTTolerance
+	}
+	return r
+}
+
+// get: rtt of the peer at addr, ok is false if it has none
+func (r *peerRTTs) get(addr string) (rtt time.Duration, ok bool) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	rtt, ok = r.rtts[addr]
+	return rtt, ok
+}
+
+// probe: measure the rtt of each of peers once, forgetting those failing
+// and those no longer peers
+func (r *peerRTTs) probe(ctx context.Context, peers map[string]*Client) {
+	var wg sync.WaitGroup
+	for addr, c := range peers {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(ctx, r.opts.ProbeInterval)
+			defer cancel()
+			start := time.Now()
+			// older peers answer Unimplemented, as fast
+			_, err := c.grpcCli.Ping(ctx, &pb.PingRequest{})
+			rtt := time.Since(start)
+			r.mtx.Lock()
+			defer r.mtx.Unlock()
+			if clusterFailure(err) {
+				delete(r.rtts, addr)
+				return
+			}
+			if last, ok := r.rtts[addr]; ok {
+				rtt = time.Duration(rttSmoothing*float64(rtt) + (1-rttSmoothing)*float64(last))
+			}
+			r.rtts[addr] = rtt
+		})
+	}
+	wg.Wait()
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	maps.DeleteFunc(r.rtts, func(addr string, _ time.Duration) bool { return peers[addr] == nil })
+}
+
+// nearest: self if among nodes and the peers of nodes within Tolerance of
+// the nearest peer, so reads spread over the local copy and the near ones.
+// All of nodes while no peer has an rtt
+func (r *peerRTTs) nearest(self string, nodes []string) []string {
+	known := make(map[string]time.Duration, len(nodes))
+	for _, addr := range nodes {
+		if rtt, ok := r.get(addr); ok && addr != self {
+			known[addr] = rtt
+		}
+	}
+	if len(known) == 0 {
+		return nodes
+	}
+	fastest := slices.Min(slices.Collect(maps.Values(known)))
+	return slices.DeleteFunc(slices.Clone(nodes), func(addr string) bool {
+		if addr == self {
+			return false
+		}
+		rtt, ok := known[addr]
+		return !ok || rtt > fastest+r.opts.Tolerance
+	})
+}
+
+// sortClients: sort clients by rtt, nearest first, those without one last
+// in their order
+func (r *peerRTTs) sortClients(clients []*Client) {
+	slices.SortStableFunc(clients, func(a, b *Client) int {
+		ra, okA := r.get(a.addr)
+		rb, okB := r.get(b.addr)
+		switch {
+		case okA && okB:
+			return cmp.Compare(ra, rb)
+		case okA:
+			return -1
+		case okB:
+			return 1
+		}
+		return 0
+	})
+}
+
+// pickNearest: a random one of nodes near the local node, see nearest
+func (p *ClientPicker) pickNearest(nodes []string) string {
+	if p.rtts != nil {
+		nodes = p.rtts.nearest(p.self, nodes)
+	}
+	return nodes[rand.N(len(nodes))]
+}
+
+// PeerRTTs: smoothed round trip times of the peers probed, by addr, nil
+// unless PickerOptions.Nearest is set
+func (p *ClientPicker) PeerRTTs() map[string]time.Duration {
+	if p.rtts == nil {
+		return nil
+	}
+	p.rtts.mtx.RLock()
+	defer p.rtts.mtx.RUnlock()
+	return maps.Clone(p.rtts.rtts)
+}
+
+// Ping: answer at once, for the rtt probes of the peers
+func (s *Server) Ping(ctx context.Context, req *pb.PingRequest) (*pb.PingResponse, error) {
+	return &pb.PingResponse{}, nil
+}
+
+// rttLoop: probe the rtts of the Picker's peers every ProbeInterval until
+// ctx ends
+func (s *Server) rttLoop(ctx context.Context) error {
+	rtts := s.opts.Picker.rtts
+	ticker := time.NewTicker(rtts.opts.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		rtts.probe(ctx, s.opts.Picker.peerClients())
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package rebelcache
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNearest(t *testing.T) {
+	r := newPeerRTTs(&NearestOptions{Tolerance: time.Millisecond})
+	r.rtts = map[string]time.Duration{
+		"near":   2 * time.Millisecond,
+		"close":  2500 * time.Microsecond,
+		"far":    20 * time.Millisecond,
+		"self":   50 * time.Millisecond, // never compared, the local copy costs no hop
+		"absent": time.Millisecond,      // not among the nodes asked about
+	}
+	tests := []struct {
+		name  string
+		nodes []string
+		want  []string
+	}{
+		{"within tolerance", []string{"far", "near", "close"}, []string{"near", "close"}},
+		{"self always kept", []string{"self", "far", "near"}, []string{"self", "near"}},
+		{"self and one peer", []string{"self", "far"}, []string{"self", "far"}},
+		{"unprobed peers dropped", []string{"new", "far"}, []string{"far"}},
+		{"nothing probed", []string{"new", "self"}, []string{"new", "self"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.nearest("self", tt.nodes); !slices.Equal(got, tt.want) {
+				t.Fatalf("nearest(%q) = %q, want %q", tt.nodes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortClientsByRTT(t *testing.T) {
+	r := newPeerRTTs(&NearestOptions{})
+	r.rtts = map[string]time.Duration{"a": 3 * time.Millisecond, "b": time.Millisecond}
+	clients := []*Client{{addr: "x"}, {addr: "a"}, {addr: "y"}, {addr: "b"}}
+	r.sortClients(clients)
+	var got []string
+	for _, c := range clients {
+		got = append(got, c.addr)
+	}
+	if want := []string{"b", "a", "x", "y"}; !slices.Equal(got, want) {
+		t.Fatalf("sorted %q, want %q", got, want)
+	}
+}
+
+func TestProbeRTTs(t *testing.T) {
+	c := newTestCluster(t, 3, clusterOptions{})
+	r := newPeerRTTs(&NearestOptions{})
+	r.rtts["gone"] = time.Millisecond
+	peers := map[string]*Client{c.nodes[1].addr: c.client(1, nil), c.nodes[2].addr: c.client(2, nil)}
+	c.nodes[2].server.Stop()
+	r.probe(context.Background(), peers)
+	if _, ok := r.get(c.nodes[1].addr); !ok {
+		t.Fatalf("no rtt of the live peer")
+	}
+	for _, addr := range []string{c.nodes[2].addr, "gone"} {
+		if rtt, ok := r.get(addr); ok {
+			t.Fatalf("rtt %v of %s, want none", rtt, addr)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package rebelcache
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	defaultSampleKeys = 20    // keys sampled by the SampleKeys rpc by default
+	maxSampleKeys     = 10000 // bound of the keys of a sample
+)
+
+// KeySample: an entry picked by a sample of a cache, see Cache.SampleKeys.
+// The details are zero unless asked for
+type KeySample struct {
+	Group      string        // empty in a sample of a Cache alone
+	Key        string        // as stored, after the key policy
+	Size       int           // bytes of the value, uncompressed
+	TTL        time.Duration // time left, 0 if the entry never expires
+	LastAccess time.Time     // last read or write, zero unless the store tracks them, see store.AccessTimer
+}
+
+// sampledEntry: an entry a keySampler picked
+type sampledEntry struct {
+	c        *Cache
+	group    string
+	key      string
+	value    store.Value // as stored, with provenance and compressed
+	expireAt time.Time
+}
+
+// keySampler: a uniform random sample of up to n of the entries offered,
+// by reservoir sampling
+type keySampler struct {
+	n      int
+	seen   int64
+	picked []sampledEntry
+}
+
+// offer: let e into the sample with the chance of every entry seen so far
+func (s *keySampler) offer(e sampledEntry) {
+	s.seen++
+	if len(s.picked) < s.n {
+		s.picked = append(s.picked, e)
+		return
+	}
+	if i := rand.Int64N(s.seen); i < int64(s.n) {
+		s.picked[i] = e
+	}
+}
+
+// samples: the picked entries, with their details if asked for
+func (s *keySampler) samples(details bool) []KeySample {
+	samples := make([]KeySample, 0, len(s.picked))
+	for _, e := range s.picked {
+		sample := KeySample{Group: e.group, Key: e.key}
+		if details {
+			sample.Size = storedSize(e.value)
+			if !e.expireAt.IsZero() {
+				// an entry expiring meanwhile still reads as one that expires
+				sample.TTL = max(time.Until(e.expireAt), time.Nanosecond)
+			}
+			sample.LastAccess = e.c.lastAccess(e.key)
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// storedSize: bytes of a stored value once unwrapped, without decompressing it
+func storedSize(value store.Value) int {
+	if v, ok := value.(*provenanceValue); ok {
+		value = v.Value
+	}
+	if v, ok := value.(*compressedValue); ok {
+		return v.size
+	}
+	return value.Len()
+}
+
+// sampleInto: offer every unexpired entry of the cache to s, tagged with
+// group. ok is false if the store cannot be ranged over
+func (c *Cache) sampleInto(s *keySampler, group string) (ok bool) {
+	if atomic.LoadInt32(&c.closed) == 1 || atomic.LoadInt32(&c.initialized) == 0 {
+		return true
+	}
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.store == nil {
+		return true
+	}
+	r, ok := c.store.(store.Ranger)
+	if !ok {
+		return false
+	}
+	r.Range(func(key string, value store.Value, expireAt time.Time) bool {
+		s.offer(sampledEntry{c: c, group: group, key: key, value: value, expireAt: expireAt})
+		return true
+	})
+	return true
+}
+
+// lastAccess: when key was last read or written, zero unless the store tracks it
+func (c *Cache) lastAccess(key string) time.Time {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if t, ok := c.store.(store.AccessTimer); ok {
+		if at, ok := t.LastAccess(key); ok {
+			return at
+		}
+	}
+	return time.Time{}
+}
+
+// SampleKeys: a uniform random sample of up to n entries of the cache, with
+// their size, ttl and last access if details, and the number of entries
+// sampled from. ok is false if the store cannot be ranged over. It walks
+// every entry under the store's read lock, a debugging aid rather than
+// something to call often
+func (c *Cache) SampleKeys(n int, details bool) (samples []KeySample, entries int64, ok bool) {
+	s := &keySampler{n: n}
+	if !c.sampleInto(s, "") {
+		return nil, 0, false
+	}
+	return s.samples(details), s.seen, true
+}
+
+// SampleKeys: a uniform random sample of up to n of the group's entries on
+// this node, see Cache.SampleKeys
+func (g *Group) SampleKeys(n int, details bool) ([]KeySample, int64, bool) {
+	s := &keySampler{n: n}
+	if !g.cache.sampleInto(s, g.name) {
+		return nil, 0, false
+	}
+	return s.samples(details), s.seen, true
+}
+
+// SampleKeys: a uniform random sample of the keys of a group on this node,
+// or of all its groups together, skipping those whose store cannot be ranged over
+func (s *Server) SampleKeys(ctx context.Context, req *pb.SampleKeysRequest) (*pb.SampleKeysResponse, error) {
+	n := int(req.GetN())
+	if n == 0 {
+		n = defaultSampleKeys
+	}
+	if n < 0 || n > maxSampleKeys {
+		return nil, status.Errorf(codes.InvalidArgument, "rebelcache: keys sampled must be between 0 and %d", maxSampleKeys)
+	}
+	sampler := &keySampler{n: n}
+	if req.GetGroup() != "" {
+		g, err := s.getGroup(req.GetGroup())
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		if !g.cache.sampleInto(sampler, g.name) {
+			return nil, status.Errorf(codes.FailedPrecondition, "rebelcache: store of group %q cannot list its entries", g.name)
+		}
+	} else {
+		s.groups.Range(func(_, g any) bool {
+			g.(*Group).cache.sampleInto(sampler, g.(*Group).name)
+			return ctx.Err() == nil
+		})
+	}
+
+	node := s.opts.AdvertiseAddr
+	if node == "" {
+		node = s.addr
+	}
+	resp := &pb.SampleKeysResponse{Node: node, Entries: sampler.seen}
+	for _, sample := range sampler.samples(req.GetDetails()) {
+		key := &pb.SampledKey{Group: sample.Group, Key: []byte(sample.Key), Size: int64(sample.Size)}
+		if sample.TTL > 0 {
+			key.Ttl = durationpb.New(sample.TTL)
+		}
+		if !sample.LastAccess.IsZero() {
+			key.LastAccess = sample.LastAccess.UnixNano()
+		}
+		resp.Keys = append(resp.Keys, key)
+	}
+	return resp, nil
+}
+
+// SampleKeys: a uniform random sample of n keys of group on the node, 0
+// means 20, or of all its groups with an empty group, with their size, ttl
+// and last access if details. Returns the number of entries sampled from too.
+// A client resolving its service asks any one node
+func (c *Client) SampleKeys(ctx context.Context, group string, n int, details bool) ([]KeySample, int64, error) {
+	var resp *pb.SampleKeysResponse
+	err := c.invoke(ctx, "SampleKeys", group, func(ctx context.Context) (err error) {
+		resp, err = c.grpcCli.SampleKeys(ctx, &pb.SampleKeysRequest{Group: group, N: int32(n), Details: details})
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	samples := make([]KeySample, 0, len(resp.GetKeys()))
+	for _, key := range resp.GetKeys() {
+		sample := KeySample{Group: key.GetGroup(), Key: string(key.GetKey()), Size: int(key.GetSize())}
+		if key.Ttl != nil {
+			sample.TTL = key.GetTtl().AsDuration()
+		}
+		if key.GetLastAccess() != 0 {
+			sample.LastAccess = time.Unix(0, key.GetLastAccess())
+		}
+		samples = append(samples, sample)
+	}
+	return samples, resp.GetEntries(), nil
+}
@@ -0,0 +1,90 @@
+package rebelcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrSelfCheck: returned by Serve when the node must not join its cluster
+var ErrSelfCheck = errors.New("rebelcache: startup self-check failed")
+
+// selfCheckTimeout: bound of reading the peers' configs
+const selfCheckTimeout = 5 * time.Second
+
+// NodeConfig: configuration all nodes of a cluster must agree on,
+// published as the value of a node's registration, see Registry
+type NodeConfig struct {
+	Addr   string   `json:"addr"`
+	Ring   string   `json:"ring,omitempty"` // ring signature, empty if the node has no picker
+	Groups []string `json:"groups"`         // sorted names of the served groups
+	// Weight: share of its place on the ring the node takes while warming,
+	// 0 means full, see WarmupOptions.Weight
+	Weight float64 `json:"weight,omitempty"`
+}
+
+// nodeConfig: the config of this node registered at addr
+func (s *Server) nodeConfig(addr string) NodeConfig {
+	conf := NodeConfig{Addr: addr, Groups: []string{}}
+	if s.opts.Picker != nil {
+		conf.Ring = s.opts.Picker.RingSignature()
+	}
+	s.groups.Range(func(name, _ any) bool {
+		conf.Groups = append(conf.Groups, name.(string))
+		return true
+	})
+	slices.Sort(conf.Groups)
+	return conf
+}
+
+// conflicts: how c differs from peer in ways that break the cluster, nil if it does not
+func (c NodeConfig) conflicts(peer NodeConfig) []string {
+	var diffs []string
+	if c.Ring != "" && peer.Ring != "" && c.Ring != peer.Ring {
+		diffs = append(diffs, fmt.Sprintf("hash ring %q, peer has %q (hash function or replica count differ)", c.Ring, peer.Ring))
+	}
+	if !slices.Equal(c.Groups, peer.Groups) {
+		diffs = append(diffs, fmt.Sprintf("groups %v, peer has %v", c.Groups, peer.Groups))
+	}
+	return diffs
+}
+
+// selfCheck: run the startup checks, then compare conf with the configs the
+// cluster's registered nodes published. Nodes registered without a config
+// are skipped
+func (s *Server) selfCheck(conf NodeConfig) error {
+	for _, check := range s.opts.StartupChecks {
+		if err := check(); err != nil {
+			return fmt.Errorf("%w: %w", ErrSelfCheck, err)
+		}
+	}
+	if s.registry == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), selfCheckTimeout)
+	defer cancel()
+	nodes, err := registeredNodes(ctx, s.registry)
+	if err != nil {
+		return fmt.Errorf("%w: read peers of %s: %w", ErrSelfCheck, s.svcName, err)
+	}
+	var problems []string
+	for _, value := range nodes {
+		var peer NodeConfig
+		if err := json.Unmarshal([]byte(value), &peer); err != nil || peer.Addr == conf.Addr {
+			continue
+		}
+		for _, diff := range conf.conflicts(peer) {
+			problems = append(problems, fmt.Sprintf("peer %s: %s", peer.Addr, diff))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: node %s conflicts with cluster %s:\n  %s",
+			ErrSelfCheck, conf.Addr, s.svcName, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
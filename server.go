@@ -1,25 +1,953 @@
 package rebelcache
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
 	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
 	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 type Server struct {
+	pb.UnimplementedCacheServer
 	addr       string           // server's addr
-	svcName    string           // service name
-	groups     *sync.Map        // cache groups
+	svcName    ServiceName      // service name
+	groups     *sync.Map        // cache groups, the group registry by default
 	grpcServer *grpc.Server     // grpc server
 	etcdCli    *clientv3.Client // etcd client
-	stopCh     chan error       // stop channel
+	loops      *supervisor      // background loops, see Loops
 	opts       *ServerOptions   // server options
 	store      store.Store      // cache store
+	stopOnce   sync.Once
+	readOnly   atomic.Bool // writes to every group are rejected with ErrReadOnly
+	allowlist  *ipAllowlist
+	shaper     *shaper       // request shaping, nil if disabled
+	labels     *GroupLabeler // group label values of metrics
+	metrics    *metrics      // prometheus metrics, see MetricsHandler
+	httpServer *http.Server  // rest api, nil if disabled
+	metricsSrv *http.Server  // prometheus endpoint, nil if disabled
+	resp       *respServer   // redis protocol listener, nil if disabled
+	restored   atomic.Bool   // snapshots were restored, so Stop may overwrite them
+	// aof: append-only log, nil if disabled or not serving yet
+	aof atomic.Pointer[appendLog]
+	// soak: soak checks, nil unless ServerOptions.Soak is set
+	soak *soakChecker
+	// gossip: membership by gossip, nil unless DiscoveryGossip is serving
+	gossip atomic.Pointer[Gossip]
+	// refresher: scheduled refreshes, see ServerOptions.Refresh
+	refresher *refresher
+	// warmup: whether the node is warming or ready, see Readiness
+	warmup *warmup
+	// registry: where the node registers, nil without a Service or with
+	// DiscoveryGossip or DiscoveryStatic. With DiscoveryDNS it only resolves
+	// the peers
+	registry Registry
+	// draining: Drain was called, the node leaves the cluster
+	draining atomic.Bool
+	// limiter: caps on concurrent rpcs, nil unless ServerOptions.Concurrency is set
+	limiter *concurrencyLimiter
+	// batches: limits and workers of the batch rpcs, see ServerOptions.Batch
+	batches *batchLimiter
+	// transforms: the transforms of ServerOptions.Transforms by group
+	transforms groupTransforms
+	// auth: checks the tokens of callers, nil unless ServerOptions.Auth is set
+	auth *authenticator
+	// skew: compares the clients' clocks with the node's, nil if
+	// ServerOptions.MaxClockSkew is negative
+	skew *skewMonitor
 }
 
 type ServerOptions struct {
 	ServerAddr string
-	EtcdAddr   string
-}
\ No newline at end of file
+	Service    ServiceName // cluster identity the server registers as
+	EtcdAddr   string      // single etcd endpoint, deprecated: use Etcd.Endpoints
+	Etcd       EtcdOptions // etcd connection, auth and namespace
+	// AllowedCIDRs: networks (or single IPs) allowed to call the server,
+	// applies to client and peer rpcs alike, empty allows everyone
+	AllowedCIDRs  []string
+	GrpcOptions   []grpc.ServerOption // extra options of the grpc server
+	AdvertiseAddr string              // addr registered in etcd for peers and clients to dial, defaults to the listen addr
+	LeaseTTL      time.Duration       // ttl of the etcd registration lease, defaults to 10s
+	ReadOnly      bool                // start in read-only mode, see SetReadOnly
+	HTTPAddr      string              // addr of the rest api, see HTTPHandler, empty disables it
+	Shaping       *ShapingOptions     // throttling of scan-heavy callers, nil disables it
+	GroupLabels   *GroupLabelOptions  // cardinality control of the group label of metrics, nil uses the defaults
+	MetricsAddr   string              // addr serving prometheus metrics at /metrics, loops at /debug/loops and probes at /livez and /readyz, empty disables it
+	// TracerProvider: spans of the rpcs served, continuing the trace of the
+	// caller, and of the forwards and loads they cause, nil disables tracing
+	TracerProvider trace.TracerProvider
+	RESPAddr       string        // addr of the redis protocol listener, empty disables it
+	RESPGroup      string        // group served over the redis protocol
+	Picker         *ClientPicker // peers of the node's groups, its ring is checked against the cluster on start
+	// StartupChecks: run before serving, e.g. integrity checks of persisted
+	// state, the first failure makes Serve refuse to serve
+	StartupChecks []func() error
+	// Snapshot: groups are restored from snapshots before serving, then
+	// snapshotted periodically and on Stop, nil disables snapshots
+	Snapshot *SnapshotOptions
+	// AOF: writes to groups are logged and the log is replayed before serving,
+	// after any snapshot, nil disables the log. A log damaged before its end
+	// makes Serve refuse to serve
+	AOF *AOFOptions
+	// ExemplarLatency: rpcs served under a sampled span and at least this slow
+	// attach their trace id as an exemplar to the latency histogram, so a spike
+	// on a dashboard leads to a trace. 0 attaches every sampled rpc
+	ExemplarLatency time.Duration
+	// Expvar: serve cache, gc and goroutine stats as expvar json at
+	// /debug/vars of MetricsAddr too, for scrapers reading expvar rather
+	// than prometheus, see ExpvarHandler
+	Expvar bool
+	// GroupConfigs: follow the group configurations in etcd, see GroupConfigs,
+	// retuning the served groups as they change. Requires a Service. Groups
+	// defined after the server started get their configuration on its next change
+	GroupConfigs bool
+	// GroupGetter: getter of the configured groups the node doesn't define,
+	// they are created once their configuration appears, nil only retunes the
+	// defined groups. It may return nil for groups the node can't load
+	GroupGetter func(group string) Getter
+	// ReplicaCount: nodes following the owner of a key on the Picker's ring
+	// that keep a copy of it, 0 disables replication. Writes through a group
+	// are copied to the owner and replicas in the background, or as many as
+	// their Consistency waits for, gets fall back
+	// to the replicas while the owner is unreachable, and owners repair
+	// replicas found missing or differing on a sample of the gets they serve.
+	// Requires a Picker
+	ReplicaCount int
+	// HintedHandoff: keep the copies of writes that a node of the replica set
+	// missed and replay them once it answers again, nil leaves them to read
+	// repair. Requires ReplicaCount, see HintOptions
+	HintedHandoff *HintOptions
+	// Discovery: how nodes find each other, DiscoveryEtcd, the default,
+	// registers a node with a Service in etcd. DiscoveryConsul and
+	// DiscoveryZooKeeper register it in consul or zookeeper instead and keep
+	// the Picker's peers from there, see Registry. DiscoveryGossip keeps the
+	// Picker's peers by gossip with the other nodes instead, see Gossip,
+	// DiscoveryStatic builds them from a fixed list, see StaticOptions, and
+	// DiscoveryDNS from the records of a DNS name, see DNSOptions
+	Discovery string
+	// Consul: the consul of DiscoveryConsul
+	Consul ConsulOptions
+	// ZooKeeper: the zookeeper of DiscoveryZooKeeper
+	ZooKeeper ZooKeeperOptions
+	// Gossip: membership by gossip with DiscoveryGossip
+	Gossip GossipOptions
+	// Static: the peers of DiscoveryStatic
+	Static StaticOptions
+	// DNS: the name resolved to the peers with DiscoveryDNS
+	DNS DNSOptions
+	// Refresh: keys reloaded on a schedule whether read or not, more can be
+	// added with RegisterRefresh, see RefreshRule
+	Refresh []RefreshRule
+	// Warmup: report the node warming until its hit ratio reaches a target,
+	// optionally at a reduced ring weight, nil reports it ready once serving.
+	// See WarmupOptions and Readiness
+	Warmup *WarmupOptions
+	// Soak: verify the served groups against the writes they published and
+	// the cluster's invariants periodically, for soak tests, nil disables it.
+	// See SoakOptions and SoakViolations
+	Soak *SoakOptions
+	// Rebalance: hand the keys the node no longer owns after its ring changed
+	// to their new owners, nil leaves them to miss there. Requires a Picker,
+	// see RebalanceOptions
+	Rebalance *RebalanceOptions
+	// Concurrency: caps on the rpcs served at once by the node and per
+	// connection, nil serves them all as they come, see ConcurrencyOptions
+	Concurrency *ConcurrencyOptions
+	// Batch: key limits and chunking of the batch rpcs, see BatchOptions
+	Batch BatchOptions
+	// Transforms: names of the registered transforms, applied in order to the
+	// values of each group returned to the node's clients, see Transform
+	Transforms map[string][]string
+	// Auth: tokens of the node's clients and of the cluster's nodes, nil
+	// accepts any caller, see AuthOptions. Set PickerOptions.PeerToken to one
+	// of the PeerTokens
+	Auth *AuthOptions
+	// MaxClockSkew: clients whose clock is off from the node's by more are
+	// logged and counted, see ClockSkewStats. 0 means 1s, negative disables it
+	MaxClockSkew time.Duration
+}
+
+// DefaultServerOptions: return default server config
+func DefaultServerOptions() *ServerOptions {
+	return &ServerOptions{
+		ServerAddr: ":8001",
+		Etcd:       DefaultEtcdOptions(),
+	}
+}
+
+// NewServer: create a server serving the registered groups, nil opts uses the defaults.
+// A server with a Service registers itself in etcd once started
+func NewServer(opts *ServerOptions) (*Server, error) {
+	if opts == nil {
+		opts = DefaultServerOptions()
+	}
+	allowlist, err := newIPAllowlist(opts.AllowedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	transforms, err := newGroupTransforms(opts.Transforms)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		addr:       opts.ServerAddr,
+		svcName:    opts.Service,
+		groups:     &groupRegistry,
+		loops:      newSupervisor(context.Background()),
+		opts:       opts,
+		allowlist:  allowlist,
+		shaper:     newShaper(opts.Shaping),
+		labels:     NewGroupLabeler(opts.GroupLabels),
+		soak:       newSoakChecker(opts.Soak),
+		warmup:     newWarmup(opts.Warmup),
+		limiter:    newConcurrencyLimiter(opts.Concurrency),
+		batches:    newBatchLimiter(opts.Batch),
+		transforms: transforms,
+		auth:       newAuthenticator(opts.Auth),
+		skew:       newSkewMonitor(opts.MaxClockSkew),
+	}
+	s.metrics = newMetrics(s)
+
+	// latencies include the time spent in the other interceptors
+	var unary []grpc.UnaryServerInterceptor
+	if opts.TracerProvider != nil {
+		unary = append(unary, s.traceUnary)
+	}
+	unary = append(unary, s.metrics.unaryInterceptor, recoverUnary, allowlist.unaryInterceptor)
+	stream := []grpc.StreamServerInterceptor{recoverStream, allowlist.streamInterceptor}
+	if s.auth != nil {
+		unary = append(unary, s.auth.unaryInterceptor)
+		stream = append(stream, s.auth.streamInterceptor)
+	}
+	if s.skew != nil {
+		unary = append(unary, s.skew.unaryInterceptor)
+	}
+	unary = append(unary, negotiateUnary)
+	if s.shaper != nil {
+		unary = append(unary, s.shaper.shapeUnary)
+	}
+	if s.limiter != nil {
+		unary = append(unary, s.limiter.limitUnary)
+	}
+	grpcOpts := append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}, opts.GrpcOptions...)
+	s.grpcServer = grpc.NewServer(grpcOpts...)
+	if opts.RESPAddr != "" {
+		s.resp = &respServer{srv: s, group: opts.RESPGroup, conns: make(map[net.Conn]struct{})}
+	}
+	if opts.HTTPAddr != "" {
+		s.httpServer = &http.Server{Addr: opts.HTTPAddr, Handler: s.HTTPHandler()}
+	}
+	if opts.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", s.MetricsHandler())
+		mux.Handle("GET /debug/loops", s.LoopsHandler())
+		mux.Handle("GET /livez", s.LivezHandler())
+		mux.Handle("GET /readyz", s.ReadyzHandler())
+		if opts.Expvar {
+			mux.Handle("GET /debug/vars", s.ExpvarHandler())
+		}
+		s.metricsSrv = &http.Server{Addr: opts.MetricsAddr, Handler: mux}
+	}
+	if opts.Snapshot != nil && opts.Snapshot.Dir == "" {
+		return nil, errors.New("rebelcache: snapshots without a directory")
+	}
+	if opts.AOF != nil && opts.AOF.Dir == "" {
+		return nil, errors.New("rebelcache: append-only log without a directory")
+	}
+	for _, format := range []string{opts.snapshotFormat(), opts.aofFormat()} {
+		if _, err := recordCodecNamed(format); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ReplicaCount > 0 {
+		if opts.Picker == nil {
+			return nil, errors.New("rebelcache: replication without a picker")
+		}
+		opts.Picker.replicaCount.Store(int32(opts.ReplicaCount))
+	}
+	if w := opts.Warmup; w != nil && (w.Weight < 0 || w.Weight > 1 || w.TargetHitRatio > 1) {
+		return nil, errors.New("rebelcache: warmup weight and hit ratio must be between 0 and 1")
+	}
+	if opts.Rebalance != nil && opts.Picker == nil {
+		return nil, errors.New("rebelcache: rebalancing without a picker")
+	}
+	if opts.HintedHandoff != nil {
+		if opts.ReplicaCount <= 0 {
+			return nil, errors.New("rebelcache: hinted handoff without replication")
+		}
+		opts.Picker.hints.Store(newHintStore(*opts.HintedHandoff))
+	}
+	if s.refresher, err = newRefresher(opts.Refresh); err != nil {
+		return nil, err
+	}
+	s.readOnly.Store(opts.ReadOnly)
+	pb.RegisterCacheServer(s.grpcServer, s)
+
+	switch opts.Discovery {
+	case "", DiscoveryEtcd, DiscoveryConsul, DiscoveryZooKeeper:
+	case DiscoveryGossip:
+		if opts.Picker == nil {
+			return nil, errors.New("rebelcache: gossip discovery without a picker")
+		}
+	case DiscoveryStatic:
+		if opts.Picker == nil {
+			return nil, errors.New("rebelcache: static discovery without a picker")
+		}
+		if _, err := opts.Static.staticPeers(); err != nil {
+			return nil, err
+		}
+	case DiscoveryDNS:
+		if opts.Picker == nil {
+			return nil, errors.New("rebelcache: dns discovery without a picker")
+		}
+		if s.registry, err = NewDNSRegistry(opts.DNS); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("rebelcache: unknown discovery %q", opts.Discovery)
+	}
+	if opts.Service.Cluster != "" {
+		if err := opts.Service.Validate(); err != nil {
+			return nil, err
+		}
+		switch opts.Discovery {
+		case DiscoveryGossip, DiscoveryStatic, DiscoveryDNS:
+		case DiscoveryConsul:
+			s.registry = NewConsulRegistry(opts.Service, opts.Consul)
+		case DiscoveryZooKeeper:
+			if s.registry, err = NewZooKeeperRegistry(opts.Service, opts.ZooKeeper); err != nil {
+				return nil, err
+			}
+		default:
+			if s.etcdCli, err = newEtcdClient(opts.etcdOptions()); err != nil {
+				return nil, fmt.Errorf("rebelcache: connect etcd: %w", err)
+			}
+			s.registry = NewEtcdRegistry(s.etcdCli, opts.Service, opts.LeaseTTL)
+		}
+	} else if opts.Discovery == DiscoveryConsul || opts.Discovery == DiscoveryZooKeeper {
+		return nil, fmt.Errorf("rebelcache: %s discovery without a service", opts.Discovery)
+	}
+	return s, nil
+}
+
+// Start: listen on the server's addr and serve rpcs until Stop
+func (s *Server) Start() error {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("rebelcache: listen on %s: %w", s.addr, err)
+	}
+	return s.Serve(lis)
+}
+
+// Serve: serve rpcs on lis until Stop, registering the server in etcd meanwhile.
+// It refuses to serve if the startup self-check fails, see selfCheck, or
+// another listener can't be bound. A failure once the background loops run
+// stops the server as Stop does
+func (s *Server) Serve(lis net.Listener) error {
+	addr := s.opts.AdvertiseAddr
+	if addr == "" {
+		addr = lis.Addr().String()
+	}
+	conf := s.nodeConfig(addr)
+	if err := s.selfCheck(conf); err != nil {
+		lis.Close()
+		return err
+	}
+	// bound before anything starts, served once nothing can fail anymore
+	httpLis, err := s.listenHTTP()
+	if err != nil {
+		lis.Close()
+		return err
+	}
+	if s.resp != nil {
+		respLis, err := net.Listen("tcp", s.opts.RESPAddr)
+		if err != nil {
+			lis.Close()
+			closeListeners(httpLis)
+			return fmt.Errorf("rebelcache: listen on %s: %w", s.opts.RESPAddr, err)
+		}
+		s.resp.lis = respLis
+	}
+	fail := func(err error) error {
+		lis.Close()
+		closeListeners(httpLis)
+		s.Stop()
+		return err
+	}
+	if s.opts.Snapshot != nil && s.restored.CompareAndSwap(false, true) {
+		s.restoreSnapshots()
+		interval := s.opts.Snapshot.Interval
+		if interval == 0 {
+			interval = defaultSnapshotInterval
+		}
+		if interval > 0 {
+			s.loops.Go("snapshots", RestartOnFailure, func(ctx context.Context) error {
+				s.snapshotLoop(ctx, interval)
+				return nil
+			})
+		}
+	}
+	if s.opts.AOF != nil && s.aof.Load() == nil {
+		aof, err := openAppendLog(*s.opts.AOF, s.logGroups(s.opts.AOF.Groups))
+		if err != nil {
+			return fail(fmt.Errorf("rebelcache: open append-only log: %w", err))
+		}
+		s.aof.Store(aof)
+	}
+	if s.startWarmup() && s.opts.Warmup != nil {
+		s.loops.Go("warmup", RestartOnFailure, s.warmupLoop)
+	}
+	if s.soak != nil {
+		s.loops.Go("soak checks", RestartOnFailure, s.soakLoop)
+	}
+	if s.opts.HintedHandoff != nil {
+		s.loops.Go("hinted handoff", RestartOnFailure, s.hintLoop)
+	}
+	s.loops.Go("key refresh", RestartOnFailure, s.refreshLoop)
+	if s.opts.Rebalance != nil {
+		s.loops.Go("rebalance", RestartOnFailure, s.rebalanceLoop)
+	}
+	if s.opts.Picker != nil && s.opts.Picker.rtts != nil {
+		s.loops.Go("rtt probes", RestartOnFailure, s.rttLoop)
+	}
+	if s.etcdCli != nil && s.opts.GroupConfigs {
+		s.loops.Go("group configs", RestartOnFailure, s.followGroupConfigs)
+	}
+	if s.opts.Discovery == DiscoveryStatic {
+		peers, err := s.opts.Static.staticPeers()
+		if err == nil {
+			err = s.setStaticPeers(addr, peers)
+		}
+		if err != nil {
+			return fail(err)
+		}
+		if s.opts.Static.File != "" {
+			s.loops.Go("static peers", RestartOnFailure, func(ctx context.Context) error {
+				return s.staticReloadLoop(ctx, addr)
+			})
+		}
+	}
+	if s.opts.Discovery == DiscoveryGossip && s.gossip.Load() == nil {
+		gossip := NewGossip(addr, s.svcName, s.opts.Gossip, func(peers []string) { s.opts.Picker.Set(peers...) })
+		if err := gossip.Start(context.Background()); err != nil {
+			return fail(fmt.Errorf("rebelcache: gossip: %w", err))
+		}
+		s.gossip.Store(gossip)
+	}
+	if s.registry != nil && s.opts.Picker != nil && s.opts.Discovery != "" && s.opts.Discovery != DiscoveryEtcd {
+		// etcd peers are followed by Picker.Discover
+		s.loops.Go("peers", RestartOnFailure, func(ctx context.Context) error {
+			if err := s.opts.Picker.Watch(ctx, s.registry); err != nil {
+				return err
+			}
+			<-ctx.Done()
+			return nil
+		})
+	}
+	if s.registry != nil {
+		// registered at the warmup weight, rewritten at full weight once ready
+		value := func() string {
+			conf := conf
+			conf.Weight = s.ringWeight()
+			b, _ := json.Marshal(conf) // plain fields, it can't fail
+			return string(b)
+		}
+		s.loops.Go("registration", RestartOnFailure, func(ctx context.Context) error {
+			if err := s.registry.Register(ctx, addr, value()); err != nil {
+				return err
+			}
+			for {
+				select {
+				case <-ctx.Done():
+					deregisterCtx, cancel := context.WithTimeout(context.Background(), registryCloseTimeout)
+					err := s.registry.Deregister(deregisterCtx, addr)
+					cancel()
+					return err
+				case <-s.warmup.updates:
+					if s.draining.Load() {
+						continue
+					}
+					if err := s.registry.Register(ctx, addr, value()); err != nil {
+						return err
+					}
+				}
+			}
+		})
+	}
+	for srv, httpLis := range httpLis {
+		go func() {
+			if err := srv.Serve(httpLis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("rebelcache: http server on %s: %v", srv.Addr, err)
+			}
+		}()
+	}
+	if s.resp != nil {
+		go s.resp.serve()
+	}
+	if err := s.grpcServer.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	return nil
+}
+
+// listenHTTP: bind the listeners of the http api and of the metrics, none
+// stays bound on a failure
+func (s *Server) listenHTTP() (map[*http.Server]net.Listener, error) {
+	bound := make(map[*http.Server]net.Listener, 2)
+	for _, srv := range []*http.Server{s.httpServer, s.metricsSrv} {
+		if srv == nil {
+			continue
+		}
+		lis, err := net.Listen("tcp", srv.Addr)
+		if err != nil {
+			closeListeners(bound)
+			return nil, fmt.Errorf("rebelcache: listen on %s: %w", srv.Addr, err)
+		}
+		bound[srv] = lis
+	}
+	return bound, nil
+}
+
+// closeListeners: close the listeners bound by listenHTTP
+func closeListeners(bound map[*http.Server]net.Listener) {
+	for _, lis := range bound {
+		lis.Close()
+	}
+}
+
+// Stop: deregister, stop accepting rpcs and wait for in-flight ones to
+// finish, then for the copies of their writes to the replicas
+func (s *Server) Stop() {
+	s.stopOnce.Do(func() {
+		if err := s.loops.Stop(); err != nil {
+			log.Printf("rebelcache: background loop: %v", err)
+		}
+		if gossip := s.gossip.Load(); gossip != nil {
+			// the other nodes take the node's keys back before it stops serving them
+			gossip.Stop()
+		}
+		s.grpcServer.GracefulStop()
+		if s.resp != nil {
+			s.resp.close()
+		}
+		// copies of the writes served to the replicas, bounded as each copy is
+		ctx, cancel := context.WithTimeout(context.Background(), replicaWriteTimeout)
+		s.groups.Range(func(_, v any) bool {
+			v.(*Group).tasks.wait(ctx)
+			return true
+		})
+		cancel()
+		if s.restored.Load() {
+			// after the last write was served
+			s.SaveSnapshots()
+		}
+		if aof := s.aof.Load(); aof != nil {
+			if err := aof.close(); err != nil {
+				log.Printf("rebelcache: close append-only log: %v", err)
+			}
+		}
+		for _, srv := range []*http.Server{s.httpServer, s.metricsSrv} {
+			if srv != nil {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				srv.Shutdown(ctx)
+				cancel()
+			}
+		}
+		if s.registry != nil {
+			if err := s.registry.Close(); err != nil {
+				log.Printf("rebelcache: close registry: %v", err)
+			}
+		}
+		if s.etcdCli != nil {
+			s.etcdCli.Close()
+		}
+	})
+}
+
+// snapshotFormat: the record codec of the snapshots, empty without them
+func (o *ServerOptions) snapshotFormat() string {
+	if o.Snapshot == nil {
+		return ""
+	}
+	return o.Snapshot.Format
+}
+
+// aofFormat: the record codec of the append-only log, empty without one
+func (o *ServerOptions) aofFormat() string {
+	if o.AOF == nil {
+		return ""
+	}
+	return o.AOF.Format
+}
+
+// etcdOptions: resolve etcd options, falling back to EtcdAddr
+func (o *ServerOptions) etcdOptions() EtcdOptions {
+	opts := o.Etcd
+	if len(opts.Endpoints) == 0 && o.EtcdAddr != "" {
+		opts.Endpoints = []string{o.EtcdAddr}
+	}
+	return opts
+}
+
+// SetReadOnly: freeze or unfreeze all groups served by the node, reads go on
+func (s *Server) SetReadOnly(readOnly bool) {
+	s.readOnly.Store(readOnly)
+}
+
+// ReadOnly: whether the node rejects writes
+func (s *Server) ReadOnly() bool {
+	return s.readOnly.Load()
+}
+
+// writableGroup: find the group a write rpc refers to, ErrReadOnly if the node is read-only
+func (s *Server) writableGroup(name string) (*Group, error) {
+	if s.readOnly.Load() {
+		return nil, fmt.Errorf("%w: node %s", ErrReadOnly, s.addr)
+	}
+	return s.getGroup(name)
+}
+
+// getGroup: find the group an rpc refers to
+func (s *Server) getGroup(name string) (*Group, error) {
+	if g, ok := s.groups.Load(name); ok {
+		return g.(*Group), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrGroupNotFound, name)
+}
+
+// Get: get value by key from a group, loading it on a miss unless the
+// request asks for the cached value only
+func (s *Server) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	g, err := s.getGroup(req.GetGroup())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	var value store.Value
+	var version uint64
+	if req.GetCached() {
+		if value, version, err = g.GetWithVersion(ctx, string(req.GetKey())); err != nil {
+			return nil, toStatus(err)
+		}
+	} else if value, err = g.Get(withRequestConsistency(ctx, req.GetConsistency()), string(req.GetKey())); err != nil {
+		return nil, toStatus(err)
+	}
+	if value == nil {
+		return nil, status.Errorf(codes.NotFound, "rebelcache: key %s not found", FormatKey(string(req.GetKey())))
+	}
+	b, err := valueBytes(value)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if b, err = s.transforms.apply(ctx, g.name, string(req.GetKey()), b); err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &pb.GetResponse{Value: b, Hot: g.isHot(string(req.GetKey())), Version: version}
+	// large values go compressed to clients that can decompress them
+	if opts := g.cache.opts.Compression; opts.compressible(b) && ClientProtocol(ctx).Supports(CapCompression) {
+		if z := compress(opts.Algorithm, b); len(z) < len(b) {
+			resp.Value, resp.Compression = z, pb.Compression(opts.Algorithm)
+		}
+	}
+	return resp, nil
+}
+
+// Set: set value by key in a group
+func (s *Server) Set(ctx context.Context, req *pb.SetRequest) (*pb.SetResponse, error) {
+	g, err := s.writableGroup(req.GetGroup())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	value, err := receivedValue(req.GetValue(), req.GetCompression())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	ttl := req.GetTtl().AsDuration()
+	key := string(req.GetKey())
+	ctx = withRequestConsistency(ctx, req.GetConsistency())
+	applied := true
+	switch {
+	case btoi(req.GetIfAbsent())+btoi(req.GetIfPresent())+btoi(req.IfVersion != nil) > 1:
+		return nil, status.Error(codes.InvalidArgument, "rebelcache: set with more than one condition")
+	case req.GetIfAbsent():
+		applied, err = g.SetNX(ctx, key, value, ttl)
+	case req.GetIfPresent():
+		applied, err = g.SetXX(ctx, key, value, ttl)
+	case req.IfVersion != nil:
+		applied, err = g.CompareAndSwap(ctx, key, req.GetIfVersion(), value, ttl)
+	default:
+		err = g.SetWithExpiration(ctx, key, value, ttl)
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.SetResponse{Applied: applied}, nil
+}
+
+// btoi: 1 if b, else 0
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Delete: delete value by key from a group
+func (s *Server) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	g, err := s.writableGroup(req.GetGroup())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	deleted, err := g.Delete(withRequestConsistency(ctx, req.GetConsistency()), string(req.GetKey()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.DeleteResponse{Deleted: deleted}, nil
+}
+
+// Stats: return statistics of a group
+func (s *Server) Stats(ctx context.Context, req *pb.StatsRequest) (*pb.StatsResponse, error) {
+	g, err := s.getGroup(req.GetGroup())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	stats := g.Stats()
+	resp := &pb.StatsResponse{Group: g.Name()}
+	resp.Hits, _ = stats["hits"].(int64)
+	resp.Misses, _ = stats["misses"].(int64)
+	resp.HitRate, _ = stats["hit_rate"].(float64)
+	resp.Closed, _ = stats["closed"].(bool)
+	if size, ok := stats["size"].(int); ok {
+		resp.Size = int64(size)
+	}
+	return resp, nil
+}
+
+// Ownership: entries and gets of a group on this node by ring segment, see OwnershipReport
+func (s *Server) Ownership(ctx context.Context, req *pb.OwnershipRequest) (*pb.OwnershipResponse, error) {
+	segments := int(req.GetSegments())
+	if segments == 0 {
+		segments = defaultSegments
+	}
+	if segments < 0 || segments > rateBuckets || segments&(segments-1) != 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "rebelcache: segments must be a power of two up to %d", rateBuckets)
+	}
+	g, err := s.getGroup(req.GetGroup())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	report, err := g.ownership(segments)
+	if errors.Is(err, errNotRangeable) {
+		return nil, status.Error(codes.Unimplemented, err.Error())
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	node := s.opts.AdvertiseAddr
+	if node == "" {
+		node = s.addr
+	}
+	resp := &pb.OwnershipResponse{Group: report.Group, Node: node}
+	for _, seg := range report.Segments {
+		resp.Segments = append(resp.Segments, &pb.RingSegment{
+			Start:     seg.Start,
+			RingShare: seg.RingShare,
+			Keys:      seg.Keys,
+			Bytes:     seg.Bytes,
+			Qps:       seg.QPS,
+		})
+	}
+	return resp, nil
+}
+
+// TopKeys: the hottest keys read of a group on this node, FailedPrecondition
+// if the group doesn't track them, see CacheOptions.TopKeys
+func (s *Server) TopKeys(ctx context.Context, req *pb.TopKeysRequest) (*pb.TopKeysResponse, error) {
+	n := int(req.GetN())
+	if n == 0 {
+		n = defaultTopKeys
+	}
+	if n < 0 {
+		return nil, status.Error(codes.InvalidArgument, "rebelcache: negative number of top keys")
+	}
+	g, err := s.getGroup(req.GetGroup())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if g.cache.top == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "rebelcache: group %q doesn't track hot keys", g.name)
+	}
+
+	node := s.opts.AdvertiseAddr
+	if node == "" {
+		node = s.addr
+	}
+	resp := &pb.TopKeysResponse{Group: g.name, Node: node}
+	for _, kr := range g.cache.TopKeys(n) {
+		resp.Keys = append(resp.Keys, &pb.KeyRate{Key: []byte(kr.Key), Qps: kr.QPS})
+	}
+	return resp, nil
+}
+
+// ImmortalKeys: keys of a group's entries without expiration on this node,
+// given the requested ttl if there is one, see Cache.ExpireImmortal
+func (s *Server) ImmortalKeys(ctx context.Context, req *pb.ImmortalKeysRequest) (*pb.ImmortalKeysResponse, error) {
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = defaultImmortalKeys
+	}
+	if limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "rebelcache: negative number of keys")
+	}
+	if req.Ttl != nil && req.GetTtl().AsDuration() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "rebelcache: ttl must be positive")
+	}
+	g, err := s.getGroup(req.GetGroup())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	var keys []string
+	if req.Ttl != nil {
+		keys, err = g.ExpireImmortal(req.GetTtl().AsDuration(), limit)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+	} else {
+		var ok bool
+		if keys, ok = g.ImmortalKeys(limit); !ok {
+			return nil, status.Errorf(codes.FailedPrecondition, "rebelcache: store of group %q cannot list its entries", g.name)
+		}
+	}
+	node := s.opts.AdvertiseAddr
+	if node == "" {
+		node = s.addr
+	}
+	resp := &pb.ImmortalKeysResponse{Group: g.name, Node: node}
+	resp.Entries, resp.Bytes, _ = g.cache.Immortal()
+	for _, key := range keys {
+		resp.Keys = append(resp.Keys, []byte(key))
+	}
+	return resp, nil
+}
+
+// Watch: stream the writes to the requested groups on this node until the
+// caller leaves or the server stops. The response header is sent once the
+// caller is subscribed. A caller that falls behind is dropped with DataLoss:
+// it has missed writes and its copy may be stale
+func (s *Server) Watch(req *pb.WatchRequest, stream pb.Cache_WatchServer) error {
+	if len(req.GetGroups()) == 0 {
+		return status.Error(codes.InvalidArgument, "rebelcache: no groups to watch")
+	}
+	w := newWatcher(watchBuffer)
+	for _, name := range req.GetGroups() {
+		g, err := s.getGroup(name)
+		if err != nil {
+			return toStatus(err)
+		}
+		g.cache.feed.subscribe(w, name)
+		defer g.cache.feed.unsubscribe(w)
+	}
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case ev := <-w.ch:
+			if err := stream.Send(toKeyEvent(ev)); err != nil {
+				return err
+			}
+		case <-w.dropped:
+			return status.Error(codes.DataLoss, "rebelcache: watcher fell behind")
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-s.loops.done():
+			return nil
+		}
+	}
+}
+
+// toKeyEvent: the rpc form of ev, a value that cannot be sent is reported as deleted
+func toKeyEvent(ev keyEvent) *pb.KeyEvent {
+	msg := &pb.KeyEvent{Group: ev.group, Key: []byte(ev.key)}
+	switch ev.kind {
+	case eventClear:
+		msg.Type = pb.KeyEvent_CLEAR
+		return msg
+	case eventDelete:
+		msg.Type = pb.KeyEvent_DELETE
+		return msg
+	}
+	b, err := valueBytes(ev.value)
+	if err != nil {
+		msg.Type = pb.KeyEvent_DELETE
+		return msg
+	}
+	msg.Type, msg.Value = pb.KeyEvent_SET, b
+	_, msg.Counter = ev.value.(store.Counter)
+	if ev.ttl > 0 {
+		msg.Ttl = durationpb.New(ev.ttl)
+	}
+	return msg
+}
+
+// toStatus: map cache errors to grpc status codes
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, ErrGroupNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidKey), errors.Is(err, store.ErrNilValue), errors.Is(err, ErrInvalidPatch), errors.Is(err, ErrReservedValue):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrCacheClosed), errors.Is(err, ErrConsistency):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, ErrReadOnly), errors.Is(err, errNotTransferable), errors.Is(err, ErrNoMerger), errors.Is(err, ErrWrongType):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// errNotTransferable: the value has no byte representation to send over rpc
+var errNotTransferable = errors.New("rebelcache: value is not transferable")
+
+// valueBytes: encode a cached value for an rpc response, the bytes of a
+// ByteView are shared and must not be modified
+func valueBytes(value store.Value) ([]byte, error) {
+	switch v := value.(type) {
+	case ByteView:
+		return v.view(), nil
+	case *compressedValue:
+		return v.view().view(), nil
+	case interface{ Bytes() []byte }:
+		return v.Bytes(), nil
+	case store.Counter:
+		return strconv.AppendInt(nil, int64(v), 10), nil
+	case fmt.Stringer:
+		return []byte(v.String()), nil
+	}
+	return nil, fmt.Errorf("%w: %T", errNotTransferable, value)
+}
@@ -0,0 +1,223 @@
+package rebelcache
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// callerKey: rpc metadata naming the calling application, see ClientOptions.CallerID
+const callerKey = "rebelcache-caller"
+
+// callerHeader: http header naming the calling application
+const callerHeader = "X-Rebelcache-Caller"
+
+// ShapingOptions: detection and throttling of scan-heavy callers. A caller
+// whose reads mostly miss, like a dump script walking the key space, is
+// flagged as a scanner: its ops draw from the scan quota instead of the
+// point quota and its misses are loaded without being cached, so it can
+// neither saturate the node nor evict the working set
+type ShapingOptions struct {
+	Window        time.Duration // detection window, 0 means 10s
+	ScanMinReads  int           // reads in a window before a caller can be flagged, 0 means 1000
+	ScanMissRatio float64       // miss ratio of reads flagging a caller, 0 means 0.8
+	PointRate     rate.Limit    // per caller ops per second of point callers, 0 means unlimited
+	PointBurst    int           // burst of point callers
+	ScanRate      rate.Limit    // per caller ops per second of scanners, 0 means unlimited
+	ScanBurst     int           // burst of scanners
+}
+
+// shaper: per caller state of request shaping
+type shaper struct {
+	opts    ShapingOptions
+	mtx     sync.Mutex
+	callers map[string]*callerState
+}
+
+// callerState: one caller's counters and quotas
+type callerState struct {
+	windowStart time.Time
+	reads       int  // reads in the current window
+	misses      int  // reads in the current window that missed
+	scanner     bool // flagged as scanner
+	point       *rate.Limiter
+	scan        *rate.Limiter
+}
+
+// readTrace: filled in by Group.Get for the shaper
+type readTrace struct {
+	noFill bool        // load misses without caching them
+	missed atomic.Bool // the read missed the cache, set from loader goroutines too
+}
+
+// readTraceKey: context key of the readTrace of a request
+type readTraceKey struct{}
+
+// traceFromContext: the readTrace of the request of ctx, or nil
+func traceFromContext(ctx context.Context) *readTrace {
+	t, _ := ctx.Value(readTraceKey{}).(*readTrace)
+	return t
+}
+
+// newShaper: create a shaper, nil if opts is nil
+func newShaper(opts *ShapingOptions) *shaper {
+	if opts == nil {
+		return nil
+	}
+	o := *opts
+	if o.Window <= 0 {
+		o.Window = 10 * time.Second
+	}
+	if o.ScanMinReads <= 0 {
+		o.ScanMinReads = 1000
+	}
+	if o.ScanMissRatio <= 0 {
+		o.ScanMissRatio = 0.8
+	}
+	return &shaper{opts: o, callers: make(map[string]*callerState)}
+}
+
+// admit: take a token from the caller's current quota, return the trace to
+// pass down or ResourceExhausted
+func (s *shaper) admit(caller string) (*readTrace, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	now := time.Now()
+	c := s.callers[caller]
+	if c == nil {
+		s.purge(now)
+		c = &callerState{
+			windowStart: now,
+			point:       newLimiter(s.opts.PointRate, s.opts.PointBurst),
+			scan:        newLimiter(s.opts.ScanRate, s.opts.ScanBurst),
+		}
+		s.callers[caller] = c
+	}
+	if now.Sub(c.windowStart) >= s.opts.Window {
+		c.scanner = s.isScanner(c)
+		c.windowStart, c.reads, c.misses = now, 0, 0
+	}
+
+	limiter := c.point
+	if c.scanner {
+		limiter = c.scan
+	}
+	if !limiter.AllowN(now, 1) {
+		kind := "point"
+		if c.scanner {
+			kind = "scan"
+		}
+		return nil, status.Errorf(codes.ResourceExhausted, "rebelcache: caller %s over its %s quota", caller, kind)
+	}
+	return &readTrace{noFill: c.scanner}, nil
+}
+
+// record: count a finished read of caller, flagging it as soon as it looks like a scan
+func (s *shaper) record(caller string, t *readTrace) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	c := s.callers[caller]
+	if c == nil {
+		return
+	}
+	c.reads++
+	if t.missed.Load() {
+		c.misses++
+	}
+	if !c.scanner && s.isScanner(c) {
+		c.scanner = true
+	}
+}
+
+// isScanner: whether the counters of c are those of a scan
+// Note: lock must be held before calling this function.
+func (s *shaper) isScanner(c *callerState) bool {
+	return c.reads >= s.opts.ScanMinReads && float64(c.misses) >= s.opts.ScanMissRatio*float64(c.reads)
+}
+
+// purge: forget callers idle for two windows
+// Note: lock must be held before calling this function.
+func (s *shaper) purge(now time.Time) {
+	for caller, c := range s.callers {
+		if now.Sub(c.windowStart) >= 2*s.opts.Window {
+			delete(s.callers, caller)
+		}
+	}
+}
+
+// newLimiter: token bucket of r per second, unlimited if r is 0
+func newLimiter(r rate.Limit, burst int) *rate.Limiter {
+	if r <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(r, max(burst, 1))
+}
+
+// callerOf: identity of the caller of an rpc, its announced name or else its ip
+func callerOf(ctx context.Context) string {
+	if caller, _ := CallerFromContext(ctx); caller != "" {
+		return caller
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return hostOf(p.Addr.String())
+	}
+	return "unknown"
+}
+
+// hostOf: host part of a "host:port" addr
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// shapeUnary: server interceptor applying the shaper to rpcs
+func (s *shaper) shapeUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	caller := callerOf(ctx)
+	t, err := s.admit(caller)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := handler(context.WithValue(ctx, readTraceKey{}, t), req)
+	if info.FullMethod == pb.Cache_Get_FullMethodName {
+		s.record(caller, t)
+	}
+	return resp, err
+}
+
+// httpMiddleware: apply the shaper to http requests
+func (s *shaper) httpMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		caller := r.Header.Get(callerHeader)
+		if caller != "" {
+			ctx = WithCaller(ctx, caller)
+		} else {
+			caller = hostOf(r.RemoteAddr)
+		}
+		if feature := r.Header.Get(featureHeader); feature != "" {
+			ctx = WithFeature(ctx, feature)
+		}
+		t, err := s.admit(caller)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, readTraceKey{}, t)))
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/keys/") {
+			s.record(caller, t)
+		}
+	})
+}
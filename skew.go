@@ -0,0 +1,119 @@
+package rebelcache
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// sentAtKey: rpc metadata carrying the client's wall clock when it sent the
+// rpc, in unix nanoseconds. Ttls travel as durations and don't depend on
+// it, a skewed clock only shows that the client's own deadlines are off
+const sentAtKey = "rebelcache-sent-at"
+
+const (
+	// defaultMaxClockSkew: ServerOptions.MaxClockSkew when zero
+	defaultMaxClockSkew = time.Second
+	// skewLogInterval: least time between two logs of skewed clients
+	skewLogInterval = time.Minute
+)
+
+// ClockSkewStats: clients whose clock was off from the node's beyond
+// ServerOptions.MaxClockSkew. A skew is the node's time at receipt less the
+// client's at sending, the latency of the rpc included, so a positive skew
+// is a client running behind
+type ClockSkewStats struct {
+	Skewed    int64         // rpcs whose client was skewed
+	LastSkew  time.Duration // skew of the last of them
+	LastAddr  string        // remote addr of the last of them
+	WorstSkew time.Duration // skew furthest from zero so far
+}
+
+// skewMonitor: compares the clocks of the clients with the node's
+type skewMonitor struct {
+	max                     time.Duration
+	skewed, lastSkew, worst atomic.Int64
+	lastAddr                atomic.Pointer[string]
+	lastLog                 atomic.Int64 // unix nanos of the last log
+}
+
+// newSkewMonitor: create a monitor reporting skews beyond max, 0 means 1s,
+// nil if max is negative
+func newSkewMonitor(max time.Duration) *skewMonitor {
+	if max < 0 {
+		return nil
+	}
+	if max == 0 {
+		max = defaultMaxClockSkew
+	}
+	return &skewMonitor{max: max}
+}
+
+// observe: record the skew of the client of ctx, if it sent its clock
+func (m *skewMonitor) observe(ctx context.Context) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	v := md.Get(sentAtKey)
+	if len(v) == 0 {
+		return
+	}
+	sent, err := strconv.ParseInt(v[0], 10, 64)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	skew := now.Sub(time.Unix(0, sent))
+	if skew <= m.max && skew >= -m.max {
+		return
+	}
+	addr := "unknown"
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+	}
+	m.skewed.Add(1)
+	m.lastSkew.Store(int64(skew))
+	m.lastAddr.Store(&addr)
+	for {
+		worst := m.worst.Load()
+		if abs(int64(skew)) <= abs(worst) || m.worst.CompareAndSwap(worst, int64(skew)) {
+			break
+		}
+	}
+	last := m.lastLog.Load()
+	if now.UnixNano()-last >= int64(skewLogInterval) && m.lastLog.CompareAndSwap(last, now.UnixNano()) {
+		log.Printf("rebelcache: clock of client %s is off by %v from the node's, over %v", addr, skew, m.max)
+	}
+}
+
+// unaryInterceptor: observe the clock of the clients of unary rpcs
+func (m *skewMonitor) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	m.observe(ctx)
+	return handler(ctx, req)
+}
+
+// stats: current ClockSkewStats
+func (m *skewMonitor) stats() ClockSkewStats {
+	st := ClockSkewStats{
+		Skewed:    m.skewed.Load(),
+		LastSkew:  time.Duration(m.lastSkew.Load()),
+		WorstSkew: time.Duration(m.worst.Load()),
+	}
+	if addr := m.lastAddr.Load(); addr != nil {
+		st.LastAddr = *addr
+	}
+	return st
+}
+
+// ClockSkewStats: clients with skewed clocks seen so far, false if
+// ServerOptions.MaxClockSkew disables the check
+func (s *Server) ClockSkewStats() (ClockSkewStats, bool) {
+	if s.skew == nil {
+		return ClockSkewStats{}, false
+	}
+	return s.skew.stats(), true
+}
@@ -0,0 +1,454 @@
+package rebelcache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+// snapshot file layout: snapshotMagic and the header of its format, see
+// recordFormat, then per entry its uvarint-prefixed record, a zero length
+// after the last one, and the big-endian crc32c of everything before it
+const snapshotMagic = "RCSNAP"
+
+// kinds of the entries of snapshots of format 1, which were laid out as a
+// kind byte, the uvarint-prefixed key, the value (uvarint-prefixed bytes,
+// or a varint for counters) and the varint expiry in unix nanos (0 for none),
+// then a snapEnd byte and the checksum
+const (
+	snapEnd     byte = 0 // end of entries
+	snapBytes   byte = 1 // value as bytes
+	snapCounter byte = 2 // store.Counter
+)
+
+// defaultSnapshotInterval: time between periodic snapshots
+const defaultSnapshotInterval = 5 * time.Minute
+
+// maxSnapshotField: longest key or value a snapshot may hold, longer lengths mean corruption
+const maxSnapshotField = 1 << 30
+
+// ErrSnapshotCorrupt: a snapshot is truncated, of an unknown format or fails its checksum
+var ErrSnapshotCorrupt = errors.New("rebelcache: corrupt snapshot")
+
+// snapshotTable: crc32c, as used by the snapshot checksum
+var snapshotTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SnapshotOptions: periodic snapshots of a server's groups, restored when it starts
+type SnapshotOptions struct {
+	Dir      string        // directory of the snapshot files, one per group
+	Interval time.Duration // time between snapshots, 0 means 5m, negative only snapshots on Stop
+	Groups   []string      // groups to snapshot, empty means all groups served
+	// Format: name of the record codec snapshots are written with, see
+	// RegisterRecordCodec, empty means "binary". Snapshots of every
+	// registered codec are restored whatever the format
+	Format string
+}
+
+// snapshotEntry: an entry as written to a snapshot
+type snapshotEntry struct {
+	key      string
+	value    store.Value
+	expireAt time.Time
+}
+
+// writeSnapshot: write the unexpired entries of c to w as records of codec,
+// values that have no byte form are left out
+func (c *Cache) writeSnapshot(w io.Writer, codec RecordCodec) (n int, err error) {
+	entries, err := c.entries()
+	if err != nil {
+		return 0, err
+	}
+	return writeEntries(w, snapshotMagic, codec, entries, func(expireAt time.Time) int64 {
+		return expireAt.UnixNano()
+	})
+}
+
+// entries: the unexpired entries of c in the order the store ranges them.
+// They are collected first so the store is not locked while writing them out
+func (c *Cache) entries() ([]snapshotEntry, error) {
+	var entries []snapshotEntry
+	ok := c.Range(func(key string, value store.Value, expireAt time.Time) bool {
+		entries = append(entries, snapshotEntry{key: key, value: value, expireAt: expireAt})
+		return true
+	})
+	if !ok {
+		return nil, errNotRangeable
+	}
+	return entries, nil
+}
+
+// writeEntries: write entries in the snapshot layout under magic as records
+// of codec, expiry encodes the expiry of entries that have one
+func writeEntries(w io.Writer, magic string, codec RecordCodec, entries []snapshotEntry, expiry func(time.Time) int64) (n int, err error) {
+	sw := &snapshotWriter{w: bufio.NewWriter(w), crc: crc32.New(snapshotTable)}
+	sw.write(appendHeader(nil, magic, codec))
+	var buf []byte
+	for _, e := range entries {
+		var expireAt int64
+		if !e.expireAt.IsZero() {
+			expireAt = expiry(e.expireAt)
+		}
+		rec, ok := newRecord("", e.key, e.value, expireAt)
+		if !ok {
+			continue
+		}
+		if buf, err = codec.AppendRecord(buf[:0], &rec); err != nil {
+			return 0, err
+		}
+		sw.bytes(buf)
+		n++
+	}
+	sw.write([]byte{0})
+	sw.write(binary.BigEndian.AppendUint32(nil, sw.crc.Sum32()))
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	return n, sw.w.Flush()
+}
+
+// snapshotWriter: buffered writer checksumming what it writes, keeping the first error
+type snapshotWriter struct {
+	w   *bufio.Writer
+	crc hash.Hash32
+	err error
+}
+
+// write: write b
+func (sw *snapshotWriter) write(b []byte) {
+	if sw.err != nil {
+		return
+	}
+	sw.crc.Write(b)
+	_, sw.err = sw.w.Write(b)
+}
+
+// bytes: write b prefixed with its length
+func (sw *snapshotWriter) bytes(b []byte) {
+	sw.write(binary.AppendUvarint(nil, uint64(len(b))))
+	sw.write(b)
+}
+
+// readSnapshot: read a snapshot written by writeSnapshot. Nothing is returned
+// unless the whole snapshot checks out, entries expired by now are left out
+func readSnapshot(r io.Reader) ([]snapshotEntry, error) {
+	return readEntries(r, snapshotMagic, func(expiry int64) time.Time {
+		return time.Unix(0, expiry)
+	})
+}
+
+// readEntries: read entries written by writeEntries under magic, or in the
+// layout of format 1, expireAt decodes a nonzero expiry
+func readEntries(r io.Reader, magic string, expireAt func(int64) time.Time) ([]snapshotEntry, error) {
+	sr := &snapshotReader{r: bufio.NewReader(r), crc: crc32.New(snapshotTable)}
+	got := sr.read(len(magic) + 1)
+	if sr.err == nil && (string(got[:len(magic)]) != magic || got[len(magic)] == 0) {
+		return nil, fmt.Errorf("%w: unknown format", ErrSnapshotCorrupt)
+	}
+	var entries []snapshotEntry
+	var err error
+	if sr.err == nil && got[len(magic)] == 1 {
+		entries, err = sr.legacyEntries(expireAt)
+	} else {
+		entries, err = sr.entries(expireAt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sum := sr.crc.Sum32()
+	if checksum := sr.read(4); sr.err == nil && binary.BigEndian.Uint32(checksum) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupt)
+	}
+	if errors.Is(sr.err, io.EOF) || errors.Is(sr.err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("%w: truncated", ErrSnapshotCorrupt)
+	}
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	return entries, nil
+}
+
+// entries: read the header and the records up to the checksum, leaving out
+// entries expired by now and records of other ops
+func (sr *snapshotReader) entries(expireAt func(int64) time.Time) ([]snapshotEntry, error) {
+	header := sr.bytes()
+	if sr.err != nil {
+		return nil, nil
+	}
+	codec, err := parseHeader(header)
+	if errors.Is(err, ErrUnsupportedFormat) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSnapshotCorrupt, err)
+	}
+	var entries []snapshotEntry
+	now := time.Now()
+	for {
+		payload := sr.bytes()
+		if sr.err != nil || len(payload) == 0 {
+			return entries, nil
+		}
+		var rec Record
+		if err := codec.DecodeRecord(payload, &rec); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrSnapshotCorrupt, err)
+		}
+		if rec.Op != RecordSet && rec.Op != RecordCounter {
+			continue
+		}
+		e := snapshotEntry{key: rec.Key, value: rec.value()}
+		if rec.Expiry != 0 {
+			e.expireAt = expireAt(rec.Expiry)
+		}
+		if e.expireAt.IsZero() || e.expireAt.After(now) {
+			entries = append(entries, e)
+		}
+	}
+}
+
+// legacyEntries: read the entries of format 1 up to the checksum, leaving
+// out those expired by now
+func (sr *snapshotReader) legacyEntries(expireAt func(int64) time.Time) ([]snapshotEntry, error) {
+	var entries []snapshotEntry
+	now := time.Now()
+	for sr.err == nil {
+		kind := sr.read(1)
+		if sr.err != nil {
+			break
+		}
+		if kind[0] == snapEnd {
+			break
+		}
+		e := snapshotEntry{key: string(sr.bytes())}
+		switch kind[0] {
+		case snapBytes:
+			e.value = byteViewOf(sr.bytes())
+		case snapCounter:
+			e.value = store.Counter(sr.varint())
+		default:
+			return nil, fmt.Errorf("%w: unknown record %d", ErrSnapshotCorrupt, kind[0])
+		}
+		if expiry := sr.varint(); expiry != 0 {
+			e.expireAt = expireAt(expiry)
+		}
+		if e.expireAt.IsZero() || e.expireAt.After(now) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// snapshotReader: buffered reader checksumming what it reads, keeping the first error
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	err error
+}
+
+// read: read exactly n bytes
+func (sr *snapshotReader) read(n int) []byte {
+	if sr.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	if _, sr.err = io.ReadFull(sr.r, b); sr.err != nil {
+		return nil
+	}
+	sr.crc.Write(b)
+	return b
+}
+
+// bytes: read a length-prefixed byte string
+func (sr *snapshotReader) bytes() []byte {
+	n := sr.uvarint()
+	if sr.err == nil && n > maxSnapshotField {
+		sr.err = fmt.Errorf("%w: length %d", ErrSnapshotCorrupt, n)
+	}
+	return sr.read(int(n))
+}
+
+// uvarint: read a uvarint
+func (sr *snapshotReader) uvarint() uint64 {
+	if sr.err != nil {
+		return 0
+	}
+	var v uint64
+	v, sr.err = binary.ReadUvarint(checksumByteReader{sr})
+	return v
+}
+
+// varint: read a varint
+func (sr *snapshotReader) varint() int64 {
+	if sr.err != nil {
+		return 0
+	}
+	var v int64
+	v, sr.err = binary.ReadVarint(checksumByteReader{sr})
+	return v
+}
+
+// checksumByteReader: io.ByteReader over a snapshotReader, checksumming the bytes read
+type checksumByteReader struct {
+	sr *snapshotReader
+}
+
+// ReadByte: read and checksum one byte
+func (br checksumByteReader) ReadByte() (byte, error) {
+	b, err := br.sr.r.ReadByte()
+	if err == nil {
+		br.sr.crc.Write([]byte{b})
+	}
+	return b, err
+}
+
+// SaveSnapshot: write the group's entries with their expiry to the file at
+// path, replacing it atomically. It returns the number of entries written,
+// values without a byte form are left out
+func (g *Group) SaveSnapshot(path string) (int, error) {
+	return g.saveSnapshot(path, BinaryRecords)
+}
+
+// saveSnapshot: SaveSnapshot with records of codec
+func (g *Group) saveSnapshot(path string, codec RecordCodec) (int, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	n, err := g.cache.writeSnapshot(f, codec)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("rebelcache: snapshot group %q: %w", g.name, err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// RestoreSnapshot: load the entries of the snapshot file at path into the
+// group with their remaining ttl, entries that expired meanwhile are skipped.
+// Nothing is loaded from a corrupt snapshot, see ErrSnapshotCorrupt
+func (g *Group) RestoreSnapshot(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	entries, err := readSnapshot(f)
+	if err != nil {
+		return 0, fmt.Errorf("rebelcache: restore group %q from %s: %w", g.name, path, err)
+	}
+	n := 0
+	for _, e := range entries {
+		// entries without expiration stay so rather than getting the default ttl
+		ttl := NoExpiration
+		if !e.expireAt.IsZero() {
+			if ttl = time.Until(e.expireAt); ttl <= 0 {
+				continue
+			}
+		}
+		if err := g.cache.setWithOrigin(e.key, e.value, ttl, "snapshot"); err != nil {
+			return n, fmt.Errorf("rebelcache: restore group %q: %w", g.name, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// snapshotPath: file of the snapshot of group in dir
+func snapshotPath(dir, group string) string {
+	return filepath.Join(dir, url.PathEscape(group)+".snap")
+}
+
+// snapshotGroups: the groups covered by the server's snapshots
+func (s *Server) snapshotGroups() []*Group {
+	var groups []*Group
+	if len(s.opts.Snapshot.Groups) == 0 {
+		s.groups.Range(func(_, v any) bool {
+			groups = append(groups, v.(*Group))
+			return true
+		})
+		return groups
+	}
+	for _, name := range s.opts.Snapshot.Groups {
+		if g, err := s.getGroup(name); err == nil {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// SaveSnapshots: snapshot the groups of SnapshotOptions now, returning the first failure
+func (s *Server) SaveSnapshots() error {
+	if s.opts.Snapshot == nil {
+		return errors.New("rebelcache: snapshots are not configured")
+	}
+	codec, err := recordCodecNamed(s.opts.Snapshot.Format)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.opts.Snapshot.Dir, 0o755); err != nil {
+		return err
+	}
+	var first error
+	for _, g := range s.snapshotGroups() {
+		if _, err := g.saveSnapshot(snapshotPath(s.opts.Snapshot.Dir, g.name), codec); err != nil {
+			log.Printf("%v", err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// restoreSnapshots: warm the groups from their snapshots, a group without a
+// snapshot starts empty, so does one whose snapshot cannot be read
+func (s *Server) restoreSnapshots() {
+	for _, g := range s.snapshotGroups() {
+		path := snapshotPath(s.opts.Snapshot.Dir, g.name)
+		n, err := g.RestoreSnapshot(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			log.Printf("%v, starting with %d entries", err, n)
+		default:
+			log.Printf("rebelcache: restored %d entries of group %q from %s", n, g.name, path)
+		}
+	}
+}
+
+// snapshotLoop: snapshot the groups every interval until ctx is done, that
+// is the server stops
+func (s *Server) snapshotLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			func() {
+				defer recoverPanic("snapshots", nil)
+				s.SaveSnapshots()
+			}()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package rebelcache
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+const (
+	defaultSoakInterval = 10 * time.Second // between soak checks
+	soakTimeout         = 5 * time.Second  // bound of asking the peers during a check
+	soakClockSlack      = 2 * time.Second  // a store and its ledger may disagree on an expiration by, the lru2 clock is coarse
+	soakShareSlack      = 1e-6             // the ring shares of a segment may sum off 1 by
+	soakReplicaSample   = 32               // keys of a group compared with their owner's copy per check
+)
+
+// SoakOptions: soak-test mode, for long-running tests of a cluster under
+// load. Each node records the writes its groups publish in a ledger of key
+// checksums and expirations, then periodically verifies its stores against
+// it and their own bookkeeping, see store.CheckInvariants. With a Picker it
+// also checks that the rings of the nodes together own every segment once
+// and, with ReplicaCount, that replicas hold their owner's value. Cluster
+// invariants are only reported once they fail two checks in a row, nodes
+// learn of membership changes and copy writes at different times.
+// Writes to a group wait while it is verified, it is not meant for production
+type SoakOptions struct {
+	Interval    time.Duration         // between checks, 0 means 10s
+	Groups      []string              // groups checked, empty checks every served group
+	OnViolation func(v SoakViolation) // called with every violation found, nil logs them
+}
+
+// SoakViolation: an invariant a soak check found broken
+type SoakViolation struct {
+	Group string
+	Key   string // empty for invariants of the whole group
+	// Check: the invariant broken, "store" (the store's bookkeeping),
+	// "unrecorded" (an entry no write published), "checksum", "expiry",
+	// "ownership" (ring shares not summing to 1) or "replica"
+	Check  string
+	Detail string
+}
+
+// String: the violation as a log line
+func (v SoakViolation) String() string {
+	if v.Key == "" {
+		return fmt.Sprintf("group %s: %s: %s", v.Group, v.Check, v.Detail)
+	}
+	return fmt.Sprintf("group %s key %s: %s: %s", v.Group, FormatKey(v.Key), v.Check, v.Detail)
+}
+
+// ledgerEntry: an entry as the last write of its key left it
+type ledgerEntry struct {
+	sum      uint32 // crc32 of the value's bytes
+	opaque   bool   // value without a byte form, only its presence is checked
+	expireAt int64  // unix nanos, 0 if it never expires
+}
+
+// entryOf: the ledger entry of value expiring at expireAt
+func entryOf(value store.Value, expireAt int64) ledgerEntry {
+	b, err := valueBytes(value)
+	if err != nil {
+		return ledgerEntry{opaque: true, expireAt: expireAt}
+	}
+	return ledgerEntry{sum: crc32.ChecksumIEEE(b), expireAt: expireAt}
+}
+
+// unixNanos: t in unix nanos, 0 for the zero time
+func unixNanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// soakLedger: what the entries of a cache should be, per the writes it
+// published. Entries evicted or expired are only forgotten once verified
+type soakLedger struct {
+	mtx     sync.Mutex
+	entries map[string]ledgerEntry
+}
+
+// record: apply a published write
+func (l *soakLedger) record(ev keyEvent) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	switch ev.kind {
+	case eventSet:
+		var expireAt int64
+		if ev.ttl > 0 {
+			expireAt = time.Now().Add(ev.ttl).UnixNano()
+		}
+		l.entries[ev.key] = entryOf(ev.value, expireAt)
+	case eventDelete:
+		delete(l.entries, ev.key)
+	case eventClear:
+		clear(l.entries)
+	}
+}
+
+// attachLedger: record the cache's writes from now on in a ledger seeded with
+// its entries, nil if its store cannot be ranged over
+func (c *Cache) attachLedger() *soakLedger {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	defer c.feed.lockAll()()
+	l := &soakLedger{entries: make(map[string]ledgerEntry)}
+	if c.store != nil {
+		r, ok := c.store.(store.Ranger)
+		if !ok {
+			return nil
+		}
+		r.Range(func(key string, value store.Value, expireAt time.Time) bool {
+			l.entries[key] = entryOf(unwrapValue(value), unixNanos(expireAt))
+			return true
+		})
+	}
+	c.feed.ledger.Store(l)
+	return l
+}
+
+// verifyLedger: check the store's bookkeeping and compare its entries with l
+// while writes wait, entries of l the store no longer holds were evicted or
+// expired and are forgotten. Returns the violations found, without their
+// group, and the entries of the store by key
+func (c *Cache) verifyLedger(l *soakLedger) ([]SoakViolation, map[string]ledgerEntry) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if c.store == nil {
+		return nil, nil
+	}
+	defer c.feed.lockAll()()
+	var found []SoakViolation
+	if err := store.CheckInvariants(c.store); err != nil {
+		found = append(found, SoakViolation{Check: "store", Detail: err.Error()})
+	}
+	r, ok := c.store.(store.Ranger)
+	if !ok {
+		return found, nil
+	}
+	entries := make(map[string]ledgerEntry)
+	r.Range(func(key string, value store.Value, expireAt time.Time) bool {
+		entries[key] = entryOf(unwrapValue(value), unixNanos(expireAt))
+		return true
+	})
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	for key := range l.entries {
+		if _, ok := entries[key]; !ok {
+			delete(l.entries, key)
+		}
+	}
+	for key, got := range entries {
+		want, ok := l.entries[key]
+		switch {
+		case !ok:
+			found = append(found, SoakViolation{Key: key, Check: "unrecorded", Detail: "held without a write publishing it"})
+		case got.opaque != want.opaque || got.sum != want.sum:
+			found = append(found, SoakViolation{Key: key, Check: "checksum",
+				Detail: fmt.Sprintf("value crc32 %08x, last written %08x", got.sum, want.sum)})
+		case (got.expireAt == 0) != (want.expireAt == 0) || time.Duration(abs(got.expireAt-want.expireAt)) > soakClockSlack:
+			found = append(found, SoakViolation{Key: key, Check: "expiry",
+				Detail: fmt.Sprintf("expires at %s, last written to expire at %s", formatUnixNanos(got.expireAt), formatUnixNanos(want.expireAt))})
+		}
+	}
+	return found, entries
+}
+
+// abs: absolute value of n
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// formatUnixNanos: an expiration for violations, "never" for 0
+func formatUnixNanos(n int64) string {
+	if n == 0 {
+		return "never"
+	}
+	return time.Unix(0, n).Format(time.RFC3339Nano)
+}
+
+// soakChecker: state of a server's soak checks, only touched by its soak loop
+type soakChecker struct {
+	opts    SoakOptions
+	ledgers map[*Group]*soakLedger // checked groups, nil for those that cannot be
+	// suspects: cluster invariants that failed the last check, by group, check and key
+	suspects   map[string]SoakViolation
+	violations atomic.Int64
+}
+
+// newSoakChecker: checker of opts, nil if soak testing is off
+func newSoakChecker(opts *SoakOptions) *soakChecker {
+	if opts == nil {
+		return nil
+	}
+	return &soakChecker{opts: *opts, ledgers: make(map[*Group]*soakLedger), suspects: make(map[string]SoakViolation)}
+}
+
+// report: count v and hand it to OnViolation
+func (k *soakChecker) report(v SoakViolation) {
+	k.violations.Add(1)
+	if k.opts.OnViolation != nil {
+		k.opts.OnViolation(v)
+		return
+	}
+	log.Printf("rebelcache: soak check: %s", v)
+}
+
+// SoakViolations: number of violations the soak checks found so far, 0 if
+// soak testing is off, see SoakOptions
+func (s *Server) SoakViolations() int64 {
+	if s.soak == nil {
+		return 0
+	}
+	return s.soak.violations.Load()
+}
+
+// soakLoop: run the soak checks every interval until ctx is done
+func (s *Server) soakLoop(ctx context.Context) error {
+	interval := s.soak.opts.Interval
+	if interval <= 0 {
+		interval = defaultSoakInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.soakCheck(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// soakCheck: verify every checked group once. Groups seen for the first time
+// get their ledger and are verified from the next check on
+func (s *Server) soakCheck(ctx context.Context) {
+	k := s.soak
+	suspects := make(map[string]SoakViolation)
+	s.groups.Range(func(name, value any) bool {
+		if len(k.opts.Groups) > 0 && !slices.Contains(k.opts.Groups, name.(string)) {
+			return true
+		}
+		g := value.(*Group)
+		ledger, ok := k.ledgers[g]
+		if !ok {
+			if k.ledgers[g] = g.cache.attachLedger(); k.ledgers[g] == nil {
+				log.Printf("rebelcache: soak check: group %s cannot be verified, its store cannot be ranged over", g.name)
+			}
+			return true
+		}
+		if ledger == nil {
+			return true
+		}
+		found, entries := g.cache.verifyLedger(ledger)
+		for _, v := range found {
+			v.Group = g.name
+			k.report(v)
+		}
+		if s.opts.Picker == nil || ctx.Err() != nil {
+			return true
+		}
+		// divergent replicas found last time are checked again first
+		var recheck []string
+		for _, v := range k.suspects {
+			if v.Group == g.name && v.Check == "replica" {
+				recheck = append(recheck, v.Key)
+			}
+		}
+		cctx, cancel := context.WithTimeout(ctx, soakTimeout)
+		defer cancel()
+		for _, v := range append(s.soakOwnership(cctx, g), g.soakReplicas(cctx, entries, recheck)...) {
+			v.Group = g.name
+			id := v.Group + "\x00" + v.Check + "\x00" + v.Key
+			if _, ok := k.suspects[id]; ok {
+				k.report(v)
+			}
+			suspects[id] = v
+		}
+		return true
+	})
+	k.suspects = suspects
+}
+
+// soakOwnership: the segments of the ring the nodes of the Picker don't own
+// exactly once between them, nil if a node cannot tell
+func (s *Server) soakOwnership(ctx context.Context, g *Group) []SoakViolation {
+	own, err := g.ownership(defaultSegments)
+	if err != nil {
+		return nil
+	}
+	sums := make([]float64, defaultSegments)
+	for i, seg := range own.Segments {
+		sums[i] += seg.RingShare
+	}
+	peers := s.opts.Picker.peerClients()
+	for _, c := range peers {
+		report, err := c.Ownership(ctx, g.name, defaultSegments)
+		if err != nil || len(report.Segments) != defaultSegments {
+			return nil
+		}
+		for i, seg := range report.Segments {
+			sums[i] += seg.RingShare
+		}
+	}
+	var found []SoakViolation
+	for i, sum := range sums {
+		if math.Abs(sum-1) > soakShareSlack {
+			found = append(found, SoakViolation{Check: "ownership",
+				Detail: fmt.Sprintf("segment %08x owned %.3f times over by %d nodes", own.Segments[i].Start, sum, 1+len(peers))})
+		}
+	}
+	return found
+}
+
+// soakReplicas: the keys among entries this node replicates whose owner
+// caches another value, recheck first then a sample of the others. Keys the
+// owner doesn't cache or cannot be asked about are skipped
+func (g *Group) soakReplicas(ctx context.Context, entries map[string]ledgerEntry, recheck []string) []SoakViolation {
+	var found []SoakViolation
+	checked := 0
+	check := func(key string) {
+		local, ok := entries[key]
+		if !ok || local.opaque {
+			return
+		}
+		set := g.replicaSet(key)
+		if len(set) < 2 || set[0] == nil || !slices.Contains(set[1:], nil) {
+			return
+		}
+		checked++
+		b, _, err := set[0].get(withForwarded(ctx), &pb.GetRequest{Group: g.name, Key: []byte(key), Cached: true})
+		if err != nil {
+			return
+		}
+		if sum := crc32.ChecksumIEEE(b); sum != local.sum {
+			found = append(found, SoakViolation{Key: key, Check: "replica",
+				Detail: fmt.Sprintf("value crc32 %08x, owner %s has %08x", local.sum, set[0].Addr(), sum)})
+		}
+	}
+	for _, key := range recheck {
+		check(key)
+		delete(entries, key)
+	}
+	for key := range entries {
+		if checked >= soakReplicaSample || ctx.Err() != nil {
+			break
+		}
+		check(key)
+	}
+	return found
+}
+
+// peerClients: clients of the peers by addr
+func (p *ClientPicker) peerClients() map[string]*Client {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	return maps.Clone(p.clients)
+}
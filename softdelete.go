@@ -0,0 +1,132 @@
+package rebelcache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+// shadowEntry: a soft-deleted entry waiting for Undelete
+type shadowEntry struct {
+	key      string
+	value    store.Value // the value as stored, provenance included
+	deadline time.Time   // Undelete fails after this
+	size     int64
+}
+
+// shadowArea: soft-deleted entries, oldest first, bounded by their own byte budget
+type shadowArea struct {
+	mtx      sync.Mutex
+	window   time.Duration            // how long deleted entries stay restorable
+	maxBytes int64                    // budget of the area
+	nbytes   int64                    // bytes held
+	ll       *list.List               // entries in deletion order
+	items    map[string]*list.Element // key -> entry
+}
+
+// newShadowArea: create a shadow area, nil if window <= 0 disables soft delete
+func newShadowArea(window time.Duration, maxBytes int64) *shadowArea {
+	if window <= 0 {
+		return nil
+	}
+	return &shadowArea{
+		window:   window,
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// put: keep a deleted entry, dropping the oldest ones over budget;
+// an entry larger than the whole budget is not kept
+func (a *shadowArea) put(key string, value store.Value) {
+	size := int64(len(key) + value.Len())
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	now := time.Now()
+	a.purge(now)
+	if elem, ok := a.items[key]; ok {
+		a.remove(elem)
+	}
+	if a.maxBytes > 0 && size > a.maxBytes {
+		return
+	}
+	a.items[key] = a.ll.PushBack(&shadowEntry{key: key, value: value, deadline: now.Add(a.window), size: size})
+	a.nbytes += size
+	for a.maxBytes > 0 && a.nbytes > a.maxBytes {
+		a.remove(a.ll.Front())
+	}
+}
+
+// take: remove and return the deleted entry of key if still restorable
+func (a *shadowArea) take(key string) (store.Value, bool) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.purge(time.Now())
+	elem, ok := a.items[key]
+	if !ok {
+		return nil, false
+	}
+	a.remove(elem)
+	return elem.Value.(*shadowEntry).value, true
+}
+
+// len: number of restorable entries
+func (a *shadowArea) len() int {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.purge(time.Now())
+	return a.ll.Len()
+}
+
+// clear: forget all deleted entries
+func (a *shadowArea) clear() {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.ll.Init()
+	clear(a.items)
+	a.nbytes = 0
+}
+
+// purge: drop entries whose window has passed, the list is ordered by deadline
+// Note: lock must be held before calling this function.
+func (a *shadowArea) purge(now time.Time) {
+	for elem := a.ll.Front(); elem != nil && !now.Before(elem.Value.(*shadowEntry).deadline); elem = a.ll.Front() {
+		a.remove(elem)
+	}
+}
+
+// remove: drop one entry
+// Note: lock must be held before calling this function.
+func (a *shadowArea) remove(elem *list.Element) {
+	entry := a.ll.Remove(elem).(*shadowEntry)
+	delete(a.items, entry.key)
+	a.nbytes -= entry.size
+}
+
+// Undelete: restore a key deleted within the SoftDeleteWindow, it fails if
+// the key has been set again since. The entry gets the ttl a new Set would get
+func (c *Cache) Undelete(key string) bool {
+	if c.shadow == nil {
+		return false
+	}
+	var restored bool
+	err := c.write(key, func(s store.Store, key string) error {
+		value, ok := c.shadow.take(key)
+		if !ok {
+			return nil
+		}
+		ttl := c.boundTTL(0)
+		var err error
+		restored, err = s.SetNX(key, value, ttl)
+		if restored {
+			c.feed.publish(setEvent(key, unwrapValue(value), ttl))
+		}
+		return err
+	})
+	return err == nil && restored
+}
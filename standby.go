@@ -0,0 +1,251 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/pb"
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+)
+
+// defaultFollowRetry: wait before resubscribing to a primary node
+const defaultFollowRetry = time.Second
+
+// FollowerOptions: options of a Follower
+type FollowerOptions struct {
+	Primary     ServiceName       // primary cluster, its nodes are discovered in Etcd
+	Etcd        EtcdOptions       // etcd of the primary cluster
+	Addrs       []string          // primary nodes to follow instead of discovering them
+	Groups      []string          // groups to copy, each must exist on both sides
+	DialOptions []grpc.DialOption // extra options when dialing primary nodes
+	// Picker: ring of the standby cluster, keys owned by another standby node
+	// are left to that node, nil copies every key
+	Picker PeerPicker
+	// RetryInterval: wait before resubscribing to a primary node, 0 means 1s
+	RetryInterval time.Duration
+}
+
+// Follower: keeps the local groups of a standby node a warm copy of a primary
+// cluster by applying the writes streamed by every primary node, see
+// Server.Watch. Failing over is a matter of pointing clients at the standby.
+//
+// The copy only holds what was written since it started following. Writes
+// missed while a stream was broken cannot be told apart, so the followed
+// groups are cleared when a stream breaks and warm up again from then on.
+// The standby should run read-only so that clients cannot make it diverge,
+// the follower writes regardless
+type Follower struct {
+	opts      FollowerOptions
+	mtx       sync.Mutex
+	streams   map[string]context.CancelFunc // primary addr -> stop its stream
+	loops     *supervisor                   // streams of the primary nodes, see Loops
+	discovery *Discovery
+	etcdCli   *clientv3.Client
+}
+
+// NewFollower: create a follower of the nodes in opts.Addrs, or of the nodes of opts.Primary
+func NewFollower(opts FollowerOptions) (*Follower, error) {
+	if len(opts.Groups) == 0 {
+		return nil, errors.New("rebelcache: follower without groups")
+	}
+	if len(opts.Addrs) == 0 {
+		if err := opts.Primary.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = defaultFollowRetry
+	}
+	return &Follower{opts: opts, streams: make(map[string]context.CancelFunc)}, nil
+}
+
+// Start: start following the primary nodes until Stop
+func (f *Follower) Start(ctx context.Context) error {
+	f.mtx.Lock()
+	f.loops = newSupervisor(context.WithoutCancel(ctx))
+	f.mtx.Unlock()
+	if len(f.opts.Addrs) > 0 {
+		f.follow(f.opts.Addrs)
+		return nil
+	}
+
+	cli, err := newEtcdClient(f.opts.Etcd)
+	if err != nil {
+		return fmt.Errorf("rebelcache: connect etcd: %w", err)
+	}
+	d := NewDiscovery(cli, f.opts.Primary, f.follow)
+	if err := d.Start(ctx); err != nil {
+		cli.Close()
+		return err
+	}
+	f.mtx.Lock()
+	f.discovery, f.etcdCli = d, cli
+	f.mtx.Unlock()
+	return nil
+}
+
+// Stop: stop following, the copy stays as it is
+func (f *Follower) Stop() {
+	f.mtx.Lock()
+	d, cli := f.discovery, f.etcdCli
+	f.discovery, f.etcdCli = nil, nil
+	loops := f.loops
+	if loops != nil {
+		// under the lock, so follow starts no stream after it
+		loops.cancel()
+	}
+	f.mtx.Unlock()
+	if d != nil {
+		d.Stop()
+		cli.Close()
+	}
+	if loops != nil {
+		loops.Stop()
+	}
+}
+
+// Loops: status of the streams from the primary nodes
+func (f *Follower) Loops() []LoopStatus {
+	f.mtx.Lock()
+	loops := f.loops
+	f.mtx.Unlock()
+	if loops == nil {
+		return nil
+	}
+	return loops.Status()
+}
+
+// follow: stream from exactly the nodes at addrs
+func (f *Follower) follow(addrs []string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.loops.stopped() {
+		return
+	}
+
+	live := make(map[string]struct{}, len(addrs))
+	for _, addr := range addrs {
+		live[addr] = struct{}{}
+		if _, ok := f.streams[addr]; ok {
+			continue
+		}
+		f.streams[addr] = f.loops.Go("follow "+addr, RestartOnFailure, func(ctx context.Context) error {
+			return f.run(ctx, addr)
+		})
+	}
+	for addr, cancel := range f.streams {
+		if _, ok := live[addr]; !ok {
+			cancel()
+			delete(f.streams, addr)
+		}
+	}
+}
+
+// run: follow the node at addr until ctx is done, resubscribing after failures.
+// Failing to dial it is returned, so the supervisor retries later
+func (f *Follower) run(ctx context.Context, addr string) error {
+	c, err := NewClient(addr, ServiceName{}, &ClientOptions{DialOptions: f.opts.DialOptions})
+	if err != nil {
+		return fmt.Errorf("rebelcache: follow %s: %w", addr, err)
+	}
+	defer c.Close()
+
+	for {
+		subscribed, err := f.stream(ctx, c)
+		if ctx.Err() != nil {
+			return nil
+		}
+		switch {
+		case errors.Is(err, io.EOF):
+			// the node stopped and sent everything it had
+		case subscribed:
+			log.Printf("rebelcache: follow %s: %v, clearing the copy", addr, err)
+			f.clear()
+		default:
+			log.Printf("rebelcache: follow %s: %v", addr, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(f.opts.RetryInterval):
+		}
+	}
+}
+
+// stream: apply the events of one Watch stream until it ends, subscribed
+// reports whether the node had subscribed us, so events may have been missed
+func (f *Follower) stream(ctx context.Context, c *Client) (subscribed bool, err error) {
+	stream, err := c.grpcCli.Watch(ctx, &pb.WatchRequest{Groups: f.opts.Groups})
+	if err != nil {
+		return false, err
+	}
+	if _, err := stream.Header(); err != nil {
+		return false, err
+	}
+	for {
+		ev, err := stream.Recv()
+		if err != nil {
+			return true, err
+		}
+		if err := f.apply(ev); err != nil {
+			return true, err
+		}
+	}
+}
+
+// apply: replay ev on the local group, a panic replaying it becomes the error
+func (f *Follower) apply(ev *pb.KeyEvent) (err error) {
+	defer recoverPanic("follower", &err)
+	g := GetGroup(ev.GetGroup())
+	if g == nil {
+		return nil
+	}
+	key := string(ev.GetKey())
+	if ev.GetType() != pb.KeyEvent_CLEAR && f.opts.Picker != nil {
+		if _, remote := f.opts.Picker.PickPeer(key); remote {
+			return nil
+		}
+	}
+
+	switch ev.GetType() {
+	case pb.KeyEvent_SET:
+		var value store.Value = byteViewOf(ev.GetValue())
+		if ev.GetCounter() {
+			n, err := strconv.ParseInt(string(ev.GetValue()), 10, 64)
+			if err != nil {
+				return nil
+			}
+			value = store.Counter(n)
+		}
+		// writes without a ttl never expire on the primary
+		ttl := NoExpiration
+		if ev.Ttl != nil {
+			ttl = ev.GetTtl().AsDuration()
+		}
+		if err := g.cache.setWithOrigin(key, value, ttl, "standby"); err != nil {
+			log.Printf("rebelcache: copy %s: %v", FormatKey(key), err)
+		}
+	case pb.KeyEvent_DELETE:
+		g.cache.Delete(key)
+	case pb.KeyEvent_CLEAR:
+		g.cache.Clear()
+	}
+	return nil
+}
+
+// clear: drop the copy of every followed group
+func (f *Follower) clear() {
+	for _, name := range f.opts.Groups {
+		if g := GetGroup(name); g != nil {
+			g.cache.Clear()
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package rebelcache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// staticReloadInterval: how often a static peer list file is checked for changes
+const staticReloadInterval = 5 * time.Second
+
+// StaticOptions: membership from a fixed list of peers with DiscoveryStatic,
+// for small fixed clusters and tests without etcd. Every node must be given
+// the same list, the node's own addr included, for the nodes to agree on the
+// owners of the keys. Nodes down stay on the ring, their keys are loaded
+// locally by the nodes that can't reach them
+type StaticOptions struct {
+	Peers []string // grpc addrs of the nodes, see ParsePeerList
+	// File: file listing the addrs of the nodes instead of Peers, one per
+	// line, see LoadPeerList. It is read again when it changes, so nodes can
+	// be added or removed by editing the file on every node
+	File string
+}
+
+// ParsePeerList: the addrs of a comma or space separated list, as passed in
+// a flag, sorted and without duplicates
+func ParsePeerList(s string) ([]string, error) {
+	return peerList(strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }))
+}
+
+// LoadPeerList: the addrs listed in the file at path, one per line, blank
+// lines and comments after # skipped, sorted and without duplicates
+func LoadPeerList(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("rebelcache: read peer list: %w", err)
+	}
+	return parsePeerFile(path, data)
+}
+
+// parsePeerFile: the addrs listed in data, the content of the file at path
+func parsePeerFile(path string, data []byte) ([]string, error) {
+	var addrs []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			addrs = append(addrs, line)
+		}
+	}
+	peers, err := peerList(addrs)
+	if err != nil {
+		return nil, fmt.Errorf("%w in %s", err, path)
+	}
+	return peers, nil
+}
+
+// peerList: addrs checked, sorted and without duplicates
+func peerList(addrs []string) ([]string, error) {
+	for _, addr := range addrs {
+		if host, port, err := net.SplitHostPort(addr); err != nil || host == "" || port == "" {
+			return nil, fmt.Errorf("rebelcache: invalid peer addr %q", addr)
+		}
+	}
+	addrs = slices.Clone(addrs)
+	slices.Sort(addrs)
+	return slices.Compact(addrs), nil
+}
+
+// staticPeers: the peers the options list, read from File if set
+func (o StaticOptions) staticPeers() ([]string, error) {
+	if o.File != "" {
+		return LoadPeerList(o.File)
+	}
+	if len(o.Peers) == 0 {
+		return nil, fmt.Errorf("rebelcache: static discovery without peers")
+	}
+	return peerList(o.Peers)
+}
+
+// setStaticPeers: put peers on the Picker's ring, refusing a list without
+// the node at addr, which the other nodes would never route its keys to
+func (s *Server) setStaticPeers(addr string, peers []string) error {
+	if !slices.Contains(peers, addr) {
+		return fmt.Errorf("rebelcache: node %s is not in its static peer list %v", addr, peers)
+	}
+	s.opts.Picker.Set(peers...)
+	return nil
+}
+
+// staticReloadLoop: follow the changes of the static peer list file until
+// ctx ends, a list that can't be used keeps the current peers
+func (s *Server) staticReloadLoop(ctx context.Context, addr string) error {
+	path := s.opts.Static.File
+	last, _ := os.ReadFile(path)
+	ticker := time.NewTicker(staticReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || bytes.Equal(data, last) {
+			continue
+		}
+		last = data
+		peers, err := parsePeerFile(path, data)
+		if err == nil {
+			err = s.setStaticPeers(addr, peers)
+		}
+		if err != nil {
+			log.Printf("rebelcache: reload static peers: %v", err)
+			continue
+		}
+		log.Printf("rebelcache: static peers now %v", peers)
+	}
+}
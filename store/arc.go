@@ -0,0 +1,617 @@
+package store
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// arc list identifiers
+const (
+	arcT1 = iota // live entries seen once recently
+	arcT2        // live entries seen at least twice recently
+	arcB1        // ghosts evicted from T1
+	arcB2        // ghosts evicted from T2
+)
+
+// arcCache implements the Adaptive Replacement Cache policy, measured in bytes.
+// T1 and T2 hold live entries, B1 and B2 remember the keys recently evicted from
+// them; a write to a ghost key shifts the target size p of T1 towards the list
+// that would have kept it, so the cache adapts between recency and frequency.
+// It is safe for concurrent access by multiple goroutines.
+type arcCache struct {
+	mtx             sync.Mutex                                           // mutex to protect the cache, every access may move entries
+	lists           [4]*list.List                                        // T1, T2, B1, B2, front is the most recently used
+	sizes           [4]int64                                             // bytes accounted to each list
+	items           map[string]*list.Element                             // map of keys to elements in any of the lists
+	p               int64                                                // target bytes of T1
+	maxBytes        int64                                                // maximum bytes of live entries, 0 or negative means no limit
+	onEvicted       func(key string, value Value, reason EvictionReason) // callback function when an item is evicted
+	stopEvictions   func()                                               // stops the dispatch of eviction callbacks, see Options.EvictionQueue
+	cleanupInterval time.Duration                                        // interval for running cleanup operations
+	cleanupTicker   *time.Ticker                                         // ticker for periodic cleanup
+	closeCh         chan struct{}                                        // channel to signal cleanup goroutine to stop
+	cleanupDone     sync.WaitGroup                                       // joins the cleanup goroutine on Close
+	onPanic         func(err *PanicError)                                // handler of panics in the cleanup loop, see Options.OnPanic
+	removalCounts
+	immortalCounts
+}
+
+// arcEntry represents a live or ghost entry in the ARC cache.
+type arcEntry struct {
+	key      string    // the key of the cache entry
+	value    Value     // the value of the cache entry, nil for ghosts
+	size     int64     // bytes of key and value when the entry was live
+	expireAt time.Time // expiration time, zero for no expiration
+	version  uint64    // version of the entry, renewed on every write
+	where    int       // list the entry belongs to
+}
+
+// newARCCache creates a new ARC cache with the given options.
+//
+// Parameters:
+//   - opts: Options containing cache configuration such as max bytes, cleanup interval, and eviction callback
+//
+// Returns:
+//   - *arcCache: A pointer to the newly created ARC cache
+func newARCCache(opts Options) *arcCache {
+	cleanup := opts.CleanupInterval
+	if cleanup <= 0 {
+		cleanup = time.Minute
+	}
+	c := &arcCache{
+		items:           make(map[string]*list.Element),
+		maxBytes:        opts.MaxBytes,
+		cleanupInterval: cleanup,
+		closeCh:         make(chan struct{}),
+		onPanic:         opts.OnPanic,
+	}
+	c.onEvicted, c.stopEvictions = opts.evictionHook()
+	for i := range c.lists {
+		c.lists[i] = list.New()
+	}
+	c.cleanupTicker = time.NewTicker(c.cleanupInterval)
+	c.cleanupDone.Go(c.cleanupLoop)
+	return c
+}
+
+// Get retrieves the value associated with the given key; a hit moves the entry to T2.
+//
+// Parameters:
+//   - key: The key to look up in the cache
+//
+// Returns:
+//   - Value: The value associated with the key, or nil if not found or expired
+//   - bool: True if the key was found and not expired, false otherwise
+func (c *arcCache) Get(key string) (Value, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	c.move(elem, arcT2)
+	return elem.Value.(*arcEntry).value, true
+}
+
+// TTL returns the remaining time to live of the given key without counting as an access.
+//
+// Parameters:
+//   - key: The key to look up
+//
+// Returns:
+//   - time.Duration: The remaining time to live, or 0 if the key never expires
+//   - bool: True if the key was found and not expired, false otherwise
+func (c *arcCache) TTL(key string) (time.Duration, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.lookup(key)
+	if !ok {
+		return 0, false
+	}
+	if entry := elem.Value.(*arcEntry); !entry.expireAt.IsZero() {
+		return time.Until(entry.expireAt), true
+	}
+	return 0, true
+}
+
+// GetWithVersion retrieves the value and version associated with the given key.
+//
+// Parameters:
+//   - key: The key to look up in the cache
+//
+// Returns:
+//   - Value: The value associated with the key, or nil if not found or expired
+//   - uint64: The version of the entry, or 0 if not found
+//   - bool: True if the key was found and not expired, false otherwise
+func (c *arcCache) GetWithVersion(key string) (Value, uint64, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.lookup(key)
+	if !ok {
+		return nil, 0, false
+	}
+	c.move(elem, arcT2)
+	entry := elem.Value.(*arcEntry)
+	return entry.value, entry.version, true
+}
+
+// lookup returns the element of an unexpired live key, removing it if it has expired.
+// Ghosts are not found.
+// Note: lock must be held before calling this function.
+func (c *arcCache) lookup(key string) (*list.Element, bool) {
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*arcEntry)
+	if entry.where == arcB1 || entry.where == arcB2 {
+		return nil, false
+	}
+	if !entry.expireAt.IsZero() && time.Now().After(entry.expireAt) {
+		c.expirations.Add(1)
+		c.removeElement(elem, EvictExpired)
+		return nil, false
+	}
+	return elem, true
+}
+
+// Set stores a key-value pair in the cache with no expiration.
+//
+// Parameters:
+//   - key: The key to store
+//   - value: The value to store
+//
+// Returns:
+//   - error: Any error encountered during the operation
+func (c *arcCache) Set(key string, value Value) error {
+	return c.SetWithExpiration(key, value, 0)
+}
+
+// SetWithExpiration stores a key-value pair in the cache with an optional expiration duration.
+//
+// Parameters:
+//   - key: The key to store
+//   - value: The value to store
+//   - expiration: The duration after which the item expires (0 for no expiration)
+//
+// Returns:
+//   - error: Any error encountered during the operation
+func (c *arcCache) SetWithExpiration(key string, value Value, expiration time.Duration) error {
+	if value == nil {
+		c.Delete(key)
+		return nil
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var expireAt time.Time
+	if expiration > 0 {
+		expireAt = time.Now().Add(expiration)
+	}
+	c.set(key, value, expireAt)
+	return nil
+}
+
+// set stores a key-value pair expiring at expireAt (zero for no expiration).
+// Note: lock must be held before calling this function.
+func (c *arcCache) set(key string, value Value, expireAt time.Time) {
+	size := int64(len(key) + value.Len())
+
+	elem, ok := c.items[key]
+	if !ok {
+		// complete miss: make room in the directory and admit into T1
+		c.trimGhosts()
+		entry := &arcEntry{key: key, value: value, size: size, expireAt: expireAt, version: nextVersion(), where: arcT1}
+		c.items[key] = c.lists[arcT1].PushFront(entry)
+		c.sizes[arcT1] += size
+		c.addImmortal(expireAt.IsZero(), size)
+		c.replace(false)
+		return
+	}
+
+	entry := elem.Value.(*arcEntry)
+	switch entry.where {
+	case arcB1:
+		// recency ghost hit: grow T1
+		c.p = min(c.p+max(c.sizes[arcB2]/max(c.sizes[arcB1], 1), 1)*size, c.maxBytes)
+	case arcB2:
+		// frequency ghost hit: shrink T1
+		c.p = max(c.p-max(c.sizes[arcB1]/max(c.sizes[arcB2], 1), 1)*size, 0)
+	}
+	inB2 := entry.where == arcB2
+	if entry.value != nil {
+		c.removeImmortal(entry.expireAt.IsZero(), entry.size)
+	}
+	c.sizes[entry.where] -= entry.size
+	entry.value, entry.size, entry.expireAt, entry.version = value, size, expireAt, nextVersion()
+	c.sizes[entry.where] += entry.size
+	c.addImmortal(expireAt.IsZero(), size)
+	c.move(elem, arcT2)
+	c.replace(inB2)
+}
+
+// SetNX stores a key-value pair only if the key is absent.
+//
+// Parameters:
+//   - key: The key to store
+//   - value: The value to store
+//   - expiration: The duration after which the item expires (0 for no expiration)
+//
+// Returns:
+//   - bool: True if the value was stored
+//   - error: ErrNilValue if value is nil
+func (c *arcCache) SetNX(key string, value Value, expiration time.Duration) (bool, error) {
+	return c.setIf(key, value, expiration, ifAbsent)
+}
+
+// SetXX stores a key-value pair only if the key is present.
+//
+// Parameters:
+//   - key: The key to store
+//   - value: The value to store
+//   - expiration: The duration after which the item expires (0 for no expiration)
+//
+// Returns:
+//   - bool: True if the value was stored
+//   - error: ErrNilValue if value is nil
+func (c *arcCache) SetXX(key string, value Value, expiration time.Duration) (bool, error) {
+	return c.setIf(key, value, expiration, ifPresent)
+}
+
+// CompareAndSwap stores a key-value pair only if the entry's current version equals version.
+//
+// Parameters:
+//   - key: The key to store
+//   - version: The expected version, 0 means the key must be absent
+//   - value: The value to store
+//   - expiration: The duration after which the item expires (0 for no expiration)
+//
+// Returns:
+//   - bool: True if the value was stored
+//   - error: ErrNilValue if value is nil
+func (c *arcCache) CompareAndSwap(key string, version uint64, value Value, expiration time.Duration) (bool, error) {
+	return c.setIf(key, value, expiration, ifVersion(version))
+}
+
+// setIf stores a key-value pair if cond holds for the current entry.
+func (c *arcCache) setIf(key string, value Value, expiration time.Duration, cond func(found bool, version uint64) bool) (bool, error) {
+	if value == nil {
+		return false, ErrNilValue
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var version uint64
+	elem, found := c.lookup(key)
+	if found {
+		version = elem.Value.(*arcEntry).version
+	}
+	if !cond(found, version) {
+		return false, nil
+	}
+	var expireAt time.Time
+	if expiration > 0 {
+		expireAt = time.Now().Add(expiration)
+	}
+	c.set(key, value, expireAt)
+	return true, nil
+}
+
+// Incr atomically adds delta to the counter stored at key, creating it from 0 if absent.
+// The remaining TTL of an existing counter is preserved.
+//
+// Parameters:
+//   - key: The key of the counter
+//   - delta: The amount to add
+//
+// Returns:
+//   - int64: The new counter value
+//   - error: ErrNotCounter if the key holds a non-counter value
+func (c *arcCache) Incr(key string, delta int64) (int64, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var cur Value
+	var expireAt time.Time
+	if elem, ok := c.lookup(key); ok {
+		entry := elem.Value.(*arcEntry)
+		cur, expireAt = entry.value, entry.expireAt
+	}
+	n, err := incrValue(cur, delta)
+	if err != nil {
+		return 0, err
+	}
+	c.set(key, n, expireAt)
+	return int64(n), nil
+}
+
+// Decr atomically subtracts delta from the counter stored at key.
+//
+// Parameters:
+//   - key: The key of the counter
+//   - delta: The amount to subtract
+//
+// Returns:
+//   - int64: The new counter value
+//   - error: ErrNotCounter if the key holds a non-counter value
+func (c *arcCache) Decr(key string, delta int64) (int64, error) {
+	return c.Incr(key, -delta)
+}
+
+// Delete removes the item with the given key from the cache.
+//
+// Parameters:
+//   - key: The key of the item to delete
+//
+// Returns:
+//   - bool: True if a live item was found and deleted, false otherwise
+func (c *arcCache) Delete(key string) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return false
+	}
+	where := elem.Value.(*arcEntry).where
+	c.removeElement(elem, EvictDeleted)
+	return where == arcT1 || where == arcT2
+}
+
+// Clear removes all items and ghosts from the cache.
+func (c *arcCache) Clear() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.onEvicted != nil {
+		for _, l := range c.lists[arcT1 : arcT2+1] {
+			for elem := l.Front(); elem != nil; elem = elem.Next() {
+				entry := elem.Value.(*arcEntry)
+				c.onEvicted(entry.key, entry.value, EvictCleared)
+			}
+		}
+	}
+	for i := range c.lists {
+		c.lists[i].Init()
+		c.sizes[i] = 0
+	}
+	c.items = make(map[string]*list.Element)
+	c.p = 0
+	c.resetImmortal()
+}
+
+// Len returns the number of live items currently in the cache.
+//
+// Returns:
+//   - int: The number of items in the cache
+func (c *arcCache) Len() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.lists[arcT1].Len() + c.lists[arcT2].Len()
+}
+
+// Range calls fn for each unexpired live entry until fn returns false, ghosts are skipped.
+//
+// Parameters:
+//   - fn: called with the key, value and expiration time (zero for no expiration) of each entry
+func (c *arcCache) Range(fn func(key string, value Value, expireAt time.Time) bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	now := time.Now()
+	for _, l := range c.lists[arcT1 : arcT2+1] {
+		for elem := l.Front(); elem != nil; elem = elem.Next() {
+			entry := elem.Value.(*arcEntry)
+			if !entry.expireAt.IsZero() && !now.Before(entry.expireAt) {
+				continue
+			}
+			if !fn(entry.key, entry.value, entry.expireAt) {
+				return
+			}
+		}
+	}
+}
+
+// Close stops the cleanup goroutine, waiting for it to return, and closes the cache.
+func (c *arcCache) Close() {
+	if c.cleanupTicker != nil {
+		c.cleanupTicker.Stop()
+		close(c.closeCh)
+		c.cleanupDone.Wait()
+	}
+	c.stopEvictions()
+}
+
+// UsedBytes returns the number of bytes currently used by live entries.
+//
+// Returns:
+//   - int64: The number of bytes currently used
+func (c *arcCache) UsedBytes() int64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.sizes[arcT1] + c.sizes[arcT2]
+}
+
+// MaxBytes returns the maximum number of bytes the cache can store.
+//
+// Returns:
+//   - int64: The maximum bytes limit of the cache, 0 or negative value means no limit.
+func (c *arcCache) MaxBytes() int64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.maxBytes
+}
+
+// move moves the element to the front of list to, keeping byte accounting.
+// Note: lock must be held before calling this function.
+func (c *arcCache) move(elem *list.Element, to int) {
+	entry := elem.Value.(*arcEntry)
+	c.lists[entry.where].Remove(elem)
+	c.sizes[entry.where] -= entry.size
+	entry.where = to
+	c.items[entry.key] = c.lists[to].PushFront(entry)
+	c.sizes[to] += entry.size
+}
+
+// removeElement removes the element from the cache entirely.
+// Note: lock must be held before calling this function.
+//
+// Parameters:
+//   - elem: The element to remove
+//   - reason: Why the element is removed, passed to the eviction callback of
+//     live entries, ghosts hold no value and are dropped silently
+func (c *arcCache) removeElement(elem *list.Element, reason EvictionReason) {
+	entry := elem.Value.(*arcEntry)
+	c.lists[entry.where].Remove(elem)
+	c.sizes[entry.where] -= entry.size
+	delete(c.items, entry.key)
+	if entry.value != nil {
+		c.removeImmortal(entry.expireAt.IsZero(), entry.size)
+	}
+
+	if entry.value != nil && c.onEvicted != nil {
+		c.onEvicted(entry.key, entry.value, reason)
+	}
+}
+
+// replace demotes live entries to the ghost lists until they fit in maxBytes.
+// Note: lock must be held before calling this function.
+//
+// Parameters:
+//   - inB2: Whether the triggering write was a hit in B2
+func (c *arcCache) replace(inB2 bool) {
+	if c.maxBytes <= 0 {
+		return
+	}
+	for c.sizes[arcT1]+c.sizes[arcT2] > c.maxBytes {
+		from, to := arcT2, arcB2
+		t1 := c.sizes[arcT1]
+		if t1 > 0 && (t1 > c.p || (inB2 && t1 == c.p) || c.lists[arcT2].Len() == 0) {
+			from, to = arcT1, arcB1
+		}
+		elem := c.lists[from].Back()
+		entry := elem.Value.(*arcEntry)
+		value := entry.value
+		c.move(elem, to)
+		c.removeImmortal(entry.expireAt.IsZero(), entry.size)
+		entry.value = nil
+		c.evictions.Add(1)
+		if c.onEvicted != nil {
+			c.onEvicted(entry.key, value, EvictCapacity)
+		}
+	}
+}
+
+// trimGhosts bounds the ghost lists so the directory tracks at most 2*maxBytes.
+// Note: lock must be held before calling this function.
+func (c *arcCache) trimGhosts() {
+	if c.maxBytes <= 0 {
+		return
+	}
+	for c.sizes[arcT1]+c.sizes[arcB1] > c.maxBytes && c.lists[arcB1].Len() > 0 {
+		c.removeElement(c.lists[arcB1].Back(), EvictCapacity)
+	}
+	for c.sizes[arcT1]+c.sizes[arcT2]+c.sizes[arcB1]+c.sizes[arcB2] > 2*c.maxBytes && c.lists[arcB2].Len() > 0 {
+		c.removeElement(c.lists[arcB2].Back(), EvictCapacity)
+	}
+}
+
+// removeExpired removes all expired live items.
+// Note: lock must be held before calling this function.
+func (c *arcCache) removeExpired() {
+	now := time.Now()
+	for _, l := range c.lists[arcT1 : arcT2+1] {
+		for elem := l.Front(); elem != nil; {
+			next := elem.Next()
+			entry := elem.Value.(*arcEntry)
+			if !entry.expireAt.IsZero() && now.After(entry.expireAt) {
+				c.expirations.Add(1)
+				c.removeElement(elem, EvictExpired)
+			}
+			elem = next
+		}
+	}
+}
+
+// CheckInvariants verifies that every entry is indexed at its element and
+// sits in the list it records, that live entries hold values and ghosts
+// don't, that each list's bytes are accounted, that the live entries fit in
+// maxBytes with p between 0 and maxBytes, and that the immortal counts match
+// the live entries without expiration.
+//
+// Returns:
+//   - error: The first inconsistency found wrapping ErrInvariant, nil if there is none
+func (c *arcCache) CheckInvariants() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var immortal, immortalBytes int64
+	entries := 0
+	for where, l := range c.lists {
+		var size int64
+		for elem := l.Front(); elem != nil; elem = elem.Next() {
+			entry := elem.Value.(*arcEntry)
+			if entry.where != where {
+				return fmt.Errorf("%w: arc: key %q is listed in %d, recorded in %d", ErrInvariant, entry.key, where, entry.where)
+			}
+			if c.items[entry.key] != elem {
+				return fmt.Errorf("%w: arc: listed key %q is not indexed at its element", ErrInvariant, entry.key)
+			}
+			live := where == arcT1 || where == arcT2
+			if live != (entry.value != nil) {
+				return fmt.Errorf("%w: arc: key %q in list %d has a value: %t", ErrInvariant, entry.key, where, entry.value != nil)
+			}
+			if live && entry.size != int64(len(entry.key)+entry.value.Len()) {
+				return fmt.Errorf("%w: arc: key %q holds %d bytes, %d recorded", ErrInvariant, entry.key, len(entry.key)+entry.value.Len(), entry.size)
+			}
+			if live && entry.expireAt.IsZero() {
+				immortal++
+				immortalBytes += entry.size
+			}
+			size += entry.size
+			entries++
+		}
+		if size != c.sizes[where] {
+			return fmt.Errorf("%w: arc: list %d holds %d bytes, %d accounted", ErrInvariant, where, size, c.sizes[where])
+		}
+	}
+	if entries != len(c.items) {
+		return fmt.Errorf("%w: arc: %d entries listed, %d indexed", ErrInvariant, entries, len(c.items))
+	}
+	if c.maxBytes > 0 {
+		if live := c.sizes[arcT1] + c.sizes[arcT2]; live > c.maxBytes {
+			return fmt.Errorf("%w: arc: %d live bytes over the %d max", ErrInvariant, live, c.maxBytes)
+		}
+		if c.p < 0 || c.p > c.maxBytes {
+			return fmt.Errorf("%w: arc: target %d of T1 out of [0, %d]", ErrInvariant, c.p, c.maxBytes)
+		}
+	}
+	if n, bytes := c.Immortal(); n != immortal || bytes != immortalBytes {
+		return fmt.Errorf("%w: arc: %d entries of %d bytes never expire, %d of %d accounted", ErrInvariant, immortal, immortalBytes, n, bytes)
+	}
+	return nil
+}
+
+// cleanupLoop runs periodically to clean up expired items.
+func (c *arcCache) cleanupLoop() {
+	for {
+		select {
+		case <-c.cleanupTicker.C:
+			c.cleanup()
+		case <-c.closeCh:
+			return
+		}
+	}
+}
+
+// cleanup removes the expired items, a panic is reported without ending the loop.
+func (c *arcCache) cleanup() {
+	defer recoverPanic("arc cleanup", c.onPanic)
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.removeExpired()
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// arcOrder returns the keys of each list of c, T1, T2, B1 and B2, from the
+// most to the least recently used
+func arcOrder(c *arcCache) [4][]string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	var order [4][]string
+	for i, l := range c.lists {
+		for elem := l.Front(); elem != nil; elem = elem.Next() {
+			order[i] = append(order[i], elem.Value.(*arcEntry).key)
+		}
+	}
+	return order
+}
+
+func TestARCOrder(t *testing.T) {
+	c := newARCCache(Options{})
+	defer c.Close()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		c.Set(key, simValue(1))
+	}
+	c.Get("b")
+	c.Get("a")
+	c.Set("c", simValue(2))
+	want := [4][]string{{"d"}, {"c", "a", "b"}, nil, nil}
+	if got := arcOrder(c); !slices.EqualFunc(got[:], want[:], slices.Equal) {
+		t.Fatalf("lists = %v, want %v", got, want)
+	}
+	c.TTL("d")
+	if got := arcOrder(c); !slices.EqualFunc(got[:], want[:], slices.Equal) {
+		t.Fatalf("lists after TTL = %v, want %v", got, want)
+	}
+}
+
+func TestARCEviction(t *testing.T) {
+	onEvicted, evicted := evictionRecorder()
+	// four entries of 1+9 bytes fit
+	c := newARCCache(Options{MaxBytes: 40, OnEvictedReason: onEvicted})
+	defer c.Close()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		c.Set(key, simValue(9))
+	}
+	c.Get("a")
+	c.Set("e", simValue(9))
+	// a write to the ghost of b grows the target of T1 and brings b back to T2
+	c.Set("b", simValue(9))
+	if got, want := evicted[EvictCapacity], []string{"b", "c"}; !slices.Equal(got, want) {
+		t.Fatalf("evicted %v, want %v", got, want)
+	}
+	want := [4][]string{{"e", "d"}, {"b", "a"}, {"c"}, nil}
+	if got := arcOrder(c); !slices.EqualFunc(got[:], want[:], slices.Equal) {
+		t.Fatalf("lists = %v, want %v", got, want)
+	}
+	if c.p != 10 || c.UsedBytes() != 40 || c.Removals().Evicted != 2 {
+		t.Fatalf("p = %d, UsedBytes = %d, evicted = %d, want 10, 40 and 2", c.p, c.UsedBytes(), c.Removals().Evicted)
+	}
+	if _, ok := c.Get("c"); ok {
+		t.Fatal("Get found a ghost")
+	}
+	if err := c.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestARCExpiry(t *testing.T) {
+	onEvicted, evicted := evictionRecorder()
+	c := newARCCache(Options{OnEvictedReason: onEvicted})
+	defer c.Close()
+	c.SetWithExpiration("short", simValue(1), time.Millisecond)
+	c.SetWithExpiration("long", simValue(1), time.Hour)
+	c.Set("never", simValue(1))
+	c.Get("short")
+	time.Sleep(5 * time.Millisecond)
+
+	c.cleanup()
+	if got := evicted[EvictExpired]; !slices.Equal(got, []string{"short"}) {
+		t.Fatalf("expired %v, want [short]", got)
+	}
+	if c.Len() != 2 || c.Removals().Expired != 1 {
+		t.Fatalf("Len = %d, expired = %d, want 2 and 1", c.Len(), c.Removals().Expired)
+	}
+	if err := c.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestARCInvariants(t *testing.T) {
+	c := newARCCache(Options{MaxBytes: 512})
+	defer c.Close()
+	checkRandomOps(t, c, 20000)
+}
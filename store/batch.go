@@ -0,0 +1,74 @@
+package store
+
+import "time"
+
+// BatchStore is implemented by stores with native multi-key operations,
+// typically taking their lock once per batch instead of once per key.
+type BatchStore interface {
+	MGet(keys []string) map[string]Value
+	MSet(entries map[string]Value, expiration time.Duration) error
+	MDelete(keys []string) int
+}
+
+// MGet retrieves the values of keys from s.
+//
+// Parameters:
+//   - s: The store to read from
+//   - keys: The keys to look up
+//
+// Returns:
+//   - map[string]Value: The values of the keys that were found
+func MGet(s Store, keys []string) map[string]Value {
+	if b, ok := s.(BatchStore); ok {
+		return b.MGet(keys)
+	}
+	values := make(map[string]Value, len(keys))
+	for _, key := range keys {
+		if value, ok := s.Get(key); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// MSet stores all entries in s with the same expiration.
+//
+// Parameters:
+//   - s: The store to write to
+//   - entries: The key-value pairs to store, nil values delete their key
+//   - expiration: The duration after which the items expire (0 for no expiration)
+//
+// Returns:
+//   - error: The first error encountered, entries after it may not be stored
+func MSet(s Store, entries map[string]Value, expiration time.Duration) error {
+	if b, ok := s.(BatchStore); ok {
+		return b.MSet(entries, expiration)
+	}
+	for key, value := range entries {
+		if err := s.SetWithExpiration(key, value, expiration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MDelete removes keys from s.
+//
+// Parameters:
+//   - s: The store to delete from
+//   - keys: The keys to delete
+//
+// Returns:
+//   - int: The number of keys that were found and deleted
+func MDelete(s Store, keys []string) int {
+	if b, ok := s.(BatchStore); ok {
+		return b.MDelete(keys)
+	}
+	n := 0
+	for _, key := range keys {
+		if s.Delete(key) {
+			n++
+		}
+	}
+	return n
+}
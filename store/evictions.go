@@ -0,0 +1,106 @@
+package store
+
+import (
+	"hash/maphash"
+	"sync"
+)
+
+// evicted is an eviction callback queued for a dispatch worker.
+type evicted struct {
+	key    string
+	value  Value
+	reason EvictionReason
+}
+
+// evictionDispatcher runs eviction callbacks on worker goroutines instead of
+// under the store's lock. Keys are spread over the workers by hash, so the
+// callbacks of a key run in the order its entries left the store.
+type evictionDispatcher struct {
+	fn     func(key string, value Value, reason EvictionReason)
+	seed   maphash.Seed
+	mtx    sync.RWMutex // held for reading while queueing, for writing to close
+	closed bool
+	queues []chan evicted
+	wg     sync.WaitGroup
+	// onPanic: handler of panicking callbacks, see Options.OnPanic
+	onPanic func(err *PanicError)
+}
+
+// newEvictionDispatcher creates a dispatcher calling fn and starts its workers.
+//
+// Parameters:
+//   - fn: The eviction callback
+//   - onPanic: The handler of panicking callbacks, see Options.OnPanic
+//   - workers: The number of workers, at least 1
+//   - queue: The callbacks each worker queues before dispatch blocks
+//
+// Returns:
+//   - *evictionDispatcher: The running dispatcher
+func newEvictionDispatcher(fn func(key string, value Value, reason EvictionReason), onPanic func(err *PanicError), workers, queue int) *evictionDispatcher {
+	d := &evictionDispatcher{fn: fn, onPanic: onPanic, seed: maphash.MakeSeed(), queues: make([]chan evicted, max(workers, 1))}
+	for i := range d.queues {
+		d.queues[i] = make(chan evicted, queue)
+		d.wg.Go(func() {
+			for e := range d.queues[i] {
+				d.run(e)
+			}
+		})
+	}
+	return d
+}
+
+// run calls the callback of a queued entry, a panic is reported without
+// stopping the worker.
+func (d *evictionDispatcher) run(e evicted) {
+	defer recoverPanic("eviction callback", d.onPanic)
+	d.fn(e.key, e.value, e.reason)
+}
+
+// dispatch queues the callback of an entry that left the store. A full queue
+// blocks the caller, and with it the store, until its worker catches up, so
+// slow callbacks slow down writes instead of piling up. After close the
+// callback runs on the caller.
+//
+// Parameters:
+//   - key: The key of the entry
+//   - value: The value of the entry
+//   - reason: Why the entry left
+func (d *evictionDispatcher) dispatch(key string, value Value, reason EvictionReason) {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+	if d.closed {
+		d.fn(key, value, reason)
+		return
+	}
+	d.queues[maphash.String(d.seed, key)%uint64(len(d.queues))] <- evicted{key: key, value: value, reason: reason}
+}
+
+// close stops the workers once they have run the callbacks already queued.
+func (d *evictionDispatcher) close() {
+	d.mtx.Lock()
+	if d.closed {
+		d.mtx.Unlock()
+		return
+	}
+	d.closed = true
+	for _, q := range d.queues {
+		close(q)
+	}
+	d.mtx.Unlock()
+	d.wg.Wait()
+}
+
+// evictionHook returns the eviction callback of a store built from o, queued
+// for workers when EvictionQueue is set, and a func stopping those workers.
+//
+// Returns:
+//   - func(key string, value Value, reason EvictionReason): The callback, nil without one
+//   - func(): Stops the dispatch workers after the queued callbacks, never nil
+func (o Options) evictionHook() (func(key string, value Value, reason EvictionReason), func()) {
+	fn := o.evictedCallback()
+	if fn == nil || o.EvictionQueue <= 0 {
+		return fn, func() {}
+	}
+	d := newEvictionDispatcher(fn, o.OnPanic, o.EvictionWorkers, o.EvictionQueue)
+	return d.dispatch, d.close
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiryItem tracks the expiration time of a single key.
+type expiryItem struct {
+	key      string    // the key that expires
+	expireAt time.Time // when the key expires
+	index    int       // position in the heap, maintained by the heap
+}
+
+// expiryHeap is a min-heap of expiry items ordered by expireAt,
+// so expiration work is proportional to the number of expired keys.
+type expiryHeap []*expiryItem
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expireAt.Before(h[j].expireAt) }
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	item := x.(*expiryItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*h = old[:n-1]
+	return item
+}
+
+// peek returns the item expiring first, or nil if the heap is empty.
+func (h expiryHeap) peek() *expiryItem {
+	if len(h) == 0 {
+		return nil
+	}
+	return h[0]
+}
+
+// schedule adds item or moves it after its expireAt changed.
+func (h *expiryHeap) schedule(item *expiryItem) {
+	if item.index >= 0 && item.index < len(*h) && (*h)[item.index] == item {
+		heap.Fix(h, item.index)
+		return
+	}
+	heap.Push(h, item)
+}
+
+// unschedule removes item from the heap if present.
+func (h *expiryHeap) unschedule(item *expiryItem) {
+	if item.index >= 0 && item.index < len(*h) && (*h)[item.index] == item {
+		heap.Remove(h, item.index)
+	}
+}
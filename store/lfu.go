@@ -0,0 +1,566 @@
+package store
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// lfuCache implements an LFU cache with O(1) operations.
+// Entries with the same access frequency share a bucket; buckets are kept in a
+// list ordered by ascending frequency, and ties are broken by recency.
+// It is safe for concurrent access by multiple goroutines.
+type lfuCache struct {
+	mtx             sync.Mutex                                           // mutex to protect the cache, every access updates frequencies
+	freqs           *list.List                                           // list of *lfuBucket ordered by ascending frequency
+	items           map[string]*list.Element                             // map of keys to elements in their bucket's entry list
+	maxBytes        int64                                                // maximum bytes the cache can hold
+	usedBytes       int64                                                // currently used bytes in the cache
+	onEvicted       func(key string, value Value, reason EvictionReason) // callback function when an item is evicted
+	stopEvictions   func()                                               // stops the dispatch of eviction callbacks, see Options.EvictionQueue
+	cleanupInterval time.Duration                                        // interval for running cleanup operations
+	cleanupTicker   *time.Ticker                                         // ticker for periodic cleanup
+	closeCh         chan struct{}                                        // channel to signal cleanup goroutine to stop
+	cleanupDone     sync.WaitGroup                                       // joins the cleanup goroutine on Close
+	onPanic         func(err *PanicError)                                // handler of panics in the cleanup loop, see Options.OnPanic
+	removalCounts
+	immortalCounts
+}
+
+// lfuBucket holds all entries accessed exactly freq times.
+type lfuBucket struct {
+	freq    int64      // access frequency shared by the entries
+	entries *list.List // list of *lfuEntry, front is the most recently used
+}
+
+// lfuEntry represents a single entry in the LFU cache.
+type lfuEntry struct {
+	key      string        // the key of the cache entry
+	value    Value         // the value of the cache entry
+	expireAt time.Time     // expiration time, zero for no expiration
+	version  uint64        // version of the entry, renewed on every write
+	bucket   *list.Element // element of the owning bucket in freqs
+}
+
+// newLFUCache creates a new LFU cache with the given options.
+//
+// Parameters:
+//   - opts: Options containing cache configuration such as max bytes, cleanup interval, and eviction callback
+//
+// Returns:
+//   - *lfuCache: A pointer to the newly created LFU cache
+func newLFUCache(opts Options) *lfuCache {
+	cleanup := opts.CleanupInterval
+	if cleanup <= 0 {
+		cleanup = time.Minute
+	}
+	c := &lfuCache{
+		freqs:           list.New(),
+		items:           make(map[string]*list.Element),
+		maxBytes:        opts.MaxBytes,
+		cleanupInterval: cleanup,
+		closeCh:         make(chan struct{}),
+		onPanic:         opts.OnPanic,
+	}
+	c.onEvicted, c.stopEvictions = opts.evictionHook()
+	c.cleanupTicker = time.NewTicker(c.cleanupInterval)
+	c.cleanupDone.Go(c.cleanupLoop)
+	return c
+}
+
+// Get retrieves the value associated with the given key and bumps its frequency.
+//
+// Parameters:
+//   - key: The key to look up in the cache
+//
+// Returns:
+//   - Value: The value associated with the key, or nil if not found or expired
+//   - bool: True if the key was found and not expired, false otherwise
+func (c *lfuCache) Get(key string) (Value, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	c.touch(elem)
+	return elem.Value.(*lfuEntry).value, true
+}
+
+// TTL returns the remaining time to live of the given key without counting as an access.
+//
+// Parameters:
+//   - key: The key to look up
+//
+// Returns:
+//   - time.Duration: The remaining time to live, or 0 if the key never expires
+//   - bool: True if the key was found and not expired, false otherwise
+func (c *lfuCache) TTL(key string) (time.Duration, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.lookup(key)
+	if !ok {
+		return 0, false
+	}
+	if entry := elem.Value.(*lfuEntry); !entry.expireAt.IsZero() {
+		return time.Until(entry.expireAt), true
+	}
+	return 0, true
+}
+
+// GetWithVersion retrieves the value and version associated with the given key.
+//
+// Parameters:
+//   - key: The key to look up in the cache
+//
+// Returns:
+//   - Value: The value associated with the key, or nil if not found or expired
+//   - uint64: The version of the entry, or 0 if not found
+//   - bool: True if the key was found and not expired, false otherwise
+func (c *lfuCache) GetWithVersion(key string) (Value, uint64, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.lookup(key)
+	if !ok {
+		return nil, 0, false
+	}
+	c.touch(elem)
+	entry := elem.Value.(*lfuEntry)
+	return entry.value, entry.version, true
+}
+
+// lookup returns the element of an unexpired key, removing it if it has expired.
+// Note: lock must be held before calling this function.
+func (c *lfuCache) lookup(key string) (*list.Element, bool) {
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	if entry := elem.Value.(*lfuEntry); !entry.expireAt.IsZero() && time.Now().After(entry.expireAt) {
+		c.expirations.Add(1)
+		c.removeElement(elem, EvictExpired)
+		return nil, false
+	}
+	return elem, true
+}
+
+// Set stores a key-value pair in the cache with no expiration.
+//
+// Parameters:
+//   - key: The key to store
+//   - value: The value to store
+//
+// Returns:
+//   - error: Any error encountered during the operation
+func (c *lfuCache) Set(key string, value Value) error {
+	return c.SetWithExpiration(key, value, 0)
+}
+
+// SetWithExpiration stores a key-value pair in the cache with an optional expiration duration.
+// Updating an existing key counts as an access.
+//
+// Parameters:
+//   - key: The key to store
+//   - value: The value to store
+//   - expiration: The duration after which the item expires (0 for no expiration)
+//
+// Returns:
+//   - error: Any error encountered during the operation
+func (c *lfuCache) SetWithExpiration(key string, value Value, expiration time.Duration) error {
+	if value == nil {
+		c.Delete(key)
+		return nil
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var expireAt time.Time
+	if expiration > 0 {
+		expireAt = time.Now().Add(expiration)
+	}
+	c.set(key, value, expireAt)
+	return nil
+}
+
+// set stores a key-value pair expiring at expireAt (zero for no expiration).
+// Note: lock must be held before calling this function.
+func (c *lfuCache) set(key string, value Value, expireAt time.Time) {
+	if elem, ok := c.items[key]; ok {
+		// update value if key exists
+		entry := elem.Value.(*lfuEntry)
+		c.removeImmortal(entry.expireAt.IsZero(), int64(len(key)+entry.value.Len()))
+		c.usedBytes += int64(value.Len() - entry.value.Len())
+		entry.value = value
+		entry.expireAt = expireAt
+		entry.version = nextVersion()
+		c.addImmortal(expireAt.IsZero(), int64(len(key)+value.Len()))
+		c.touch(elem)
+		c.evict()
+		return
+	}
+
+	// make room before inserting so the new key isn't its own victim
+	c.usedBytes += int64(len(key) + value.Len())
+	c.evict()
+
+	// add new key with frequency 1
+	front := c.freqs.Front()
+	if front == nil || front.Value.(*lfuBucket).freq != 1 {
+		front = c.freqs.PushFront(&lfuBucket{freq: 1, entries: list.New()})
+	}
+	entry := &lfuEntry{key: key, value: value, expireAt: expireAt, version: nextVersion(), bucket: front}
+	c.items[key] = front.Value.(*lfuBucket).entries.PushFront(entry)
+	c.addImmortal(expireAt.IsZero(), int64(len(key)+value.Len()))
+}
+
+// SetNX stores a key-value pair only if the key is absent.
+//
+// Parameters:
+//   - key: The key to store
+//   - value: The value to store
+//   - expiration: The duration after which the item expires (0 for no expiration)
+//
+// Returns:
+//   - bool: True if the value was stored
+//   - error: ErrNilValue if value is nil
+func (c *lfuCache) SetNX(key string, value Value, expiration time.Duration) (bool, error) {
+	return c.setIf(key, value, expiration, ifAbsent)
+}
+
+// SetXX stores a key-value pair only if the key is present.
+//
+// Parameters:
+//   - key: The key to store
+//   - value: The value to store
+//   - expiration: The duration after which the item expires (0 for no expiration)
+//
+// Returns:
+//   - bool: True if the value was stored
+//   - error: ErrNilValue if value is nil
+func (c *lfuCache) SetXX(key string, value Value, expiration time.Duration) (bool, error) {
+	return c.setIf(key, value, expiration, ifPresent)
+}
+
+// CompareAndSwap stores a key-value pair only if the entry's current version equals version.
+//
+// Parameters:
+//   - key: The key to store
+//   - version: The expected version, 0 means the key must be absent
+//   - value: The value to store
+//   - expiration: The duration after which the item expires (0 for no expiration)
+//
+// Returns:
+//   - bool: True if the value was stored
+//   - error: ErrNilValue if value is nil
+func (c *lfuCache) CompareAndSwap(key string, version uint64, value Value, expiration time.Duration) (bool, error) {
+	return c.setIf(key, value, expiration, ifVersion(version))
+}
+
+// setIf stores a key-value pair if cond holds for the current entry.
+func (c *lfuCache) setIf(key string, value Value, expiration time.Duration, cond func(found bool, version uint64) bool) (bool, error) {
+	if value == nil {
+		return false, ErrNilValue
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var version uint64
+	elem, found := c.lookup(key)
+	if found {
+		version = elem.Value.(*lfuEntry).version
+	}
+	if !cond(found, version) {
+		return false, nil
+	}
+	var expireAt time.Time
+	if expiration > 0 {
+		expireAt = time.Now().Add(expiration)
+	}
+	c.set(key, value, expireAt)
+	return true, nil
+}
+
+// Incr atomically adds delta to the counter stored at key, creating it from 0 if absent.
+// The remaining TTL of an existing counter is preserved.
+//
+// Parameters:
+//   - key: The key of the counter
+//   - delta: The amount to add
+//
+// Returns:
+//   - int64: The new counter value
+//   - error: ErrNotCounter if the key holds a non-counter value
+func (c *lfuCache) Incr(key string, delta int64) (int64, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var cur Value
+	var expireAt time.Time
+	if elem, ok := c.lookup(key); ok {
+		entry := elem.Value.(*lfuEntry)
+		cur, expireAt = entry.value, entry.expireAt
+	}
+	n, err := incrValue(cur, delta)
+	if err != nil {
+		return 0, err
+	}
+	c.set(key, n, expireAt)
+	return int64(n), nil
+}
+
+// Decr atomically subtracts delta from the counter stored at key.
+//
+// Parameters:
+//   - key: The key of the counter
+//   - delta: The amount to subtract
+//
+// Returns:
+//   - int64: The new counter value
+//   - error: ErrNotCounter if the key holds a non-counter value
+func (c *lfuCache) Decr(key string, delta int64) (int64, error) {
+	return c.Incr(key, -delta)
+}
+
+// Delete removes the item with the given key from the cache.
+//
+// Parameters:
+//   - key: The key of the item to delete
+//
+// Returns:
+//   - bool: True if the item was found and deleted, false otherwise
+func (c *lfuCache) Delete(key string) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem, EvictDeleted)
+		return true
+	}
+	return false
+}
+
+// Clear removes all items from the cache.
+func (c *lfuCache) Clear() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.onEvicted != nil {
+		for _, elem := range c.items {
+			entry := elem.Value.(*lfuEntry)
+			c.onEvicted(entry.key, entry.value, EvictCleared)
+		}
+	}
+	c.freqs.Init()
+	c.items = make(map[string]*list.Element)
+	c.usedBytes = 0
+	c.resetImmortal()
+}
+
+// Len returns the number of items currently in the cache.
+//
+// Returns:
+//   - int: The number of items in the cache
+func (c *lfuCache) Len() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return len(c.items)
+}
+
+// Range calls fn for each unexpired entry, most frequently used first, until fn returns false.
+//
+// Parameters:
+//   - fn: called with the key, value and expiration time (zero for no expiration) of each entry
+func (c *lfuCache) Range(fn func(key string, value Value, expireAt time.Time) bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	now := time.Now()
+	for b := c.freqs.Back(); b != nil; b = b.Prev() {
+		for elem := b.Value.(*lfuBucket).entries.Front(); elem != nil; elem = elem.Next() {
+			entry := elem.Value.(*lfuEntry)
+			if !entry.expireAt.IsZero() && !now.Before(entry.expireAt) {
+				continue
+			}
+			if !fn(entry.key, entry.value, entry.expireAt) {
+				return
+			}
+		}
+	}
+}
+
+// Close stops the cleanup goroutine, waiting for it to return, and closes the cache.
+func (c *lfuCache) Close() {
+	if c.cleanupTicker != nil {
+		c.cleanupTicker.Stop()
+		close(c.closeCh)
+		c.cleanupDone.Wait()
+	}
+	c.stopEvictions()
+}
+
+// UsedBytes returns the number of bytes currently used by the cache.
+//
+// Returns:
+//   - int64: The number of bytes currently used
+func (c *lfuCache) UsedBytes() int64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.usedBytes
+}
+
+// MaxBytes returns the maximum number of bytes the cache can store.
+//
+// Returns:
+//   - int64: The maximum bytes limit of the cache, 0 or negative value means no limit.
+func (c *lfuCache) MaxBytes() int64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.maxBytes
+}
+
+// touch moves the entry to the bucket of the next frequency.
+// Note: lock must be held before calling this function.
+//
+// Parameters:
+//   - elem: The entry element to promote
+func (c *lfuCache) touch(elem *list.Element) {
+	entry := elem.Value.(*lfuEntry)
+	cur := entry.bucket
+	bucket := cur.Value.(*lfuBucket)
+
+	next := cur.Next()
+	if next == nil || next.Value.(*lfuBucket).freq != bucket.freq+1 {
+		next = c.freqs.InsertAfter(&lfuBucket{freq: bucket.freq + 1, entries: list.New()}, cur)
+	}
+	bucket.entries.Remove(elem)
+	if bucket.entries.Len() == 0 {
+		c.freqs.Remove(cur)
+	}
+	entry.bucket = next
+	c.items[entry.key] = next.Value.(*lfuBucket).entries.PushFront(entry)
+}
+
+// removeElement removes the specified element from the cache.
+// Note: lock must be held before calling this function.
+//
+// Parameters:
+//   - elem: The entry element to remove
+//   - reason: Why the element is removed, passed to the eviction callback
+func (c *lfuCache) removeElement(elem *list.Element, reason EvictionReason) {
+	entry := elem.Value.(*lfuEntry)
+	bucket := entry.bucket.Value.(*lfuBucket)
+	bucket.entries.Remove(elem)
+	if bucket.entries.Len() == 0 {
+		c.freqs.Remove(entry.bucket)
+	}
+	delete(c.items, entry.key)
+	c.usedBytes -= int64(len(entry.key) + entry.value.Len())
+	c.removeImmortal(entry.expireAt.IsZero(), int64(len(entry.key)+entry.value.Len()))
+
+	if c.onEvicted != nil {
+		c.onEvicted(entry.key, entry.value, reason)
+	}
+}
+
+// evict removes the least frequently used items until the cache is within maxBytes.
+// Ties within the lowest frequency are broken by least recent use.
+// Note: lock must be held before calling this function.
+func (c *lfuCache) evict() {
+	for c.maxBytes > 0 && c.usedBytes > c.maxBytes {
+		front := c.freqs.Front()
+		if front == nil {
+			return
+		}
+		c.evictions.Add(1)
+		c.removeElement(front.Value.(*lfuBucket).entries.Back(), EvictCapacity)
+	}
+}
+
+// removeExpired removes all expired items.
+// Note: lock must be held before calling this function.
+func (c *lfuCache) removeExpired() {
+	now := time.Now()
+	for _, elem := range c.items {
+		entry := elem.Value.(*lfuEntry)
+		if !entry.expireAt.IsZero() && now.After(entry.expireAt) {
+			c.expirations.Add(1)
+			c.removeElement(elem, EvictExpired)
+		}
+	}
+}
+
+// CheckInvariants verifies that the buckets run by strictly ascending
+// frequency and are never empty, that every entry sits in its own bucket and
+// is indexed at its element, that usedBytes is the size of the entries within
+// maxBytes and that the immortal counts match the entries without expiration.
+//
+// Returns:
+//   - error: The first inconsistency found wrapping ErrInvariant, nil if there is none
+func (c *lfuCache) CheckInvariants() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var used, immortal, immortalBytes int64
+	entries := 0
+	for b := c.freqs.Front(); b != nil; b = b.Next() {
+		bucket := b.Value.(*lfuBucket)
+		if bucket.entries.Len() == 0 {
+			return fmt.Errorf("%w: lfu: bucket of frequency %d is empty", ErrInvariant, bucket.freq)
+		}
+		if prev := b.Prev(); prev != nil && prev.Value.(*lfuBucket).freq >= bucket.freq {
+			return fmt.Errorf("%w: lfu: bucket of frequency %d follows %d", ErrInvariant, bucket.freq, prev.Value.(*lfuBucket).freq)
+		}
+		for elem := bucket.entries.Front(); elem != nil; elem = elem.Next() {
+			entry := elem.Value.(*lfuEntry)
+			if entry.bucket != b {
+				return fmt.Errorf("%w: lfu: key %q is listed in a bucket not its own", ErrInvariant, entry.key)
+			}
+			if c.items[entry.key] != elem {
+				return fmt.Errorf("%w: lfu: listed key %q is not indexed at its element", ErrInvariant, entry.key)
+			}
+			size := int64(len(entry.key) + entry.value.Len())
+			used += size
+			if entry.expireAt.IsZero() {
+				immortal++
+				immortalBytes += size
+			}
+			entries++
+		}
+	}
+	if entries != len(c.items) {
+		return fmt.Errorf("%w: lfu: %d entries listed, %d indexed", ErrInvariant, entries, len(c.items))
+	}
+	if used != c.usedBytes {
+		return fmt.Errorf("%w: lfu: entries hold %d bytes, %d accounted", ErrInvariant, used, c.usedBytes)
+	}
+	if c.maxBytes > 0 && c.usedBytes > c.maxBytes {
+		return fmt.Errorf("%w: lfu: %d bytes used over the %d max", ErrInvariant, c.usedBytes, c.maxBytes)
+	}
+	if n, bytes := c.Immortal(); n != immortal || bytes != immortalBytes {
+		return fmt.Errorf("%w: lfu: %d entries of %d bytes never expire, %d of %d accounted", ErrInvariant, immortal, immortalBytes, n, bytes)
+	}
+	return nil
+}
+
+// cleanupLoop runs periodically to clean up expired items.
+func (c *lfuCache) cleanupLoop() {
+	for {
+		select {
+		case <-c.cleanupTicker.C:
+			c.cleanup()
+		case <-c.closeCh:
+			return
+		}
+	}
+}
+
+// cleanup removes the expired items, a panic is reported without ending the loop.
+func (c *lfuCache) cleanup() {
+	defer recoverPanic("lfu cleanup", c.onPanic)
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.removeExpired()
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// lfuOrder returns the buckets of c by ascending frequency, each as the
+// frequency followed by its keys from the most to the least recently used
+func lfuOrder(c *lfuCache) []string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	var order []string
+	for b := c.freqs.Front(); b != nil; b = b.Next() {
+		bucket := b.Value.(*lfuBucket)
+		order = append(order, fmt.Sprint(bucket.freq))
+		for elem := bucket.entries.Front(); elem != nil; elem = elem.Next() {
+			order = append(order, elem.Value.(*lfuEntry).key)
+		}
+	}
+	return order
+}
+
+func TestLFUOrder(t *testing.T) {
+	c := newLFUCache(Options{})
+	defer c.Close()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		c.Set(key, simValue(1))
+	}
+	c.Get("a")
+	c.Get("a")
+	c.Get("c")
+	c.Set("b", simValue(2))
+	if got, want := lfuOrder(c), []string{"1", "d", "2", "b", "c", "3", "a"}; !slices.Equal(got, want) {
+		t.Fatalf("order = %v, want %v", got, want)
+	}
+	// TTL doesn't count as an access
+	c.TTL("d")
+	if got, want := lfuOrder(c), []string{"1", "d", "2", "b", "c", "3", "a"}; !slices.Equal(got, want) {
+		t.Fatalf("order after TTL = %v, want %v", got, want)
+	}
+}
+
+func TestLFUEviction(t *testing.T) {
+	onEvicted, evicted := evictionRecorder()
+	// four entries of 1+9 bytes fit
+	c := newLFUCache(Options{MaxBytes: 40, OnEvictedReason: onEvicted})
+	defer c.Close()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		c.Set(key, simValue(9))
+	}
+	c.Get("a")
+	c.Get("a")
+	c.Get("c")
+	// the least recently used of the least frequently used goes first
+	c.Set("e", simValue(9))
+	c.Set("f", simValue(9))
+	if got, want := evicted[EvictCapacity], []string{"b", "d"}; !slices.Equal(got, want) {
+		t.Fatalf("evicted %v, want %v", got, want)
+	}
+	if got, want := lfuOrder(c), []string{"1", "f", "e", "2", "c", "3", "a"}; !slices.Equal(got, want) {
+		t.Fatalf("order = %v, want %v", got, want)
+	}
+	if c.UsedBytes() != 40 || c.Removals().Evicted != 2 {
+		t.Fatalf("UsedBytes = %d, evicted = %d, want 40 and 2", c.UsedBytes(), c.Removals().Evicted)
+	}
+	if err := c.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLFUExpiry(t *testing.T) {
+	onEvicted, evicted := evictionRecorder()
+	c := newLFUCache(Options{OnEvictedReason: onEvicted})
+	defer c.Close()
+	c.SetWithExpiration("short", simValue(1), time.Millisecond)
+	c.SetWithExpiration("long", simValue(1), time.Hour)
+	c.Set("never", simValue(1))
+	time.Sleep(5 * time.Millisecond)
+
+	c.cleanup()
+	if got := evicted[EvictExpired]; !slices.Equal(got, []string{"short"}) {
+		t.Fatalf("expired %v, want [short]", got)
+	}
+	if c.Len() != 2 || c.Removals().Expired != 1 {
+		t.Fatalf("Len = %d, expired = %d, want 2 and 1", c.Len(), c.Removals().Expired)
+	}
+	if err := c.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLFUInvariants(t *testing.T) {
+	c := newLFUCache(Options{MaxBytes: 512})
+	defer c.Close()
+	checkRandomOps(t, c, 20000)
+}
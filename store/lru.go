@@ -2,29 +2,60 @@ package store
 
 import (
 	"container/list"
+	"fmt"
 	"sync"
 	"time"
 )
 
 // lruCache implements an LRU cache using a doubly linked list.
 // It is safe for concurrent access by multiple goroutines.
+//
+// The list runs from the least recently used entry at the front to the most
+// recently used one at the back. Every read or write of an entry moves it to
+// the back, only reads that don't count as an access (TTL, Range) leave it in
+// place. Eviction and the admission victim take the front.
 type lruCache struct {
-	mtx             sync.RWMutex                  // read-write mutex to protect the cache
-	lru             *list.List                    // doubly linked list to maintain LRU order
-	items           map[string]*list.Element      // map of keys to list elements for O(1) access
-	expires         map[string]time.Time          // map of keys to their expiration times
-	maxBytes        int64                         // maximum bytes the cache can hold
-	usedBytes       int64                         // currently used bytes in the cache
-	onEvicted       func(key string, value Value) // callback function when an item is evicted
-	cleanupInterval time.Duration                 // interval for running cleanup operations
-	cleanupTicker   *time.Ticker                  // ticker for periodic cleanup
-	closeCh         chan struct{}                 // channel to signal cleanup goroutine to stop
+	mtx             sync.RWMutex                                         // read-write mutex to protect the cache
+	lru             *list.List                                           // doubly linked list to maintain LRU order
+	items           map[string]*list.Element                             // map of keys to list elements for O(1) access
+	expiryQueue     expiryHeap                                           // expirations of the entries that expire, soonest first
+	maxBytes        int64                                                // maximum bytes the cache can hold
+	usedBytes       int64                                                // currently used bytes in the cache
+	onEvicted       func(key string, value Value, reason EvictionReason) // callback function when an item is evicted
+	stopEvictions   func()                                               // stops the dispatch of eviction callbacks, see Options.EvictionQueue
+	admission       AdmissionPolicy                                      // optional admission filter for new keys
+	cleanupInterval time.Duration                                        // interval for running cleanup operations
+	cleanupTicker   *time.Ticker                                         // ticker for periodic cleanup
+	closeCh         chan struct{}                                        // channel to signal cleanup goroutine to stop
+	cleanupDone     sync.WaitGroup                                       // joins the cleanup goroutine on Close
+	stopPressure    func()                                               // stops watching the heap, see Options.MemoryPressure
+	onPanic         func(err *PanicError)                                // handler of panics in the cleanup loop, see Options.OnPanic
+	removalCounts
+	immortalCounts
 }
 
 // lruEntry represents a single entry in the LRU cache.
 type lruEntry struct {
-	key   string // the key of the cache entry
-	value Value  // the value of the cache entry
+	key     string     // the key of the cache entry
+	value   Value      // the value of the cache entry
+	version uint64     // version of the entry, renewed on every write
+	expiry  expiryItem // expiration, zero expireAt and out of expiryQueue if the entry never expires
+	access  int64      // unix nanoseconds of the last read or write, see LastAccess
+}
+
+// expired reports whether the entry has expired by now.
+func (e *lruEntry) expired(now time.Time) bool {
+	return !e.expiry.expireAt.IsZero() && now.After(e.expiry.expireAt)
+}
+
+// immortal reports whether the entry never expires.
+func (e *lruEntry) immortal() bool {
+	return e.expiry.expireAt.IsZero()
+}
+
+// size returns the bytes of the entry's key and value.
+func (e *lruEntry) size() int64 {
+	return int64(len(e.key) + e.value.Len())
 }
 
 // newLRUCache creates a new LRU cache with the given options.
@@ -42,18 +73,22 @@ func newLRUCache(opts Options) *lruCache {
 	c := &lruCache{
 		lru:             list.New(),
 		items:           make(map[string]*list.Element),
-		expires:         make(map[string]time.Time),
 		maxBytes:        opts.MaxBytes,
-		onEvicted:       opts.OnEvicted,
+		admission:       opts.AdmissionPolicy,
 		cleanupInterval: cleanup,
 		closeCh:         make(chan struct{}),
+		onPanic:         opts.OnPanic,
 	}
+	c.onEvicted, c.stopEvictions = opts.evictionHook()
+	c.stopPressure = opts.MemoryPressure.watch(c.shed, opts.OnPanic)
 	c.cleanupTicker = time.NewTicker(c.cleanupInterval)
-	go c.cleanupLoop()
+	c.cleanupDone.Go(c.cleanupLoop)
 	return c
 }
 
-// Get retrieves the value associated with the given key from the cache.
+// Get retrieves the value associated with the given key from the cache and
+// marks it most recently used. The lookup and the move to the back of the list
+// happen under the write lock, a read lock cannot protect the list.
 //
 // Parameters:
 //   - key: The key to look up in the cache
@@ -62,32 +97,18 @@ func newLRUCache(opts Options) *lruCache {
 //   - Value: The value associated with the key, or nil if not found or expired
 //   - bool: True if the key was found and not expired, false otherwise
 func (c *lruCache) Get(key string) (Value, bool) {
-	c.mtx.RLock()
-	elem, ok := c.items[key]
-	if !ok {
-		c.mtx.RUnlock()
-		return nil, false
+	if c.admission != nil {
+		c.admission.Record(key)
 	}
-	// check expiration
-	if expire, isExpired := c.expires[key]; isExpired && time.Now().After(expire) {
-		c.mtx.RUnlock()
-		// asynchronously delete expired item
-		go c.Delete(key)
-		return nil, false
-	}
-	// entry to get the value and release r-lock
-	entry := elem.Value.(*lruEntry)
-	value := entry.value
-	c.mtx.RUnlock()
-
-	// update position in LRU with w-lock
 	c.mtx.Lock()
-	// check if item still exists
-	if _, ok := c.items[key]; ok {
-		c.lru.MoveToFront(elem)
+	defer c.mtx.Unlock()
+
+	elem, ok := c.lookup(key)
+	if !ok {
+		return nil, false
 	}
-	c.mtx.Unlock()
-	return value, true
+	c.touch(elem)
+	return elem.Value.(*lruEntry).value, true
 }
 
 // Set stores a key-value pair in the cache with no expiration.
@@ -103,6 +124,8 @@ func (c *lruCache) Set(key string, value Value) error {
 }
 
 // SetWithExpiration stores a key-value pair in the cache with an optional expiration duration.
+// With an admission policy, a new key that would force an eviction is silently
+// dropped unless the policy prefers it over the eviction victim.
 //
 // Parameters:
 //   - key: The key to store
@@ -123,30 +146,300 @@ func (c *lruCache) SetWithExpiration(key string, value Value, expiration time.Du
 	var expire time.Time
 	if expiration > 0 {
 		expire = time.Now().Add(expiration)
-		c.expires[key] = expire
-	} else {
-		delete(c.expires, key)
+	}
+	c.set(key, value, expire)
+	return nil
+}
+
+// set stores a key-value pair expiring at expire (zero for no expiration).
+// Note: lock must be held before calling this function.
+//
+// Parameters:
+//   - key: The key to store
+//   - value: The value to store
+//   - expire: The expiration time, or zero for no expiration
+func (c *lruCache) set(key string, value Value, expire time.Time) {
+	// admission check for new keys that don't fit
+	if _, ok := c.items[key]; !ok && c.admission != nil {
+		c.admission.Record(key)
+		if c.maxBytes > 0 && c.usedBytes+int64(len(key)+value.Len()) > c.maxBytes {
+			if victim := c.lru.Front(); victim != nil && !c.admission.Admit(key, victim.Value.(*lruEntry).key) {
+				return
+			}
+		}
 	}
 
 	if elem, ok := c.items[key]; ok {
 		// update value if key exists
 		entry := elem.Value.(*lruEntry)
+		c.removeImmortal(entry.immortal(), entry.size())
 		c.usedBytes += int64(value.Len() - entry.value.Len())
 		entry.value = value
-		c.lru.MoveToBack(elem)
-		return nil
+		entry.version = nextVersion()
+		c.setExpiration(entry, expire)
+		c.addImmortal(entry.immortal(), entry.size())
+		c.touch(elem)
+		// a larger value can push the cache over maxBytes too
+		c.evict()
+		return
 	}
 	// add new key
-	entry := &lruEntry{key: key, value: value}
+	entry := &lruEntry{key: key, value: value, version: nextVersion(), expiry: expiryItem{key: key, index: -1}, access: time.Now().UnixNano()}
+	c.setExpiration(entry, expire)
 	elem := c.lru.PushBack(entry)
 	c.items[key] = elem
-	c.usedBytes += int64(len(key) + value.Len())
+	c.usedBytes += entry.size()
+	c.addImmortal(entry.immortal(), entry.size())
 
 	// evict if necessary
 	c.evict()
+}
+
+// TTL returns the remaining time to live of the given key without counting as an access.
+//
+// Parameters:
+//   - key: The key to look up
+//
+// Returns:
+//   - time.Duration: The remaining time to live, or 0 if the key never expires
+//   - bool: True if the key was found and not expired, false otherwise
+func (c *lruCache) TTL(key string) (time.Duration, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.lookup(key)
+	if !ok {
+		return 0, false
+	}
+	if expireAt := elem.Value.(*lruEntry).expiry.expireAt; !expireAt.IsZero() {
+		return time.Until(expireAt), true
+	}
+	return 0, true
+}
+
+// GetWithVersion retrieves the value and version associated with the given key.
+//
+// Parameters:
+//   - key: The key to look up in the cache
+//
+// Returns:
+//   - Value: The value associated with the key, or nil if not found or expired
+//   - uint64: The version of the entry, or 0 if not found
+//   - bool: True if the key was found and not expired, false otherwise
+func (c *lruCache) GetWithVersion(key string) (Value, uint64, bool) {
+	if c.admission != nil {
+		c.admission.Record(key)
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.lookup(key)
+	if !ok {
+		return nil, 0, false
+	}
+	c.touch(elem)
+	entry := elem.Value.(*lruEntry)
+	return entry.value, entry.version, true
+}
+
+// SetNX stores a key-value pair only if the key is absent.
+//
+// Parameters:
+//   - key: The key to store
+//   - value: The value to store
+//   - expiration: The duration after which the item expires (0 for no expiration)
+//
+// Returns:
+//   - bool: True if the value was stored
+//   - error: ErrNilValue if value is nil
+func (c *lruCache) SetNX(key string, value Value, expiration time.Duration) (bool, error) {
+	return c.setIf(key, value, expiration, ifAbsent)
+}
+
+// SetXX stores a key-value pair only if the key is present.
+//
+// Parameters:
+//   - key: The key to store
+//   - value: The value to store
+//   - expiration: The duration after which the item expires (0 for no expiration)
+//
+// Returns:
+//   - bool: True if the value was stored
+//   - error: ErrNilValue if value is nil
+func (c *lruCache) SetXX(key string, value Value, expiration time.Duration) (bool, error) {
+	return c.setIf(key, value, expiration, ifPresent)
+}
+
+// CompareAndSwap stores a key-value pair only if the entry's current version equals version.
+//
+// Parameters:
+//   - key: The key to store
+//   - version: The expected version, 0 means the key must be absent
+//   - value: The value to store
+//   - expiration: The duration after which the item expires (0 for no expiration)
+//
+// Returns:
+//   - bool: True if the value was stored
+//   - error: ErrNilValue if value is nil
+func (c *lruCache) CompareAndSwap(key string, version uint64, value Value, expiration time.Duration) (bool, error) {
+	return c.setIf(key, value, expiration, ifVersion(version))
+}
+
+// setIf stores a key-value pair if cond holds for the current entry.
+func (c *lruCache) setIf(key string, value Value, expiration time.Duration, cond func(found bool, version uint64) bool) (bool, error) {
+	if value == nil {
+		return false, ErrNilValue
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var version uint64
+	elem, found := c.lookup(key)
+	if found {
+		version = elem.Value.(*lruEntry).version
+	}
+	if !cond(found, version) {
+		return false, nil
+	}
+	var expire time.Time
+	if expiration > 0 {
+		expire = time.Now().Add(expiration)
+	}
+	c.set(key, value, expire)
+	return true, nil
+}
+
+// lookup returns the element of an unexpired key, removing it if it has expired.
+// Note: lock must be held before calling this function.
+func (c *lruCache) lookup(key string) (*list.Element, bool) {
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	if elem.Value.(*lruEntry).expired(time.Now()) {
+		c.expirations.Add(1)
+		c.removeElement(elem, EvictExpired)
+		return nil, false
+	}
+	return elem, true
+}
+
+// Incr atomically adds delta to the counter stored at key, creating it from 0 if absent.
+// The remaining TTL of an existing counter is preserved.
+//
+// Parameters:
+//   - key: The key of the counter
+//   - delta: The amount to add
+//
+// Returns:
+//   - int64: The new counter value
+//   - error: ErrNotCounter if the key holds a non-counter value
+func (c *lruCache) Incr(key string, delta int64) (int64, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var cur Value
+	var expire time.Time
+	if elem, ok := c.lookup(key); ok {
+		entry := elem.Value.(*lruEntry)
+		cur, expire = entry.value, entry.expiry.expireAt
+	}
+	n, err := incrValue(cur, delta)
+	if err != nil {
+		return 0, err
+	}
+	c.set(key, n, expire)
+	return int64(n), nil
+}
+
+// Decr atomically subtracts delta from the counter stored at key.
+//
+// Parameters:
+//   - key: The key of the counter
+//   - delta: The amount to subtract
+//
+// Returns:
+//   - int64: The new counter value
+//   - error: ErrNotCounter if the key holds a non-counter value
+func (c *lruCache) Decr(key string, delta int64) (int64, error) {
+	return c.Incr(key, -delta)
+}
+
+// MGet retrieves the values of keys under a single lock acquisition.
+//
+// Parameters:
+//   - keys: The keys to look up
+//
+// Returns:
+//   - map[string]Value: The values of the keys that were found and not expired
+func (c *lruCache) MGet(keys []string) map[string]Value {
+	if c.admission != nil {
+		for _, key := range keys {
+			c.admission.Record(key)
+		}
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	values := make(map[string]Value, len(keys))
+	for _, key := range keys {
+		if elem, ok := c.lookup(key); ok {
+			c.touch(elem)
+			values[key] = elem.Value.(*lruEntry).value
+		}
+	}
+	return values
+}
+
+// MSet stores all entries with the same expiration under a single lock acquisition.
+//
+// Parameters:
+//   - entries: The key-value pairs to store, nil values delete their key
+//   - expiration: The duration after which the items expire (0 for no expiration)
+//
+// Returns:
+//   - error: Any error encountered during the operation
+func (c *lruCache) MSet(entries map[string]Value, expiration time.Duration) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var expire time.Time
+	if expiration > 0 {
+		expire = time.Now().Add(expiration)
+	}
+	for key, value := range entries {
+		if value == nil {
+			if elem, ok := c.items[key]; ok {
+				c.removeElement(elem, EvictDeleted)
+			}
+			continue
+		}
+		c.set(key, value, expire)
+	}
 	return nil
 }
 
+// MDelete removes keys under a single lock acquisition.
+//
+// Parameters:
+//   - keys: The keys to delete
+//
+// Returns:
+//   - int: The number of keys that were found and deleted
+func (c *lruCache) MDelete(keys []string) int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	n := 0
+	for _, key := range keys {
+		if elem, ok := c.items[key]; ok {
+			c.removeElement(elem, EvictDeleted)
+			n++
+		}
+	}
+	return n
+}
+
 // Delete removes the item with the given key from the cache.
 //
 // Parameters:
@@ -159,7 +452,7 @@ func (c *lruCache) Delete(key string) bool {
 	defer c.mtx.Unlock()
 
 	if elem, ok := c.items[key]; ok {
-		c.removeElement(elem)
+		c.removeElement(elem, EvictDeleted)
 		return true
 	}
 	return false
@@ -174,14 +467,15 @@ func (c *lruCache) Clear() {
 	if c.onEvicted != nil {
 		for _, elem := range c.items {
 			entry := elem.Value.(*lruEntry)
-			c.onEvicted(entry.key, entry.value)
+			c.onEvicted(entry.key, entry.value, EvictCleared)
 		}
 	}
 	// clear all items
 	c.lru.Init()
 	c.items = make(map[string]*list.Element)
-	c.expires = make(map[string]time.Time)
+	c.expiryQueue = nil
 	c.usedBytes = 0
+	c.resetImmortal()
 }
 
 // Len returns the number of items currently in the cache.
@@ -194,32 +488,98 @@ func (c *lruCache) Len() int {
 	return c.lru.Len()
 }
 
+// Range calls fn for each unexpired entry from most to least recently used until fn returns false.
+//
+// Parameters:
+//   - fn: called with the key, value and expiration time (zero for no expiration) of each entry
+func (c *lruCache) Range(fn func(key string, value Value, expireAt time.Time) bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	now := time.Now()
+	// the back is the most recently used end, evict works from the front
+	for elem := c.lru.Back(); elem != nil; elem = elem.Prev() {
+		entry := elem.Value.(*lruEntry)
+		expireAt := entry.expiry.expireAt
+		if !expireAt.IsZero() && !now.Before(expireAt) {
+			continue
+		}
+		if !fn(entry.key, entry.value, expireAt) {
+			return
+		}
+	}
+}
+
+// touch marks the entry of elem as just accessed.
+// Note: lock must be held before calling this function.
+func (c *lruCache) touch(elem *list.Element) {
+	// the back is the most recently used end, evict works from the front
+	c.lru.MoveToBack(elem)
+	elem.Value.(*lruEntry).access = time.Now().UnixNano()
+}
+
+// LastAccess returns when key was last read or written, without counting as an access.
+//
+// Parameters:
+//   - key: The key to look up
+//
+// Returns:
+//   - time.Time: the time of the last read or write of the key
+//   - bool: True if the key was found and not expired, false otherwise
+func (c *lruCache) LastAccess(key string) (time.Time, bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	elem, ok := c.items[key]
+	if !ok || elem.Value.(*lruEntry).expired(time.Now()) {
+		return time.Time{}, false
+	}
+	return time.Unix(0, elem.Value.(*lruEntry).access), true
+}
+
+// Peek returns the value of key without counting as an access.
+//
+// Parameters:
+//   - key: The key to look up
+//
+// Returns:
+//   - Value: The value associated with the key, or nil if not found or expired
+//   - bool: True if the key was found and not expired, false otherwise
+func (c *lruCache) Peek(key string) (Value, bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	elem, ok := c.items[key]
+	if !ok || elem.Value.(*lruEntry).expired(time.Now()) {
+		return nil, false
+	}
+	return elem.Value.(*lruEntry).value, true
+}
+
 // removeElement removes the specified element from the cache.
 // Note: lock must be held before calling this function.
 //
 // Parameters:
 //   - elem: The list element to remove
-func (c *lruCache) removeElement(elem *list.Element) {
+//   - reason: Why the element is removed, passed to the eviction callback
+func (c *lruCache) removeElement(elem *list.Element, reason EvictionReason) {
 	entry := elem.Value.(*lruEntry)
 	c.lru.Remove(elem)
 	delete(c.items, entry.key)
-	delete(c.expires, entry.key)
-	c.usedBytes -= int64(len(entry.key) + entry.value.Len())
+	c.removeImmortal(entry.immortal(), entry.size())
+	c.setExpiration(entry, time.Time{})
+	c.usedBytes -= entry.size()
 
 	if c.onEvicted != nil {
-		c.onEvicted(entry.key, entry.value)
+		c.onEvicted(entry.key, entry.value, reason)
 	}
 }
 
 // evict removes expired items and/or least recently used items if the cache exceeds its limits.
 // Note: lock must be held before calling this function.
 func (c *lruCache) evict() {
-	// evict expired items first
+	// evict expired items first, soonest expiration at the top of the heap
 	now := time.Now()
-	for key, expire := range c.expires {
-		if now.After(expire) {
-			c.removeElement(c.items[key])
-		}
+	for item := c.expiryQueue.peek(); item != nil && now.After(item.expireAt); item = c.expiryQueue.peek() {
+		c.expirations.Add(1)
+		c.removeElement(c.items[item.key], EvictExpired)
 	}
 
 	// evict items until within maxBytes
@@ -227,31 +587,119 @@ func (c *lruCache) evict() {
 		// get the least recently used element(head of the list) and remove it
 		elem := c.lru.Front()
 		if elem != nil {
-			c.removeElement(elem)
+			c.evictions.Add(1)
+			c.removeElement(elem, EvictCapacity)
+		}
+	}
+}
+
+// shed evicts expired items, then the given fraction of the remaining ones,
+// at least one, least recently used first. It runs while the process heap is
+// over its threshold, see Options.MemoryPressure.
+//
+// Parameters:
+//   - fraction: The fraction of the entries to evict
+func (c *lruCache) shed(fraction float64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.evict()
+	for n := max(int(float64(c.lru.Len())*fraction), 1); n > 0; n-- {
+		elem := c.lru.Front()
+		if elem == nil {
+			return
 		}
+		c.evictions.Add(1)
+		c.removeElement(elem, EvictCapacity)
 	}
 }
 
+// CheckInvariants verifies that the list and the index hold the same entries,
+// that every scheduled expiration belongs to an entry and sits at its place in
+// the heap, that usedBytes is the size of the entries within maxBytes and that
+// the immortal counts match the entries without expiration.
+//
+// Returns:
+//   - error: The first inconsistency found wrapping ErrInvariant, nil if there is none
+func (c *lruCache) CheckInvariants() error {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	if c.lru.Len() != len(c.items) {
+		return fmt.Errorf("%w: lru: %d entries listed, %d indexed", ErrInvariant, c.lru.Len(), len(c.items))
+	}
+	var used int64
+	for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*lruEntry)
+		if c.items[entry.key] != elem {
+			return fmt.Errorf("%w: lru: listed key %q is not indexed at its element", ErrInvariant, entry.key)
+		}
+		used += int64(len(entry.key) + entry.value.Len())
+	}
+	if used != c.usedBytes {
+		return fmt.Errorf("%w: lru: entries hold %d bytes, %d accounted", ErrInvariant, used, c.usedBytes)
+	}
+	if c.maxBytes > 0 && c.usedBytes > c.maxBytes {
+		return fmt.Errorf("%w: lru: %d bytes used over the %d max", ErrInvariant, c.usedBytes, c.maxBytes)
+	}
+
+	expiring := 0
+	var immortal, immortalBytes int64
+	for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*lruEntry)
+		if entry.immortal() {
+			immortal++
+			immortalBytes += entry.size()
+			continue
+		}
+		expiring++
+		item := &entry.expiry
+		if item.index < 0 || item.index >= len(c.expiryQueue) || c.expiryQueue[item.index] != item {
+			return fmt.Errorf("%w: lru: expiration of key %q is not at its heap index", ErrInvariant, entry.key)
+		}
+	}
+	if len(c.expiryQueue) != expiring {
+		return fmt.Errorf("%w: lru: %d expirations scheduled, %d entries expire", ErrInvariant, len(c.expiryQueue), expiring)
+	}
+	if entries, bytes := c.Immortal(); entries != immortal || bytes != immortalBytes {
+		return fmt.Errorf("%w: lru: %d entries of %d bytes never expire, %d of %d accounted", ErrInvariant, immortal, immortalBytes, entries, bytes)
+	}
+	for i := 1; i < len(c.expiryQueue); i++ {
+		if c.expiryQueue.Less(i, (i-1)/2) {
+			return fmt.Errorf("%w: lru: expiration heap out of order at %d", ErrInvariant, i)
+		}
+	}
+	return nil
+}
+
 // cleanupLoop runs periodically to clean up expired items.
 func (c *lruCache) cleanupLoop() {
 	for {
 		select {
 		case <-c.cleanupTicker.C:
-			c.mtx.Lock()
-			c.evict()
-			c.mtx.Unlock()
+			c.cleanup()
 		case <-c.closeCh:
 			return
 		}
 	}
 }
 
-// Close stops the cleanup goroutine and closes the cache.
+// cleanup removes the expired items, a panic is reported without ending the loop.
+func (c *lruCache) cleanup() {
+	defer recoverPanic("lru cleanup", c.onPanic)
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.evict()
+}
+
+// Close stops the cleanup goroutine, waiting for it to return, and closes the cache.
 func (c *lruCache) Close() {
 	if c.cleanupTicker != nil {
 		c.cleanupTicker.Stop()
 		close(c.closeCh)
+		c.cleanupDone.Wait()
 	}
+	c.stopPressure()
+	c.stopEvictions()
 }
 
 // GetWithExpiration retrieves the value and expiration duration for the given key.
@@ -264,28 +712,21 @@ func (c *lruCache) Close() {
 //   - time.Duration: The remaining time until expiration, or 0 if no expiration
 //   - bool: True if the key was found and not expired, false otherwise
 func (c *lruCache) GetWithExpiration(key string) (Value, time.Duration, bool) {
-	c.mtx.RLock()
-	defer c.mtx.RUnlock()
-	elem, ok := c.items[key]
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	elem, ok := c.lookup(key)
 	if !ok {
 		return nil, 0, false
 	}
+	c.touch(elem)
 
-	// check expiration
-	now := time.Now()
-	if expire, isExpired := c.expires[key]; isExpired {
-		if now.After(expire) {
-			// delete expired item
-			return nil, 0, false
-		}
-		// get remaining expiration duratinon
-		remaining := expire.Sub(now)
-		c.lru.MoveToBack(elem)
-		return elem.Value.(*lruEntry).value, remaining, true
+	// get remaining expiration duration
+	entry := elem.Value.(*lruEntry)
+	var remaining time.Duration
+	if !entry.expiry.expireAt.IsZero() {
+		remaining = time.Until(entry.expiry.expireAt)
 	}
-	// if not expiration
-	c.lru.MoveToBack(elem)
-	return elem.Value.(*lruEntry).value, 0, true
+	return entry.value, remaining, true
 }
 
 // GetExpiration returns the expiration time for the given key.
@@ -299,8 +740,11 @@ func (c *lruCache) GetWithExpiration(key string) (Value, time.Duration, bool) {
 func (c *lruCache) GetExpiration(key string) (time.Time, bool) {
 	c.mtx.RLock()
 	defer c.mtx.RUnlock()
-	expire, ok := c.expires[key]
-	return expire, ok
+	elem, ok := c.items[key]
+	if !ok || elem.Value.(*lruEntry).expiry.expireAt.IsZero() {
+		return time.Time{}, false
+	}
+	return elem.Value.(*lruEntry).expiry.expireAt, true
 }
 
 // UpdateExpiration updates the expiration time for the given key.
@@ -312,20 +756,40 @@ func (c *lruCache) GetExpiration(key string) (time.Time, bool) {
 // Returns:
 //   - bool: True if the key was found and expiration was updated, false otherwise
 func (c *lruCache) UpdateExpiration(key string, expiration time.Duration) bool {
-	c.mtx.RLock()
-	defer c.mtx.RUnlock()
-	if _, ok := c.items[key]; !ok {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
 		return false
 	}
 
+	var expire time.Time
 	if expiration > 0 {
-		c.expires[key] = time.Now().Add(expiration)
-	} else {
-		delete(c.expires, key)
+		expire = time.Now().Add(expiration)
 	}
+	entry := elem.Value.(*lruEntry)
+	c.removeImmortal(entry.immortal(), entry.size())
+	c.setExpiration(entry, expire)
+	c.addImmortal(entry.immortal(), entry.size())
 	return true
 }
 
+// setExpiration records the expiration time of entry and places it in the
+// expiry queue, zero time means no expiration.
+// Note: lock must be held before calling this function.
+//
+// Parameters:
+//   - entry: The entry whose expiration time is set
+//   - expire: The expiration time, or zero to clear it
+func (c *lruCache) setExpiration(entry *lruEntry, expire time.Time) {
+	entry.expiry.expireAt = expire
+	if expire.IsZero() {
+		c.expiryQueue.unschedule(&entry.expiry)
+		return
+	}
+	c.expiryQueue.schedule(&entry.expiry)
+}
+
 // UsedBytes returns the number of bytes currently used by the cache.
 //
 // Returns:
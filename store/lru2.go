@@ -1,99 +1,791 @@
 package store
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// lru2Store implements a bucketed two-level LRU (LRU-2) cache.
+// Keys are hashed into buckets, each protected by its own lock. A key is first
+// admitted into the bucket's level-1 cache and is promoted to the level-2 cache
+// on its second access, so one-off accesses cannot flush frequently used keys.
 type lru2Store struct {
-	locks []*sync.Mutex
-	// caches [][2]*cache
-	onEvicted   func(key string, value Value)
-	cleanupTick *time.Ticker
-	mask        int32
+	locks         []sync.Mutex                                         // one lock per bucket
+	caches        [][2]*cache                                          // per-bucket level-1 and level-2 caches
+	onEvicted     func(key string, value Value, reason EvictionReason) // callback function when an item is evicted
+	stopEvictions func()                                               // stops the dispatch of eviction callbacks, see Options.EvictionQueue
+	cleanupTick   *time.Ticker                                         // ticker for periodic cleanup
+	closeCh       chan struct{}                                        // channel to signal cleanup goroutine to stop
+	cleanupDone   sync.WaitGroup                                       // joins the cleanup goroutine on Close
+	onPanic       func(err *PanicError)                                // handler of panics in the cleanup loop, see Options.OnPanic
+	mask          int32                                                // bucket mask, bucket count is mask+1
+	usedBytes     atomic.Int64                                         // bytes of keys and values of all entries
+	removalCounts
+	immortalCounts
 }
 
+// newLRU2Cache creates a new LRU-2 cache with the given options.
+//
+// Parameters:
+//   - opts: Options containing bucket count, per-level capacities, cleanup interval, and eviction callback
+//
+// Returns:
+//   - *lru2Store: A pointer to the newly created LRU-2 cache
 func newLRU2Cache(opts Options) *lru2Store {
-	return nil
+	defaults := NewOptions()
+	if opts.BucketCnt == 0 {
+		opts.BucketCnt = defaults.BucketCnt
+	}
+	if opts.CapPerBucket == 0 {
+		opts.CapPerBucket = defaults.CapPerBucket
+	}
+	if opts.Level2Cap == 0 {
+		opts.Level2Cap = defaults.Level2Cap
+	}
+	if opts.CleanupInterval <= 0 {
+		opts.CleanupInterval = defaults.CleanupInterval
+	}
+
+	mask := maskOfNextPowerOfTwo(opts.BucketCnt)
+	s := &lru2Store{
+		locks:       make([]sync.Mutex, mask+1),
+		caches:      make([][2]*cache, mask+1),
+		cleanupTick: time.NewTicker(opts.CleanupInterval),
+		closeCh:     make(chan struct{}),
+		mask:        mask,
+		onPanic:     opts.OnPanic,
+	}
+	s.onEvicted, s.stopEvictions = opts.evictionHook()
+	for i := range s.caches {
+		s.caches[i][0] = Create(opts.CapPerBucket)
+		s.caches[i][1] = Create(opts.Level2Cap)
+	}
+	s.cleanupDone.Go(s.cleanupLoop)
+	return s
 }
 
-func (c *lru2Store) Get(key string) (Value, bool) {
-	return nil, false
+// Get retrieves the value associated with the given key from the cache.
+// A hit in level-1 promotes the entry to level-2.
+//
+// Parameters:
+//   - key: The key to look up in the cache
+//
+// Returns:
+//   - Value: The value associated with the key, or nil if not found or expired
+//   - bool: True if the key was found and not expired, false otherwise
+func (s *lru2Store) Get(key string) (Value, bool) {
+	idx := hashBKBD(key) & s.mask
+	s.locks[idx].Lock()
+	defer s.locks[idx].Unlock()
+
+	n, ok := s.get(idx, key)
+	return n.v, ok
 }
 
-func (c *lru2Store) Set(key string, value Value) error {
-	return nil
+// TTL returns the remaining time to live of the given key without counting as an access.
+//
+// Parameters:
+//   - key: The key to look up
+//
+// Returns:
+//   - time.Duration: The remaining time to live, or 0 if the key never expires
+//   - bool: True if the key was found and not expired, false otherwise
+func (s *lru2Store) TTL(key string) (time.Duration, bool) {
+	idx := hashBKBD(key) & s.mask
+	s.locks[idx].Lock()
+	defer s.locks[idx].Unlock()
+
+	n, ok := s.lookup(idx, key)
+	if !ok {
+		return 0, false
+	}
+	if n.expireAt > 0 {
+		return time.Duration(n.expireAt - Now()), true
+	}
+	return 0, true
+}
+
+// LastAccess returns when key was last read or written, without counting as an access.
+// The time is that of the store's coarse clock, see Now.
+//
+// Parameters:
+//   - key: The key to look up
+//
+// Returns:
+//   - time.Time: the time of the last read or write of the key
+//   - bool: True if the key was found and not expired, false otherwise
+func (s *lru2Store) LastAccess(key string) (time.Time, bool) {
+	idx := hashBKBD(key) & s.mask
+	s.locks[idx].Lock()
+	defer s.locks[idx].Unlock()
+
+	n, ok := s.lookup(idx, key)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, n.access), true
+}
+
+// Peek returns the value of key without counting as an access, a level-1
+// entry is not promoted.
+//
+// Parameters:
+//   - key: The key to look up
+//
+// Returns:
+//   - Value: The value associated with the key, or nil if not found or expired
+//   - bool: True if the key was found and not expired, false otherwise
+func (s *lru2Store) Peek(key string) (Value, bool) {
+	idx := hashBKBD(key) & s.mask
+	s.locks[idx].Lock()
+	defer s.locks[idx].Unlock()
+
+	n, ok := s.lookup(idx, key)
+	return n.v, ok
+}
+
+// GetWithVersion retrieves the value and version associated with the given key.
+//
+// Parameters:
+//   - key: The key to look up in the cache
+//
+// Returns:
+//   - Value: The value associated with the key, or nil if not found or expired
+//   - uint64: The version of the entry, or 0 if not found
+//   - bool: True if the key was found and not expired, false otherwise
+func (s *lru2Store) GetWithVersion(key string) (Value, uint64, bool) {
+	idx := hashBKBD(key) & s.mask
+	s.locks[idx].Lock()
+	defer s.locks[idx].Unlock()
+
+	n, ok := s.get(idx, key)
+	return n.v, n.version, ok
+}
+
+// get looks up key in bucket idx, promoting a level-1 hit to level-2.
+// Note: the bucket lock must be held before calling this function.
+func (s *lru2Store) get(idx int32, key string) (node, bool) {
+	now := Now()
+	// second access: move from level-1 to level-2
+	if n1, ok := s.caches[idx][0].get(key); ok == 1 {
+		n := *n1
+		s.caches[idx][0].del(key)
+		if expired(n.expireAt, now) {
+			s.expirations.Add(1)
+			s.evicted(n, EvictExpired)
+			return node{}, false
+		}
+		s.caches[idx][1].put(n.k, n.v, n.expireAt, n.version, s.displaced)
+		return n, true
+	}
+
+	if n2, ok := s.caches[idx][1].get(key); ok == 1 {
+		n := *n2
+		if expired(n.expireAt, now) {
+			s.caches[idx][1].del(key)
+			s.expirations.Add(1)
+			s.evicted(n, EvictExpired)
+			return node{}, false
+		}
+		return n, true
+	}
+	return node{}, false
 }
 
-func (c *lru2Store) SetWithExpiration(key string, value Value, expiration time.Duration) error {
+// lookup returns the entry of an unexpired key without touching its position,
+// removing it if it has expired.
+// Note: the bucket lock must be held before calling this function.
+func (s *lru2Store) lookup(idx int32, key string) (node, bool) {
+	for _, c := range s.caches[idx] {
+		if i, ok := c.hash[key]; ok {
+			n := c.m[i-1]
+			if expired(n.expireAt, Now()) {
+				s.expirations.Add(1)
+				s.delete(idx, key, EvictExpired)
+				return node{}, false
+			}
+			return n, true
+		}
+	}
+	return node{}, false
+}
+
+// Set stores a key-value pair in the cache with no expiration.
+//
+// Parameters:
+//   - key: The key to store
+//   - value: The value to store
+//
+// Returns:
+//   - error: Any error encountered during the operation
+func (s *lru2Store) Set(key string, value Value) error {
+	return s.SetWithExpiration(key, value, 0)
+}
+
+// SetWithExpiration stores a key-value pair in the cache with an optional expiration duration.
+// New keys enter level-1; keys already promoted to level-2 are updated in place.
+//
+// Parameters:
+//   - key: The key to store
+//   - value: The value to store
+//   - expiration: The duration after which the item expires (0 for no expiration)
+//
+// Returns:
+//   - error: Any error encountered during the operation
+func (s *lru2Store) SetWithExpiration(key string, value Value, expiration time.Duration) error {
+	if value == nil {
+		s.Delete(key)
+		return nil
+	}
+	var expireAt int64
+	if expiration > 0 {
+		expireAt = Now() + int64(expiration)
+	}
+
+	idx := hashBKBD(key) & s.mask
+	s.locks[idx].Lock()
+	defer s.locks[idx].Unlock()
+	s.set(idx, key, value, expireAt)
 	return nil
 }
 
-func (c *lru2Store) Delete(key string) bool {
-	return false
+// set stores a key-value pair in bucket idx.
+// Note: the bucket lock must be held before calling this function.
+func (s *lru2Store) set(idx int32, key string, value Value, expireAt int64) {
+	level := 0
+	if _, ok := s.caches[idx][1].hash[key]; ok {
+		level = 1
+	}
+	if i, ok := s.caches[idx][level].hash[key]; ok {
+		old := s.caches[idx][level].m[i-1]
+		s.usedBytes.Add(-old.size())
+		s.removeImmortal(old.expireAt == 0, old.size())
+	}
+	s.usedBytes.Add(int64(len(key) + value.Len()))
+	s.addImmortal(expireAt == 0, int64(len(key)+value.Len()))
+	s.caches[idx][level].put(key, value, expireAt, nextVersion(), s.displaced)
+}
+
+// SetNX stores a key-value pair only if the key is absent.
+//
+// Parameters:
+//   - key: The key to store
+//   - value: The value to store
+//   - expiration: The duration after which the item expires (0 for no expiration)
+//
+// Returns:
+//   - bool: True if the value was stored
+//   - error: ErrNilValue if value is nil
+func (s *lru2Store) SetNX(key string, value Value, expiration time.Duration) (bool, error) {
+	return s.setIf(key, value, expiration, ifAbsent)
+}
+
+// SetXX stores a key-value pair only if the key is present.
+//
+// Parameters:
+//   - key: The key to store
+//   - value: The value to store
+//   - expiration: The duration after which the item expires (0 for no expiration)
+//
+// Returns:
+//   - bool: True if the value was stored
+//   - error: ErrNilValue if value is nil
+func (s *lru2Store) SetXX(key string, value Value, expiration time.Duration) (bool, error) {
+	return s.setIf(key, value, expiration, ifPresent)
 }
 
-func (c *lru2Store) Clear() {
+// CompareAndSwap stores a key-value pair only if the entry's current version equals version.
+//
+// Parameters:
+//   - key: The key to store
+//   - version: The expected version, 0 means the key must be absent
+//   - value: The value to store
+//   - expiration: The duration after which the item expires (0 for no expiration)
+//
+// Returns:
+//   - bool: True if the value was stored
+//   - error: ErrNilValue if value is nil
+func (s *lru2Store) CompareAndSwap(key string, version uint64, value Value, expiration time.Duration) (bool, error) {
+	return s.setIf(key, value, expiration, ifVersion(version))
 }
 
-func (c *lru2Store) Len() int {
-	return 0
+// setIf stores a key-value pair if cond holds for the current entry.
+func (s *lru2Store) setIf(key string, value Value, expiration time.Duration, cond func(found bool, version uint64) bool) (bool, error) {
+	if value == nil {
+		return false, ErrNilValue
+	}
+	var expireAt int64
+	if expiration > 0 {
+		expireAt = Now() + int64(expiration)
+	}
+
+	idx := hashBKBD(key) & s.mask
+	s.locks[idx].Lock()
+	defer s.locks[idx].Unlock()
+
+	n, found := s.lookup(idx, key)
+	if !cond(found, n.version) {
+		return false, nil
+	}
+	s.set(idx, key, value, expireAt)
+	return true, nil
+}
+
+// Incr atomically adds delta to the counter stored at key, creating it from 0 if absent.
+// The remaining TTL of an existing counter is preserved.
+//
+// Parameters:
+//   - key: The key of the counter
+//   - delta: The amount to add
+//
+// Returns:
+//   - int64: The new counter value
+//   - error: ErrNotCounter if the key holds a non-counter value
+func (s *lru2Store) Incr(key string, delta int64) (int64, error) {
+	idx := hashBKBD(key) & s.mask
+	s.locks[idx].Lock()
+	defer s.locks[idx].Unlock()
+
+	cur, _ := s.lookup(idx, key)
+	n, err := incrValue(cur.v, delta)
+	if err != nil {
+		return 0, err
+	}
+	s.set(idx, key, n, cur.expireAt)
+	return int64(n), nil
+}
+
+// Decr atomically subtracts delta from the counter stored at key.
+//
+// Parameters:
+//   - key: The key of the counter
+//   - delta: The amount to subtract
+//
+// Returns:
+//   - int64: The new counter value
+//   - error: ErrNotCounter if the key holds a non-counter value
+func (s *lru2Store) Decr(key string, delta int64) (int64, error) {
+	return s.Incr(key, -delta)
 }
 
-func (c *lru2Store) Close() {
+// Delete removes the item with the given key from both levels of the cache.
+//
+// Parameters:
+//   - key: The key of the item to delete
+//
+// Returns:
+//   - bool: True if the item was found and deleted, false otherwise
+func (s *lru2Store) Delete(key string) bool {
+	idx := hashBKBD(key) & s.mask
+	s.locks[idx].Lock()
+	defer s.locks[idx].Unlock()
+	return s.delete(idx, key, EvictDeleted)
+}
+
+// Clear removes all items from the cache.
+func (s *lru2Store) Clear() {
+	for i := range s.caches {
+		s.locks[i].Lock()
+		var keys []string
+		for _, c := range s.caches[i] {
+			c.walk(func(k string, v Value, expireAt int64) bool {
+				keys = append(keys, k)
+				return true
+			})
+		}
+		for _, k := range keys {
+			s.delete(int32(i), k, EvictCleared)
+		}
+		s.locks[i].Unlock()
+	}
 }
 
+// Len returns the number of unexpired items currently in the cache.
+//
+// Returns:
+//   - int: The number of items in the cache
+func (s *lru2Store) Len() int {
+	cnt := 0
+	now := Now()
+	for i := range s.caches {
+		s.locks[i].Lock()
+		for _, c := range s.caches[i] {
+			c.walk(func(k string, v Value, expireAt int64) bool {
+				if !expired(expireAt, now) {
+					cnt++
+				}
+				return true
+			})
+		}
+		s.locks[i].Unlock()
+	}
+	return cnt
+}
+
+// Range calls fn for each unexpired entry, bucket by bucket, until fn returns false.
+//
+// Parameters:
+//   - fn: called with the key, value and expiration time (zero for no expiration) of each entry
+func (s *lru2Store) Range(fn func(key string, value Value, expireAt time.Time) bool) {
+	now := Now()
+	for i := range s.caches {
+		s.locks[i].Lock()
+		more := true
+		for _, c := range s.caches[i] {
+			c.walk(func(k string, v Value, expireAt int64) bool {
+				if expired(expireAt, now) {
+					return true
+				}
+				var at time.Time
+				if expireAt > 0 {
+					at = time.Unix(0, expireAt)
+				}
+				more = fn(k, v, at)
+				return more
+			})
+			if !more {
+				break
+			}
+		}
+		s.locks[i].Unlock()
+		if !more {
+			return
+		}
+	}
+}
+
+// UsedBytes returns the number of bytes of the keys and values of all entries.
+// The store is bounded by entry counts, the bytes are only reported.
+//
+// Returns:
+//   - int64: The number of bytes currently used
+func (s *lru2Store) UsedBytes() int64 {
+	return s.usedBytes.Load()
+}
+
+// Close stops the cleanup goroutine, waiting for it to return, and closes the cache.
+func (s *lru2Store) Close() {
+	if s.cleanupTick != nil {
+		s.cleanupTick.Stop()
+		close(s.closeCh)
+		s.cleanupDone.Wait()
+	}
+	s.stopEvictions()
+}
+
+// delete removes key from both levels of bucket idx.
+// Note: the bucket lock must be held before calling this function.
+func (s *lru2Store) delete(idx int32, key string, reason EvictionReason) bool {
+	found := false
+	for _, c := range s.caches[idx] {
+		if n, ok := c.del(key); ok == 1 {
+			s.evicted(n, reason)
+			found = true
+		}
+	}
+	return found
+}
+
+// evicted releases the bytes of a removed entry and invokes the eviction callback if one is set.
+func (s *lru2Store) evicted(n node, reason EvictionReason) {
+	s.usedBytes.Add(-n.size())
+	s.removeImmortal(n.expireAt == 0, n.size())
+	if s.onEvicted != nil {
+		s.onEvicted(n.k, n.v, reason)
+	}
+}
+
+// displaced counts an entry evicted to make room in a full level and invokes the eviction callback.
+func (s *lru2Store) displaced(n node) {
+	s.evictions.Add(1)
+	s.evicted(n, EvictCapacity)
+}
+
+// CheckInvariants verifies, with every bucket locked, that each level's
+// links form one chain through its allocated slots, that the live slots are
+// indexed at their places, that a key lives in one level of the bucket it
+// hashes to, that usedBytes is the size of the entries and that the immortal
+// counts match the entries without expiration.
+//
+// Returns:
+//   - error: The first inconsistency found wrapping ErrInvariant, nil if there is none
+func (s *lru2Store) CheckInvariants() error {
+	for i := range s.locks {
+		s.locks[i].Lock()
+		defer s.locks[i].Unlock()
+	}
+
+	var used, immortal, immortalBytes int64
+	for i := range s.caches {
+		for level, c := range s.caches[i] {
+			slots, live := 0, 0
+			last := uint16(0)
+			for idx := c.dlink[0][next]; idx != 0; idx = c.dlink[idx][next] {
+				if c.dlink[idx][prev] != last {
+					return fmt.Errorf("%w: lru2: bucket %d level %d: slot %d linked back to %d, not %d", ErrInvariant, i, level, idx, c.dlink[idx][prev], last)
+				}
+				if slots++; slots > int(c.last) {
+					return fmt.Errorf("%w: lru2: bucket %d level %d: chain longer than its %d slots", ErrInvariant, i, level, c.last)
+				}
+				last = idx
+				n := c.m[idx-1]
+				if n.v == nil {
+					continue
+				}
+				live++
+				if c.hash[n.k] != idx {
+					return fmt.Errorf("%w: lru2: bucket %d level %d: key %q is not indexed at its slot", ErrInvariant, i, level, n.k)
+				}
+				if hashBKBD(n.k)&s.mask != int32(i) {
+					return fmt.Errorf("%w: lru2: key %q is in bucket %d, not its own", ErrInvariant, n.k, i)
+				}
+				if _, ok := s.caches[i][1-level].hash[n.k]; ok {
+					return fmt.Errorf("%w: lru2: key %q is in both levels of bucket %d", ErrInvariant, n.k, i)
+				}
+				used += n.size()
+				if n.expireAt == 0 {
+					immortal++
+					immortalBytes += n.size()
+				}
+			}
+			if c.dlink[0][prev] != last || slots != int(c.last) {
+				return fmt.Errorf("%w: lru2: bucket %d level %d: %d of %d slots chained", ErrInvariant, i, level, slots, c.last)
+			}
+			if live != len(c.hash) {
+				return fmt.Errorf("%w: lru2: bucket %d level %d: %d entries live, %d indexed", ErrInvariant, i, level, live, len(c.hash))
+			}
+		}
+	}
+	if used != s.usedBytes.Load() {
+		return fmt.Errorf("%w: lru2: entries hold %d bytes, %d accounted", ErrInvariant, used, s.usedBytes.Load())
+	}
+	if n, bytes := s.Immortal(); n != immortal || bytes != immortalBytes {
+		return fmt.Errorf("%w: lru2: %d entries of %d bytes never expire, %d of %d accounted", ErrInvariant, immortal, immortalBytes, n, bytes)
+	}
+	return nil
+}
+
+// cleanupLoop runs periodically to clean up expired items.
+func (s *lru2Store) cleanupLoop() {
+	for {
+		select {
+		case <-s.cleanupTick.C:
+			for i := range s.caches {
+				s.cleanup(i)
+			}
+		case <-s.closeCh:
+			return
+		}
+	}
+}
+
+// cleanup removes the expired items of bucket i, a panic is reported without
+// ending the loop.
+func (s *lru2Store) cleanup(i int) {
+	defer recoverPanic("lru2 cleanup", s.onPanic)
+	s.locks[i].Lock()
+	defer s.locks[i].Unlock()
+	now := Now()
+	var keys []string
+	for _, c := range s.caches[i] {
+		c.walk(func(k string, v Value, expireAt int64) bool {
+			if expired(expireAt, now) {
+				keys = append(keys, k)
+			}
+			return true
+		})
+	}
+	for _, k := range keys {
+		s.delete(int32(i), k, EvictExpired)
+	}
+	s.expirations.Add(int64(len(keys)))
+}
+
+// expired reports whether expireAt (0 for no expiration) has passed at now.
+func expired(expireAt, now int64) bool {
+	return expireAt > 0 && now >= expireAt
+}
+
+// clock is a coarse wall clock in nanoseconds, refreshed in the background
+// so hot paths don't have to call time.Now().
+var clock = time.Now().UnixNano()
+
+// Now returns the coarse current time in nanoseconds.
 func Now() int64 {
-	return 0
+	return atomic.LoadInt64(&clock)
 }
 
 func init() {
-
+	go func() {
+		for {
+			// calibrate once a second, advance in 100ms steps in between
+			atomic.StoreInt64(&clock, time.Now().UnixNano())
+			for i := 0; i < 9; i++ {
+				time.Sleep(100 * time.Millisecond)
+				atomic.AddInt64(&clock, int64(100*time.Millisecond))
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}()
 }
 
+// hashBKBD computes the BKDR hash of key.
 func hashBKBD(key string) (hash int32) {
-	return 0
+	for i := 0; i < len(key); i++ {
+		hash = hash*131 + int32(key[i])
+	}
+	return hash
 }
 
+// maskOfNextPowerOfTwo returns the mask (n-1) of the smallest power of two n >= cap.
 func maskOfNextPowerOfTwo(cap uint16) int32 {
 	if cap == 0 {
 		return 0
 	}
-	return int32(cap - 1)
+	cap--
+	cap |= cap >> 1
+	cap |= cap >> 2
+	cap |= cap >> 4
+	cap |= cap >> 8
+	return int32(cap)
 }
 
+// link directions in cache.dlink
+const (
+	prev = 0
+	next = 1
+)
+
+// node is a single slot of a fixed-capacity cache.
 type node struct {
 	k        string
-	v        Value
-	expireAt int64
+	v        Value  // nil marks a free slot
+	expireAt int64  // expiration time in nanoseconds, 0 for no expiration
+	version  uint64 // version of the entry, renewed on every write
+	access   int64  // time of the last read or write in nanoseconds, see lru2Store.LastAccess
 }
 
+// size returns the bytes of the node's key and value.
+func (n node) size() int64 {
+	return int64(len(n.k) + n.v.Len())
+}
+
+// cache is a fixed-capacity LRU backed by arrays.
+// Slots are 1-indexed in dlink; dlink[0] is the sentinel whose next is the
+// head (most recently used) and whose prev is the tail (least recently used).
 type cache struct {
-	dlink [][2]uint16
-	m     []node
-	hash  map[string]uint16
-	last  uint16
+	dlink [][2]uint16       // prev/next links of each slot
+	m     []node            // slots
+	hash  map[string]uint16 // key to slot index
+	last  uint16            // number of slots ever allocated
 }
 
+// Create creates a fixed-capacity cache holding at most cap entries.
 func Create(cap uint16) *cache {
-	return &cache{}
+	return &cache{
+		dlink: make([][2]uint16, uint32(cap)+1),
+		m:     make([]node, cap),
+		hash:  make(map[string]uint16, cap),
+	}
 }
 
-func (c *cache) put(k string, v Value, expireAt int64, onEvict func(string, Value)) int {
-	return 0
+// put inserts or updates k and moves it to the head.
+// When the cache is full the tail slot is reused and its entry evicted.
+//
+// Returns:
+//   - int: 1 if a new entry was inserted, 0 if an existing entry was updated
+func (c *cache) put(k string, v Value, expireAt int64, version uint64, onEvict func(node)) int {
+	if idx, ok := c.hash[k]; ok {
+		c.m[idx-1].v, c.m[idx-1].expireAt, c.m[idx-1].version, c.m[idx-1].access = v, expireAt, version, Now()
+		c.adjust(idx, prev, next)
+		return 0
+	}
+
+	if c.last == uint16(len(c.m)) {
+		// reuse the tail slot
+		idx := c.dlink[0][prev]
+		tail := &c.m[idx-1]
+		if tail.v != nil {
+			delete(c.hash, tail.k)
+			if onEvict != nil {
+				onEvict(*tail)
+			}
+		}
+		tail.k, tail.v, tail.expireAt, tail.version, tail.access = k, v, expireAt, version, Now()
+		c.hash[k] = idx
+		c.adjust(idx, prev, next)
+		return 1
+	}
+
+	// allocate a new slot at the head
+	c.last++
+	if c.dlink[0][next] == 0 {
+		c.dlink[0][prev] = c.last
+	} else {
+		c.dlink[c.dlink[0][next]][prev] = c.last
+	}
+	c.m[c.last-1] = node{k: k, v: v, expireAt: expireAt, version: version, access: Now()}
+	c.dlink[c.last] = [2]uint16{0, c.dlink[0][next]}
+	c.dlink[0][next] = c.last
+	c.hash[k] = c.last
+	return 1
 }
 
+// get looks up k and moves it to the head.
+//
+// Returns:
+//   - *node: the slot holding k, only valid until the next mutation
+//   - int: 1 if found, 0 otherwise
 func (c *cache) get(k string) (*node, int) {
+	if idx, ok := c.hash[k]; ok {
+		c.adjust(idx, prev, next)
+		c.m[idx-1].access = Now()
+		return &c.m[idx-1], 1
+	}
 	return nil, 0
 }
 
-func (c *cache) del(k string) int {
-	return 0
+// del removes k, frees its slot and moves the slot to the tail for reuse.
+//
+// Returns:
+//   - node: a copy of the removed entry
+//   - int: 1 if found, 0 otherwise
+func (c *cache) del(k string) (node, int) {
+	idx, ok := c.hash[k]
+	if !ok {
+		return node{}, 0
+	}
+	n := c.m[idx-1]
+	delete(c.hash, k)
+	c.m[idx-1] = node{}
+	c.adjust(idx, next, prev)
+	return n, 1
 }
 
+// walk visits live entries from most to least recently used until walker returns false.
 func (c *cache) walk(walker func(k string, v Value, expireAt int64) bool) {
+	for idx := c.dlink[0][next]; idx != 0; idx = c.dlink[idx][next] {
+		n := &c.m[idx-1]
+		if n.v != nil && !walker(n.k, n.v, n.expireAt) {
+			return
+		}
+	}
 }
 
+// adjust moves slot idx to the head (f=prev, t=next) or to the tail (f=next, t=prev).
 func (c *cache) adjust(idx, f, t uint16) {
-
+	if c.dlink[idx][f] == 0 {
+		// already at the target end
+		return
+	}
+	// unlink
+	c.dlink[c.dlink[idx][t]][f] = c.dlink[idx][f]
+	c.dlink[c.dlink[idx][f]][t] = c.dlink[idx][t]
+	// relink at the target end
+	c.dlink[idx][f] = 0
+	c.dlink[idx][t] = c.dlink[0][t]
+	c.dlink[c.dlink[0][t]][f] = idx
+	c.dlink[0][t] = idx
 }
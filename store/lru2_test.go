@@ -0,0 +1,108 @@
+package store
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// lru2Order returns the keys of a level of the first bucket of s from the
+// most to the least recently used
+func lru2Order(s *lru2Store, level int) []string {
+	s.locks[0].Lock()
+	defer s.locks[0].Unlock()
+	var keys []string
+	s.caches[0][level].walk(func(k string, _ Value, _ int64) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
+
+func TestLRU2RecencyOrder(t *testing.T) {
+	s := newLRU2Cache(Options{BucketCnt: 1, CapPerBucket: 2, Level2Cap: 2})
+	defer s.Close()
+	for _, key := range []string{"a", "b", "c"} {
+		s.Set(key, simValue(1))
+	}
+	// the second access promotes to level-2
+	s.Get("b")
+	if got, want := lru2Order(s, 0), []string{"c"}; !slices.Equal(got, want) {
+		t.Fatalf("level-1 = %v, want %v", got, want)
+	}
+	s.Set("d", simValue(1))
+	s.Set("e", simValue(1))
+	s.Get("d")
+	s.Get("b")
+	if got, want := lru2Order(s, 1), []string{"b", "d"}; !slices.Equal(got, want) {
+		t.Fatalf("level-2 = %v, want %v", got, want)
+	}
+	// a write to a promoted key stays in level-2, a Peek promotes nothing
+	s.Set("d", simValue(2))
+	s.Peek("e")
+	if got, want := lru2Order(s, 1), []string{"d", "b"}; !slices.Equal(got, want) {
+		t.Fatalf("level-2 after Set = %v, want %v", got, want)
+	}
+	if got, want := lru2Order(s, 0), []string{"e"}; !slices.Equal(got, want) {
+		t.Fatalf("level-1 after Peek = %v, want %v", got, want)
+	}
+	if err := s.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLRU2Eviction(t *testing.T) {
+	onEvicted, evicted := evictionRecorder()
+	s := newLRU2Cache(Options{BucketCnt: 1, CapPerBucket: 2, Level2Cap: 2, OnEvictedReason: onEvicted})
+	defer s.Close()
+	for _, key := range []string{"a", "b", "c"} {
+		s.Set(key, simValue(1))
+	}
+	s.Get("b")
+	s.Get("c")
+	s.Set("d", simValue(1))
+	s.Get("d")
+	if got, want := evicted[EvictCapacity], []string{"a", "b"}; !slices.Equal(got, want) {
+		t.Fatalf("evicted %v, want %v", got, want)
+	}
+	if s.Len() != 2 || s.UsedBytes() != 4 || s.Removals().Evicted != 2 {
+		t.Fatalf("Len = %d, UsedBytes = %d, evicted = %d, want 2, 4 and 2", s.Len(), s.UsedBytes(), s.Removals().Evicted)
+	}
+	if err := s.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLRU2Expiry(t *testing.T) {
+	onEvicted, evicted := evictionRecorder()
+	s := newLRU2Cache(Options{BucketCnt: 1, OnEvictedReason: onEvicted})
+	defer s.Close()
+	s.SetWithExpiration("short", simValue(1), 50*time.Millisecond)
+	s.SetWithExpiration("long", simValue(1), time.Hour)
+	s.Set("never", simValue(1))
+	// the store's clock advances in steps of 100ms
+	time.Sleep(300 * time.Millisecond)
+
+	if _, ok := s.TTL("short"); ok {
+		t.Fatal("TTL found an expired key")
+	}
+	if ttl, ok := s.TTL("long"); !ok || ttl <= 0 {
+		t.Fatalf("TTL of long = %s, %t", ttl, ok)
+	}
+	s.cleanup(0)
+	if got := evicted[EvictExpired]; !slices.Equal(got, []string{"short"}) {
+		t.Fatalf("expired %v, want [short]", got)
+	}
+	if s.Len() != 2 || s.Removals().Expired != 1 {
+		t.Fatalf("Len = %d, expired = %d, want 2 and 1", s.Len(), s.Removals().Expired)
+	}
+	if err := s.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLRU2Invariants(t *testing.T) {
+	s := newLRU2Cache(Options{BucketCnt: 4, CapPerBucket: 8, Level2Cap: 4})
+	defer s.Close()
+	checkRandomOps(t, s, 20000)
+}
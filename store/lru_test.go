@@ -0,0 +1,140 @@
+package store
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// lruOrder returns the keys of c from the least to the most recently used
+func lruOrder(c *lruCache) []string {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	var keys []string
+	for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+		keys = append(keys, elem.Value.(*lruEntry).key)
+	}
+	return keys
+}
+
+func TestLRURecencyOrder(t *testing.T) {
+	c := newLRUCache(Options{})
+	defer c.Close()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		c.Set(key, simValue(1))
+	}
+	c.Get("a")
+	c.Set("c", simValue(2))
+	if got, want := lruOrder(c), []string{"b", "d", "a", "c"}; !slices.Equal(got, want) {
+		t.Fatalf("order after Get and Set = %v, want %v", got, want)
+	}
+	// reads that don't count as an access leave the order alone
+	c.Peek("b")
+	c.TTL("b")
+	c.LastAccess("b")
+	c.Range(func(string, Value, time.Time) bool { return true })
+	if got, want := lruOrder(c), []string{"b", "d", "a", "c"}; !slices.Equal(got, want) {
+		t.Fatalf("order after Peek, TTL and Range = %v, want %v", got, want)
+	}
+}
+
+func TestLRUExpiryHeapOrder(t *testing.T) {
+	c := newLRUCache(Options{})
+	defer c.Close()
+	ttls := []time.Duration{5, 1, 4, 9, 2, 7, 3, 8, 6}
+	for i, ttl := range ttls {
+		c.SetWithExpiration(string(rune('a'+i)), simValue(1), ttl*time.Hour)
+	}
+	c.Set("never", simValue(1))
+	// a write moves an entry within the heap, clearing its ttl takes it out
+	c.SetWithExpiration("d", simValue(1), 30*time.Minute)
+	c.Set("f", simValue(1))
+	if err := c.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for {
+		c.mtx.RLock()
+		item := c.expiryQueue.peek()
+		c.mtx.RUnlock()
+		if item == nil {
+			break
+		}
+		got = append(got, item.key)
+		c.Delete(item.key)
+		if err := c.CheckInvariants(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"d", "b", "e", "g", "c", "a", "i", "h"}; !slices.Equal(got, want) {
+		t.Fatalf("expiration order = %v, want %v", got, want)
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	onEvicted, evicted := evictionRecorder()
+	c := newLRUCache(Options{OnEvictedReason: onEvicted})
+	defer c.Close()
+	c.SetWithExpiration("short", simValue(1), time.Millisecond)
+	c.SetWithExpiration("long", simValue(1), time.Hour)
+	c.Set("never", simValue(1))
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := c.Get("short"); ok {
+		t.Fatal("Get found an expired key")
+	}
+	c.cleanup()
+	if got := evicted[EvictExpired]; !slices.Equal(got, []string{"short"}) {
+		t.Fatalf("expired %v, want [short]", got)
+	}
+	if c.Len() != 2 || c.Removals().Expired != 1 {
+		t.Fatalf("Len = %d, expired = %d, want 2 and 1", c.Len(), c.Removals().Expired)
+	}
+	if err := c.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	onEvicted, evicted := evictionRecorder()
+	// four entries of 1+9 bytes fit
+	c := newLRUCache(Options{MaxBytes: 40, OnEvictedReason: onEvicted})
+	defer c.Close()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		c.Set(key, simValue(9))
+	}
+	c.Get("a")
+	c.Set("e", simValue(9))
+	c.Set("f", simValue(9))
+	if got := evicted[EvictCapacity]; !slices.Equal(got, []string{"b", "c"}) {
+		t.Fatalf("evicted %v, want [b c]", got)
+	}
+	if got, want := lruOrder(c), []string{"d", "a", "e", "f"}; !slices.Equal(got, want) {
+		t.Fatalf("order = %v, want %v", got, want)
+	}
+	if c.UsedBytes() != 40 || c.Removals().Evicted != 2 {
+		t.Fatalf("UsedBytes = %d, evicted = %d, want 40 and 2", c.UsedBytes(), c.Removals().Evicted)
+	}
+
+	// growing an entry evicts the least recently used others
+	c.Set("f", simValue(19))
+	if got := evicted[EvictCapacity]; !slices.Equal(got, []string{"b", "c", "d"}) {
+		t.Fatalf("evicted %v, want [b c d]", got)
+	}
+	if err := c.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLRUInvariants(t *testing.T) {
+	c := newLRUCache(Options{MaxBytes: 512})
+	defer c.Close()
+	checkRandomOps(t, c, 20000)
+}
+
+func TestLRUInvariantsUnbounded(t *testing.T) {
+	c := newLRUCache(Options{})
+	defer c.Close()
+	checkRandomOps(t, c, 20000)
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// PanicError is a panic recovered in a background goroutine, converted to an
+// error so it can be reported instead of crashing the process.
+type PanicError struct {
+	Where string // the goroutine or handler that panicked
+	Value any    // the value passed to panic
+	Stack []byte // the stack of the panicking goroutine
+}
+
+// Error returns the place and value of the panic.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in %s: %v", e.Where, e.Value)
+}
+
+// Unwrap returns the value of the panic if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// NewPanicError converts a value recovered from a panic to an error, with the
+// stack of the calling goroutine.
+//
+// Parameters:
+//   - where: The goroutine or handler that panicked
+//   - value: The value returned by recover
+//
+// Returns:
+//   - *PanicError: The panic as an error
+func NewPanicError(where string, value any) *PanicError {
+	return &PanicError{Where: where, Value: value, Stack: debug.Stack()}
+}
+
+// recoverPanic recovers a panic of the calling goroutine and hands it to
+// onPanic, or logs it when onPanic is nil. It must be deferred directly.
+//
+// Parameters:
+//   - where: The goroutine that may panic
+//   - onPanic: The handler of the recovered panic, see Options.OnPanic
+func recoverPanic(where string, onPanic func(err *PanicError)) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	err := NewPanicError(where, r)
+	if onPanic == nil {
+		log.Printf("store: %v\n%s", err, err.Stack)
+		return
+	}
+	onPanic(err)
+}
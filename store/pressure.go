@@ -0,0 +1,96 @@
+package store
+
+import (
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"time"
+)
+
+// heapMetric is the runtime metric holding the bytes of live and not yet
+// swept heap objects, cheap to read unlike runtime.ReadMemStats.
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// MemoryPressure configures the proactive eviction of a store while the
+// process heap is close to its limit, on top of the approximate MaxBytes
+// accounting. Only LRU and ShardedLRU stores honor it.
+type MemoryPressure struct {
+	HeapLimit uint64        // heap bytes the process should stay under, 0 uses the GOMEMLIMIT soft limit
+	Threshold float64       // fraction of HeapLimit from which entries are shed, 0 means 0.9
+	Shed      float64       // fraction of the entries evicted per check over the threshold, 0 means 0.05
+	Interval  time.Duration // time between heap checks, 0 means 1s
+}
+
+// withDefaults returns p with its zero fields set to their defaults.
+func (p MemoryPressure) withDefaults() MemoryPressure {
+	if p.HeapLimit == 0 {
+		if limit := debug.SetMemoryLimit(-1); limit > 0 && limit < math.MaxInt64 {
+			p.HeapLimit = uint64(limit)
+		}
+	}
+	if p.Threshold <= 0 {
+		p.Threshold = 0.9
+	}
+	if p.Shed <= 0 || p.Shed > 1 {
+		p.Shed = 0.05
+	}
+	if p.Interval <= 0 {
+		p.Interval = time.Second
+	}
+	return p
+}
+
+// heapBytes returns the bytes of the heap objects of the process.
+func heapBytes() uint64 {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// watch starts checking the heap every Interval and calls shed with the Shed
+// fraction whenever it is over the threshold. Without a HeapLimit, given or
+// from GOMEMLIMIT, nothing is watched.
+//
+// Parameters:
+//   - shed: Evicts the given fraction of the store's entries
+//   - onPanic: The handler of panics while shedding, see Options.OnPanic
+//
+// Returns:
+//   - func(): Stops watching and waits for the watching goroutine to return, never nil
+func (p *MemoryPressure) watch(shed func(fraction float64), onPanic func(err *PanicError)) func() {
+	if p == nil {
+		return func() {}
+	}
+	conf := p.withDefaults()
+	if conf.HeapLimit == 0 {
+		return func() {}
+	}
+	threshold := uint64(float64(conf.HeapLimit) * conf.Threshold)
+	ticker := time.NewTicker(conf.Interval)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if heapBytes() >= threshold {
+					func() {
+						defer recoverPanic("memory pressure", onPanic)
+						shed(conf.Shed)
+					}()
+				}
+			case <-done:
+				return
+			}
+		}
+	})
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
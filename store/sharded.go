@@ -0,0 +1,286 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// shardedStore spreads keys over independent lru shards to reduce lock contention.
+// Each shard owns an equal share of MaxBytes and does its own byte accounting.
+type shardedStore struct {
+	shards []*lruCache // shards, count is a power of two
+	mask   int32       // shard mask, shard count is mask+1
+	// stopEvictions: stops the dispatch of eviction callbacks, shared by the shards
+	stopEvictions func()
+	stopPressure  func() // stops watching the heap for all shards, see Options.MemoryPressure
+}
+
+// newShardedStore creates a sharded lru store with the given options.
+//
+// Parameters:
+//   - opts: Options containing shard count, max bytes, cleanup interval, and eviction callback
+//
+// Returns:
+//   - *shardedStore: A pointer to the newly created sharded store
+func newShardedStore(opts Options) *shardedStore {
+	if opts.ShardCnt == 0 {
+		opts.ShardCnt = NewOptions().ShardCnt
+	}
+	mask := maskOfNextPowerOfTwo(opts.ShardCnt)
+	s := &shardedStore{
+		shards: make([]*lruCache, mask+1),
+		mask:   mask,
+	}
+	shardOpts := opts
+	// one set of dispatch workers serves all shards
+	shardOpts.OnEvicted, shardOpts.EvictionQueue = nil, 0
+	shardOpts.OnEvictedReason, s.stopEvictions = opts.evictionHook()
+	// one heap watcher sheds from every shard
+	shardOpts.MemoryPressure = nil
+	if opts.MaxBytes > 0 {
+		shardOpts.MaxBytes = max(opts.MaxBytes/int64(len(s.shards)), 1)
+	}
+	for i := range s.shards {
+		s.shards[i] = newLRUCache(shardOpts)
+	}
+	s.stopPressure = opts.MemoryPressure.watch(s.shed, opts.OnPanic)
+	return s
+}
+
+// shard returns the shard owning key.
+func (s *shardedStore) shard(key string) *lruCache {
+	return s.shards[hashBKBD(key)&s.mask]
+}
+
+// Get retrieves the value associated with the given key from its shard.
+func (s *shardedStore) Get(key string) (Value, bool) {
+	return s.shard(key).Get(key)
+}
+
+// Set stores a key-value pair in its shard with no expiration.
+func (s *shardedStore) Set(key string, value Value) error {
+	return s.shard(key).Set(key, value)
+}
+
+// SetWithExpiration stores a key-value pair in its shard with an optional expiration duration.
+func (s *shardedStore) SetWithExpiration(key string, value Value, expiration time.Duration) error {
+	return s.shard(key).SetWithExpiration(key, value, expiration)
+}
+
+// Delete removes the item with the given key from its shard.
+func (s *shardedStore) Delete(key string) bool {
+	return s.shard(key).Delete(key)
+}
+
+// GetWithVersion retrieves the value and version associated with the given key from its shard.
+func (s *shardedStore) GetWithVersion(key string) (Value, uint64, bool) {
+	return s.shard(key).GetWithVersion(key)
+}
+
+// TTL returns the remaining time to live of the given key from its shard.
+func (s *shardedStore) TTL(key string) (time.Duration, bool) {
+	return s.shard(key).TTL(key)
+}
+
+// SetNX stores a key-value pair in its shard only if the key is absent.
+func (s *shardedStore) SetNX(key string, value Value, expiration time.Duration) (bool, error) {
+	return s.shard(key).SetNX(key, value, expiration)
+}
+
+// SetXX stores a key-value pair in its shard only if the key is present.
+func (s *shardedStore) SetXX(key string, value Value, expiration time.Duration) (bool, error) {
+	return s.shard(key).SetXX(key, value, expiration)
+}
+
+// CompareAndSwap stores a key-value pair in its shard only if the entry's version equals version.
+func (s *shardedStore) CompareAndSwap(key string, version uint64, value Value, expiration time.Duration) (bool, error) {
+	return s.shard(key).CompareAndSwap(key, version, value, expiration)
+}
+
+// Incr atomically adds delta to the counter stored at key in its shard.
+func (s *shardedStore) Incr(key string, delta int64) (int64, error) {
+	return s.shard(key).Incr(key, delta)
+}
+
+// Decr atomically subtracts delta from the counter stored at key in its shard.
+func (s *shardedStore) Decr(key string, delta int64) (int64, error) {
+	return s.shard(key).Decr(key, delta)
+}
+
+// MGet retrieves the values of keys, batching keys per shard.
+func (s *shardedStore) MGet(keys []string) map[string]Value {
+	values := make(map[string]Value, len(keys))
+	for i, part := range s.split(keys) {
+		for key, value := range s.shards[i].MGet(part) {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// MSet stores all entries with the same expiration, batching entries per shard.
+func (s *shardedStore) MSet(entries map[string]Value, expiration time.Duration) error {
+	parts := make(map[int32]map[string]Value)
+	for key, value := range entries {
+		idx := hashBKBD(key) & s.mask
+		if parts[idx] == nil {
+			parts[idx] = make(map[string]Value)
+		}
+		parts[idx][key] = value
+	}
+	for idx, part := range parts {
+		if err := s.shards[idx].MSet(part, expiration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MDelete removes keys, batching keys per shard.
+func (s *shardedStore) MDelete(keys []string) int {
+	n := 0
+	for i, part := range s.split(keys) {
+		n += s.shards[i].MDelete(part)
+	}
+	return n
+}
+
+// split groups keys by the shard owning them.
+func (s *shardedStore) split(keys []string) map[int32][]string {
+	parts := make(map[int32][]string)
+	for _, key := range keys {
+		idx := hashBKBD(key) & s.mask
+		parts[idx] = append(parts[idx], key)
+	}
+	return parts
+}
+
+// Removals returns the number of entries evicted and expired across all shards.
+func (s *shardedStore) Removals() Removals {
+	var r Removals
+	for _, shard := range s.shards {
+		sr := shard.Removals()
+		r.Evicted += sr.Evicted
+		r.Expired += sr.Expired
+	}
+	return r
+}
+
+// Immortal returns the number of entries without expiration and their bytes across all shards.
+func (s *shardedStore) Immortal() (entries int64, bytes int64) {
+	for _, shard := range s.shards {
+		n, b := shard.Immortal()
+		entries += n
+		bytes += b
+	}
+	return entries, bytes
+}
+
+// Clear removes all items from all shards.
+func (s *shardedStore) Clear() {
+	for _, shard := range s.shards {
+		shard.Clear()
+	}
+}
+
+// Len returns the number of items across all shards.
+func (s *shardedStore) Len() int {
+	n := 0
+	for _, shard := range s.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+// Peek returns the value of key from its shard without counting as an access.
+func (s *shardedStore) Peek(key string) (Value, bool) {
+	return s.shard(key).Peek(key)
+}
+
+// LastAccess returns when key was last read or written in its shard, see lruCache.LastAccess.
+func (s *shardedStore) LastAccess(key string) (time.Time, bool) {
+	return s.shard(key).LastAccess(key)
+}
+
+// Range calls fn for each unexpired entry, shard by shard, until fn returns false.
+//
+// Parameters:
+//   - fn: called with the key, value and expiration time (zero for no expiration) of each entry
+func (s *shardedStore) Range(fn func(key string, value Value, expireAt time.Time) bool) {
+	more := true
+	for _, shard := range s.shards {
+		shard.Range(func(key string, value Value, expireAt time.Time) bool {
+			more = fn(key, value, expireAt)
+			return more
+		})
+		if !more {
+			return
+		}
+	}
+}
+
+// CheckInvariants verifies the bookkeeping of every shard and that each key
+// lives in the shard owning it.
+//
+// Returns:
+//   - error: The first inconsistency found wrapping ErrInvariant, nil if there is none
+func (s *shardedStore) CheckInvariants() error {
+	for i, shard := range s.shards {
+		if err := shard.CheckInvariants(); err != nil {
+			return fmt.Errorf("shard %d: %w", i, err)
+		}
+		var misplaced string
+		shard.mtx.RLock()
+		for key := range shard.items {
+			if s.shard(key) != shard {
+				misplaced = key
+				break
+			}
+		}
+		shard.mtx.RUnlock()
+		if misplaced != "" {
+			return fmt.Errorf("%w: sharded: key %q lives in shard %d, not its owner", ErrInvariant, misplaced, i)
+		}
+	}
+	return nil
+}
+
+// Close closes all shards.
+func (s *shardedStore) Close() {
+	for _, shard := range s.shards {
+		shard.Close()
+	}
+	s.stopPressure()
+	s.stopEvictions()
+}
+
+// shed evicts the given fraction of the entries of every shard, see lruCache.shed.
+func (s *shardedStore) shed(fraction float64) {
+	for _, shard := range s.shards {
+		shard.shed(fraction)
+	}
+}
+
+// UsedBytes returns the number of bytes used across all shards.
+//
+// Returns:
+//   - int64: The number of bytes currently used
+func (s *shardedStore) UsedBytes() int64 {
+	var n int64
+	for _, shard := range s.shards {
+		n += shard.UsedBytes()
+	}
+	return n
+}
+
+// MaxBytes returns the total byte limit across all shards.
+//
+// Returns:
+//   - int64: The maximum bytes limit of the store, 0 or negative value means no limit.
+func (s *shardedStore) MaxBytes() int64 {
+	var n int64
+	for _, shard := range s.shards {
+		n += shard.MaxBytes()
+	}
+	return n
+}
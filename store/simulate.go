@@ -0,0 +1,202 @@
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Access is one read of an access log replayed by Simulate.
+type Access struct {
+	Key  string // the key read
+	Size int    // bytes of the value, stored on a miss
+}
+
+// SimConfig is a store configuration Simulate evaluates.
+type SimConfig struct {
+	Name    string    // label of the configuration in the results
+	Type    CacheType // the store type
+	Options Options   // options of the store, eviction callbacks, CleanupInterval and MemoryPressure are ignored
+	// TinyLFU: admit new keys through a TinyLFU filter sized for the
+	// configuration's expected entry count, LRU only
+	TinyLFU bool
+}
+
+// SimResult is the outcome of replaying an access log against a SimConfig.
+type SimResult struct {
+	Config   SimConfig
+	Accesses int64 // reads replayed
+	Hits     int64 // reads served from the store
+	Bytes    int64 // bytes read
+	HitBytes int64 // bytes read that were served from the store
+}
+
+// HitRatio returns the fraction of reads that hit.
+func (r SimResult) HitRatio() float64 {
+	if r.Accesses == 0 {
+		return 0
+	}
+	return float64(r.Hits) / float64(r.Accesses)
+}
+
+// ByteHitRatio returns the fraction of bytes read that hit.
+func (r SimResult) ByteHitRatio() float64 {
+	if r.Bytes == 0 {
+		return 0
+	}
+	return float64(r.HitBytes) / float64(r.Bytes)
+}
+
+// simValue is a value of a given size without content.
+type simValue int
+
+// Len returns the simulated size.
+func (v simValue) Len() int {
+	return int(v)
+}
+
+// SimConfigs returns the configurations of the byte-bounded policies, LRU,
+// LRU with TinyLFU admission, LFU and ARC, at each of the given sizes.
+//
+// Parameters:
+//   - sizes: the MaxBytes values to evaluate
+//
+// Returns:
+//   - []SimConfig: one configuration per policy and size
+func SimConfigs(sizes ...int64) []SimConfig {
+	var configs []SimConfig
+	for _, size := range sizes {
+		opts := NewOptions()
+		opts.MaxBytes = size
+		configs = append(configs,
+			SimConfig{Name: "LRU", Type: LRU, Options: opts},
+			SimConfig{Name: "LRU+TinyLFU", Type: LRU, Options: opts, TinyLFU: true},
+			SimConfig{Name: "LFU", Type: LFU, Options: opts},
+			SimConfig{Name: "ARC", Type: ARC, Options: opts},
+		)
+	}
+	return configs
+}
+
+// Simulate replays accesses against a fresh store per configuration, as a
+// cache filled on miss would see them, and reports the hit ratios each
+// configuration would have reached. Expiration is not simulated.
+//
+// Parameters:
+//   - accesses: the reads to replay, in order
+//   - configs: the store configurations to evaluate
+//
+// Returns:
+//   - []SimResult: one result per configuration, in the order of configs
+func Simulate(accesses []Access, configs []SimConfig) []SimResult {
+	var totalBytes int64
+	distinct := make(map[string]struct{})
+	for _, a := range accesses {
+		totalBytes += int64(len(a.Key) + a.Size)
+		distinct[a.Key] = struct{}{}
+	}
+
+	results := make([]SimResult, len(configs))
+	for i, config := range configs {
+		opts := config.Options
+		// nothing expires, the default cleanup has nothing to do
+		opts.OnEvicted, opts.OnEvictedReason, opts.CleanupInterval = nil, nil, 0
+		// the replay's hit ratio must not depend on the heap of the process
+		opts.MemoryPressure = nil
+		if config.TinyLFU {
+			opts.AdmissionPolicy = NewTinyLFU(expectedEntries(opts.MaxBytes, totalBytes, len(accesses), len(distinct)))
+		}
+		s := NewStore(config.Type, opts)
+		r := SimResult{Config: config}
+		for _, a := range accesses {
+			r.Accesses++
+			r.Bytes += int64(a.Size)
+			if _, ok := s.Get(a.Key); ok {
+				r.Hits++
+				r.HitBytes += int64(a.Size)
+				continue
+			}
+			s.Set(a.Key, simValue(a.Size))
+		}
+		s.Close()
+		results[i] = r
+	}
+	return results
+}
+
+// expectedEntries estimates how many entries fit in maxBytes from the mean
+// entry size of the log, at most the number of distinct keys.
+func expectedEntries(maxBytes, totalBytes int64, accesses, distinct int) int {
+	if accesses == 0 || totalBytes == 0 || maxBytes <= 0 {
+		return distinct
+	}
+	mean := totalBytes / int64(accesses)
+	return int(min(maxBytes/max(mean, 1), int64(distinct)))
+}
+
+// ReadAccessLog parses an access log, one read per line: the key, Go-quoted
+// if it holds spaces or non-printable bytes, then optionally a space or tab
+// and the value size in bytes. Blank lines and lines starting with # are skipped.
+//
+// Parameters:
+//   - r: The log to read
+//   - defaultSize: the value size of reads that give none
+//
+// Returns:
+//   - []Access: the reads in log order
+//   - error: the first malformed line, with its number
+func ReadAccessLog(r io.Reader, defaultSize int) ([]Access, error) {
+	var accesses []Access
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		a := Access{Size: defaultSize}
+		rest := text
+		if strings.HasPrefix(text, `"`) {
+			quoted, err := strconv.QuotedPrefix(text)
+			if err != nil {
+				return nil, fmt.Errorf("store: access log line %d: %w", line, err)
+			}
+			a.Key, _ = strconv.Unquote(quoted)
+			rest = text[len(quoted):]
+		} else if i := strings.IndexAny(text, " \t"); i >= 0 {
+			a.Key, rest = text[:i], text[i:]
+		} else {
+			a.Key, rest = text, ""
+		}
+		if rest = strings.TrimSpace(rest); rest != "" {
+			size, err := strconv.Atoi(rest)
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("store: access log line %d: invalid size %q", line, rest)
+			}
+			a.Size = size
+		}
+		accesses = append(accesses, a)
+	}
+	return accesses, sc.Err()
+}
+
+// WriteSimResults writes results as a table, one line per configuration.
+//
+// Parameters:
+//   - w: The writer the table is written to
+//   - results: The results of Simulate
+//
+// Returns:
+//   - error: the first write error
+func WriteSimResults(w io.Writer, results []SimResult) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "POLICY\tMAX BYTES\tACCESSES\tHITS\tHIT RATIO\tBYTE HIT RATIO\t")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.2f%%\t%.2f%%\t\n", r.Config.Name, r.Config.Options.MaxBytes,
+			r.Accesses, r.Hits, 100*r.HitRatio(), 100*r.ByteHitRatio())
+	}
+	return tw.Flush()
+}
@@ -1,36 +1,278 @@
 package store
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 type Value interface {
 	Len() int
 }
 
+// Store: keys are arbitrary byte strings, including NULs and non-utf8 bytes
 type Store interface {
 	Get(key string) (Value, bool)
 	Set(key string, value Value) error
 	SetWithExpiration(key string, value Value, expiration time.Duration) error
-	Delete(key string) error
+	Delete(key string) bool
+	Incr(key string, delta int64) (int64, error)
+	Decr(key string, delta int64) (int64, error)
+	// GetWithVersion: like Get, also returning the entry's version
+	GetWithVersion(key string) (Value, uint64, bool)
+	// TTL: remaining time to live of key, 0 if it never expires
+	TTL(key string) (time.Duration, bool)
+	// SetNX: set only if key is absent
+	SetNX(key string, value Value, expiration time.Duration) (bool, error)
+	// SetXX: set only if key is present
+	SetXX(key string, value Value, expiration time.Duration) (bool, error)
+	// CompareAndSwap: set only if the entry's version equals version, 0 means absent
+	CompareAndSwap(key string, version uint64, value Value, expiration time.Duration) (bool, error)
 	Clear()
 	Len() int
 	Close()
 }
 
+// Removals: entries a store dropped by itself, as opposed to those its caller deleted
+type Removals struct {
+	Evicted int64 // entries evicted to stay within capacity
+	Expired int64 // entries removed because their ttl passed
+}
+
+// RemovalCounter: implemented by stores that count their Removals, all built-in stores do
+type RemovalCounter interface {
+	Removals() Removals
+}
+
+// removalCounts: counters behind RemovalCounter, embedded by the built-in stores
+type removalCounts struct {
+	evictions   atomic.Int64
+	expirations atomic.Int64
+}
+
+// Removals returns the number of entries evicted and expired since the store was created.
+func (r *removalCounts) Removals() Removals {
+	return Removals{Evicted: r.evictions.Load(), Expired: r.expirations.Load()}
+}
+
+// ImmortalCounter: implemented by stores that count their entries without
+// expiration, all built-in stores do. Such entries only leave on a delete, an
+// eviction or a write giving them a ttl, they are the usual cause of a cache
+// that never frees memory
+type ImmortalCounter interface {
+	// Immortal: number of entries without expiration and the bytes of their
+	// keys and values
+	Immortal() (entries int64, bytes int64)
+}
+
+// immortalCounts: counters behind ImmortalCounter, embedded by the built-in stores
+type immortalCounts struct {
+	immortalEntries atomic.Int64
+	immortalBytes   atomic.Int64
+}
+
+// Immortal returns the number of entries without expiration and their bytes.
+func (m *immortalCounts) Immortal() (int64, int64) {
+	return m.immortalEntries.Load(), m.immortalBytes.Load()
+}
+
+// addImmortal counts an entry of size bytes entering the store, or having its
+// expiration cleared, if it never expires.
+func (m *immortalCounts) addImmortal(immortal bool, size int64) {
+	if immortal {
+		m.immortalEntries.Add(1)
+		m.immortalBytes.Add(size)
+	}
+}
+
+// removeImmortal uncounts an entry of size bytes leaving the store, or
+// getting an expiration, if it never expired.
+func (m *immortalCounts) removeImmortal(immortal bool, size int64) {
+	if immortal {
+		m.immortalEntries.Add(-1)
+		m.immortalBytes.Add(-size)
+	}
+}
+
+// resetImmortal uncounts every entry, for stores being cleared.
+func (m *immortalCounts) resetImmortal() {
+	m.immortalEntries.Store(0)
+	m.immortalBytes.Store(0)
+}
+
+// Ranger: implemented by stores that can visit their entries, all built-in stores do
+type Ranger interface {
+	// Range: call fn for each unexpired entry with its expiration time, zero if
+	// it never expires, until fn returns false. Visiting is not an access.
+	// Note: fn runs under the store's locks and must not call the store
+	Range(fn func(key string, value Value, expireAt time.Time) bool)
+}
+
+// AccessTimer: implemented by stores remembering when each entry was last
+// read or written, lru, lru2 and sharded lru do
+type AccessTimer interface {
+	// LastAccess: when key was last read or written, ok is false if it is
+	// absent or expired. Asking is not an access
+	LastAccess(key string) (at time.Time, ok bool)
+}
+
+// Peeker: implemented by stores that can read an entry without it counting
+// as an access, lru, lru2 and sharded lru do
+type Peeker interface {
+	// Peek: the value of key, ok is false if it is absent or expired. It
+	// neither refreshes the entry's recency nor counts towards its frequency
+	Peek(key string) (value Value, ok bool)
+}
+
+// InvariantChecker: implemented by stores that can verify their own bookkeeping
+type InvariantChecker interface {
+	// CheckInvariants: nil if the store's index, recency order, expirations and
+	// byte accounting agree, else an ErrInvariant describing the first mismatch
+	CheckInvariants() error
+}
+
+// ErrInvariant: a store's bookkeeping is inconsistent, see CheckInvariants
+var ErrInvariant = errors.New("store: invariant violated")
+
+// CheckInvariants verifies the bookkeeping of s, for tests and debugging. It
+// takes the store's locks and walks every entry, it is not meant for hot paths.
+//
+// Parameters:
+//   - s: The store to check
+//
+// Returns:
+//   - error: The first inconsistency found wrapping ErrInvariant, nil if there
+//     is none or s does not implement InvariantChecker
+func CheckInvariants(s Store) error {
+	if c, ok := s.(InvariantChecker); ok {
+		return c.CheckInvariants()
+	}
+	return nil
+}
+
+// ErrNilValue: conditional writes don't accept nil values
+var ErrNilValue = errors.New("store: nil value")
+
+// version: source of entry versions, every write gets a new one so
+// a key deleted and set again never reuses a version
+var version uint64
+
+// nextVersion: return a fresh entry version, never 0
+func nextVersion() uint64 {
+	return atomic.AddUint64(&version, 1)
+}
+
+// write conditions, given whether the key is present and its version
+func ifAbsent(found bool, _ uint64) bool  { return !found }
+func ifPresent(found bool, _ uint64) bool { return found }
+func ifVersion(want uint64) func(bool, uint64) bool {
+	return func(_ bool, cur uint64) bool { return cur == want }
+}
+
+// ErrNotCounter: Incr or Decr on a key holding a non-counter value
+var ErrNotCounter = errors.New("store: value is not a counter")
+
+// Counter: the value type maintained by Incr and Decr
+type Counter int64
+
+// Len: a counter is accounted as 8 bytes
+func (n Counter) Len() int {
+	return 8
+}
+
+// incrValue: add delta to a counter value, a nil value counts from 0
+func incrValue(v Value, delta int64) (Counter, error) {
+	if v == nil {
+		return Counter(delta), nil
+	}
+	n, ok := v.(Counter)
+	if !ok {
+		return 0, ErrNotCounter
+	}
+	return n + Counter(delta), nil
+}
+
 type CacheType string
 
 const (
 	LRU  CacheType = "LRU"
 	LRU2 CacheType = "LRU2"
+	LFU  CacheType = "LFU"
+	ARC  CacheType = "ARC"
+	// ShardedLRU: lru split into ShardCnt independently locked shards
+	ShardedLRU CacheType = "ShardedLRU"
 )
 
-// Options: general options for lru and lru2
+// Options: general options for all store types
 type Options struct {
 	MaxBytes        int64                         // max bytes of lru cache
 	BucketCnt       uint16                        // number of lru2 buckets
 	CapPerBucket    uint16                        // capacity of lru2's bucket
 	Level2Cap       uint16                        // capacity of lru2's lv2 cache
+	ShardCnt        uint16                        // number of sharded lru shards
 	CleanupInterval time.Duration                 // cleanup Duration
 	OnEvicted       func(key string, value Value) // eviction callback func
+	AdmissionPolicy AdmissionPolicy               // admission filter for new keys, e.g. NewTinyLFU, nil admits all (lru only)
+	// OnEvictedReason: eviction callback told why the entry left, called
+	// after OnEvicted when both are set
+	OnEvictedReason func(key string, value Value, reason EvictionReason)
+	// EvictionQueue: callbacks queued per dispatch worker, so eviction
+	// callbacks run outside the store's lock, in order for each key. Writes
+	// block while a worker's queue is full. 0 calls them under the lock
+	EvictionQueue   int
+	EvictionWorkers int // dispatch workers of EvictionQueue, 0 means 1
+	// MemoryPressure: evict entries proactively while the process heap is
+	// near its limit, nil relies on MaxBytes alone (lru and sharded lru only)
+	MemoryPressure *MemoryPressure
+	// OnPanic: called with the panics recovered in the store's background
+	// goroutines, expiration cleanup, heap watching and queued eviction
+	// callbacks, which keep running. nil logs them
+	OnPanic func(err *PanicError)
+}
+
+// EvictionReason: why an entry left a store
+type EvictionReason int
+
+const (
+	EvictCapacity EvictionReason = iota // evicted to make room for other entries
+	EvictExpired                        // its expiration passed
+	EvictDeleted                        // removed by Delete, MDelete or a nil value in MSet
+	EvictCleared                        // removed by Clear
+)
+
+// String returns the name of the reason.
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	case EvictDeleted:
+		return "deleted"
+	case EvictCleared:
+		return "cleared"
+	}
+	return fmt.Sprintf("EvictionReason(%d)", int(r))
+}
+
+// evictedCallback: the callback stores call when an entry leaves them, nil if
+// neither OnEvicted nor OnEvictedReason is set
+func (o Options) evictedCallback() func(key string, value Value, reason EvictionReason) {
+	onEvicted, onReason := o.OnEvicted, o.OnEvictedReason
+	switch {
+	case onEvicted == nil && onReason == nil:
+		return nil
+	case onReason == nil:
+		return func(key string, value Value, _ EvictionReason) { onEvicted(key, value) }
+	case onEvicted == nil:
+		return onReason
+	}
+	return func(key string, value Value, reason EvictionReason) {
+		onEvicted(key, value)
+		onReason(key, value, reason)
+	}
 }
 
 func NewOptions() Options {
@@ -39,24 +281,47 @@ func NewOptions() Options {
 		BucketCnt:       16,
 		CapPerBucket:    512,
 		Level2Cap:       256,
+		ShardCnt:        16,
 		CleanupInterval: time.Minute,
 		OnEvicted:       nil,
 	}
 }
 
-// NewStore: create a new store example
-func NewStore(cacheType CacheType, opts Options) Store {
-	switch cacheType {
-	case LRU:
-		// return newLRUCache(opts)
-		return nil
-	case LRU2:
-		// return newLRU2Cache(opts)
-		return nil
+// Factory: creates a store from options
+type Factory func(opts Options) Store
 
-	default:
-		// return newLRUCache(opts)
-		return nil
+var (
+	factoriesMtx sync.RWMutex
+	factories    = map[CacheType]Factory{
+		LRU:        func(opts Options) Store { return newLRUCache(opts) },
+		LRU2:       func(opts Options) Store { return newLRU2Cache(opts) },
+		LFU:        func(opts Options) Store { return newLFUCache(opts) },
+		ARC:        func(opts Options) Store { return newARCCache(opts) },
+		ShardedLRU: func(opts Options) Store { return newShardedStore(opts) },
 	}
+)
 
+// RegisterStore: make a store implementation available under name.
+// It panics if factory is nil or name is already registered.
+func RegisterStore(name CacheType, factory func(Options) Store) {
+	factoriesMtx.Lock()
+	defer factoriesMtx.Unlock()
+	if factory == nil {
+		panic("store: RegisterStore factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic(fmt.Sprintf("store: RegisterStore called twice for %q", name))
+	}
+	factories[name] = factory
+}
+
+// NewStore: create a new store example, unknown types fall back to LRU
+func NewStore(cacheType CacheType, opts Options) Store {
+	factoriesMtx.RLock()
+	factory, ok := factories[cacheType]
+	if !ok {
+		factory = factories[LRU]
+	}
+	factoriesMtx.RUnlock()
+	return factory(opts)
 }
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+// checkRandomOps runs a seeded random sequence of operations over a small key
+// space against s and checks its invariants every few operations and at the
+// end. Expirations of a nanosecond make entries expire while the sequence runs
+func checkRandomOps(t *testing.T, s Store, ops int) {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+	ttl := func() time.Duration {
+		switch rng.IntN(3) {
+		case 0:
+			return 0
+		case 1:
+			return time.Nanosecond
+		}
+		return time.Hour
+	}
+	for i := range ops {
+		key := fmt.Sprintf("k%d", rng.IntN(64))
+		value := simValue(1 + rng.IntN(48))
+		switch op := rng.IntN(12); op {
+		case 0, 1:
+			s.Set(key, value)
+		case 2, 3:
+			s.SetWithExpiration(key, value, ttl())
+		case 4, 5:
+			s.Get(key)
+		case 6:
+			s.Delete(key)
+		case 7:
+			s.SetNX(key, value, ttl())
+		case 8:
+			s.SetXX(key, value, ttl())
+		case 9:
+			_, version, _ := s.GetWithVersion(key)
+			s.CompareAndSwap(key, version, value, ttl())
+		case 10:
+			s.Incr(fmt.Sprintf("n%d", rng.IntN(8)), rng.Int64N(10))
+		case 11:
+			if p, ok := s.(Peeker); ok {
+				p.Peek(key)
+			} else {
+				s.TTL(key)
+			}
+		}
+		if i%1000 == 999 && rng.IntN(4) == 0 {
+			s.Clear()
+		}
+		if i%50 == 0 {
+			if err := CheckInvariants(s); err != nil {
+				t.Fatalf("after %d operations: %v", i+1, err)
+			}
+		}
+	}
+	if err := CheckInvariants(s); err != nil {
+		t.Fatalf("after %d operations: %v", ops, err)
+	}
+}
+
+// evictionRecorder returns an OnEvictedReason callback and the keys it was
+// called with for each reason
+func evictionRecorder() (func(key string, value Value, reason EvictionReason), map[EvictionReason][]string) {
+	evicted := make(map[EvictionReason][]string)
+	return func(key string, _ Value, reason EvictionReason) {
+		evicted[reason] = append(evicted[reason], key)
+	}, evicted
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// AdmissionPolicy decides whether a new key is worth admitting when the
+// store is full and admitting it would evict an existing entry.
+// Implementations must be safe for concurrent use.
+type AdmissionPolicy interface {
+	// Record registers an access to key.
+	Record(key string)
+	// Admit reports whether candidate should be admitted at the expense of victim.
+	Admit(candidate, victim string) bool
+}
+
+// cmDepth is the number of rows of the count-min sketch.
+const cmDepth = 4
+
+// tinyLFU is a TinyLFU admission filter: a doorkeeper bloom filter absorbs
+// one-hit wonders and a count-min sketch of 4-bit saturating counters
+// estimates the frequency of keys seen more than once. All counters are
+// halved every samples records so the estimates follow recent history.
+type tinyLFU struct {
+	mtx       sync.Mutex
+	sketch    [cmDepth][]uint8 // count-min sketch rows, counters saturate at 15
+	door      []uint64         // doorkeeper bloom filter bits
+	mask      uint64           // row width - 1, width is a power of two
+	samples   int              // records between two resets
+	additions int              // records since the last reset
+}
+
+// NewTinyLFU creates a TinyLFU admission policy sized for about samples
+// distinct keys, typically a small multiple of the expected entry count.
+//
+// Parameters:
+//   - samples: the sample window; non-positive values default to 4096
+//
+// Returns:
+//   - AdmissionPolicy: the TinyLFU admission filter
+func NewTinyLFU(samples int) AdmissionPolicy {
+	if samples <= 0 {
+		samples = 4096
+	}
+	width := uint64(1)
+	for width < uint64(samples) {
+		width <<= 1
+	}
+	t := &tinyLFU{
+		door:    make([]uint64, (width+63)/64),
+		mask:    width - 1,
+		samples: samples * 10,
+	}
+	for i := range t.sketch {
+		t.sketch[i] = make([]uint8, width)
+	}
+	return t
+}
+
+// Record registers an access to key.
+func (t *tinyLFU) Record(key string) {
+	h1, h2 := hashPair(key)
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	// first sighting only sets the doorkeeper
+	if !t.doorHas(h1, h2) {
+		t.doorAdd(h1, h2)
+	} else {
+		for i := range t.sketch {
+			idx := (h1 + uint64(i)*h2) & t.mask
+			if t.sketch[i][idx] < 15 {
+				t.sketch[i][idx]++
+			}
+		}
+	}
+
+	t.additions++
+	if t.additions >= t.samples {
+		t.reset()
+	}
+}
+
+// Admit reports whether candidate is estimated to be more frequent than victim.
+func (t *tinyLFU) Admit(candidate, victim string) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.estimate(candidate) > t.estimate(victim)
+}
+
+// estimate returns the approximate access frequency of key.
+// Note: lock must be held before calling this function.
+func (t *tinyLFU) estimate(key string) int {
+	h1, h2 := hashPair(key)
+	freq := uint8(15)
+	for i := range t.sketch {
+		if c := t.sketch[i][(h1+uint64(i)*h2)&t.mask]; c < freq {
+			freq = c
+		}
+	}
+	if t.doorHas(h1, h2) {
+		return int(freq) + 1
+	}
+	return int(freq)
+}
+
+// reset halves all counters and clears the doorkeeper.
+// Note: lock must be held before calling this function.
+func (t *tinyLFU) reset() {
+	for i := range t.sketch {
+		for j := range t.sketch[i] {
+			t.sketch[i][j] >>= 1
+		}
+	}
+	clear(t.door)
+	t.additions = 0
+}
+
+// doorHas reports whether the doorkeeper may contain the hashed key.
+func (t *tinyLFU) doorHas(h1, h2 uint64) bool {
+	for i := uint64(0); i < 2; i++ {
+		bit := (h1 + i*h2) & t.mask
+		if t.door[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// doorAdd adds the hashed key to the doorkeeper.
+func (t *tinyLFU) doorAdd(h1, h2 uint64) {
+	for i := uint64(0); i < 2; i++ {
+		bit := (h1 + i*h2) & t.mask
+		t.door[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// hashPair derives two hashes of key for double hashing.
+func hashPair(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	return sum, (sum >> 32) | (sum << 32) | 1
+}
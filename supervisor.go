@@ -0,0 +1,257 @@
+package rebelcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// backoff of restarted loops, doubling from min to max, back to min after a
+// run that lasted max
+const (
+	minRestartBackoff = time.Second
+	maxRestartBackoff = time.Minute
+)
+
+// RestartPolicy: what a supervisor does when one of its loops fails
+type RestartPolicy int
+
+const (
+	RestartNever     RestartPolicy = iota // a loop that fails stays stopped
+	RestartOnFailure                      // a loop that fails or panics is restarted after a backoff
+)
+
+// LoopStatus: state of a background loop, see Server.Loops
+type LoopStatus struct {
+	Name      string    `json:"name"`
+	Running   bool      `json:"running"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"` // error or panic of the last failed run
+	StartedAt time.Time `json:"started_at"`           // start of the current or last run
+}
+
+// supervisor: owns background loops, runs them until it is stopped,
+// restarts them on failure per their policy and reports their status
+type supervisor struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	group  errgroup.Group // errors of loops that gave up
+	mtx    sync.Mutex
+	loops  map[*loopState]struct{}
+}
+
+// loopState: status of one loop of a supervisor
+type loopState struct {
+	mtx    sync.Mutex
+	status LoopStatus
+}
+
+// newSupervisor: create a supervisor whose loops stop with parent or Stop
+func newSupervisor(parent context.Context) *supervisor {
+	ctx, cancel := context.WithCancel(parent)
+	return &supervisor{ctx: ctx, cancel: cancel, loops: make(map[*loopState]struct{})}
+}
+
+// Go: run fn under the supervisor until its ctx is done. fn returns nil once
+// ctx is done, an error or a panic is a failure handled per policy. The
+// returned func stops this loop alone and forgets it
+func (s *supervisor) Go(name string, policy RestartPolicy, fn func(ctx context.Context) error) context.CancelFunc {
+	ctx, cancel := context.WithCancel(s.ctx)
+	st := &loopState{status: LoopStatus{Name: name}}
+	s.mtx.Lock()
+	s.loops[st] = struct{}{}
+	s.mtx.Unlock()
+
+	s.group.Go(func() error {
+		defer cancel()
+		backoff := minRestartBackoff
+		for {
+			st.started()
+			err := runLoop(ctx, name, fn)
+			if ctx.Err() != nil {
+				st.stopped(nil)
+				return nil
+			}
+			st.stopped(err)
+			if policy != RestartOnFailure {
+				return err
+			}
+			if time.Since(st.startedAt()) >= maxRestartBackoff {
+				backoff = minRestartBackoff
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, maxRestartBackoff)
+			st.restarted()
+		}
+	})
+	return func() {
+		cancel()
+		s.mtx.Lock()
+		delete(s.loops, st)
+		s.mtx.Unlock()
+	}
+}
+
+// goUntil: Go, the loop also stops once ctx ends, e.g. the watch of a
+// Registry stopping with the ctx passed to Watch
+func (s *supervisor) goUntil(ctx context.Context, name string, policy RestartPolicy, fn func(ctx context.Context) error) {
+	context.AfterFunc(ctx, s.Go(name, policy, fn))
+}
+
+// runLoop: run fn once, a panic becomes its error and returning without
+// error before ctx is done is a failure too
+func runLoop(ctx context.Context, name string, fn func(ctx context.Context) error) (err error) {
+	defer recoverPanic(name, &err)
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	if ctx.Err() == nil {
+		return errors.New("rebelcache: loop returned before it was stopped")
+	}
+	return nil
+}
+
+// Stop: stop all loops and wait for them, returning the first error of a
+// loop that failed without restart
+func (s *supervisor) Stop() error {
+	s.cancel()
+	return s.group.Wait()
+}
+
+// stopped: whether Stop was called or the parent ctx is done
+func (s *supervisor) stopped() bool {
+	return s.ctx.Err() != nil
+}
+
+// done: closed once the supervisor stops
+func (s *supervisor) done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// tasks: one-off background work, e.g. per request, joined on close. A
+// panic of a task is reported and ends it alone
+type tasks struct {
+	mtx     sync.Mutex
+	closed  bool
+	running int
+	idle    chan struct{} // closed once no task runs, nil while none does
+}
+
+// Go: run fn in the background unless closed, return whether it was started
+func (t *tasks) Go(name string, fn func()) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.closed {
+		return false
+	}
+	if t.running++; t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+	go func() {
+		defer t.done()
+		defer recoverPanic(name, nil)
+		fn()
+	}()
+	return true
+}
+
+// done: count a task finished
+func (t *tasks) done() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.running--; t.running == 0 {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// wait: wait until no task runs or ctx ends, tasks may still start
+func (t *tasks) wait(ctx context.Context) error {
+	t.mtx.Lock()
+	idle := t.idle
+	t.mtx.Unlock()
+	if idle == nil {
+		return nil
+	}
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close: start no more tasks and wait for those running
+func (t *tasks) close() {
+	t.mtx.Lock()
+	t.closed = true
+	t.mtx.Unlock()
+	t.wait(context.Background())
+}
+
+// Status: status of the loops by name
+func (s *supervisor) Status() []LoopStatus {
+	s.mtx.Lock()
+	statuses := make([]LoopStatus, 0, len(s.loops))
+	for st := range s.loops {
+		st.mtx.Lock()
+		statuses = append(statuses, st.status)
+		st.mtx.Unlock()
+	}
+	s.mtx.Unlock()
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// started, stopped, restarted, startedAt: status transitions of a loop
+func (st *loopState) started() {
+	st.mtx.Lock()
+	st.status.Running, st.status.StartedAt = true, time.Now()
+	st.mtx.Unlock()
+}
+
+func (st *loopState) stopped(err error) {
+	st.mtx.Lock()
+	st.status.Running = false
+	if err != nil {
+		st.status.LastError = err.Error()
+	}
+	st.mtx.Unlock()
+}
+
+func (st *loopState) restarted() {
+	st.mtx.Lock()
+	st.status.Restarts++
+	st.mtx.Unlock()
+}
+
+func (st *loopState) startedAt() time.Time {
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	return st.status.StartedAt
+}
+
+// Loops: status of the server's background loops, snapshots and etcd
+// registration, served as json at /debug/loops of MetricsAddr
+func (s *Server) Loops() []LoopStatus {
+	return s.loops.Status()
+}
+
+// LoopsHandler: Loops as json, callers it doesn't allow are rejected
+func (s *Server) LoopsHandler() http.Handler {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Loops())
+	})
+	return s.allowlist.httpMiddleware(h)
+}
@@ -0,0 +1,145 @@
+package rebelcache
+
+import (
+	"cmp"
+	"hash/maphash"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	sketchDepth    = 4    // rows of the count-min sketch of key accesses
+	sketchWidth    = 2048 // counters per row
+	maxTopKeys     = 1024 // bound of CacheOptions.TopKeys
+	defaultTopKeys = 10   // keys reported by the TopKeys rpc by default
+)
+
+// KeyRate: a hot key and its estimated gets per second, see Cache.TopKeys
+type KeyRate struct {
+	Key string
+	QPS float64
+}
+
+// topKeys: the hottest keys of a cache over fixed windows of rateWindow. A
+// count-min sketch estimates how often each key was read, keys estimated
+// above the coldest of the tracked ones replace it
+type topKeys struct {
+	seed    maphash.Seed
+	sketch  [sketchDepth][sketchWidth]atomic.Uint32
+	started atomic.Int64  // unix nanos of the current window
+	floor   atomic.Uint32 // estimate a key must exceed to be tracked once limit keys are
+	mtx     sync.Mutex
+	limit   int               // keys tracked
+	top     map[string]uint32 // tracked keys of the current window by estimate
+	prev    []KeyRate         // hottest keys of the last complete window
+	// prevRates: rates of prev by key, read without the lock
+	prevRates atomic.Pointer[map[string]float64]
+}
+
+// newTopKeys: track the limit hottest keys, nil if limit is not positive
+func newTopKeys(limit int) *topKeys {
+	if limit <= 0 {
+		return nil
+	}
+	t := &topKeys{seed: maphash.MakeSeed(), limit: min(limit, maxTopKeys), top: make(map[string]uint32)}
+	t.started.Store(time.Now().UnixNano())
+	return t
+}
+
+// record: count a read of key
+func (t *topKeys) record(key string) {
+	t.roll(time.Now())
+	h := maphash.String(t.seed, key)
+	h1, h2 := h, h>>32|h<<32|1
+	est := ^uint32(0)
+	for i := range t.sketch {
+		est = min(est, t.sketch[i][(h1+uint64(i)*h2)%sketchWidth].Add(1))
+	}
+	if est <= t.floor.Load() {
+		return
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.top[key] = est
+	if len(t.top) <= t.limit {
+		return
+	}
+	coldest, floor := "", ^uint32(0)
+	for k, n := range t.top {
+		if n < floor {
+			coldest, floor = k, n
+		}
+	}
+	delete(t.top, coldest)
+	t.floor.Store(floor)
+}
+
+// roll: start a new window if the current one is over, keeping the hottest
+// keys of the one ending
+func (t *topKeys) roll(now time.Time) {
+	if now.UnixNano()-t.started.Load() < int64(rateWindow) {
+		return
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	started := t.started.Load()
+	if now.UnixNano()-started < int64(rateWindow) {
+		return
+	}
+	t.prev = t.rates(time.Duration(now.UnixNano() - started))
+	byKey := make(map[string]float64, len(t.prev))
+	for _, kr := range t.prev {
+		byKey[kr.Key] = kr.QPS
+	}
+	t.prevRates.Store(&byKey)
+	for i := range t.sketch {
+		for j := range t.sketch[i] {
+			t.sketch[i][j].Store(0)
+		}
+	}
+	clear(t.top)
+	t.floor.Store(0)
+	t.started.Store(now.UnixNano())
+}
+
+// rates: the tracked keys hottest first with their rates over elapsed
+// Note: lock must be held before calling this function.
+func (t *topKeys) rates(elapsed time.Duration) []KeyRate {
+	rates := make([]KeyRate, 0, len(t.top))
+	if elapsed <= 0 {
+		return rates
+	}
+	for key, n := range t.top {
+		rates = append(rates, KeyRate{Key: key, QPS: float64(n) / elapsed.Seconds()})
+	}
+	slices.SortFunc(rates, func(a, b KeyRate) int {
+		return cmp.Or(cmp.Compare(b.QPS, a.QPS), cmp.Compare(a.Key, b.Key))
+	})
+	return rates
+}
+
+// rate: gets per second of key over the last complete window, 0 unless it
+// was among the hottest
+func (t *topKeys) rate(key string) float64 {
+	if rates := t.prevRates.Load(); rates != nil {
+		return (*rates)[key]
+	}
+	return 0
+}
+
+// hottest: the n hottest keys of the last complete window, or of the current
+// one before a window completed
+func (t *topKeys) hottest(n int) []KeyRate {
+	now := time.Now()
+	t.roll(now)
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	rates := t.prev
+	if rates == nil {
+		rates = t.rates(time.Duration(now.UnixNano() - t.started.Load()))
+	}
+	return slices.Clone(rates[:min(n, len(rates))])
+}
@@ -0,0 +1,101 @@
+package rebelcache
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// tracerName: instrumentation scope of the spans of the package
+const tracerName = "github.com/RebellioN-YonG/Distrbuted-Cache"
+
+// tracePropagator: carries the trace context in rpc metadata, w3c format
+// whatever the global propagator is, so nodes always understand each other
+var tracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// mdCarrier: propagation.TextMapCarrier over rpc metadata
+type mdCarrier metadata.MD
+
+// Get: first value of key
+func (c mdCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Set: replace the values of key
+func (c mdCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+// Keys: all keys
+func (c mdCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// tracerFor: tracer of tp, or with a nil tp of the span in ctx, so work done
+// for a traced request joins its trace and other work is not traced
+func tracerFor(ctx context.Context, tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = trace.SpanFromContext(ctx).TracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// endSpan: record err on span and end it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+}
+
+// injectTrace: add the trace context of ctx to its outgoing rpc metadata
+func injectTrace(ctx context.Context) context.Context {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	tracePropagator.Inject(ctx, mdCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// rpcAttributes: semantic attributes of the rpc named by a grpc full method
+func rpcAttributes(fullMethod string) []attribute.KeyValue {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return []attribute.KeyValue{
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.service", service),
+		attribute.String("rpc.method", method),
+	}
+}
+
+// traceUnary: server interceptor continuing the caller's trace with a span per rpc
+func (s *Server) traceUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = tracePropagator.Extract(ctx, mdCarrier(md))
+	attrs := rpcAttributes(info.FullMethod)
+	if r, ok := req.(interface{ GetGroup() string }); ok {
+		attrs = append(attrs, attribute.String("rebelcache.group", r.GetGroup()))
+	}
+	ctx, span := s.opts.TracerProvider.Tracer(tracerName).Start(ctx, strings.TrimPrefix(info.FullMethod, "/"),
+		trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+	resp, err := handler(ctx, req)
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(status.Code(err))))
+	endSpan(span, err)
+	return resp, err
+}
@@ -0,0 +1,85 @@
+package rebelcache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Transform: rewrites the values a node returns for the gets of a group's
+// clients, e.g. decompressing, redacting fields or deriving bytes, so the
+// work runs once near the data rather than in every client. Values stay
+// cached as written, forwards between nodes carry them untransformed.
+// value must not be modified, return a new slice instead
+type Transform interface {
+	Transform(ctx context.Context, group, key string, value []byte) ([]byte, error)
+}
+
+// TransformFunc: adapter allowing ordinary functions as Transforms
+type TransformFunc func(ctx context.Context, group, key string, value []byte) ([]byte, error)
+
+// Transform: implements Transform
+func (f TransformFunc) Transform(ctx context.Context, group, key string, value []byte) ([]byte, error) {
+	return f(ctx, group, key, value)
+}
+
+var (
+	transformsMtx sync.RWMutex
+	transforms    = map[string]Transform{}
+)
+
+// RegisterTransform: make t available under name for ServerOptions.Transforms.
+// It panics if t is nil or name is already registered
+func RegisterTransform(name string, t Transform) {
+	transformsMtx.Lock()
+	defer transformsMtx.Unlock()
+	if t == nil {
+		panic("rebelcache: RegisterTransform transform is nil")
+	}
+	if _, dup := transforms[name]; dup {
+		panic(fmt.Sprintf("rebelcache: RegisterTransform called twice for %q", name))
+	}
+	transforms[name] = t
+}
+
+// TransformByName: the transform registered under name
+func TransformByName(name string) (Transform, bool) {
+	transformsMtx.RLock()
+	defer transformsMtx.RUnlock()
+	t, ok := transforms[name]
+	return t, ok
+}
+
+// groupTransforms: the transforms of each group by ServerOptions.Transforms
+type groupTransforms map[string][]Transform
+
+// newGroupTransforms: look up the transforms named by byGroup, an error
+// names the first one not registered
+func newGroupTransforms(byGroup map[string][]string) (groupTransforms, error) {
+	gt := make(groupTransforms, len(byGroup))
+	for group, names := range byGroup {
+		for _, name := range names {
+			t, ok := TransformByName(name)
+			if !ok {
+				return nil, fmt.Errorf("rebelcache: transform %q of group %q is not registered", name, group)
+			}
+			gt[group] = append(gt[group], t)
+		}
+	}
+	return gt, nil
+}
+
+// apply: value of key of group after its transforms in order, unchanged for
+// gets forwarded by a peer, which transforms them for its own client
+func (gt groupTransforms) apply(ctx context.Context, group, key string, value []byte) (_ []byte, err error) {
+	if len(gt[group]) == 0 || isForwarded(ctx) {
+		return value, nil
+	}
+	defer recoverPanic("transform of group "+group, &err)
+	for _, t := range gt[group] {
+		if value, err = t.Transform(ctx, group, key, value); err != nil {
+			return nil, fmt.Errorf("rebelcache: transform %s of group %s: %w", FormatKey(key), group, err)
+		}
+	}
+	return value, nil
+}
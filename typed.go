@@ -0,0 +1,117 @@
+package rebelcache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+// Codec: converts the values of a TypedGroup to the bytes cached and sent to
+// peers, and back
+type Codec[V any] interface {
+	Encode(value V) ([]byte, error)
+	Decode(data []byte) (V, error)
+}
+
+// JSONCodec: encodes values as json
+type JSONCodec[V any] struct{}
+
+// Encode: the json of value
+func (JSONCodec[V]) Encode(value V) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+// Decode: the value of the json in data
+func (JSONCodec[V]) Decode(data []byte) (V, error) {
+	var value V
+	err := json.Unmarshal(data, &value)
+	return value, err
+}
+
+// StringCodec: caches strings as their bytes
+type StringCodec struct{}
+
+// Encode: the bytes of value
+func (StringCodec) Encode(value string) ([]byte, error) {
+	return []byte(value), nil
+}
+
+// Decode: data as a string
+func (StringCodec) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
+
+// TypedGroup: a Group whose values are of type V, encoded by a Codec, so call
+// sites deal with V instead of store.Value. The group underneath caches the
+// encoded values as ByteView and stays usable untyped, see Group
+type TypedGroup[V any] struct {
+	group *Group
+	codec Codec[V]
+}
+
+// NewTypedGroup: create and register a group of values of type V, loaded by
+// getter on a miss, see NewGroup
+func NewTypedGroup[V any](name string, cacheBytes int64, codec Codec[V], getter func(ctx context.Context, key string) (V, error), opts ...GroupOption) *TypedGroup[V] {
+	g := NewGroup(name, cacheBytes, GetterFunc(func(ctx context.Context, key string) (store.Value, error) {
+		value, err := getter(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		data, err := codec.Encode(value)
+		if err != nil {
+			return nil, fmt.Errorf("rebelcache: encode %s: %w", FormatKey(key), err)
+		}
+		return byteViewOf(data), nil
+	}), opts...)
+	return Typed(g, codec)
+}
+
+// Typed: a typed view of an existing group, its values must be encoded by codec
+func Typed[V any](g *Group, codec Codec[V]) *TypedGroup[V] {
+	return &TypedGroup[V]{group: g, codec: codec}
+}
+
+// Group: the untyped group underneath
+func (t *TypedGroup[V]) Group() *Group {
+	return t.group
+}
+
+// Get: the value of key, see Group.Get
+func (t *TypedGroup[V]) Get(ctx context.Context, key string) (V, error) {
+	var zero V
+	value, err := t.group.Get(ctx, key)
+	if err != nil {
+		return zero, err
+	}
+	data, err := valueBytes(value)
+	if err != nil {
+		return zero, err
+	}
+	v, err := t.codec.Decode(data)
+	if err != nil {
+		return zero, fmt.Errorf("rebelcache: decode %s: %w", FormatKey(key), err)
+	}
+	return v, nil
+}
+
+// Set: set key to value without expiration, see Group.Set
+func (t *TypedGroup[V]) Set(ctx context.Context, key string, value V) error {
+	return t.SetWithExpiration(ctx, key, value, 0)
+}
+
+// SetWithExpiration: set key to value expiring after ttl, see Group.SetWithExpiration
+func (t *TypedGroup[V]) SetWithExpiration(ctx context.Context, key string, value V, ttl time.Duration) error {
+	data, err := t.codec.Encode(value)
+	if err != nil {
+		return fmt.Errorf("rebelcache: encode %s: %w", FormatKey(key), err)
+	}
+	return t.group.SetWithExpiration(ctx, key, byteViewOf(data), ttl)
+}
+
+// Delete: delete key, see Group.Delete
+func (t *TypedGroup[V]) Delete(ctx context.Context, key string) (bool, error) {
+	return t.group.Delete(ctx, key)
+}
@@ -0,0 +1,188 @@
+package rebelcache
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultWarmupHitRatio    = 0.8
+	defaultWarmupMinGets     = 1000
+	defaultWarmupMaxDuration = 10 * time.Minute
+	warmupCheckInterval      = time.Second
+)
+
+// Readiness states of a node, see Server.Readiness
+const (
+	ReadinessWarming = "warming" // serving, but its cache is still filling
+	ReadinessReady   = "ready"   // serving at its target hit ratio
+)
+
+// WarmupOptions: a node joining with an empty cache reports warming rather
+// than ready until its groups serve TargetHitRatio of their gets from cache,
+// so load balancers can hold back traffic from it, see Server.ReadyzHandler.
+// Zero fields take defaults
+type WarmupOptions struct {
+	TargetHitRatio float64 // share of the gets served from cache the node is ready at, 0 means 0.8
+	MinGets        int64   // gets served before the hit ratio is trusted, 0 means 1000
+	// MaxDuration: the node is ready after this long whatever its hit ratio,
+	// e.g. when its keys are rarely read twice, 0 means 10m
+	MaxDuration time.Duration
+	// Weight: share of its place on the ring the node takes while warming,
+	// from 0 to 1, so it owns fewer keys until it is ready, 0 keeps full
+	// weight. The nodes learn the weight from the node's etcd registration,
+	// with DiscoveryGossip it is ignored
+	Weight float64
+}
+
+// Readiness: whether a node is warming or ready
+type Readiness struct {
+	State    string  `json:"state"`     // ReadinessWarming or ReadinessReady
+	Gets     int64   `json:"gets"`      // gets served by the groups since the node started serving
+	HitRatio float64 `json:"hit_ratio"` // share of these gets served from cache
+}
+
+// warmupCounts: gets of the groups served from cache and missing it
+type warmupCounts struct {
+	hits, misses int64
+}
+
+// warmupStart: when the node started serving and its counts then
+type warmupStart struct {
+	at   time.Time
+	base warmupCounts
+}
+
+// warmup: progress of a node towards ready
+type warmup struct {
+	opts    WarmupOptions
+	started atomic.Pointer[warmupStart] // nil until the node serves
+	ready   atomic.Bool
+	// updates: the registration is rewritten once the node is ready, dropping its weight
+	updates chan struct{}
+}
+
+// newWarmup: a node warming by opts, nil opts makes it ready once serving
+func newWarmup(opts *WarmupOptions) *warmup {
+	w := &warmup{updates: make(chan struct{}, 1)}
+	if opts == nil {
+		return w
+	}
+	w.opts = *opts
+	if w.opts.TargetHitRatio <= 0 {
+		w.opts.TargetHitRatio = defaultWarmupHitRatio
+	}
+	if w.opts.MinGets <= 0 {
+		w.opts.MinGets = defaultWarmupMinGets
+	}
+	if w.opts.MaxDuration <= 0 {
+		w.opts.MaxDuration = defaultWarmupMaxDuration
+	}
+	return w
+}
+
+// getCounts: gets of the groups served by the node so far
+func (s *Server) getCounts() warmupCounts {
+	var counts warmupCounts
+	s.groups.Range(func(_, g any) bool {
+		counts.hits += atomic.LoadInt64(&g.(*Group).cache.hits)
+		counts.misses += atomic.LoadInt64(&g.(*Group).cache.misses)
+		return true
+	})
+	return counts
+}
+
+// Readiness: whether the node is ready to take its full share of traffic.
+// Without ServerOptions.Warmup a node is ready once it serves, snapshots and
+// the append-only log replayed
+func (s *Server) Readiness() Readiness {
+	r := Readiness{State: ReadinessWarming}
+	if s.warmup.ready.Load() {
+		r.State = ReadinessReady
+	}
+	start := s.warmup.started.Load()
+	if start == nil {
+		return r
+	}
+	counts := s.getCounts()
+	hits, misses := counts.hits-start.base.hits, counts.misses-start.base.misses
+	if r.Gets = hits + misses; r.Gets > 0 {
+		r.HitRatio = float64(hits) / float64(r.Gets)
+	}
+	return r
+}
+
+// SetReady: report the node ready whatever its hit ratio
+func (s *Server) SetReady() {
+	if s.warmup.ready.CompareAndSwap(false, true) && s.opts.Warmup != nil {
+		log.Printf("rebelcache: node %s ready, %+v", s.addr, s.Readiness())
+		select {
+		case s.warmup.updates <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// ringWeight: the weight the node registers with, 0 for full
+func (s *Server) ringWeight() float64 {
+	if s.warmup.ready.Load() {
+		return 0
+	}
+	return s.warmup.opts.Weight
+}
+
+// startWarmup: count the gets from now on, ready at once without
+// ServerOptions.Warmup. Only the first call of a server counts
+func (s *Server) startWarmup() bool {
+	if !s.warmup.started.CompareAndSwap(nil, &warmupStart{at: time.Now(), base: s.getCounts()}) {
+		return false
+	}
+	if s.opts.Warmup == nil {
+		s.SetReady()
+	}
+	return true
+}
+
+// warmupLoop: check the node's hit ratio until it is ready
+func (s *Server) warmupLoop(ctx context.Context) error {
+	ticker := time.NewTicker(warmupCheckInterval)
+	defer ticker.Stop()
+	for !s.warmup.ready.Load() {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		r := s.Readiness()
+		if time.Since(s.warmup.started.Load().at) >= s.warmup.opts.MaxDuration ||
+			r.Gets >= s.warmup.opts.MinGets && r.HitRatio >= s.warmup.opts.TargetHitRatio {
+			s.SetReady()
+		}
+	}
+	return nil
+}
+
+// LivezHandler: 200 while the node serves, for liveness probes
+func (s *Server) LivezHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("ok\n"))
+	})
+}
+
+// ReadyzHandler: the node's Readiness as json, with 200 once ready and 503
+// while warming, for readiness probes of load balancers
+func (s *Server) ReadyzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		readiness := s.Readiness()
+		w.Header().Set("Content-Type", "application/json")
+		if readiness.State != ReadinessReady {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(readiness)
+	})
+}
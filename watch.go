@@ -0,0 +1,218 @@
+package rebelcache
+
+import (
+	"hash/maphash"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RebellioN-YonG/Distrbuted-Cache/store"
+)
+
+// watchStripes: locks ordering the events of a key like its writes
+const watchStripes = 64
+
+// watchBuffer: events queued per watcher before it counts as fallen behind
+const watchBuffer = 4096
+
+// eventKind: what a keyEvent reports
+type eventKind int
+
+const (
+	eventSet    eventKind = iota // key was set to value
+	eventDelete                  // key was deleted
+	eventClear                   // all entries were removed
+)
+
+// keyEvent: a write applied to a cache, as seen by watchers
+type keyEvent struct {
+	group string
+	kind  eventKind
+	key   string        // normalized key, empty for eventClear
+	value store.Value   // value without provenance, eventSet only
+	ttl   time.Duration // ttl given to the entry, 0 if it never expires
+}
+
+// watcher: a subscription to the writes of one or more caches, dropped
+// once it falls behind: it has missed writes from then on
+type watcher struct {
+	ch      chan keyEvent
+	dropped chan struct{}
+	once    sync.Once
+}
+
+// newWatcher: create a watcher queueing up to buffer events
+func newWatcher(buffer int) *watcher {
+	return &watcher{ch: make(chan keyEvent, buffer), dropped: make(chan struct{})}
+}
+
+// drop: give up on the watcher
+func (w *watcher) drop() {
+	w.once.Do(func() { close(w.dropped) })
+}
+
+// eventFeed: fan-out of a cache's writes to watchers. A write and the
+// publishing of its event happen under the key's stripe lock, so watchers
+// see the writes of each key in the order they were applied
+type eventFeed struct {
+	journal  atomic.Pointer[func(keyEvent)] // called with every event before the write returns, see appendLog
+	observe  func(keyEvent)                 // called with every event first, set before the first write
+	watched  atomic.Int32                   // number of watchers, 0 skips publishing
+	mtx      sync.RWMutex
+	watchers map[*watcher]string // watcher -> group name reported in its events
+	seed     maphash.Seed
+	stripes  [watchStripes]sync.Mutex
+	hot      *hotWrites // holds back the events of hot keys, nil without HotWrites
+	// ledger: records every event for soak checks, nil unless the cache is
+	// soak tested, see SoakOptions
+	ledger atomic.Pointer[soakLedger]
+	// loads: keys being loaded by GetOrLoad -> set once a write of the key
+	// is published, so the load doesn't overwrite it
+	loads   sync.Map
+	loading atomic.Int32 // number of loads tracked, 0 skips marking them
+}
+
+// newEventFeed: create a feed without watchers
+func newEventFeed() *eventFeed {
+	return &eventFeed{watchers: make(map[*watcher]string), seed: maphash.MakeSeed()}
+}
+
+// subscribe: send the events of the feed to w, tagged with group
+func (f *eventFeed) subscribe(w *watcher, group string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if _, ok := f.watchers[w]; !ok {
+		f.watchers[w] = group
+		f.watched.Add(1)
+	}
+}
+
+// unsubscribe: stop sending events to w
+func (f *eventFeed) unsubscribe(w *watcher) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if _, ok := f.watchers[w]; ok {
+		delete(f.watchers, w)
+		f.watched.Add(-1)
+	}
+}
+
+// stripe: index of the stripe lock of key
+func (f *eventFeed) stripe(key string) int {
+	return int(maphash.String(f.seed, key) % watchStripes)
+}
+
+// lock: lock the stripe of key, the returned func unlocks it
+func (f *eventFeed) lock(key string) func() {
+	mu := &f.stripes[f.stripe(key)]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// lockKeys: lock the stripes of keys in a fixed order, the returned func unlocks them
+func (f *eventFeed) lockKeys(keys []string) func() {
+	var idx []int
+	for _, key := range keys {
+		idx = append(idx, f.stripe(key))
+	}
+	slices.Sort(idx)
+	idx = slices.Compact(idx)
+	for _, i := range idx {
+		f.stripes[i].Lock()
+	}
+	return func() {
+		for _, i := range idx {
+			f.stripes[i].Unlock()
+		}
+	}
+}
+
+// lockAll: lock every stripe, excluding all writes but Clear, the returned
+// func unlocks them
+func (f *eventFeed) lockAll() func() {
+	for i := range f.stripes {
+		f.stripes[i].Lock()
+	}
+	return func() {
+		for i := range f.stripes {
+			f.stripes[i].Unlock()
+		}
+	}
+}
+
+// trackLoad: track a load of key until the returned func is called, the
+// flag is set once a write of key is published in between
+func (f *eventFeed) trackLoad(key string) (superseded *atomic.Bool, done func()) {
+	superseded = new(atomic.Bool)
+	f.loads.Store(key, superseded)
+	f.loading.Add(1)
+	return superseded, func() {
+		f.loads.CompareAndDelete(key, superseded)
+		f.loading.Add(-1)
+	}
+}
+
+// supersedeLoads: mark the loads of the key ev wrote, all of them on a clear
+func (f *eventFeed) supersedeLoads(ev keyEvent) {
+	if ev.kind == eventClear {
+		f.loads.Range(func(_, superseded any) bool {
+			superseded.(*atomic.Bool).Store(true)
+			return true
+		})
+		return
+	}
+	if superseded, ok := f.loads.Load(ev.key); ok {
+		superseded.(*atomic.Bool).Store(true)
+	}
+}
+
+// setJournal: call fn with every event from now on, nil stops it
+func (f *eventFeed) setJournal(fn func(keyEvent)) {
+	if fn == nil {
+		f.journal.Store(nil)
+		return
+	}
+	f.journal.Store(&fn)
+}
+
+// publish: hand ev to the journal, then queue it for every watcher without
+// blocking, watchers with a full queue are dropped. Events of hot keys are
+// held back and sent later, see HotWriteOptions.
+// Note: the stripe lock of ev's key must be held, or all writes excluded
+func (f *eventFeed) publish(ev keyEvent) {
+	if f.loading.Load() > 0 {
+		f.supersedeLoads(ev)
+	}
+	if f.observe != nil {
+		f.observe(ev)
+	}
+	if ledger := f.ledger.Load(); ledger != nil {
+		ledger.record(ev)
+	}
+	if journal := f.journal.Load(); journal != nil {
+		(*journal)(ev)
+	}
+	if f.watched.Load() == 0 {
+		return
+	}
+	if f.hot != nil && f.hot.hold(ev) {
+		return
+	}
+	f.send(ev)
+}
+
+// send: queue ev for every watcher without blocking, watchers with a full
+// queue are dropped
+func (f *eventFeed) send(ev keyEvent) {
+	f.mtx.RLock()
+	defer f.mtx.RUnlock()
+	for w, group := range f.watchers {
+		ev.group = group
+		select {
+		case w.ch <- ev:
+		default:
+			w.drop()
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package rebelcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+)
+
+const (
+	defaultZooKeeperSessionTimeout = 10 * time.Second
+	defaultZooKeeperRoot           = "/rebelcache"
+)
+
+// ZooKeeperOptions: connection to zookeeper for DiscoveryZooKeeper. Nodes
+// register as ephemeral znodes, zookeeper deletes them once their session
+// expires, and watch the znodes of the cluster
+type ZooKeeperOptions struct {
+	Servers        []string      // addrs of the zookeeper ensemble, empty means 127.0.0.1:2181
+	SessionTimeout time.Duration // 0 means 10s
+	Root           string        // znode the clusters register under, lets several share one ensemble, empty means /rebelcache
+}
+
+// zkRegistry: Registry of nodes registered as ephemeral znodes
+type zkRegistry struct {
+	conn *zk.Conn
+	svc  ServiceName
+	root string
+	regs registrations
+	// loops: watches, restarted after a panic and joined by Close
+	loops    *supervisor
+	watchers sync.WaitGroup // goroutines waiting for a znode watch to fire
+}
+
+// NewZooKeeperRegistry: Registry of the nodes of svc in zookeeper, the
+// connection is made in the background and kept until Close
+func NewZooKeeperRegistry(svc ServiceName, opts ZooKeeperOptions) (Registry, error) {
+	if len(opts.Servers) == 0 {
+		opts.Servers = []string{"127.0.0.1:2181"}
+	}
+	if opts.SessionTimeout <= 0 {
+		opts.SessionTimeout = defaultZooKeeperSessionTimeout
+	}
+	if opts.Root == "" {
+		opts.Root = defaultZooKeeperRoot
+	}
+	conn, _, err := zk.Connect(opts.Servers, opts.SessionTimeout, zk.WithLogInfo(false))
+	if err != nil {
+		return nil, fmt.Errorf("rebelcache: connect zookeeper: %w", err)
+	}
+	return &zkRegistry{conn: conn, svc: svc, root: "/" + strings.Trim(opts.Root, "/"), loops: newSupervisor(context.Background())}, nil
+}
+
+// dir: znode the nodes of the cluster register under
+func (z *zkRegistry) dir() string {
+	return z.root + strings.TrimSuffix(z.svc.EtcdPrefix(), "/")
+}
+
+// ensureDir: create dir and its parents if missing
+func (z *zkRegistry) ensureDir() error {
+	var path string
+	for part := range strings.SplitSeq(strings.TrimPrefix(z.dir(), "/"), "/") {
+		path += "/" + part
+		if _, err := z.conn.Create(path, nil, 0, zk.WorldACL(zk.PermAll)); err != nil && !errors.Is(err, zk.ErrNodeExists) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Register: implements Registry
+func (z *zkRegistry) Register(_ context.Context, addr, value string) error {
+	z.regs.start(addr, value, func(ctx context.Context, r *registration) {
+		z.keep(ctx, z.dir()+"/"+addr, r)
+	})
+	return nil
+}
+
+// keep: keep the znode at path registered until ctx ends, then delete it.
+// A znode lost with an expired session is created again
+func (z *zkRegistry) keep(ctx context.Context, path string, r *registration) {
+	for {
+		err := z.hold(ctx, path, r)
+		if ctx.Err() != nil {
+			if err := z.conn.Delete(path, -1); err != nil && !errors.Is(err, zk.ErrNoNode) {
+				log.Printf("rebelcache: delete znode %s: %v", path, err)
+			}
+			return
+		}
+		log.Printf("rebelcache: register %s in zookeeper: %v", path, err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(registerRetryInterval):
+		}
+	}
+}
+
+// hold: create the znode at path and keep its value the one of r until ctx
+// ends, nil then, or the znode is lost
+func (z *zkRegistry) hold(ctx context.Context, path string, r *registration) error {
+	if err := z.ensureDir(); err != nil {
+		return err
+	}
+	if err := z.create(path, r.current()); err != nil {
+		return err
+	}
+	for {
+		exists, stat, events, err := z.conn.ExistsW(path)
+		if err != nil {
+			return err
+		}
+		if !exists || stat.EphemeralOwner != z.conn.SessionID() {
+			return errors.New("znode lost with its session")
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-events:
+			// deleted, or the watch ended with the session, checked again
+		case <-r.updates:
+			if _, err := z.conn.Set(path, []byte(r.current()), -1); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// create: create the ephemeral znode at path, replacing one left by an
+// earlier session of the node, which would be deleted once it expires
+func (z *zkRegistry) create(path, value string) error {
+	for range 2 {
+		_, err := z.conn.Create(path, []byte(value), zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
+		if !errors.Is(err, zk.ErrNodeExists) {
+			return err
+		}
+		exists, stat, err := z.conn.Exists(path)
+		if err != nil {
+			return err
+		}
+		if exists && stat.EphemeralOwner == z.conn.SessionID() {
+			_, err := z.conn.Set(path, []byte(value), -1)
+			return err
+		}
+		if err := z.conn.Delete(path, -1); err != nil && !errors.Is(err, zk.ErrNoNode) {
+			return err
+		}
+	}
+	return fmt.Errorf("znode %s kept being created by another session", path)
+}
+
+// Deregister: implements Registry
+func (z *zkRegistry) Deregister(ctx context.Context, addr string) error {
+	return z.regs.stop(ctx, addr)
+}
+
+// zkWatch: the znodes of a Watch with a zookeeper watch set, each set once
+// until it fires
+type zkWatch struct {
+	z       *zkRegistry
+	ctx     context.Context
+	changed chan struct{} // signaled when a watch fires
+	mtx     sync.Mutex
+	armed   map[string]bool // path -> a watch is set
+}
+
+// Watch: implements Registry
+func (z *zkRegistry) Watch(ctx context.Context, onChange func(nodes map[string]string)) error {
+	if err := z.ensureDir(); err != nil {
+		return fmt.Errorf("rebelcache: create znode %s: %w", z.dir(), err)
+	}
+	w := &zkWatch{z: z, ctx: ctx, changed: make(chan struct{}, 1), armed: make(map[string]bool)}
+	nodes, err := w.list()
+	if err != nil {
+		return fmt.Errorf("rebelcache: list nodes in zookeeper: %w", err)
+	}
+	onChange(maps.Clone(nodes))
+	z.loops.goUntil(ctx, "zookeeper watch", RestartOnFailure, func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-w.changed:
+			}
+			next, err := w.list()
+			if err != nil {
+				log.Printf("rebelcache: watch nodes in zookeeper: %v", err)
+				w.signal()
+				select {
+				case <-ctx.Done():
+				case <-time.After(registerRetryInterval):
+				}
+				continue
+			}
+			if !maps.Equal(next, nodes) {
+				nodes = next
+				onChange(maps.Clone(nodes))
+			}
+		}
+	})
+	return nil
+}
+
+// list: the registered nodes, setting the watches of the znodes without one
+func (w *zkWatch) list() (map[string]string, error) {
+	dir := w.z.dir()
+	var children []string
+	var err error
+	if w.isArmed(dir) {
+		children, _, err = w.z.conn.Children(dir)
+	} else {
+		var events <-chan zk.Event
+		if children, _, events, err = w.z.conn.ChildrenW(dir); err == nil {
+			w.arm(dir, events)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	nodes := make(map[string]string, len(children))
+	for _, child := range children {
+		path := dir + "/" + child
+		var data []byte
+		if w.isArmed(path) {
+			data, _, err = w.z.conn.Get(path)
+		} else {
+			var events <-chan zk.Event
+			if data, _, events, err = w.z.conn.GetW(path); err == nil {
+				w.arm(path, events)
+			}
+		}
+		if errors.Is(err, zk.ErrNoNode) {
+			// deleted since listed, the watch of dir fires
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		nodes[child] = string(data)
+	}
+	return nodes, nil
+}
+
+// isArmed: whether path has a watch set
+func (w *zkWatch) isArmed(path string) bool {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.armed[path]
+}
+
+// arm: signal a change once the watch of path fires
+func (w *zkWatch) arm(path string, events <-chan zk.Event) {
+	w.mtx.Lock()
+	w.armed[path] = true
+	w.mtx.Unlock()
+	w.z.watchers.Go(func() {
+		select {
+		case <-events:
+			w.mtx.Lock()
+			delete(w.armed, path)
+			w.mtx.Unlock()
+			w.signal()
+		case <-w.ctx.Done():
+		case <-w.z.loops.done():
+		}
+	})
+}
+
+// signal: have the nodes listed again
+func (w *zkWatch) signal() {
+	select {
+	case w.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Close: implements Registry
+func (z *zkRegistry) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), registryCloseTimeout)
+	defer cancel()
+	err := z.regs.stopAll(ctx)
+	z.loops.Stop()
+	z.watchers.Wait()
+	z.conn.Close()
+	return err
+}